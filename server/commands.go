@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// runCommand runs a one-off command instead of the server, e.g. `prop-ock migrate`.
+// Returns the process exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "migrate":
+		return runMigrateCommand(args[1:])
+	case "redis-schema":
+		return runRedisSchemaCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %v\n", args[0])
+		return 2
+	}
+}
+
+// runMigrateCommand copies Redis into the SQL database from the storage config.
+// With -export, Redis is written to a JSON archive instead, and with -import
+// an archive is read into the SQL database.
+func runMigrateCommand(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	exportPath := flags.String("export", "", "write Redis to a JSON archive at this path instead of migrating")
+	importPath := flags.String("import", "", "read the JSON archive at this path into SQL instead of migrating from Redis")
+	flags.Parse(args)
+
+	if *exportPath != "" && *importPath != "" {
+		fmt.Fprintln(os.Stderr, "migrate takes either -export or -import, not both")
+		return 2
+	}
+
+	migrationService := InitializeMigrationService()
+	context := utils.NewBackgroundContext(echo.New())
+
+	var summary entities.ArchiveSummary
+	var err error
+	switch {
+	case *exportPath != "":
+		summary, err = migrationService.ExportArchive(context, *exportPath)
+	case *importPath != "":
+		summary, err = migrationService.ImportArchive(context, *importPath)
+	default:
+		summary, err = migrationService.MigrateRedisToSql(context)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate failed: %v\n", err)
+		return 1
+	}
+
+	summaryJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Println(string(summaryJSON))
+	return 0
+}
+
+// runRedisSchemaCommand applies the Redis migrations that haven't run yet, which
+// the server also does on startup. With -dry-run, it only reports what would change.
+func runRedisSchemaCommand(args []string) int {
+	flags := flag.NewFlagSet("redis-schema", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "count the keys each migration would change without writing anything")
+	flags.Parse(args)
+
+	migrationService := InitializeMigrationService()
+	context := utils.NewBackgroundContext(echo.New())
+
+	results, err := migrationService.MigrateRedisSchema(context, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "redis-schema failed: %v\n", err)
+		return 1
+	}
+
+	resultsJSON, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "redis-schema failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Println(string(resultsJSON))
+	return 0
+}
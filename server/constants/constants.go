@@ -1,12 +1,6 @@
 package constants
 
-import "github.com/google/uuid"
-
-// For now we assume there's only ONE true league (Field of GGreams)
-var LEAGUE_ID = uuid.MustParse("894098e8-8cfe-4c92-9e32-332aac801899")
-
-// Amount each user starts with by default
-const STARTING_WALLET_AMOUNT = 500
+import "time"
 
 // Send messages with this tag to allow us to continuously send
 // them the auction players for bidding daily
@@ -15,5 +9,50 @@ const CONFIRM_TAG_UPDATE = "CONFIRMED_EVENT_UPDATE"
 const WINNING_BID_TITLE = "You my new owner for only"
 const CLAIM_INSTRUCTIONS = "Go claim me on ESPN. If no good, talk to Addy."
 
-// Key for getting a transaction out of the Echo context
-const TX = "transaction"
+// Reply for the "help" text command and for anything we can't understand
+const COMMAND_HELP_TEXT = `Here's what you can send me:
+bid <player> <amount> - bid on a player up for auction
+cancel <player> - cancel your bid on a player
+mybids - list your bids in the current auction
+wallet - check your available funds and funds held in bids
+players - list the players up for auction
+join <code> - join a league with an invite code
+help - show this message
+When auctions are running in more than one of your leagues, start with the league, like "My League: mybids"`
+
+// Key for marking that the request holds the in-memory store's lock
+const MEMORY_TX = "memory_transaction"
+
+// Key for getting a SQL transaction out of the Echo context
+const SQL_TX = "sql_transaction"
+
+// How often the scheduler checks Redis for auction transitions that are due
+const SCHEDULER_POLL_INTERVAL = 30 * time.Second
+
+// How long a user's conversation state lives without being touched
+const MESSAGE_STATE_TTL = 7 * 24 * time.Hour
+
+// How long we remember webhook events we've seen so Messenger retries are skipped
+const WEBHOOK_EVENT_DEDUPE_TTL = 24 * time.Hour
+
+// How long a trade proposal stays open before it expires
+const TRADE_EXPIRATION = 3 * 24 * time.Hour
+
+// How long an accepted trade waits before going through, giving the commissioner a chance to veto it
+const TRADE_REVIEW_PERIOD = 24 * time.Hour
+
+// How long invite codes last when the commissioner doesn't pick an expiry
+const INVITE_EXPIRATION = 7 * 24 * time.Hour
+
+// Keys for who made the request, set in the Echo context by the auth middleware
+const AUTH_USER_ID = "auth_user_id"
+const AUTH_IS_ADMIN = "auth_is_admin"
+
+// How long tokens handed out to users last
+const AUTH_TOKEN_EXPIRATION = 30 * 24 * time.Hour
+
+// How long the bid links sent to users keep working
+const WEBVIEW_TOKEN_EXPIRATION = 24 * time.Hour
+
+// How long a claim on processing an auction lasts, in case the process dies part way through
+const AUCTION_PROCESSING_CLAIM_TTL = 10 * time.Minute
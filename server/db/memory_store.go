@@ -0,0 +1,199 @@
+package redis_client
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/constants"
+)
+
+// MemoryStore keeps everything in the server's memory so it can run without Redis.
+// Repos keep their values under the same keys they use in Redis. Everything is
+// lost when the server stops.
+type MemoryStore struct {
+	mutex     sync.Mutex
+	values    map[string]interface{}
+	expiresAt map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		values:    make(map[string]interface{}),
+		expiresAt: make(map[string]time.Time),
+	}
+}
+
+// MemoryValues reads and writes the store's values while its lock is held.
+// Values are shared with the store, so copy anything handed back to callers.
+type MemoryValues struct {
+	store *MemoryStore
+}
+
+// Get returns the value for the key, treating expired keys as missing
+func (v MemoryValues) Get(key string) (interface{}, bool) {
+	expiresAt, ok := v.store.expiresAt[key]
+	if ok && !time.Now().Before(expiresAt) {
+		v.Delete(key)
+		return nil, false
+	}
+
+	value, ok := v.store.values[key]
+	return value, ok
+}
+
+// Set stores the value for the key and clears any expiry, like a Redis SET
+func (v MemoryValues) Set(key string, value interface{}) {
+	v.store.values[key] = value
+	delete(v.store.expiresAt, key)
+}
+
+// ExpireAt has the key deleted once the time passes
+func (v MemoryValues) ExpireAt(key string, expiresAt time.Time) {
+	if _, ok := v.store.values[key]; ok {
+		v.store.expiresAt[key] = expiresAt
+	}
+}
+
+func (v MemoryValues) Delete(key string) {
+	delete(v.store.values, key)
+	delete(v.store.expiresAt, key)
+}
+
+// SMembers returns every member of the set at the key, sorted so results are stable
+func (v MemoryValues) SMembers(key string) []string {
+	set := v.getSet(key)
+
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+
+	return members
+}
+
+func (v MemoryValues) SIsMember(key string, member string) bool {
+	_, ok := v.getSet(key)[member]
+	return ok
+}
+
+func (v MemoryValues) SAdd(key string, members ...string) {
+	set := v.getSet(key)
+	for _, member := range members {
+		set[member] = struct{}{}
+	}
+
+	v.store.values[key] = set
+}
+
+func (v MemoryValues) SRem(key string, members ...string) {
+	set := v.getSet(key)
+	for _, member := range members {
+		delete(set, member)
+	}
+
+	if len(set) == 0 {
+		v.Delete(key)
+	}
+}
+
+func (v MemoryValues) getSet(key string) map[string]struct{} {
+	value, ok := v.Get(key)
+	if !ok {
+		return make(map[string]struct{})
+	}
+
+	return value.(map[string]struct{})
+}
+
+// ZAdd adds the member to the sorted set at the key, or moves it to the new score
+func (v MemoryValues) ZAdd(key string, member string, score int64) {
+	sortedSet := v.getSortedSet(key)
+	sortedSet[member] = score
+
+	v.store.values[key] = sortedSet
+}
+
+// ZRangeByScore returns the members of the sorted set scored at or below the max, lowest first
+func (v MemoryValues) ZRangeByScore(key string, max int64) []string {
+	sortedSet := v.getSortedSet(key)
+
+	members := []string{}
+	for member, score := range sortedSet {
+		if score <= max {
+			members = append(members, member)
+		}
+	}
+
+	sort.Slice(members, func(a, b int) bool {
+		if sortedSet[members[a]] != sortedSet[members[b]] {
+			return sortedSet[members[a]] < sortedSet[members[b]]
+		}
+
+		return members[a] < members[b]
+	})
+
+	return members
+}
+
+func (v MemoryValues) ZScore(key string, member string) (int64, bool) {
+	score, ok := v.getSortedSet(key)[member]
+	return score, ok
+}
+
+func (v MemoryValues) ZRem(key string, members ...string) {
+	sortedSet := v.getSortedSet(key)
+	for _, member := range members {
+		delete(sortedSet, member)
+	}
+
+	if len(sortedSet) == 0 {
+		v.Delete(key)
+	}
+}
+
+func (v MemoryValues) getSortedSet(key string) map[string]int64 {
+	value, ok := v.Get(key)
+	if !ok {
+		return make(map[string]int64)
+	}
+
+	return value.(map[string]int64)
+}
+
+// Update runs the function with the store locked. Requests inside a transaction
+// already hold the lock, so the function runs straight away for them.
+func (m *MemoryStore) Update(context echo.Context, update func(values MemoryValues) error) error {
+	if context.Get(constants.MEMORY_TX) == m {
+		return update(MemoryValues{m})
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return update(MemoryValues{m})
+}
+
+// StartTransaction holds the store's lock for every command in the function, so
+// nothing else reads or writes the store until it's finished. Nothing is rolled
+// back if the function fails.
+func (m *MemoryStore) StartTransaction(context echo.Context, commandList func() error) error {
+	if context.Get(constants.MEMORY_TX) == m {
+		return commandList()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	context.Set(constants.MEMORY_TX, m)
+
+	err := commandList()
+
+	// Clear the transaction from the context once it's finished
+	// so later calls in the request take the lock again
+	context.Set(constants.MEMORY_TX, nil)
+
+	return err
+}
@@ -0,0 +1,283 @@
+package redis_client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Key schema for every key kept in Redis. Each format has a %v for every id in the key.
+// The repos build their keys with the generators below, and anything that has to find
+// keys without knowing their ids, like migrations and archives, scans for them with
+// GetRedisKeyPattern and reads the ids back with ParseRedisKey, so they can't drift apart.
+const (
+	// Holds the version of the last Redis migration applied, missing before any have run
+	REDIS_SCHEMA_VERSION_KEY = "schema_version"
+
+	REDIS_USER_KEY = "user:user_id:%v"
+	// Hash of leagueId to the user's available funds in the league
+	REDIS_USER_WALLET_KEY = "wallet:user_id:%v"
+	// Funds tied up in pending bids, keyed on leagueId like the wallet
+	REDIS_USER_HELD_WALLET_KEY = "wallet_held:user_id:%v"
+	// Append-only list of every change to a user's wallet in a league
+	REDIS_USER_WALLET_LEDGER_KEY = "wallet_ledger:user_id:%v:league_id:%v"
+	// Hash of leagueId to the serialized wallet the user had when they left the league
+	REDIS_USER_ARCHIVED_WALLET_KEY    = "wallet_archive:user_id:%v"
+	REDIS_SENDER_PS_ID_TO_USER_ID_KEY = "relationship:sender_ps_id_to_user_id:%v"
+	REDIS_USER_ID_TO_SENDER_PS_ID_KEY = "relationship:user_id_to_sender_ps_id:%v"
+
+	REDIS_LEAGUE_KEY         = "league:league_id:%v"
+	REDIS_LEAGUE_MEMBERS_KEY = "relationship:league_to_user:league_id:%v"
+	REDIS_USER_LEAGUES_KEY   = "relationship:user_to_league:user_id:%v"
+	// Hash of setting name to value, stored alongside the league hash
+	REDIS_LEAGUE_SETTINGS_KEY = "league_settings:league_id:%v"
+	// Hash of userId to role for the league's owner and commissioners, plain members aren't stored
+	REDIS_LEAGUE_ROLES_KEY = "league_roles:league_id:%v"
+	// Ordered list of userIds, the front of the list has the highest waiver priority
+	REDIS_LEAGUE_WAIVER_PRIORITY_KEY = "relationship:league_to_waiver_priority:league_id:%v"
+
+	REDIS_AUCTION_KEY                   = "auction:auction_id:%v"
+	REDIS_LEAGUE_TO_CURRENT_AUCTION_KEY = "relationship:league_to_current_auction:league_id:%v"
+	// Hash of playerId to the user's bid on them
+	REDIS_BID_KEY = "bid:auction_id:%v:user_id:%v"
+	// Hash of playerId to when the user's bid came in, for breaking ties
+	REDIS_BID_TIMESTAMP_KEY = "bid_timestamp:auction_id:%v:user_id:%v"
+	// Set while an auction is being processed so it can't be settled twice
+	REDIS_AUCTION_PROCESSING_KEY = "auction_processing:auction_id:%v"
+	REDIS_AUCTION_RESULTS_KEY    = "result:auction_id:%v"
+	// All pending transitions live in a single sorted set scored by the
+	// unix millisecond timestamp they should run at
+	REDIS_AUCTION_TRANSITIONS_KEY = "schedule:auction_transitions"
+
+	// Hash of playerId to the serialized roster player for the user's roster in the league
+	REDIS_ROSTER_KEY = "roster:league_id:%v:user_id:%v"
+	// Hash of playerId to the userId that owns them in a league
+	REDIS_PLAYER_TO_OWNER_KEY = "relationship:player_to_owner:league_id:%v"
+
+	REDIS_PLAYER_KEY = "player:player_id:%v"
+	// Set of every playerId in the catalog so we can list players without scanning keys
+	REDIS_PLAYER_CATALOG_KEY = "relationship:catalog_to_player"
+	REDIS_PLAYER_DEBUT_KEY   = "debut:%v"
+
+	REDIS_PLAYER_SET_KEY         = "player_set:player_set_id:%v"
+	REDIS_PLAYER_SET_PLAYERS_KEY = "relationship:player_set_to_player:player_set_id:%v"
+	REDIS_LEAGUE_PLAYER_SETS_KEY = "relationship:league_to_player_set:league_id:%v"
+
+	REDIS_TRADE_KEY            = "trade:trade_id:%v"
+	REDIS_LEAGUE_TO_TRADES_KEY = "relationship:league_to_trades:league_id:%v"
+	// Sorted set of tradeIds scored by the unix millisecond timestamp the
+	// trade next needs looking at, either to expire it or to process it
+	REDIS_SCHEDULED_TRADES_KEY = "schedule:trades"
+
+	// Invites are deleted by Redis once they expire
+	REDIS_INVITE_KEY            = "invite:code:%v"
+	REDIS_LEAGUE_TO_INVITES_KEY = "relationship:league_to_invites:league_id:%v"
+	REDIS_MESSAGE_STATE_KEY     = "message_state:user_id:%v"
+	REDIS_WEBHOOK_EVENT_KEY     = "webhook_event:event_id:%v"
+)
+
+// GetRedisKeyPattern returns the SCAN pattern matching every key with the format
+func GetRedisKeyPattern(format string) string {
+	return strings.ReplaceAll(format, "%v", "*")
+}
+
+// ParseRedisKey returns the ids in a key built from the format, in the order the format
+// has them. The last id takes the rest of the key, so it can hold any character.
+func ParseRedisKey(format string, key string) ([]string, error) {
+	literals := strings.Split(format, "%v")
+	if len(literals) == 1 {
+		if key != format {
+			return nil, newRedisKeyFormatError(format, key)
+		}
+
+		return []string{}, nil
+	}
+
+	firstLiteral, lastLiteral := literals[0], literals[len(literals)-1]
+	if len(key) <= len(firstLiteral)+len(lastLiteral) ||
+		!strings.HasPrefix(key, firstLiteral) ||
+		!strings.HasSuffix(key, lastLiteral) {
+		return nil, newRedisKeyFormatError(format, key)
+	}
+
+	rest := key[len(firstLiteral) : len(key)-len(lastLiteral)]
+	ids := make([]string, 0, len(literals)-1)
+	for _, literal := range literals[1 : len(literals)-1] {
+		index := strings.Index(rest, literal)
+		if index <= 0 {
+			return nil, newRedisKeyFormatError(format, key)
+		}
+
+		ids = append(ids, rest[:index])
+		rest = rest[index+len(literal):]
+	}
+
+	if rest == "" {
+		return nil, newRedisKeyFormatError(format, key)
+	}
+
+	return append(ids, rest), nil
+}
+
+// ParseRedisKeyIds is ParseRedisKey for keys whose ids are all uuids
+func ParseRedisKeyIds(format string, key string) ([]uuid.UUID, error) {
+	rawIds, err := ParseRedisKey(format, key)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(rawIds))
+	for index, rawId := range rawIds {
+		ids[index], err = uuid.Parse(rawId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+func newRedisKeyFormatError(format string, key string) error {
+	return fmt.Errorf("key %v doesn't match the key format %v", key, format)
+}
+
+func GenerateUserRedisKey(userId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_USER_KEY, userId)
+}
+
+func GenerateUserWalletRedisKey(userId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_USER_WALLET_KEY, userId)
+}
+
+func GenerateUserHeldWalletRedisKey(userId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_USER_HELD_WALLET_KEY, userId)
+}
+
+func GenerateUserWalletLedgerRedisKey(userId uuid.UUID, leagueId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_USER_WALLET_LEDGER_KEY, userId, leagueId)
+}
+
+func GenerateUserArchivedWalletRedisKey(userId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_USER_ARCHIVED_WALLET_KEY, userId)
+}
+
+func GenerateSenderPsIdToUserIdRedisKey(senderPsId string) string {
+	return fmt.Sprintf(REDIS_SENDER_PS_ID_TO_USER_ID_KEY, senderPsId)
+}
+
+func GenerateUserIdToSenderPsIdRedisKey(userId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_USER_ID_TO_SENDER_PS_ID_KEY, userId)
+}
+
+func GenerateLeagueRedisKey(leagueId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_LEAGUE_KEY, leagueId)
+}
+
+func GenerateLeagueMembersRedisKey(leagueId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_LEAGUE_MEMBERS_KEY, leagueId)
+}
+
+func GenerateUserLeaguesRedisKey(userId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_USER_LEAGUES_KEY, userId)
+}
+
+func GenerateLeagueSettingsRedisKey(leagueId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_LEAGUE_SETTINGS_KEY, leagueId)
+}
+
+func GenerateLeagueRolesRedisKey(leagueId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_LEAGUE_ROLES_KEY, leagueId)
+}
+
+func GenerateLeagueWaiverPriorityRedisKey(leagueId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_LEAGUE_WAIVER_PRIORITY_KEY, leagueId)
+}
+
+func GenerateAuctionRedisKey(auctionId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_AUCTION_KEY, auctionId)
+}
+
+func GenerateLeagueToCurrentAuctionRedisKey(leagueId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_LEAGUE_TO_CURRENT_AUCTION_KEY, leagueId)
+}
+
+func GenerateBidRedisKey(auctionId uuid.UUID, userId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_BID_KEY, auctionId, userId)
+}
+
+func GenerateBidTimestampRedisKey(auctionId uuid.UUID, userId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_BID_TIMESTAMP_KEY, auctionId, userId)
+}
+
+func GenerateAuctionProcessingRedisKey(auctionId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_AUCTION_PROCESSING_KEY, auctionId)
+}
+
+func GenerateAuctionResultsRedisKey(auctionId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_AUCTION_RESULTS_KEY, auctionId)
+}
+
+func GenerateAuctionTransitionsRedisKey() string {
+	return REDIS_AUCTION_TRANSITIONS_KEY
+}
+
+func GenerateRosterRedisKey(leagueId uuid.UUID, userId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_ROSTER_KEY, leagueId, userId)
+}
+
+func GeneratePlayerToOwnerRedisKey(leagueId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_PLAYER_TO_OWNER_KEY, leagueId)
+}
+
+func GeneratePlayerRedisKey(playerId string) string {
+	return fmt.Sprintf(REDIS_PLAYER_KEY, playerId)
+}
+
+func GeneratePlayerCatalogRedisKey() string {
+	return REDIS_PLAYER_CATALOG_KEY
+}
+
+func GeneratePlayerDebutRedisKey(playerId string) string {
+	return fmt.Sprintf(REDIS_PLAYER_DEBUT_KEY, playerId)
+}
+
+func GeneratePlayerSetRedisKey(playerSetId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_PLAYER_SET_KEY, playerSetId)
+}
+
+func GeneratePlayerSetPlayersRedisKey(playerSetId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_PLAYER_SET_PLAYERS_KEY, playerSetId)
+}
+
+func GenerateLeaguePlayerSetsRedisKey(leagueId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_LEAGUE_PLAYER_SETS_KEY, leagueId)
+}
+
+func GenerateTradeRedisKey(tradeId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_TRADE_KEY, tradeId)
+}
+
+func GenerateLeagueToTradesRedisKey(leagueId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_LEAGUE_TO_TRADES_KEY, leagueId)
+}
+
+func GenerateScheduledTradesRedisKey() string {
+	return REDIS_SCHEDULED_TRADES_KEY
+}
+
+func GenerateInviteRedisKey(code string) string {
+	return fmt.Sprintf(REDIS_INVITE_KEY, code)
+}
+
+func GenerateLeagueToInvitesRedisKey(leagueId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_LEAGUE_TO_INVITES_KEY, leagueId)
+}
+
+func GenerateMessageStateRedisKey(userId uuid.UUID) string {
+	return fmt.Sprintf(REDIS_MESSAGE_STATE_KEY, userId)
+}
+
+func GenerateWebhookEventRedisKey(eventId string) string {
+	return fmt.Sprintf(REDIS_WEBHOOK_EVENT_KEY, eventId)
+}
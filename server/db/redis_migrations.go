@@ -0,0 +1,236 @@
+package redis_client
+
+import (
+	goContext "context"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type redisMigration struct {
+	version int64
+	name    string
+	// apply brings every key the migration covers up to date and returns how many
+	// it changed. With dryRun set, it only counts the keys it would change.
+	// Running it again after it succeeds must change nothing.
+	apply func(ctx goContext.Context, redisClient *redis.Client, dryRun bool) (int64, error)
+}
+
+// redisMigrations bring the key schema up to date in order. The schema version
+// is bumped after each one succeeds, so add new migrations to the end rather than
+// changing ones that have already shipped. Servers started together may run the
+// same migration at once, which is why each one has to be safe to repeat.
+var redisMigrations = []redisMigration{
+	{
+		version: 1,
+		name:    "add players to the catalog",
+		apply:   addPlayersToCatalog,
+	},
+	{
+		version: 2,
+		name:    "fill in team and position on players",
+		apply:   fillInPlayerTeamAndPosition,
+	},
+	{
+		version: 3,
+		name:    "move legacy league settings into the settings hash",
+		apply:   moveLegacyLeagueSettings,
+	},
+}
+
+// RedisSchemaVersion is the version Redis is at once every migration has run
+var RedisSchemaVersion = redisMigrations[len(redisMigrations)-1].version
+
+// RedisMigrationResult describes a migration that was run, or would be run on a dry run
+type RedisMigrationResult struct {
+	Version     int64  `json:"version"`
+	Name        string `json:"name"`
+	ChangedKeys int64  `json:"changed_keys"`
+	DryRun      bool   `json:"dry_run"`
+}
+
+// GetRedisSchemaVersion returns the version of the last migration applied to Redis
+func GetRedisSchemaVersion(ctx goContext.Context, redisClient *redis.Client) (int64, error) {
+	rawVersion, err := redisClient.Get(ctx, REDIS_SCHEMA_VERSION_KEY).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(rawVersion, 10, 64)
+}
+
+// MigrateRedis applies every migration Redis doesn't have yet. With dryRun set,
+// nothing is written and the results count the keys each migration would change.
+func MigrateRedis(ctx goContext.Context, redisClient *redis.Client, dryRun bool) ([]RedisMigrationResult, error) {
+	currentVersion, err := GetRedisSchemaVersion(ctx, redisClient)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []RedisMigrationResult{}
+	for _, migration := range redisMigrations {
+		if migration.version <= currentVersion {
+			continue
+		}
+
+		changedKeys, err := migration.apply(ctx, redisClient, dryRun)
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, RedisMigrationResult{
+			Version:     migration.version,
+			Name:        migration.name,
+			ChangedKeys: changedKeys,
+			DryRun:      dryRun,
+		})
+
+		if dryRun {
+			continue
+		}
+
+		err = redisClient.Set(ctx, REDIS_SCHEMA_VERSION_KEY, migration.version, 0).Err()
+		if err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// Players from before the catalog set existed were only stored as hashes
+func addPlayersToCatalog(ctx goContext.Context, redisClient *redis.Client, dryRun bool) (int64, error) {
+	var changedKeys int64
+	err := scanRedisKeys(ctx, redisClient, GetRedisKeyPattern(REDIS_PLAYER_KEY), func(key string) error {
+		keyIds, err := ParseRedisKey(REDIS_PLAYER_KEY, key)
+		if err != nil {
+			return err
+		}
+		playerId := keyIds[0]
+
+		isCataloged, err := redisClient.SIsMember(ctx, GeneratePlayerCatalogRedisKey(), playerId).Result()
+		if err != nil || isCataloged {
+			return err
+		}
+
+		changedKeys++
+		if dryRun {
+			return nil
+		}
+
+		return redisClient.SAdd(ctx, GeneratePlayerCatalogRedisKey(), playerId).Err()
+	})
+
+	return changedKeys, err
+}
+
+// Players from before team and position existed are missing both fields.
+// Nothing knows their real values, so they're filled in as blank.
+func fillInPlayerTeamAndPosition(ctx goContext.Context, redisClient *redis.Client, dryRun bool) (int64, error) {
+	var changedKeys int64
+	err := scanRedisKeys(ctx, redisClient, GetRedisKeyPattern(REDIS_PLAYER_KEY), func(key string) error {
+		fields := []string{"team", "position"}
+		values, err := redisClient.HMGet(ctx, key, fields...).Result()
+		if err != nil {
+			return err
+		}
+
+		missingFields := []string{}
+		for index, value := range values {
+			if value == nil {
+				missingFields = append(missingFields, fields[index])
+			}
+		}
+
+		if len(missingFields) == 0 {
+			return nil
+		}
+
+		changedKeys++
+		if dryRun {
+			return nil
+		}
+
+		// HSetNX leaves a value alone if the player was updated since it was read
+		_, err = redisClient.TxPipelined(ctx, func(pipeline redis.Pipeliner) error {
+			for _, field := range missingFields {
+				pipeline.HSetNX(ctx, key, field, "")
+			}
+			return nil
+		})
+		return err
+	})
+
+	return changedKeys, err
+}
+
+// Leagues from before settings existed kept their tie-break policy and release
+// refund on the league hash. Values already in the settings hash win.
+func moveLegacyLeagueSettings(ctx goContext.Context, redisClient *redis.Client, dryRun bool) (int64, error) {
+	var changedKeys int64
+	err := scanRedisKeys(ctx, redisClient, GetRedisKeyPattern(REDIS_LEAGUE_KEY), func(key string) error {
+		fields := []string{"tie_break_policy", "release_refund_percentage"}
+		values, err := redisClient.HMGet(ctx, key, fields...).Result()
+		if err != nil {
+			return err
+		}
+
+		legacySettings := map[string]string{}
+		for index, value := range values {
+			if legacyValue, ok := value.(string); ok {
+				legacySettings[fields[index]] = legacyValue
+			}
+		}
+
+		if len(legacySettings) == 0 {
+			return nil
+		}
+
+		changedKeys++
+		if dryRun {
+			return nil
+		}
+
+		keyIds, err := ParseRedisKeyIds(REDIS_LEAGUE_KEY, key)
+		if err != nil {
+			return err
+		}
+		leagueId := keyIds[0]
+		_, err = redisClient.TxPipelined(ctx, func(pipeline redis.Pipeliner) error {
+			for field, legacyValue := range legacySettings {
+				pipeline.HSetNX(ctx, GenerateLeagueSettingsRedisKey(leagueId), field, legacyValue)
+				pipeline.HDel(ctx, key, field)
+			}
+			return nil
+		})
+		return err
+	})
+
+	return changedKeys, err
+}
+
+// scanRedisKeys calls handleKey once for every key matching the pattern,
+// without blocking Redis the way KEYS would
+func scanRedisKeys(ctx goContext.Context, redisClient *redis.Client, pattern string, handleKey func(key string) error) error {
+	// SCAN can return the same key more than once
+	seenKeys := map[string]bool{}
+
+	iterator := redisClient.Scan(ctx, 0, pattern, 100).Iterator()
+	for iterator.Next(ctx) {
+		key := iterator.Val()
+		if seenKeys[key] {
+			continue
+		}
+		seenKeys[key] = true
+
+		err := handleKey(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return iterator.Err()
+}
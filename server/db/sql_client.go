@@ -0,0 +1,258 @@
+package redis_client
+
+import (
+	goContext "context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/wilbertthelam/prop-ock/constants"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+)
+
+// SqlClient runs queries against SQLite or PostgreSQL. Queries are written
+// with ? placeholders, which are swapped for $1, $2... on PostgreSQL.
+type SqlClient struct {
+	db     *sql.DB
+	driver string
+}
+
+// sqlTransaction is the open transaction shared through the context, along
+// with how many savepoints deep the current commands are
+type sqlTransaction struct {
+	tx         *sql.Tx
+	savepoints int
+}
+
+// sqlQueryable is satisfied by both *sql.DB and *sql.Tx
+type sqlQueryable interface {
+	ExecContext(ctx goContext.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx goContext.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx goContext.Context, query string, args ...interface{}) *sql.Row
+}
+
+// NewSqlClient connects to the SQL database and brings its schema up to date.
+// Nothing is opened unless the config picks the SQL backend.
+func NewSqlClient(config *config_service.Config) *SqlClient {
+	storageConfig := config.GetStorageConfig()
+	if storageConfig.Backend != config_service.STORAGE_BACKEND_SQL {
+		return nil
+	}
+
+	sqlClient, err := OpenSqlClient(storageConfig.SqlDriver, storageConfig.SqlUrl)
+	if err != nil {
+		panic(fmt.Sprintf("failed to start server when connecting to SQL: %+v", err))
+	}
+
+	err = sqlClient.Migrate(goContext.Background())
+	if err != nil {
+		panic(fmt.Sprintf("failed to start server when migrating SQL schema: %+v", err))
+	}
+
+	return sqlClient
+}
+
+// OpenSqlClient connects to the database without touching its schema
+func OpenSqlClient(driver string, url string) (*SqlClient, error) {
+	switch driver {
+	case config_service.SQL_DRIVER_SQLITE:
+		// SQLite leaves foreign keys off unless they're turned on for every connection
+		separator := "?"
+		if strings.Contains(url, "?") {
+			separator = "&"
+		}
+		url = url + separator + "_foreign_keys=on&_busy_timeout=5000"
+	case config_service.SQL_DRIVER_POSTGRES:
+	default:
+		return nil, fmt.Errorf("unsupported SQL driver: %v", driver)
+	}
+
+	db, err := sql.Open(driver, url)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows one writer at a time, so share a single connection
+	// rather than have transactions fail on a locked database
+	if driver == config_service.SQL_DRIVER_SQLITE {
+		db.SetMaxOpenConns(1)
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SqlClient{
+		db,
+		driver,
+	}, nil
+}
+
+func (s *SqlClient) Close() error {
+	return s.db.Close()
+}
+
+// Rebind swaps the query's ? placeholders for the ones the driver expects
+func (s *SqlClient) Rebind(query string) string {
+	if s.driver != config_service.SQL_DRIVER_POSTGRES {
+		return query
+	}
+
+	var rebound strings.Builder
+	placeholder := 0
+	for _, character := range query {
+		if character != '?' {
+			rebound.WriteRune(character)
+			continue
+		}
+
+		placeholder++
+		rebound.WriteString("$" + strconv.Itoa(placeholder))
+	}
+
+	return rebound.String()
+}
+
+// getQueryable runs queries on the transaction open in the context,
+// or straight on the database if there isn't one
+func (s *SqlClient) getQueryable(context echo.Context) sqlQueryable {
+	transaction, ok := context.Get(constants.SQL_TX).(*sqlTransaction)
+	if !ok || transaction == nil {
+		return s.db
+	}
+
+	return transaction.tx
+}
+
+func (s *SqlClient) Exec(context echo.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.getQueryable(context).ExecContext(context.Request().Context(), s.Rebind(query), args...)
+}
+
+func (s *SqlClient) Query(context echo.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.getQueryable(context).QueryContext(context.Request().Context(), s.Rebind(query), args...)
+}
+
+func (s *SqlClient) QueryRow(context echo.Context, query string, args ...interface{}) *sql.Row {
+	return s.getQueryable(context).QueryRowContext(context.Request().Context(), s.Rebind(query), args...)
+}
+
+// StartTransaction runs the commands in the function in a single transaction,
+// shared through the context. Everything is rolled back if the function fails.
+// Transactions started inside another one run in a savepoint, so a failure only
+// rolls back their own commands and leaves the outer transaction to carry on.
+func (s *SqlClient) StartTransaction(context echo.Context, commandList func() error) error {
+	transaction, ok := context.Get(constants.SQL_TX).(*sqlTransaction)
+	if ok && transaction != nil {
+		return s.runInSavepoint(context, transaction, commandList)
+	}
+
+	tx, err := s.db.BeginTx(context.Request().Context(), nil)
+	if err != nil {
+		return err
+	}
+
+	context.Set(constants.SQL_TX, &sqlTransaction{tx: tx})
+
+	err = commandList()
+
+	// Clear transaction from context once it's finished
+	context.Set(constants.SQL_TX, nil)
+
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			context.Logger().Errorf("failed to roll back SQL transaction: %v", rollbackErr)
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SqlClient) runInSavepoint(context echo.Context, transaction *sqlTransaction, commandList func() error) error {
+	transaction.savepoints++
+	savepoint := fmt.Sprintf("savepoint_%v", transaction.savepoints)
+	defer func() {
+		transaction.savepoints--
+	}()
+
+	_, err := transaction.tx.ExecContext(context.Request().Context(), "SAVEPOINT "+savepoint)
+	if err != nil {
+		return err
+	}
+
+	err = commandList()
+	if err != nil {
+		_, rollbackErr := transaction.tx.ExecContext(context.Request().Context(), "ROLLBACK TO SAVEPOINT "+savepoint)
+		if rollbackErr != nil {
+			context.Logger().Errorf("failed to roll back SQL savepoint: %v", rollbackErr)
+		}
+
+		return err
+	}
+
+	_, err = transaction.tx.ExecContext(context.Request().Context(), "RELEASE SAVEPOINT "+savepoint)
+	return err
+}
+
+// NullUuid stores empty ids as NULL, so optional references
+// don't trip foreign keys
+func NullUuid(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+
+	return id
+}
+
+// QueryUuids returns the first column of every row the query returns as ids
+func (s *SqlClient) QueryUuids(context echo.Context, query string, args ...interface{}) ([]uuid.UUID, error) {
+	rows, err := s.Query(context, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// QueryStrings returns the first column of every row the query returns as strings
+func (s *SqlClient) QueryStrings(context echo.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := s.Query(context, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		err = rows.Scan(&value)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
@@ -0,0 +1,289 @@
+package redis_client
+
+import (
+	goContext "context"
+	"time"
+)
+
+type sqlMigration struct {
+	version    int64
+	name       string
+	statements []string
+}
+
+// sqlMigrations bring the schema up to date in order. Each one is recorded in
+// schema_migrations once applied, so add new migrations to the end rather than
+// changing ones that have already shipped. The SQL has to run on both SQLite
+// and PostgreSQL, so ids are stored as TEXT and times as unix milliseconds.
+var sqlMigrations = []sqlMigration{
+	{
+		version: 1,
+		name:    "create leagues, users, auctions and wallets",
+		statements: []string{
+			`CREATE TABLE leagues (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL
+			)`,
+			`CREATE TABLE league_settings (
+				league_id TEXT PRIMARY KEY REFERENCES leagues (id) ON DELETE CASCADE,
+				starting_wallet BIGINT NOT NULL,
+				min_bid BIGINT NOT NULL,
+				bid_increment BIGINT NOT NULL,
+				max_bids_per_auction BIGINT NOT NULL,
+				roster_size_cap BIGINT NOT NULL,
+				auction_duration BIGINT NOT NULL,
+				tie_break_policy BIGINT NOT NULL,
+				release_refund_percentage BIGINT NOT NULL
+			)`,
+			`CREATE TABLE users (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL
+			)`,
+			`CREATE TABLE user_sender_ps_ids (
+				sender_ps_id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE
+			)`,
+			`CREATE INDEX user_sender_ps_ids_user_id ON user_sender_ps_ids (user_id)`,
+			`CREATE TABLE league_members (
+				league_id TEXT NOT NULL REFERENCES leagues (id) ON DELETE CASCADE,
+				user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				PRIMARY KEY (league_id, user_id)
+			)`,
+			`CREATE INDEX league_members_user_id ON league_members (user_id)`,
+			`CREATE TABLE league_roles (
+				league_id TEXT NOT NULL REFERENCES leagues (id) ON DELETE CASCADE,
+				user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				role BIGINT NOT NULL,
+				PRIMARY KEY (league_id, user_id)
+			)`,
+			`CREATE TABLE waiver_priorities (
+				league_id TEXT NOT NULL REFERENCES leagues (id) ON DELETE CASCADE,
+				user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				priority BIGINT NOT NULL,
+				PRIMARY KEY (league_id, user_id)
+			)`,
+			`CREATE TABLE players (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				image TEXT NOT NULL,
+				team TEXT NOT NULL,
+				position TEXT NOT NULL
+			)`,
+			`CREATE TABLE player_sets (
+				id TEXT PRIMARY KEY,
+				league_id TEXT NOT NULL REFERENCES leagues (id) ON DELETE CASCADE,
+				name TEXT NOT NULL
+			)`,
+			`CREATE INDEX player_sets_league_id ON player_sets (league_id)`,
+			`CREATE TABLE player_set_players (
+				player_set_id TEXT NOT NULL REFERENCES player_sets (id) ON DELETE CASCADE,
+				player_id TEXT NOT NULL,
+				PRIMARY KEY (player_set_id, player_id)
+			)`,
+			`CREATE TABLE auctions (
+				id TEXT PRIMARY KEY,
+				league_id TEXT NOT NULL REFERENCES leagues (id) ON DELETE CASCADE,
+				player_set_id TEXT NOT NULL,
+				start_time BIGINT NOT NULL,
+				end_time BIGINT NOT NULL,
+				status BIGINT NOT NULL,
+				pricing_mode BIGINT NOT NULL,
+				name TEXT NOT NULL,
+				notes TEXT NOT NULL
+			)`,
+			`CREATE INDEX auctions_league_id ON auctions (league_id)`,
+			`CREATE TABLE league_current_auctions (
+				league_id TEXT PRIMARY KEY REFERENCES leagues (id) ON DELETE CASCADE,
+				auction_id TEXT NOT NULL REFERENCES auctions (id) ON DELETE CASCADE
+			)`,
+			`CREATE TABLE auction_processing_claims (
+				auction_id TEXT PRIMARY KEY REFERENCES auctions (id) ON DELETE CASCADE,
+				expires_at BIGINT NOT NULL
+			)`,
+			`CREATE TABLE bids (
+				auction_id TEXT NOT NULL REFERENCES auctions (id) ON DELETE CASCADE,
+				user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				player_id TEXT NOT NULL,
+				bid BIGINT NOT NULL,
+				created_at BIGINT NOT NULL,
+				PRIMARY KEY (auction_id, user_id, player_id)
+			)`,
+			`CREATE TABLE auction_results (
+				auction_id TEXT NOT NULL REFERENCES auctions (id) ON DELETE CASCADE,
+				player_id TEXT NOT NULL,
+				winning_user_id TEXT NOT NULL REFERENCES users (id),
+				winning_bid BIGINT NOT NULL,
+				winning_bid_created_at BIGINT NOT NULL,
+				price BIGINT NOT NULL,
+				tie_break_policy BIGINT NOT NULL,
+				tie_break_seed BIGINT NOT NULL,
+				PRIMARY KEY (auction_id, player_id)
+			)`,
+			`CREATE TABLE auction_result_tied_bids (
+				auction_id TEXT NOT NULL,
+				player_id TEXT NOT NULL,
+				user_id TEXT NOT NULL REFERENCES users (id),
+				bid BIGINT NOT NULL,
+				created_at BIGINT NOT NULL,
+				sort_order BIGINT NOT NULL,
+				PRIMARY KEY (auction_id, player_id, user_id),
+				FOREIGN KEY (auction_id, player_id) REFERENCES auction_results (auction_id, player_id) ON DELETE CASCADE
+			)`,
+			`CREATE TABLE auction_transitions (
+				auction_id TEXT NOT NULL REFERENCES auctions (id) ON DELETE CASCADE,
+				transition BIGINT NOT NULL,
+				run_at BIGINT NOT NULL,
+				PRIMARY KEY (auction_id, transition)
+			)`,
+			`CREATE INDEX auction_transitions_run_at ON auction_transitions (run_at)`,
+			`CREATE TABLE wallets (
+				user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				league_id TEXT NOT NULL REFERENCES leagues (id) ON DELETE CASCADE,
+				available BIGINT NOT NULL CHECK (available >= 0),
+				held BIGINT NOT NULL CHECK (held >= 0),
+				PRIMARY KEY (user_id, league_id)
+			)`,
+			`CREATE TABLE archived_wallets (
+				user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				league_id TEXT NOT NULL REFERENCES leagues (id) ON DELETE CASCADE,
+				available BIGINT NOT NULL,
+				held BIGINT NOT NULL,
+				PRIMARY KEY (user_id, league_id)
+			)`,
+			`CREATE TABLE wallet_transactions (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				league_id TEXT NOT NULL REFERENCES leagues (id) ON DELETE CASCADE,
+				sort_order BIGINT NOT NULL,
+				amount BIGINT NOT NULL,
+				held_amount BIGINT NOT NULL,
+				reason BIGINT NOT NULL,
+				auction_id TEXT REFERENCES auctions (id),
+				player_id TEXT NOT NULL,
+				created_at BIGINT NOT NULL,
+				balance BIGINT NOT NULL,
+				held_balance BIGINT NOT NULL
+			)`,
+			`CREATE INDEX wallet_transactions_user_id_league_id ON wallet_transactions (user_id, league_id, sort_order)`,
+			`CREATE TABLE rosters (
+				league_id TEXT NOT NULL REFERENCES leagues (id) ON DELETE CASCADE,
+				player_id TEXT NOT NULL,
+				user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				auction_id TEXT REFERENCES auctions (id),
+				price BIGINT NOT NULL,
+				acquired_at BIGINT NOT NULL,
+				PRIMARY KEY (league_id, player_id)
+			)`,
+			`CREATE INDEX rosters_league_id_user_id ON rosters (league_id, user_id)`,
+			`CREATE TABLE trades (
+				id TEXT PRIMARY KEY,
+				league_id TEXT NOT NULL REFERENCES leagues (id) ON DELETE CASCADE,
+				proposer_id TEXT NOT NULL REFERENCES users (id),
+				receiver_id TEXT NOT NULL REFERENCES users (id),
+				proposer_funds BIGINT NOT NULL,
+				receiver_funds BIGINT NOT NULL,
+				status BIGINT NOT NULL,
+				counter_of_trade_id TEXT REFERENCES trades (id),
+				created_at BIGINT NOT NULL,
+				expires_at BIGINT NOT NULL,
+				process_at BIGINT NOT NULL,
+				updated_at BIGINT NOT NULL
+			)`,
+			`CREATE INDEX trades_league_id ON trades (league_id)`,
+			`CREATE TABLE trade_players (
+				trade_id TEXT NOT NULL REFERENCES trades (id) ON DELETE CASCADE,
+				player_id TEXT NOT NULL,
+				user_id TEXT NOT NULL REFERENCES users (id),
+				sort_order BIGINT NOT NULL,
+				PRIMARY KEY (trade_id, player_id)
+			)`,
+			`CREATE TABLE trade_schedule (
+				trade_id TEXT PRIMARY KEY REFERENCES trades (id) ON DELETE CASCADE,
+				run_at BIGINT NOT NULL
+			)`,
+			`CREATE INDEX trade_schedule_run_at ON trade_schedule (run_at)`,
+			`CREATE TABLE invites (
+				code TEXT PRIMARY KEY,
+				league_id TEXT NOT NULL REFERENCES leagues (id) ON DELETE CASCADE,
+				max_uses BIGINT NOT NULL,
+				uses BIGINT NOT NULL,
+				expires_at BIGINT NOT NULL,
+				created_at BIGINT NOT NULL
+			)`,
+			`CREATE INDEX invites_league_id ON invites (league_id)`,
+			`CREATE TABLE message_states (
+				user_id TEXT PRIMARY KEY,
+				state BIGINT NOT NULL,
+				expires_at BIGINT NOT NULL
+			)`,
+			`CREATE TABLE webhook_events (
+				event_id TEXT PRIMARY KEY,
+				expires_at BIGINT NOT NULL
+			)`,
+		},
+	},
+}
+
+// Migrate applies every migration the database doesn't have yet,
+// each in its own transaction
+func (s *SqlClient) Migrate(ctx goContext.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range sqlMigrations {
+		err = s.applyMigration(ctx, migration)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SqlClient) applyMigration(ctx goContext.Context, migration sqlMigration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var appliedCount int64
+	err = tx.QueryRowContext(
+		ctx,
+		s.Rebind("SELECT COUNT(*) FROM schema_migrations WHERE version = ?"),
+		migration.version,
+	).Scan(&appliedCount)
+	if err != nil {
+		return err
+	}
+
+	if appliedCount > 0 {
+		return nil
+	}
+
+	for _, statement := range migration.statements {
+		_, err = tx.ExecContext(ctx, statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		s.Rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+		migration.version,
+		migration.name,
+		time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
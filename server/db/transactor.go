@@ -0,0 +1,12 @@
+package redis_client
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+// Transactor starts transactions on the memory and SQL backends. Redis has no
+// Transactor: every write there that has to land together, or not at all, is a
+// single Lua script in its repo.
+type Transactor interface {
+	StartTransaction(context echo.Context, commandList func() error) error
+}
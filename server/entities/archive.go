@@ -0,0 +1,65 @@
+package entities
+
+import "github.com/google/uuid"
+
+// ARCHIVE_VERSION changes whenever the archive layout does,
+// so older archives can be told apart when they're imported
+const ARCHIVE_VERSION int64 = 1
+
+// Archive is a portable copy of everything the server keeps, used to move
+// data from one storage backend to another. Short-lived state like
+// conversation state and webhook claims is left out.
+type Archive struct {
+	Version            int64                        `json:"version"`
+	ExportedAt         int64                        `json:"exported_at,omitempty"`
+	Users              []ArchivedUser               `json:"users"`
+	Leagues            []ArchivedLeague             `json:"leagues"`
+	Players            []Player                     `json:"players"`
+	PlayerSets         []PlayerSet                  `json:"player_sets"`
+	Auctions           []ArchivedAuction            `json:"auctions"`
+	Rosters            []RosterPlayer               `json:"rosters"`
+	Trades             []ArchivedTrade              `json:"trades"`
+	Invites            []LeagueInvite               `json:"invites"`
+	AuctionTransitions []ScheduledAuctionTransition `json:"auction_transitions"`
+}
+
+// ArchivedUser is a user along with their Messenger ids, wallets and wallet ledger
+type ArchivedUser struct {
+	User        User     `json:"user"`
+	SenderPsIds []string `json:"sender_ps_ids,omitempty"`
+	Wallets     []Wallet `json:"wallets,omitempty"`
+	// ArchivedWallets are the balances the user left leagues with
+	ArchivedWallets    []Wallet            `json:"archived_wallets,omitempty"`
+	WalletTransactions []WalletTransaction `json:"wallet_transactions,omitempty"`
+}
+
+// ArchivedLeague is a league along with its settings, roles and waiver order.
+// The league's members are kept on the league itself.
+type ArchivedLeague struct {
+	League           League                   `json:"league"`
+	Settings         LeagueSettings           `json:"settings"`
+	Roles            map[uuid.UUID]LeagueRole `json:"roles,omitempty"`
+	WaiverPriority   []uuid.UUID              `json:"waiver_priority,omitempty"`
+	CurrentAuctionId uuid.UUID                `json:"current_auction_id,omitempty"`
+}
+
+// ArchivedAuction is an auction along with every bid placed in it and its results
+type ArchivedAuction struct {
+	Auction Auction                  `json:"auction"`
+	Bids    []AuctionBid             `json:"bids,omitempty"`
+	Results map[string]AuctionResult `json:"results,omitempty"`
+}
+
+// ArchivedTrade is a trade along with when it next needs looking at, if it's scheduled
+type ArchivedTrade struct {
+	Trade       Trade `json:"trade"`
+	ScheduledAt int64 `json:"scheduled_at,omitempty"`
+}
+
+// ArchiveSummary counts what's in an archive or a store, so a migration can
+// check that everything arrived. Counts are keyed on the SQL table they end up in.
+type ArchiveSummary struct {
+	Counts          map[string]int64 `json:"counts"`
+	WalletAvailable int64            `json:"wallet_available"`
+	WalletHeld      int64            `json:"wallet_held"`
+}
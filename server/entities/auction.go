@@ -18,15 +18,26 @@ const (
 	AUCTION_STATUS_CLOSED AuctionStatus = 4
 )
 
+type AuctionPricingMode int64
+
+const (
+	AUCTION_PRICING_MODE_INVALID AuctionPricingMode = 0
+	// AUCTION_PRICING_MODE_FIRST_PRICE charges the winner their full bid
+	AUCTION_PRICING_MODE_FIRST_PRICE AuctionPricingMode = 1
+	// AUCTION_PRICING_MODE_SECOND_PRICE charges the winner the second highest bid plus one (Vickrey auction)
+	AUCTION_PRICING_MODE_SECOND_PRICE AuctionPricingMode = 2
+)
+
 type Auction struct {
-	Id          uuid.UUID     `json:"auction_id,omitempty"`
-	LeagueId    uuid.UUID     `json:"league_id,omitempty"`
-	PlayerSetId uuid.UUID     `json:"player_set_id,omitempty"`
-	StartTime   int64         `json:"start_time,omitempty"`
-	EndTime     int64         `json:"end_time,omitempty"`
-	Status      AuctionStatus `json:"status,omitempty"`
-	Name        string        `json:"name,omitempty"`
-	Notes       string        `json:"notes,omitempty"`
+	Id          uuid.UUID          `json:"auction_id,omitempty"`
+	LeagueId    uuid.UUID          `json:"league_id,omitempty"`
+	PlayerSetId uuid.UUID          `json:"player_set_id,omitempty"`
+	StartTime   int64              `json:"start_time,omitempty"`
+	EndTime     int64              `json:"end_time,omitempty"`
+	Status      AuctionStatus      `json:"status,omitempty"`
+	PricingMode AuctionPricingMode `json:"pricing_mode,omitempty"`
+	Name        string             `json:"name,omitempty"`
+	Notes       string             `json:"notes,omitempty"`
 }
 
 type AuctionBid struct {
@@ -35,4 +46,41 @@ type AuctionBid struct {
 	UserId    uuid.UUID `json:"user_id,omitempty"`
 	PlayerId  string    `json:"player_id,omitempty"`
 	Bid       int64     `json:"bid,omitempty"`
+	Timestamp int64     `json:"timestamp,omitempty"`
+}
+
+// BidLimits caps how many bids a user can have open in an auction. Caps left at 0 are off.
+type BidLimits struct {
+	MaxBidsPerAuction int64
+	// RosterSizeCap counts the user's open bids on top of the players already on
+	// their roster, since every open bid could still be won
+	RosterSizeCap int64
+}
+
+// AuctionResult is the processed outcome for a single player in an auction
+type AuctionResult struct {
+	PlayerId   string     `json:"player_id,omitempty"`
+	WinningBid AuctionBid `json:"winning_bid,omitempty"`
+	// Price is what the winner actually pays, which can be lower than
+	// their bid depending on the auction's pricing mode
+	Price int64 `json:"price,omitempty"`
+	// TiedBids holds every bid that tied for the highest value (including the
+	// winning bid) when a tie-break was needed to pick the winner
+	TiedBids       []AuctionBid   `json:"tied_bids,omitempty"`
+	TieBreakPolicy TieBreakPolicy `json:"tie_break_policy,omitempty"`
+	// TieBreakSeed is the seed used for random draws so the result can be audited
+	TieBreakSeed int64 `json:"tie_break_seed,omitempty"`
+}
+
+// AuctionSettlement is everything processing a stopped auction changes, applied in one step
+type AuctionSettlement struct {
+	Results map[string]AuctionResult
+	// Bids are the bids the settlement was worked out from, which all have to still be open
+	Bids []AuctionBid
+	// WalletTransactions release the losing holds and pay for the winning bids, in order
+	WalletTransactions []WalletTransaction
+	RosterPlayers      []RosterPlayer
+	// WaiverPriorityMoves are the users who won a tie on waiver priority, in the order
+	// they go to the back of the line
+	WaiverPriorityMoves []uuid.UUID
 }
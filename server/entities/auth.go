@@ -0,0 +1,25 @@
+package entities
+
+import "github.com/google/uuid"
+
+// AuthClaims are signed into the tokens callers send as "Authorization: Bearer <token>"
+type AuthClaims struct {
+	UserId    uuid.UUID `json:"user_id,omitempty"`
+	ExpiresAt int64     `json:"expires_at,omitempty"`
+}
+
+// AuthToken is handed out to a user so they can call the API as themselves
+type AuthToken struct {
+	UserId    uuid.UUID `json:"user_id,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt int64     `json:"expires_at,omitempty"`
+}
+
+// WebviewClaims are signed into the bid webview link so the webview can
+// only bid for the user it was sent to, on the player it was sent for
+type WebviewClaims struct {
+	UserId    uuid.UUID `json:"user_id,omitempty"`
+	AuctionId uuid.UUID `json:"auction_id,omitempty"`
+	PlayerId  string    `json:"player_id,omitempty"`
+	ExpiresAt int64     `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,16 @@
+package entities
+
+import "github.com/google/uuid"
+
+// LeagueInvite lets whoever has the code join the league until it
+// expires or runs out of uses. A MaxUses of 0 is unlimited.
+type LeagueInvite struct {
+	Code      string    `json:"code,omitempty"`
+	LeagueId  uuid.UUID `json:"league_id,omitempty"`
+	MaxUses   int64     `json:"max_uses,omitempty"`
+	Uses      int64     `json:"uses"`
+	ExpiresAt int64     `json:"expires_at,omitempty"`
+	CreatedAt int64     `json:"created_at,omitempty"`
+	// Link is the m.me link that joins the league with this code when opened
+	Link string `json:"link,omitempty"`
+}
@@ -2,8 +2,96 @@ package entities
 
 import "github.com/google/uuid"
 
+type TieBreakPolicy int64
+
+const (
+	TIE_BREAK_POLICY_INVALID TieBreakPolicy = 0
+	// TIE_BREAK_POLICY_EARLIEST_BID awards the player to whoever bid first
+	TIE_BREAK_POLICY_EARLIEST_BID TieBreakPolicy = 1
+	// TIE_BREAK_POLICY_LOWEST_WALLET awards the player to whoever has the least money left
+	TIE_BREAK_POLICY_LOWEST_WALLET TieBreakPolicy = 2
+	// TIE_BREAK_POLICY_WAIVER_PRIORITY awards the player to whoever is highest in the
+	// league's waiver order, then moves them to the back of the order
+	TIE_BREAK_POLICY_WAIVER_PRIORITY TieBreakPolicy = 3
+	// TIE_BREAK_POLICY_RANDOM awards the player using a seeded random draw that's saved with the results
+	TIE_BREAK_POLICY_RANDOM TieBreakPolicy = 4
+)
+
+// Leagues that never picked a policy fall back to this one
+const DEFAULT_TIE_BREAK_POLICY = TIE_BREAK_POLICY_EARLIEST_BID
+
+// Defaults for any league setting that was never set
+const (
+	DEFAULT_STARTING_WALLET           = 500
+	DEFAULT_MIN_BID                   = 0
+	DEFAULT_BID_INCREMENT             = 1
+	DEFAULT_MAX_BIDS_PER_AUCTION      = 0
+	DEFAULT_ROSTER_SIZE_CAP           = 0
+	DEFAULT_AUCTION_DURATION          = 10 * 60 * 1000
+	DEFAULT_RELEASE_REFUND_PERCENTAGE = 50
+)
+
 type League struct {
 	Id      uuid.UUID   `json:"id,omitempty"`
 	Name    string      `json:"name,omitempty"`
 	Members []uuid.UUID `json:"members,omitempty"`
 }
+
+// LeagueMember is a user's membership in a league
+type LeagueMember struct {
+	LeagueId uuid.UUID `json:"league_id,omitempty"`
+	UserId   uuid.UUID `json:"user_id,omitempty"`
+}
+
+type LeagueRole int64
+
+// Roles are ordered so a higher role can do everything a lower one can
+const (
+	LEAGUE_ROLE_INVALID LeagueRole = 0
+	// LEAGUE_ROLE_MEMBER bids, trades and manages their own roster
+	LEAGUE_ROLE_MEMBER LeagueRole = 1
+	// LEAGUE_ROLE_COMMISSIONER runs auctions, invites, settings and trade vetoes for the league
+	LEAGUE_ROLE_COMMISSIONER LeagueRole = 2
+	// LEAGUE_ROLE_OWNER is a commissioner who can also pick the league's commissioners
+	LEAGUE_ROLE_OWNER LeagueRole = 3
+)
+
+// LeagueMemberRole is the role a user has in a league. Members without
+// a commissioner or owner role are never stored with one.
+type LeagueMemberRole struct {
+	LeagueId uuid.UUID  `json:"league_id,omitempty"`
+	UserId   uuid.UUID  `json:"user_id,omitempty"`
+	Role     LeagueRole `json:"role,omitempty"`
+}
+
+// LeagueSettings are the rules a league plays by. Caps set to 0 are unlimited.
+type LeagueSettings struct {
+	LeagueId uuid.UUID `json:"league_id,omitempty"`
+	// StartingWallet is what every member gets to spend when they join
+	StartingWallet int64 `json:"starting_wallet"`
+	MinBid         int64 `json:"min_bid"`
+	// BidIncrement is the step bids must go up in from the minimum bid
+	BidIncrement      int64 `json:"bid_increment"`
+	MaxBidsPerAuction int64 `json:"max_bids_per_auction"`
+	// RosterSizeCap counts players owned plus open bids, so nobody can win more than they have room for
+	RosterSizeCap int64 `json:"roster_size_cap"`
+	// AuctionDuration is how long auctions run for in milliseconds when no end time is given
+	AuctionDuration int64          `json:"auction_duration"`
+	TieBreakPolicy  TieBreakPolicy `json:"tie_break_policy"`
+	// ReleaseRefundPercentage is how much of a player's winning price goes back to the owner when they release them
+	ReleaseRefundPercentage int64 `json:"release_refund_percentage"`
+}
+
+func NewDefaultLeagueSettings(leagueId uuid.UUID) LeagueSettings {
+	return LeagueSettings{
+		LeagueId:                leagueId,
+		StartingWallet:          DEFAULT_STARTING_WALLET,
+		MinBid:                  DEFAULT_MIN_BID,
+		BidIncrement:            DEFAULT_BID_INCREMENT,
+		MaxBidsPerAuction:       DEFAULT_MAX_BIDS_PER_AUCTION,
+		RosterSizeCap:           DEFAULT_ROSTER_SIZE_CAP,
+		AuctionDuration:         DEFAULT_AUCTION_DURATION,
+		TieBreakPolicy:          DEFAULT_TIE_BREAK_POLICY,
+		ReleaseRefundPercentage: DEFAULT_RELEASE_REFUND_PERCENTAGE,
+	}
+}
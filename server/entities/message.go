@@ -17,3 +17,13 @@ const (
 	STATE_BIDDING          MessageState = 2
 	STATE_BIDDING_FINISHED MessageState = 3
 )
+
+// MESSAGE_STATE_TRANSITIONS lists the states a user can move to from each state.
+// An auction opening moves everyone back to STATE_AUCTION_OPENED, and an auction
+// stopping moves everyone to STATE_BIDDING_FINISHED, whatever state they were in.
+var MESSAGE_STATE_TRANSITIONS = map[MessageState][]MessageState{
+	STATE_INVALID:          {STATE_AUCTION_OPENED, STATE_BIDDING_FINISHED},
+	STATE_AUCTION_OPENED:   {STATE_AUCTION_OPENED, STATE_BIDDING, STATE_BIDDING_FINISHED},
+	STATE_BIDDING:          {STATE_AUCTION_OPENED, STATE_BIDDING, STATE_BIDDING_FINISHED},
+	STATE_BIDDING_FINISHED: {STATE_AUCTION_OPENED, STATE_BIDDING_FINISHED},
+}
@@ -10,8 +10,10 @@ type SendEvent struct {
 	Tag       string      `json:"tag,omitempty"`
 }
 
+// SendMessage holds either plain text or a template attachment, never both
 type SendMessage struct {
-	Attachment Template `json:"attachment,omitempty"`
+	Text       string    `json:"text,omitempty"`
+	Attachment *Template `json:"attachment,omitempty"`
 }
 
 type SendEventResponse struct {
@@ -15,6 +15,8 @@ type WebhookEvent struct {
 	Message   WebhookMessage  `json:"message,omitempty"`
 	Postback  WebhookPostback `json:"postback,omitempty"`
 	Read      WebhookRead     `json:"read,omitempty"`
+	// Referral is sent on its own when a user already in the conversation opens an m.me link
+	Referral WebhookReferral `json:"referral,omitempty"`
 }
 
 type WebhookMessage struct {
@@ -23,15 +25,26 @@ type WebhookMessage struct {
 }
 
 type WebhookPostback struct {
-	Title   string `json:"title,omitempty"`
-	Payload string `json:"payload,omitempty"`
+	Title    string          `json:"title,omitempty"`
+	Payload  string          `json:"payload,omitempty"`
+	Referral WebhookReferral `json:"referral,omitempty"`
 }
 
-type WebhookRead struct{}
+// WebhookReferral is attached when the user enters the conversation
+// through an m.me link carrying a ref param
+type WebhookReferral struct {
+	Ref    string `json:"ref,omitempty"`
+	Source string `json:"source,omitempty"`
+	Type   string `json:"type,omitempty"`
+}
+
+type WebhookRead struct {
+	Watermark int64 `json:"watermark,omitempty"`
+}
 
+// WebhookBidPostBody is sent by the bid webview. The user, auction and
+// player all come from the signed token the webview was opened with.
 type WebhookBidPostBody struct {
-	PlayerId   string `json:"player_id,omitempty"`
-	SenderPsId string `json:"sender_ps_id,omitempty"`
-	AuctionId  string `json:"auction_id,omitempty"`
-	Bid        int64  `json:"bid,omitempty"`
+	Token string `json:"token,omitempty"`
+	Bid   int64  `json:"bid,omitempty"`
 }
@@ -0,0 +1,11 @@
+package entities
+
+import "github.com/google/uuid"
+
+// PlayerSet is the group of players that are up for bidding in an auction
+type PlayerSet struct {
+	Id        uuid.UUID `json:"id,omitempty"`
+	LeagueId  uuid.UUID `json:"league_id,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	PlayerIds []string  `json:"player_ids,omitempty"`
+}
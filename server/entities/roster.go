@@ -0,0 +1,20 @@
+package entities
+
+import "github.com/google/uuid"
+
+// RosterPlayer is a player owned by a user in a league, along with how they got them
+type RosterPlayer struct {
+	PlayerId   string    `json:"player_id,omitempty"`
+	UserId     uuid.UUID `json:"user_id,omitempty"`
+	LeagueId   uuid.UUID `json:"league_id,omitempty"`
+	AuctionId  uuid.UUID `json:"auction_id,omitempty"`
+	Price      int64     `json:"price,omitempty"`
+	AcquiredAt int64     `json:"acquired_at,omitempty"`
+}
+
+// Roster is every player a user owns in a league
+type Roster struct {
+	LeagueId uuid.UUID      `json:"league_id,omitempty"`
+	UserId   uuid.UUID      `json:"user_id,omitempty"`
+	Players  []RosterPlayer `json:"players"`
+}
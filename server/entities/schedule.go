@@ -0,0 +1,23 @@
+package entities
+
+import "github.com/google/uuid"
+
+type AuctionTransition int64
+
+const (
+	AUCTION_TRANSITION_INVALID AuctionTransition = 0
+	// AUCTION_TRANSITION_START moves the auction from CREATED to ACTIVE
+	AUCTION_TRANSITION_START AuctionTransition = 1
+	// AUCTION_TRANSITION_STOP moves the auction from ACTIVE to STOPPED
+	AUCTION_TRANSITION_STOP AuctionTransition = 2
+	// AUCTION_TRANSITION_PROCESS settles the bids and moves the auction from STOPPED to CLOSED
+	AUCTION_TRANSITION_PROCESS AuctionTransition = 3
+	// AUCTION_TRANSITION_BROADCAST_RESULTS sends the winners their results on Messenger
+	AUCTION_TRANSITION_BROADCAST_RESULTS AuctionTransition = 4
+)
+
+type ScheduledAuctionTransition struct {
+	AuctionId  uuid.UUID         `json:"auction_id,omitempty"`
+	Transition AuctionTransition `json:"transition,omitempty"`
+	RunAt      int64             `json:"run_at,omitempty"`
+}
@@ -0,0 +1,49 @@
+package entities
+
+import "github.com/google/uuid"
+
+type TradeStatus int64
+
+const (
+	TRADE_STATUS_INVALID TradeStatus = 0
+	// TRADE_STATUS_PROPOSED is waiting on the receiver to accept, reject or counter
+	TRADE_STATUS_PROPOSED TradeStatus = 1
+	// TRADE_STATUS_COUNTERED was replaced by a counter offer from the receiver
+	TRADE_STATUS_COUNTERED TradeStatus = 2
+	// TRADE_STATUS_ACCEPTED is agreed to by both sides and waiting out the review period
+	TRADE_STATUS_ACCEPTED TradeStatus = 3
+	TRADE_STATUS_REJECTED TradeStatus = 4
+	TRADE_STATUS_EXPIRED  TradeStatus = 5
+	TRADE_STATUS_VETOED   TradeStatus = 6
+	// TRADE_STATUS_COMPLETED has moved its players and funds
+	TRADE_STATUS_COMPLETED TradeStatus = 7
+	// TRADE_STATUS_FAILED was accepted but one side no longer had what they were trading away
+	TRADE_STATUS_FAILED TradeStatus = 8
+)
+
+// Trade swaps players and/or auction dollars between two members of a league.
+// Each side lists what they are giving up.
+type Trade struct {
+	Id                uuid.UUID   `json:"id,omitempty"`
+	LeagueId          uuid.UUID   `json:"league_id,omitempty"`
+	ProposerId        uuid.UUID   `json:"proposer_id,omitempty"`
+	ReceiverId        uuid.UUID   `json:"receiver_id,omitempty"`
+	ProposerPlayerIds []string    `json:"proposer_player_ids,omitempty"`
+	ReceiverPlayerIds []string    `json:"receiver_player_ids,omitempty"`
+	ProposerFunds     int64       `json:"proposer_funds,omitempty"`
+	ReceiverFunds     int64       `json:"receiver_funds,omitempty"`
+	Status            TradeStatus `json:"status,omitempty"`
+	// CounterOfTradeId is the trade this one was made to counter
+	CounterOfTradeId uuid.UUID `json:"counter_of_trade_id,omitempty"`
+	CreatedAt        int64     `json:"created_at,omitempty"`
+	// ExpiresAt is when an open proposal lapses, ProcessAt is when an accepted trade goes through
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+	ProcessAt int64 `json:"process_at,omitempty"`
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+}
+
+// TradeResponse is a user (or the commissioner) acting on a trade
+type TradeResponse struct {
+	TradeId uuid.UUID `json:"trade_id,omitempty"`
+	UserId  uuid.UUID `json:"user_id,omitempty"`
+}
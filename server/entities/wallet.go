@@ -0,0 +1,74 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WalletTransactionReason int64
+
+const (
+	WALLET_TRANSACTION_REASON_INVALID          WalletTransactionReason = 0
+	WALLET_TRANSACTION_REASON_STARTING_GRANT   WalletTransactionReason = 1
+	WALLET_TRANSACTION_REASON_BID_HOLD         WalletTransactionReason = 2
+	WALLET_TRANSACTION_REASON_BID_CANCEL       WalletTransactionReason = 3
+	WALLET_TRANSACTION_REASON_REFUND           WalletTransactionReason = 4
+	WALLET_TRANSACTION_REASON_ADMIN_ADJUSTMENT WalletTransactionReason = 5
+	WALLET_TRANSACTION_REASON_WINNING_BID      WalletTransactionReason = 6
+	WALLET_TRANSACTION_REASON_RELEASE_REFUND   WalletTransactionReason = 7
+	WALLET_TRANSACTION_REASON_TRADE            WalletTransactionReason = 8
+)
+
+// Wallet is a user's funds in a league. Available funds can be put towards new bids,
+// while held funds are tied up in pending bids until the auction is processed.
+type Wallet struct {
+	LeagueId  uuid.UUID `json:"league_id,omitempty"`
+	Available int64     `json:"available"`
+	Held      int64     `json:"held"`
+}
+
+// WalletTransaction is a single entry in a user's wallet ledger for a league.
+// Amount is the change to available funds and HeldAmount is the change to held
+// funds, both positive for funds added and negative for funds removed.
+type WalletTransaction struct {
+	Id         uuid.UUID               `json:"id,omitempty"`
+	UserId     uuid.UUID               `json:"user_id,omitempty"`
+	LeagueId   uuid.UUID               `json:"league_id,omitempty"`
+	Amount     int64                   `json:"amount,omitempty"`
+	HeldAmount int64                   `json:"held_amount,omitempty"`
+	Reason     WalletTransactionReason `json:"reason,omitempty"`
+	AuctionId  uuid.UUID               `json:"auction_id,omitempty"`
+	PlayerId   string                  `json:"player_id,omitempty"`
+	Timestamp  int64                   `json:"timestamp,omitempty"`
+	// Balance and HeldBalance are the wallet's available and held funds right after this transaction
+	Balance     int64 `json:"balance"`
+	HeldBalance int64 `json:"held_balance"`
+}
+
+// NewWalletTransaction makes the ledger entry for a change to the user's wallet in the league,
+// timestamped now. Its balances are left for whoever applies the change to fill in.
+func NewWalletTransaction(userId uuid.UUID, leagueId uuid.UUID, amount int64, heldAmount int64, reason WalletTransactionReason, auctionId uuid.UUID, playerId string) WalletTransaction {
+	return WalletTransaction{
+		Id:         uuid.New(),
+		UserId:     userId,
+		LeagueId:   leagueId,
+		Amount:     amount,
+		HeldAmount: heldAmount,
+		Reason:     reason,
+		AuctionId:  auctionId,
+		PlayerId:   playerId,
+		Timestamp:  time.Now().UnixMilli(),
+	}
+}
+
+// WalletReconciliation compares a wallet's balances against the balances recomputed from its ledger
+type WalletReconciliation struct {
+	UserId            uuid.UUID `json:"user_id,omitempty"`
+	LeagueId          uuid.UUID `json:"league_id,omitempty"`
+	Balance           int64     `json:"balance"`
+	LedgerBalance     int64     `json:"ledger_balance"`
+	HeldBalance       int64     `json:"held_balance"`
+	LedgerHeldBalance int64     `json:"ledger_held_balance"`
+	IsReconciled      bool      `json:"is_reconciled"`
+}
@@ -7,54 +7,41 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"github.com/wilbertthelam/prop-ock/constants"
 	"github.com/wilbertthelam/prop-ock/entities"
 	messenger_entities "github.com/wilbertthelam/prop-ock/entities/messenger"
 	auction_service "github.com/wilbertthelam/prop-ock/services/auction"
-	user_service "github.com/wilbertthelam/prop-ock/services/user"
+	auth_service "github.com/wilbertthelam/prop-ock/services/auth"
 	"github.com/wilbertthelam/prop-ock/utils"
 )
 
 type AuctionHandler struct {
 	auctionService *auction_service.AuctionService
-	userService    *user_service.UserService
+	authService    *auth_service.AuthService
 }
 
 func New(
 	auctionService *auction_service.AuctionService,
-	userService *user_service.UserService,
+	authService *auth_service.AuthService,
 ) *AuctionHandler {
 	return &AuctionHandler{
 		auctionService,
-		userService,
+		authService,
 	}
 }
 
+// GetBid returns the user's bid on the player the webview token was issued for.
+// The token comes in the X-Webview-Token header so it never ends up in the request log.
 func (a *AuctionHandler) GetBid(context echo.Context) error {
-	params := context.QueryParams()
-
-	auctionId, err := uuid.Parse(params.Get("auction_id"))
+	claims, err := a.authService.VerifyWebviewToken(context.Request().Header.Get("X-Webview-Token"))
 	if err != nil {
-		newErr := utils.NewError(utils.ErrorParams{
-			Code:    http.StatusBadRequest,
-			Message: "failed to get bid params",
-			Args: []interface{}{
-				"auctionId", context.QueryParam("auction_id"),
-			},
-			Err: err,
-		})
-		return utils.JSONError(context, newErr)
+		return utils.JSONError(context, err)
 	}
 
-	// Make sure the sender has a userId
-	// Grab userId from the senderPsId
-	userId, err := a.userService.GetUserIdFromSenderPsId(context, params.Get("sender_ps_id"))
+	bid, err := a.auctionService.GetBid(context, claims.AuctionId, claims.UserId, claims.PlayerId)
 	if err != nil {
 		return utils.JSONError(context, err)
 	}
 
-	bid, err := a.auctionService.GetBid(context, auctionId, userId, params.Get("player_id"))
-
 	return context.JSON(http.StatusOK, bid)
 }
 
@@ -71,22 +58,14 @@ func (a *AuctionHandler) MakeBid(context echo.Context) error {
 		return utils.JSONError(context, newErr)
 	}
 
-	// Make sure the sender has a userId
-	// Grab userId from the senderPsId
-	userId, err := a.userService.GetUserIdFromSenderPsId(context, body.SenderPsId)
+	// The user, auction and player only come from the signed token,
+	// so a bid link can't be used to bid as anyone else
+	claims, err := a.authService.VerifyWebviewToken(body.Token)
 	if err != nil {
 		return utils.JSONError(context, err)
 	}
 
-	auctionId, err := uuid.Parse(body.AuctionId)
-	if err != nil {
-		return utils.JSONError(context, err)
-	}
-
-	playerId := body.PlayerId
-	bid := body.Bid
-
-	err = a.auctionService.MakeBid(context, auctionId, userId, playerId, bid)
+	err = a.auctionService.MakeBid(context, claims.AuctionId, claims.UserId, claims.PlayerId, body.Bid)
 	if err != nil {
 		return utils.JSONError(context, err)
 	}
@@ -107,47 +86,84 @@ func (a *AuctionHandler) CancelBid(context echo.Context) error {
 		return utils.JSONError(context, newErr)
 	}
 
-	// Make sure the sender has a userId
-	// Grab userId from the senderPsId
-	userId, err := a.userService.GetUserIdFromSenderPsId(context, body.SenderPsId)
+	claims, err := a.authService.VerifyWebviewToken(body.Token)
 	if err != nil {
 		return utils.JSONError(context, err)
 	}
 
-	auctionId, err := uuid.Parse(body.AuctionId)
+	err = a.auctionService.CancelBid(context, claims.AuctionId, claims.UserId, claims.PlayerId)
 	if err != nil {
 		return utils.JSONError(context, err)
 	}
 
-	playerId := body.PlayerId
+	return context.JSON(http.StatusOK, "cancel bid successful")
+}
+
+func (a *AuctionHandler) CreateAuction(context echo.Context) error {
+	var body entities.Auction
 
-	err = a.auctionService.CancelBid(context, auctionId, userId, playerId)
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
 	if err != nil {
-		return utils.JSONError(context, err)
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode create auction body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
 	}
 
-	return context.JSON(http.StatusOK, "cancel bid successful")
-}
+	if body.LeagueId == uuid.Nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "league id is required to create an auction",
+			Err:     nil,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	if body.PlayerSetId == uuid.Nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "player set id is required to create an auction",
+			Err:     nil,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = a.authService.RequireLeagueRole(context, body.LeagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
 
-func (a *AuctionHandler) CreateAuction(context echo.Context) error {
-	leagueId := constants.LEAGUE_ID
 	auctionId := uuid.New()
+	now := time.Now()
+
+	// Default to opening the auction right away. Leaving out the end time
+	// runs the auction for the league's default auction duration.
+	startTime := body.StartTime
+	if startTime == 0 {
+		startTime = now.UnixMilli()
+	}
 
 	auction, err := a.auctionService.CreateAuction(
 		context,
 		auctionId,
-		leagueId,
-		time.Now().UnixMilli(),
-		time.Now().Add(time.Duration(10)*time.Minute).UnixMilli(),
+		body.LeagueId,
+		body.PlayerSetId,
+		body.PricingMode,
+		startTime,
+		body.EndTime,
 	)
 	if err != nil {
 		return utils.JSONError(context, err)
 	}
 
-	// For now, start auction when we create it
-	err = a.auctionService.StartAuction(context, auction.Id)
-	if err != nil {
-		return utils.JSONError(context, err)
+	// Start the auction now if it's already due, otherwise the scheduler will start it
+	if startTime <= now.UnixMilli() {
+		err = a.auctionService.StartAuction(context, auction.Id)
+		if err != nil {
+			return utils.JSONError(context, err)
+		}
 	}
 
 	return context.JSON(http.StatusOK, "created auction successful")
@@ -169,6 +185,11 @@ func (a *AuctionHandler) StopAuction(context echo.Context) error {
 
 	auctionId := body.Id
 
+	err = a.authorizeAuctionCommissioner(context, auctionId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
 	err = a.auctionService.StopAuction(context, auctionId)
 	if err != nil {
 		return utils.JSONError(context, err)
@@ -193,6 +214,11 @@ func (a *AuctionHandler) ProcessAuction(context echo.Context) error {
 
 	auctionId := body.Id
 
+	err = a.authorizeAuctionCommissioner(context, auctionId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
 	err = a.auctionService.ProcessAuction(context, auctionId)
 	if err != nil {
 		return utils.JSONError(context, err)
@@ -201,6 +227,16 @@ func (a *AuctionHandler) ProcessAuction(context echo.Context) error {
 	return context.JSON(http.StatusOK, "processing auction successful")
 }
 
+// authorizeAuctionCommissioner makes sure only the commissioners of the auction's league can run it
+func (a *AuctionHandler) authorizeAuctionCommissioner(context echo.Context, auctionId uuid.UUID) error {
+	auction, err := a.auctionService.GetAuctionByAuctionId(context, auctionId)
+	if err != nil {
+		return err
+	}
+
+	return a.authService.RequireLeagueRole(context, auction.LeagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+}
+
 func (a *AuctionHandler) GetCurrentAuctionForLeague(context echo.Context) error {
 	leagueId, err := uuid.Parse(context.QueryParam("league_id"))
 	if err != nil {
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auth_service "github.com/wilbertthelam/prop-ock/services/auth"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type AuthHandler struct {
+	authService *auth_service.AuthService
+}
+
+func New(authService *auth_service.AuthService) *AuthHandler {
+	return &AuthHandler{
+		authService,
+	}
+}
+
+// Authenticate is middleware that rejects requests without a valid admin API key or user token
+func (a *AuthHandler) Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(context echo.Context) error {
+		err := a.authService.AuthenticateRequest(context)
+		if err != nil {
+			return utils.JSONError(context, err)
+		}
+
+		return next(context)
+	}
+}
+
+// IssueToken lets admins hand out tokens users can call the API with
+func (a *AuthHandler) IssueToken(context echo.Context) error {
+	err := a.authService.RequireAdmin(context)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	var body entities.AuthToken
+
+	err = json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode issue token body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	token, err := a.authService.IssueToken(context, body.UserId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, token)
+}
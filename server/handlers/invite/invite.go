@@ -0,0 +1,114 @@
+package invite
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auth_service "github.com/wilbertthelam/prop-ock/services/auth"
+	invite_service "github.com/wilbertthelam/prop-ock/services/invite"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type InviteHandler struct {
+	inviteService *invite_service.InviteService
+	authService   *auth_service.AuthService
+}
+
+func New(
+	inviteService *invite_service.InviteService,
+	authService *auth_service.AuthService,
+) *InviteHandler {
+	return &InviteHandler{
+		inviteService,
+		authService,
+	}
+}
+
+func (i *InviteHandler) GetInvitesForLeague(context echo.Context) error {
+	leagueId, err := uuid.Parse(context.QueryParam("league_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get invites for league params",
+			Args: []interface{}{
+				"leagueId", context.QueryParam("league_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = i.authService.RequireLeagueRole(context, leagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	invites, err := i.inviteService.GetInvitesForLeague(context, leagueId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, invites)
+}
+
+// CreateInvite takes the league_id along with an optional max_uses (0 for unlimited)
+// and expires_at (unix milliseconds, defaults to a week from now)
+func (i *InviteHandler) CreateInvite(context echo.Context) error {
+	var body entities.LeagueInvite
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode create invite body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = i.authService.RequireLeagueRole(context, body.LeagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	invite, err := i.inviteService.CreateInvite(context, body.LeagueId, body.MaxUses, body.ExpiresAt)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, invite)
+}
+
+func (i *InviteHandler) RevokeInvite(context echo.Context) error {
+	var body entities.LeagueInvite
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode revoke invite body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	invite, err := i.inviteService.GetInviteByCode(context, body.Code)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	err = i.authService.RequireLeagueRole(context, invite.LeagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	err = i.inviteService.RevokeInvite(context, body.Code)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, "ok")
+}
@@ -1,23 +1,29 @@
 package league
 
 import (
+	"encoding/json"
 	"net/http"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"github.com/wilbertthelam/prop-ock/constants"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auth_service "github.com/wilbertthelam/prop-ock/services/auth"
 	league_service "github.com/wilbertthelam/prop-ock/services/league"
 	"github.com/wilbertthelam/prop-ock/utils"
 )
 
 type LeagueHandler struct {
 	leagueService *league_service.LeagueService
+	authService   *auth_service.AuthService
 }
 
 func New(
 	leagueService *league_service.LeagueService,
+	authService *auth_service.AuthService,
 ) *LeagueHandler {
 	return &LeagueHandler{
 		leagueService,
+		authService,
 	}
 }
 
@@ -25,12 +31,263 @@ func (l *LeagueHandler) GetLeagueCheck(c echo.Context) error {
 	return c.JSON(http.StatusOK, "ok")
 }
 
+func (l *LeagueHandler) GetLeague(context echo.Context) error {
+	leagueId, err := uuid.Parse(context.QueryParam("league_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get league params",
+			Args: []interface{}{
+				"leagueId", context.QueryParam("league_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	league, err := l.leagueService.GetLeagueByLeagueId(context, leagueId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	if league.Id == uuid.Nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "no league found",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: nil,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	members, err := l.leagueService.GetMembersInLeague(context, leagueId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	league.Members = members
+
+	return context.JSON(http.StatusOK, league)
+}
+
+func (l *LeagueHandler) GetLeaguesForUser(context echo.Context) error {
+	userId, err := uuid.Parse(context.QueryParam("user_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get leagues for user params",
+			Args: []interface{}{
+				"userId", context.QueryParam("user_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	leagueIds, err := l.leagueService.GetLeaguesForUser(context, userId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, leagueIds)
+}
+
 func (l *LeagueHandler) CreateLeague(context echo.Context) error {
-	leagueId := constants.LEAGUE_ID
-	err := l.leagueService.CreateLeague(context, leagueId, "Field of GGreams")
+	var body entities.League
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode create league body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	if body.Name == "" {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "league name is required",
+			Err:     nil,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	// Users who create a league own it, admins give it an owner afterwards
+	league, err := l.leagueService.CreateLeague(context, body.Id, body.Name, auth_service.GetAuthenticatedUserId(context))
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, league)
+}
+
+func (l *LeagueHandler) RemoveUserFromLeague(context echo.Context) error {
+	var body entities.LeagueMember
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode remove user from league body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	// Users can leave on their own, commissioners can remove anyone
+	err = l.authService.RequireUserOrLeagueRole(context, body.UserId, body.LeagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	err = l.leagueService.RemoveUserFromLeague(context, body.UserId, body.LeagueId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, "removed user from league successful")
+}
+
+func (l *LeagueHandler) GetLeagueSettings(context echo.Context) error {
+	leagueId, err := uuid.Parse(context.QueryParam("league_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get league settings params",
+			Args: []interface{}{
+				"leagueId", context.QueryParam("league_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	settings, err := l.leagueService.GetLeagueSettings(context, leagueId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, settings)
+}
+
+// UpdateLeagueSettings only changes the settings included in the body,
+// everything left out keeps its current value
+func (l *LeagueHandler) UpdateLeagueSettings(context echo.Context) error {
+	leagueId, err := uuid.Parse(context.QueryParam("league_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get update league settings params",
+			Args: []interface{}{
+				"leagueId", context.QueryParam("league_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = l.authService.RequireLeagueRole(context, leagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	settings, err := l.leagueService.GetLeagueSettings(context, leagueId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	err = json.NewDecoder(context.Request().Body).Decode(&settings)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode update league settings body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	// The league in the URL wins over anything in the body
+	settings.LeagueId = leagueId
+
+	settings, err = l.leagueService.UpdateLeagueSettings(context, settings)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, settings)
+}
+
+func (l *LeagueHandler) GetLeagueRoles(context echo.Context) error {
+	leagueId, err := uuid.Parse(context.QueryParam("league_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get league roles params",
+			Args: []interface{}{
+				"leagueId", context.QueryParam("league_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	roles, err := l.leagueService.GetLeagueRoles(context, leagueId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, roles)
+}
+
+// SetLeagueRole lets the league owner pick commissioners or hand ownership to someone else
+func (l *LeagueHandler) SetLeagueRole(context echo.Context) error {
+	var body entities.LeagueMemberRole
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode set league role body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = l.authService.RequireLeagueRole(context, body.LeagueId, entities.LEAGUE_ROLE_OWNER)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	err = l.leagueService.SetLeagueRole(context, body)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, "set league role successful")
+}
+
+func (l *LeagueHandler) GetWaiverPriority(context echo.Context) error {
+	leagueId, err := uuid.Parse(context.QueryParam("league_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get waiver priority params",
+			Args: []interface{}{
+				"leagueId", context.QueryParam("league_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	waiverPriority, err := l.leagueService.GetWaiverPriority(context, leagueId)
 	if err != nil {
 		return utils.JSONError(context, err)
 	}
 
-	return nil
+	return context.JSON(http.StatusOK, waiverPriority)
 }
@@ -1,18 +1,17 @@
 package message
 
 import (
-	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"github.com/wilbertthelam/prop-ock/constants"
 	"github.com/wilbertthelam/prop-ock/entities"
 	messenger_entities "github.com/wilbertthelam/prop-ock/entities/messenger"
 	auction_service "github.com/wilbertthelam/prop-ock/services/auction"
+	auth_service "github.com/wilbertthelam/prop-ock/services/auth"
 	callups_service "github.com/wilbertthelam/prop-ock/services/callups"
 	config_service "github.com/wilbertthelam/prop-ock/services/config"
 	league_service "github.com/wilbertthelam/prop-ock/services/league"
@@ -28,6 +27,7 @@ type MessageHandler struct {
 	leagueService  *league_service.LeagueService
 	messageService *message_service.MessageService
 	config         *config_service.Config
+	authService    *auth_service.AuthService
 }
 
 func New(
@@ -37,6 +37,7 @@ func New(
 	leagueService *league_service.LeagueService,
 	messageService *message_service.MessageService,
 	config *config_service.Config,
+	authService *auth_service.AuthService,
 ) *MessageHandler {
 	return &MessageHandler{
 		auctionService,
@@ -45,6 +46,7 @@ func New(
 		leagueService,
 		messageService,
 		config,
+		authService,
 	}
 }
 
@@ -80,9 +82,34 @@ func (m *MessageHandler) VerifyMessengerWebhook(context echo.Context) error {
 }
 
 func (m *MessageHandler) ProcessMessengerWebhook(context echo.Context) error {
+	// Read the raw body since the signature is computed over the exact bytes sent
+	rawBody, err := io.ReadAll(context.Request().Body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to read messenger webhook body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	// Only accept events Messenger signed with our app secret
+	signature := context.Request().Header.Get("X-Hub-Signature-256")
+	if !utils.VerifyHubSignature(rawBody, signature, m.config.GetMessengerConfig().AppSecret) {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusForbidden,
+			Message: "invalid messenger webhook signature",
+			Args: []interface{}{
+				"signature", signature,
+			},
+			Err: nil,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
 	var body messenger_entities.WebhookBody
 
-	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	err = json.Unmarshal(rawBody, &body)
 	if err != nil {
 		newErr := utils.NewError(utils.ErrorParams{
 			Code:    http.StatusBadRequest,
@@ -102,38 +129,31 @@ func (m *MessageHandler) ProcessMessengerWebhook(context echo.Context) error {
 		return utils.JSONError(context, newErr)
 	}
 
-	// Iterates over each entry - there may be multiple if batched
+	// Iterates over every event in every entry - Messenger batches
+	// events under load, so there may be many of each
+	errList := make([]interface{}, 0)
 	for _, entry := range body.Entry {
-		// Gets the message. entry.messaging is an array, but
-		// will only ever contain one message, so we get index 0
-		webhookEvent := entry.Messaging[0]
-
-		context.Logger().Infof("webhook event: %+v", webhookEvent)
-
-		// Process webhook event here
-		// Get the sender PSID
-		senderPsId := webhookEvent.Sender.Id
-		context.Logger().Infof("senderPsId: %v", senderPsId)
-
-		// Check if the event is a message or postback or read and
-		// pass the event to the appropriate handler function
-		if (webhookEvent.Message != messenger_entities.WebhookMessage{}) {
-			err = m.HandleMessengerWebhookMessage(context, senderPsId, webhookEvent.Message)
-		} else if (webhookEvent.Postback != messenger_entities.WebhookPostback{}) {
-			err = m.HandleMessengerWebhookPostback(context, senderPsId, webhookEvent.Postback)
-		} else if (webhookEvent.Read != messenger_entities.WebhookRead{}) {
-			err = m.HandleMessengerWebhookRead(context, senderPsId, webhookEvent.Read)
+		for index, webhookEvent := range entry.Messaging {
+			err = m.processWebhookEvent(context, webhookEvent)
+			if err != nil {
+				context.Logger().Errorf("failed to process webhook event: %+v, err: %v", webhookEvent, err)
+
+				// Events without a mid or postback don't have an id, so fall back to where they were in the batch
+				eventId := getWebhookEventId(webhookEvent)
+				if eventId == "" {
+					eventId = fmt.Sprintf("sender:%v:index:%v", webhookEvent.Sender.Id, index)
+				}
+				errList = append(errList, eventId, err.Error())
+			}
 		}
-
-		// Webhook event processed
-		context.Logger().Info("webhook event processed")
 	}
 
-	if err != nil {
+	if len(errList) > 0 {
 		newErr := utils.NewError(utils.ErrorParams{
 			Code:    http.StatusInternalServerError,
 			Message: "webhook processing error",
-			Err:     err,
+			Args:    errList,
+			Err:     nil,
 		})
 		return utils.JSONError(context, newErr)
 	}
@@ -142,9 +162,74 @@ func (m *MessageHandler) ProcessMessengerWebhook(context echo.Context) error {
 	return context.String(http.StatusOK, "EVENT_RECEIVED")
 }
 
+// processWebhookEvent passes a single event to the handler for its type,
+// skipping any event that has already been processed
+func (m *MessageHandler) processWebhookEvent(context echo.Context, webhookEvent messenger_entities.WebhookEvent) error {
+	context.Logger().Infof("webhook event: %+v", webhookEvent)
+
+	// Messenger retries deliveries it thinks failed, so make sure
+	// we only act on each message and postback once
+	eventId := getWebhookEventId(webhookEvent)
+	if eventId != "" {
+		isFirstDelivery, err := m.messageService.ClaimWebhookEvent(context, eventId)
+		if err != nil {
+			return err
+		}
+
+		if !isFirstDelivery {
+			context.Logger().Infof("skipping duplicate webhook event: %v", eventId)
+			return nil
+		}
+	}
+
+	// Get the sender PSID
+	senderPsId := webhookEvent.Sender.Id
+
+	// Check if the event is a message or postback or read and
+	// pass the event to the appropriate handler function
+	var err error
+	if (webhookEvent.Message != messenger_entities.WebhookMessage{}) {
+		err = m.HandleMessengerWebhookMessage(context, senderPsId, webhookEvent.Message)
+	} else if (webhookEvent.Postback != messenger_entities.WebhookPostback{}) {
+		err = m.HandleMessengerWebhookPostback(context, senderPsId, webhookEvent.Postback)
+	} else if (webhookEvent.Read != messenger_entities.WebhookRead{}) {
+		err = m.HandleMessengerWebhookRead(context, senderPsId, webhookEvent.Read)
+	} else if (webhookEvent.Referral != messenger_entities.WebhookReferral{}) {
+		err = m.HandleMessengerWebhookReferral(context, senderPsId, webhookEvent.Referral)
+	}
+
+	// Let Messenger's retry of a failed event through
+	if err != nil && eventId != "" {
+		releaseErr := m.messageService.ReleaseWebhookEvent(context, eventId)
+		if releaseErr != nil {
+			context.Logger().Errorf("failed to release webhook event: %v, err: %v", eventId, releaseErr)
+		}
+	}
+
+	return err
+}
+
+// getWebhookEventId identifies messages by their mid, and postbacks and referrals by who sent them and when.
+// Other events (like reads) are safe to process twice and have no id.
+func getWebhookEventId(webhookEvent messenger_entities.WebhookEvent) string {
+	if webhookEvent.Message.Mid != "" {
+		return fmt.Sprintf("mid:%v", webhookEvent.Message.Mid)
+	}
+
+	if (webhookEvent.Postback != messenger_entities.WebhookPostback{}) {
+		return fmt.Sprintf("postback:%v:%v", webhookEvent.Sender.Id, webhookEvent.Timestamp)
+	}
+
+	if (webhookEvent.Referral != messenger_entities.WebhookReferral{}) {
+		return fmt.Sprintf("referral:%v:%v", webhookEvent.Sender.Id, webhookEvent.Timestamp)
+	}
+
+	return ""
+}
+
 func (m *MessageHandler) HandleMessengerWebhookMessage(context echo.Context, senderPsId string, event messenger_entities.WebhookMessage) error {
-	// Grab userId from the senderPsId
-	userId, err := m.userService.GetUserIdFromSenderPsId(context, senderPsId)
+	// New users can message us their invite code before ever pressing Get Started
+	userId, err := m.getOrCreateUserId(context, senderPsId)
 	if err != nil {
 		return err
 	}
@@ -158,23 +243,17 @@ func (m *MessageHandler) HandleMessengerWebhookPostback(context echo.Context, se
 	// New user initialization type
 	switch event.Payload {
 	case "user_joined":
-		// Initialize new userId
-		userId := uuid.New()
-		leagueId := constants.LEAGUE_ID
-
-		err := m.userService.InitializeUser(context, userId, senderPsId, "[add-name]")
+		userId, err := m.getOrCreateUserId(context, senderPsId)
 		if err != nil {
 			return err
 		}
 
-		// Join the league
-		err = m.leagueService.AddUserToLeague(context, userId, leagueId)
-		if err != nil {
-			return err
+		// Users coming in from an m.me invite link carry the invite code
+		if event.Referral.Ref == "" {
+			break
 		}
 
-		// Add starting funds to their wallet
-		_, err = m.userService.AddFundsToUserWallet(context, userId, leagueId, constants.STARTING_WALLET_AMOUNT)
+		err = m.messageService.JoinLeagueWithInviteCode(context, userId, event.Referral.Ref)
 		if err != nil {
 			return err
 		}
@@ -185,170 +264,111 @@ func (m *MessageHandler) HandleMessengerWebhookPostback(context echo.Context, se
 	return nil
 }
 
-func (m *MessageHandler) HandleMessengerWebhookRead(context echo.Context, senderPsId string, event messenger_entities.WebhookRead) error {
-	return nil
-}
-
-func (m *MessageHandler) SendWinningBids(context echo.Context) error {
-	auctionId, err := m.auctionService.GetCurrentAuctionIdByLeagueId(context, constants.LEAGUE_ID)
-	if err != nil {
-		return utils.JSONError(context, err)
+// HandleMessengerWebhookReferral joins users who open an m.me invite link
+// after they've already started talking to us
+func (m *MessageHandler) HandleMessengerWebhookReferral(context echo.Context, senderPsId string, event messenger_entities.WebhookReferral) error {
+	if event.Ref == "" {
+		return nil
 	}
 
-	auctionResults, err := m.auctionService.GetAuctionResults(context, auctionId)
+	userId, err := m.getOrCreateUserId(context, senderPsId)
 	if err != nil {
-		return utils.JSONError(context, err)
+		return err
 	}
 
-	// For each winning bid, create a success response for it
-	playerEvents := make([]messenger_entities.SendEvent, 0)
-	for _, winningBids := range auctionResults {
-		if len(winningBids) > 1 {
-			// TODO: handle tie case
-		}
-
-		winningBid := winningBids[0]
-
-		playerEvent, err := m.messageService.CreateWinningBidForPlayerEvent(context, winningBid)
-		if err != nil {
-			return utils.JSONError(context, err)
-		}
-
-		playerEvent, err = m.attachSenderToEvent(context, winningBid.UserId, playerEvent)
-		if err != nil {
-			return utils.JSONError(context, err)
-		}
-
-		playerEvent = m.attachConnectionTagToEvent(context, playerEvent)
+	return m.messageService.JoinLeagueWithInviteCode(context, userId, event.Ref)
+}
 
-		playerEvents = append(playerEvents, playerEvent)
+// getOrCreateUserId looks up the user behind the senderPsId, creating them if we haven't seen them before
+func (m *MessageHandler) getOrCreateUserId(context echo.Context, senderPsId string) (uuid.UUID, error) {
+	userId, err := m.userService.GetUserIdFromSenderPsId(context, senderPsId)
+	if err == nil {
+		return userId, nil
 	}
-
-	// Once all events are generated, send them out
-	errListMap := m.sendEvents(context, playerEvents)
-	errList := make([]interface{}, len(errListMap))
-	for index, err := range errList {
-		errList[index] = err
+	if !utils.IsNotFoundError(err) {
+		return uuid.Nil, err
 	}
-	if len(errListMap) > 0 {
-		newErr := utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to send winning bid events to users on messenger",
-			Args:    errList,
-			Err:     errors.New("error list"),
-		})
-		return utils.JSONError(context, newErr)
+
+	// Initialize new userId
+	userId = uuid.New()
+
+	err = m.userService.InitializeUser(context, userId, senderPsId, "[add-name]")
+	if err != nil {
+		return uuid.Nil, err
 	}
 
-	return context.JSON(http.StatusOK, "ok")
+	return userId, nil
 }
 
-func (m *MessageHandler) attachConnectionTagToEvent(context echo.Context, event messenger_entities.SendEvent) messenger_entities.SendEvent {
-	// Attached required tags to the event to make sure that we can keep
-	// sending the user messages after 24 hours
-	event.Tag = constants.CONFIRM_TAG_UPDATE
-	return event
+func (m *MessageHandler) HandleMessengerWebhookRead(context echo.Context, senderPsId string, event messenger_entities.WebhookRead) error {
+	return nil
 }
 
-func (m *MessageHandler) SendPlayersForBidding(context echo.Context) error {
-	auctionId, err := m.auctionService.GetCurrentAuctionIdByLeagueId(context, constants.LEAGUE_ID)
+func (m *MessageHandler) SendWinningBids(context echo.Context) error {
+	leagueId, err := m.getLeagueIdFromBody(context)
 	if err != nil {
 		return utils.JSONError(context, err)
 	}
 
-	sendEvents, err := m.messageService.CreateBidsForAuction(context, auctionId)
+	auctionId, err := m.auctionService.GetCurrentAuctionIdByLeagueId(context, leagueId)
 	if err != nil {
 		return utils.JSONError(context, err)
 	}
 
-	for index, sendEvent := range sendEvents {
-		sendEvent = m.attachConnectionTagToEvent(context, sendEvent)
-		sendEvents[index] = sendEvent
-	}
-
-	// Once all events are generated, send them out
-	errListMap := m.sendEvents(context, sendEvents)
-	errList := make([]interface{}, len(errListMap))
-	for index, err := range errList {
-		errList[index] = err
-	}
-	if len(errListMap) > 0 {
-		newErr := utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to send auction bid events to users on messenger",
-			Args:    errList,
-			Err:     errors.New("error list"),
-		})
-		return utils.JSONError(context, newErr)
+	err = m.messageService.SendWinningBidsForAuction(context, auctionId)
+	if err != nil {
+		return utils.JSONError(context, err)
 	}
 
 	return context.JSON(http.StatusOK, "ok")
 }
 
-func (m *MessageHandler) attachSenderToEvent(context echo.Context, userId uuid.UUID, event messenger_entities.SendEvent) (messenger_entities.SendEvent, error) {
-	senderPsId, err := m.userService.GetSenderPsIdFromUserId(context, userId)
+func (m *MessageHandler) SendPlayersForBidding(context echo.Context) error {
+	leagueId, err := m.getLeagueIdFromBody(context)
 	if err != nil {
-		return messenger_entities.SendEvent{}, err
+		return utils.JSONError(context, err)
 	}
 
-	// Attach intended sender the event should be directed towards
-	event.Recipient = messenger_entities.Id{
-		Id: senderPsId,
+	auctionId, err := m.auctionService.GetCurrentAuctionIdByLeagueId(context, leagueId)
+	if err != nil {
+		return utils.JSONError(context, err)
 	}
 
-	return event, nil
+	err = m.messageService.SendPlayersForBiddingForAuction(context, auctionId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, "ok")
 }
 
-func (m *MessageHandler) sendEvents(context echo.Context, sendEvents []messenger_entities.SendEvent) map[string]error {
-	postURL := fmt.Sprintf("https://graph.facebook.com/v12.0/me/messages?access_token=%v", m.config.GetMessengerConfig().AccessToken)
-
-	errors := make(map[string]error)
-	for _, sendEvent := range sendEvents {
-		sendEventJSON, _ := json.Marshal(sendEvent)
-
-		rawResp, httpErr := http.Post(postURL, "application/json", bytes.NewBuffer(sendEventJSON))
-		context.Logger().Infof("response: %+v, error: %+v", rawResp, httpErr)
-
-		if httpErr != nil {
-			newHttpErr := utils.NewError(utils.ErrorParams{
-				Code:    http.StatusBadRequest,
-				Message: "failed to post send event request",
-				Args: []interface{}{
-					"sendEventJson", string(sendEventJSON),
-				},
-				Err: httpErr,
-			})
-			errors[sendEvent.Recipient.Id] = newHttpErr
-			continue
-		}
+// getLeagueIdFromBody pulls the league the request is acting on out of the body,
+// as long as the caller is one of its commissioners
+func (m *MessageHandler) getLeagueIdFromBody(context echo.Context) (uuid.UUID, error) {
+	var body entities.Auction
 
-		var resp messenger_entities.SendEventResponse
-		decodeErr := json.NewDecoder(rawResp.Body).Decode(&resp)
-		if decodeErr != nil {
-			newDecodeErr := utils.NewError(utils.ErrorParams{
-				Code:    http.StatusBadRequest,
-				Message: "failed to decode send event request",
-				Err:     httpErr,
-			})
-			errors[sendEvent.Recipient.Id] = newDecodeErr
-			continue
-		}
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode league body",
+			Err:     err,
+		})
+	}
 
-		// If the Messenger SendAPI returns an error, give us a heads up
-		if resp.Error.Code > 0 {
-			respErr := utils.NewError(utils.ErrorParams{
-				Code:    http.StatusBadRequest,
-				Message: "failed to post send event request",
-				Args: []interface{}{
-					"error", resp.Error,
-				},
-			})
-			errors[sendEvent.Recipient.Id] = respErr
-			continue
-		}
+	if body.LeagueId == uuid.Nil {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "league id is required",
+			Err:     nil,
+		})
+	}
 
-		defer rawResp.Body.Close()
+	// Only the league's commissioners can message its members
+	err = m.authService.RequireLeagueRole(context, body.LeagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+	if err != nil {
+		return uuid.Nil, err
 	}
 
-	return errors
+	return body.LeagueId, nil
 }
@@ -0,0 +1,227 @@
+package message
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	auction_repo "github.com/wilbertthelam/prop-ock/repos/auction"
+	invite_repo "github.com/wilbertthelam/prop-ock/repos/invite"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	member_repo "github.com/wilbertthelam/prop-ock/repos/member"
+	message_repo "github.com/wilbertthelam/prop-ock/repos/message"
+	player_repo "github.com/wilbertthelam/prop-ock/repos/player"
+	player_set_repo "github.com/wilbertthelam/prop-ock/repos/player_set"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	schedule_repo "github.com/wilbertthelam/prop-ock/repos/schedule"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	auction_service "github.com/wilbertthelam/prop-ock/services/auction"
+	auth_service "github.com/wilbertthelam/prop-ock/services/auth"
+	callups_service "github.com/wilbertthelam/prop-ock/services/callups"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+	invite_service "github.com/wilbertthelam/prop-ock/services/invite"
+	league_service "github.com/wilbertthelam/prop-ock/services/league"
+	message_service "github.com/wilbertthelam/prop-ock/services/message"
+	player_service "github.com/wilbertthelam/prop-ock/services/player"
+	player_set_service "github.com/wilbertthelam/prop-ock/services/player_set"
+	roster_service "github.com/wilbertthelam/prop-ock/services/roster"
+	user_service "github.com/wilbertthelam/prop-ock/services/user"
+)
+
+const testAppSecret = "test_app_secret"
+
+func TestProcessMessengerWebhookSignature(t *testing.T) {
+	body := readFixture(t, "message_event.json")
+
+	tests := []struct {
+		name              string
+		signatureHeader   string
+		expectedCode      int
+		expectedSendCount int
+	}{
+		{"valid signature", signBody(body, testAppSecret), http.StatusOK, 1},
+		{"missing header", "", http.StatusForbidden, 0},
+		{"mismatched signature", signBody(body, "another_secret"), http.StatusForbidden, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := newTestMessageHandler()
+			sendApi := stubSendApi(t)
+
+			recorder := postWebhook(t, handler, body, test.signatureHeader)
+
+			if recorder.Code != test.expectedCode {
+				t.Errorf("responded %v, expected %v: %v", recorder.Code, test.expectedCode, recorder.Body.String())
+			}
+
+			if sendApi.getSendCount() != test.expectedSendCount {
+				t.Errorf("sent %v replies, expected %v", sendApi.getSendCount(), test.expectedSendCount)
+			}
+		})
+	}
+}
+
+func TestProcessMessengerWebhookSkipsDuplicateMids(t *testing.T) {
+	t.Run("redelivered webhook", func(t *testing.T) {
+		handler := newTestMessageHandler()
+		sendApi := stubSendApi(t)
+		body := readFixture(t, "message_event.json")
+
+		for delivery := 0; delivery < 2; delivery++ {
+			recorder := postWebhook(t, handler, body, signBody(body, testAppSecret))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("delivery %v responded %v: %v", delivery, recorder.Code, recorder.Body.String())
+			}
+		}
+
+		if sendApi.getSendCount() != 1 {
+			t.Errorf("sent %v replies, expected 1", sendApi.getSendCount())
+		}
+	})
+
+	t.Run("same mid twice in one batch", func(t *testing.T) {
+		handler := newTestMessageHandler()
+		sendApi := stubSendApi(t)
+		body := readFixture(t, "redelivered_message_events.json")
+
+		recorder := postWebhook(t, handler, body, signBody(body, testAppSecret))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("responded %v: %v", recorder.Code, recorder.Body.String())
+		}
+
+		if sendApi.getSendCount() != 1 {
+			t.Errorf("sent %v replies, expected 1", sendApi.getSendCount())
+		}
+	})
+}
+
+// newTestMessageHandler wires up the handler the same way the server does, on the memory backend
+func newTestMessageHandler() *MessageHandler {
+	config := &config_service.Config{
+		Messenger: config_service.Messenger{
+			AppSecret: testAppSecret,
+		},
+		Storage: config_service.Storage{
+			Backend: config_service.STORAGE_BACKEND_MEMORY,
+		},
+	}
+
+	client := redis_client.New(config)
+	memoryStore := redis_client.NewMemoryStore()
+	sqlClient := redis_client.NewSqlClient(config)
+
+	userRepo := user_repo.New(config, client, memoryStore, sqlClient)
+	leagueService := league_service.New(league_repo.New(config, client, memoryStore, sqlClient), member_repo.New(config, client, memoryStore, sqlClient))
+	userService := user_service.New(userRepo, leagueService)
+	playerService := player_service.New(player_repo.New(config, client, memoryStore, sqlClient))
+	rosterService := roster_service.New(roster_repo.New(config, client, memoryStore, sqlClient), leagueService)
+	playerSetService := player_set_service.New(player_set_repo.New(config, client, memoryStore, sqlClient), leagueService, playerService, rosterService)
+	auctionService := auction_service.New(
+		auction_repo.New(config, client, memoryStore, sqlClient),
+		schedule_repo.New(config, client, memoryStore, sqlClient),
+		userService,
+		playerService,
+		playerSetService,
+		leagueService,
+		rosterService,
+	)
+	inviteService := invite_service.New(invite_repo.New(config, client, memoryStore, sqlClient), leagueService, userService, config)
+	authService := auth_service.New(userService, leagueService, config)
+	messageService := message_service.New(
+		message_repo.New(config, client, memoryStore, sqlClient),
+		auctionService,
+		userService,
+		playerService,
+		playerSetService,
+		leagueService,
+		inviteService,
+		authService,
+		config,
+	)
+
+	return New(auctionService, callups_service.New(client), userService, leagueService, messageService, config, authService)
+}
+
+// sendApiStub counts the replies posted to the Messenger Send API instead of sending them
+type sendApiStub struct {
+	mutex     sync.Mutex
+	sendCount int
+}
+
+// stubSendApi swaps the transport the Send API is called through until the test ends
+func stubSendApi(t *testing.T) *sendApiStub {
+	sendApi := &sendApiStub{}
+
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = sendApi
+	t.Cleanup(func() {
+		http.DefaultTransport = defaultTransport
+	})
+
+	return sendApi
+}
+
+func (s *sendApiStub) RoundTrip(request *http.Request) (*http.Response, error) {
+	s.mutex.Lock()
+	s.sendCount++
+	s.mutex.Unlock()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"recipient_id":"4379205498814127","message_id":"m_reply"}`)),
+		Request:    request,
+	}, nil
+}
+
+func (s *sendApiStub) getSendCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.sendCount
+}
+
+func postWebhook(t *testing.T, handler *MessageHandler, body []byte, signatureHeader string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/message/webhook", bytes.NewReader(body))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if signatureHeader != "" {
+		request.Header.Set("X-Hub-Signature-256", signatureHeader)
+	}
+
+	recorder := httptest.NewRecorder()
+	err := handler.ProcessMessengerWebhook(echo.New().NewContext(request, recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return recorder
+}
+
+// readFixture loads a webhook payload recorded from Messenger
+func readFixture(t *testing.T, name string) []byte {
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.TrimSpace(body)
+}
+
+func signBody(body []byte, appSecret string) string {
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
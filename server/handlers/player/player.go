@@ -1,26 +1,177 @@
 package player
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auth_service "github.com/wilbertthelam/prop-ock/services/auth"
 	player_service "github.com/wilbertthelam/prop-ock/services/player"
+	"github.com/wilbertthelam/prop-ock/utils"
 )
 
 type PlayerHandler struct {
 	playerService *player_service.PlayerService
+	authService   *auth_service.AuthService
 }
 
-func New(playerService *player_service.PlayerService) *PlayerHandler {
+func New(
+	playerService *player_service.PlayerService,
+	authService *auth_service.AuthService,
+) *PlayerHandler {
 	return &PlayerHandler{
 		playerService,
+		authService,
 	}
 }
 
 func (p *PlayerHandler) GetPlayer(context echo.Context) error {
-	player, err := p.playerService.GetPlayerByPlayerId(context, context.QueryParam("player_id"))
+	playerId := context.QueryParam("player_id")
+
+	player, err := p.playerService.GetPlayerByPlayerId(context, playerId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	if player.Id == "" {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "no player found",
+			Args: []interface{}{
+				"playerId", playerId,
+			},
+			Err: nil,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	return context.JSON(http.StatusOK, player)
+}
+
+func (p *PlayerHandler) GetAllPlayers(context echo.Context) error {
+	players, err := p.playerService.GetAllPlayers(context)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, players)
+}
+
+func (p *PlayerHandler) SearchPlayers(context echo.Context) error {
+	players, err := p.playerService.SearchPlayers(
+		context,
+		context.QueryParam("name"),
+		context.QueryParam("team"),
+		context.QueryParam("position"),
+	)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, players)
+}
+
+func (p *PlayerHandler) CreatePlayer(context echo.Context) error {
+	var body entities.Player
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode create player body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = p.authService.RequireAdmin(context)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	player, err := p.playerService.CreatePlayer(context, body)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, player)
+}
+
+func (p *PlayerHandler) UpdatePlayer(context echo.Context) error {
+	var body entities.Player
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode update player body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = p.authService.RequireAdmin(context)
 	if err != nil {
-		return context.JSON(http.StatusInternalServerError, err.Error())
+		return utils.JSONError(context, err)
 	}
+
+	player, err := p.playerService.UpdatePlayer(context, body)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
 	return context.JSON(http.StatusOK, player)
 }
+
+func (p *PlayerHandler) DeletePlayer(context echo.Context) error {
+	var body entities.Player
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode delete player body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = p.authService.RequireAdmin(context)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	err = p.playerService.DeletePlayer(context, body.Id)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, "delete player successful")
+}
+
+func (p *PlayerHandler) BulkUpsertPlayers(context echo.Context) error {
+	var body []entities.Player
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode bulk upsert players body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = p.authService.RequireAdmin(context)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	err = p.playerService.BulkUpsertPlayers(context, body)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, "bulk upsert players successful")
+}
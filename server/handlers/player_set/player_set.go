@@ -0,0 +1,160 @@
+package player_set
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auth_service "github.com/wilbertthelam/prop-ock/services/auth"
+	player_set_service "github.com/wilbertthelam/prop-ock/services/player_set"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type PlayerSetHandler struct {
+	playerSetService *player_set_service.PlayerSetService
+	authService      *auth_service.AuthService
+}
+
+func New(
+	playerSetService *player_set_service.PlayerSetService,
+	authService *auth_service.AuthService,
+) *PlayerSetHandler {
+	return &PlayerSetHandler{
+		playerSetService,
+		authService,
+	}
+}
+
+func (p *PlayerSetHandler) GetPlayerSet(context echo.Context) error {
+	playerSetId, err := uuid.Parse(context.QueryParam("player_set_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get player set params",
+			Args: []interface{}{
+				"playerSetId", context.QueryParam("player_set_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	playerSet, err := p.playerSetService.GetPlayerSetByPlayerSetId(context, playerSetId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, playerSet)
+}
+
+func (p *PlayerSetHandler) GetPlayerSetsForLeague(context echo.Context) error {
+	leagueId, err := uuid.Parse(context.QueryParam("league_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get player sets for league params",
+			Args: []interface{}{
+				"leagueId", context.QueryParam("league_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	playerSets, err := p.playerSetService.GetPlayerSetsByLeagueId(context, leagueId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, playerSets)
+}
+
+func (p *PlayerSetHandler) CreatePlayerSet(context echo.Context) error {
+	var body entities.PlayerSet
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode create player set body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = p.authService.RequireLeagueRole(context, body.LeagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	playerSet, err := p.playerSetService.CreatePlayerSet(context, body.LeagueId, body.Name, body.PlayerIds)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, playerSet)
+}
+
+func (p *PlayerSetHandler) UpdatePlayerSet(context echo.Context) error {
+	var body entities.PlayerSet
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode update player set body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = p.authorizePlayerSetCommissioner(context, body.Id)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	playerSet, err := p.playerSetService.UpdatePlayerSet(context, body.Id, body.Name, body.PlayerIds)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, playerSet)
+}
+
+func (p *PlayerSetHandler) DeletePlayerSet(context echo.Context) error {
+	var body entities.PlayerSet
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode delete player set body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = p.authorizePlayerSetCommissioner(context, body.Id)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	err = p.playerSetService.DeletePlayerSet(context, body.Id)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, "delete player set successful")
+}
+
+// authorizePlayerSetCommissioner makes sure only the commissioners of the player set's league can change it
+func (p *PlayerSetHandler) authorizePlayerSetCommissioner(context echo.Context, playerSetId uuid.UUID) error {
+	playerSet, err := p.playerSetService.GetPlayerSetByPlayerSetId(context, playerSetId)
+	if err != nil {
+		return err
+	}
+
+	return p.authService.RequireLeagueRole(context, playerSet.LeagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+}
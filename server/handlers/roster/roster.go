@@ -0,0 +1,150 @@
+package roster
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auth_service "github.com/wilbertthelam/prop-ock/services/auth"
+	roster_service "github.com/wilbertthelam/prop-ock/services/roster"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RosterHandler struct {
+	rosterService *roster_service.RosterService
+	authService   *auth_service.AuthService
+}
+
+func New(
+	rosterService *roster_service.RosterService,
+	authService *auth_service.AuthService,
+) *RosterHandler {
+	return &RosterHandler{
+		rosterService,
+		authService,
+	}
+}
+
+func (r *RosterHandler) GetRoster(context echo.Context) error {
+	leagueId, err := uuid.Parse(context.QueryParam("league_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get roster params",
+			Args: []interface{}{
+				"leagueId", context.QueryParam("league_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	userId, err := uuid.Parse(context.QueryParam("user_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get roster params",
+			Args: []interface{}{
+				"userId", context.QueryParam("user_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	roster, err := r.rosterService.GetRoster(context, leagueId, userId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, roster)
+}
+
+func (r *RosterHandler) GetRostersForLeague(context echo.Context) error {
+	leagueId, err := uuid.Parse(context.QueryParam("league_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get rosters for league params",
+			Args: []interface{}{
+				"leagueId", context.QueryParam("league_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	rosters, err := r.rosterService.GetRostersForLeague(context, leagueId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, rosters)
+}
+
+func (r *RosterHandler) GetPlayerOwner(context echo.Context) error {
+	leagueId, err := uuid.Parse(context.QueryParam("league_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get player owner params",
+			Args: []interface{}{
+				"leagueId", context.QueryParam("league_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	playerId := context.QueryParam("player_id")
+
+	ownerId, err := r.rosterService.GetPlayerOwner(context, leagueId, playerId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	if ownerId == uuid.Nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "player is not owned by anyone in this league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"playerId", playerId,
+			},
+			Err: nil,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	return context.JSON(http.StatusOK, ownerId)
+}
+
+func (r *RosterHandler) ReleasePlayer(context echo.Context) error {
+	var body entities.RosterPlayer
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode release player body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = r.authService.RequireUser(context, body.UserId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	refund, err := r.rosterService.ReleasePlayer(context, body.LeagueId, body.UserId, body.PlayerId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, map[string]int64{
+		"refund": refund,
+	})
+}
@@ -0,0 +1,209 @@
+package trade
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auth_service "github.com/wilbertthelam/prop-ock/services/auth"
+	trade_service "github.com/wilbertthelam/prop-ock/services/trade"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type TradeHandler struct {
+	tradeService *trade_service.TradeService
+	authService  *auth_service.AuthService
+}
+
+func New(
+	tradeService *trade_service.TradeService,
+	authService *auth_service.AuthService,
+) *TradeHandler {
+	return &TradeHandler{
+		tradeService,
+		authService,
+	}
+}
+
+func (t *TradeHandler) GetTrade(context echo.Context) error {
+	tradeId, err := uuid.Parse(context.QueryParam("trade_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get trade params",
+			Args: []interface{}{
+				"tradeId", context.QueryParam("trade_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	trade, err := t.tradeService.GetTradeByTradeId(context, tradeId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, trade)
+}
+
+func (t *TradeHandler) GetTradesForLeague(context echo.Context) error {
+	leagueId, err := uuid.Parse(context.QueryParam("league_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get trades for league params",
+			Args: []interface{}{
+				"leagueId", context.QueryParam("league_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	trades, err := t.tradeService.GetTradesForLeague(context, leagueId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, trades)
+}
+
+func (t *TradeHandler) ProposeTrade(context echo.Context) error {
+	var body entities.Trade
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode propose trade body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = t.authService.RequireUser(context, body.ProposerId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	trade, err := t.tradeService.ProposeTrade(context, body)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, trade)
+}
+
+// CounterTrade takes the counter offer's terms from the countering user's side,
+// with counter_of_trade_id set to the trade being countered
+func (t *TradeHandler) CounterTrade(context echo.Context) error {
+	var body entities.Trade
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode counter trade body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = t.authService.RequireUser(context, body.ProposerId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	trade, err := t.tradeService.CounterTrade(context, body)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, trade)
+}
+
+func (t *TradeHandler) AcceptTrade(context echo.Context) error {
+	var body entities.TradeResponse
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode accept trade body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = t.authService.RequireUser(context, body.UserId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	trade, err := t.tradeService.AcceptTrade(context, body.TradeId, body.UserId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, trade)
+}
+
+func (t *TradeHandler) RejectTrade(context echo.Context) error {
+	var body entities.TradeResponse
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode reject trade body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = t.authService.RequireUser(context, body.UserId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	trade, err := t.tradeService.RejectTrade(context, body.TradeId, body.UserId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, trade)
+}
+
+func (t *TradeHandler) VetoTrade(context echo.Context) error {
+	var body entities.TradeResponse
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode veto trade body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	trade, err := t.tradeService.GetTradeByTradeId(context, body.TradeId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	err = t.authService.RequireLeagueRole(context, trade.LeagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	trade, err = t.tradeService.VetoTrade(context, body.TradeId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, trade)
+}
@@ -0,0 +1,160 @@
+package wallet
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auth_service "github.com/wilbertthelam/prop-ock/services/auth"
+	user_service "github.com/wilbertthelam/prop-ock/services/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type WalletHandler struct {
+	userService *user_service.UserService
+	authService *auth_service.AuthService
+}
+
+func New(
+	userService *user_service.UserService,
+	authService *auth_service.AuthService,
+) *WalletHandler {
+	return &WalletHandler{
+		userService,
+		authService,
+	}
+}
+
+// GetWalletHistory returns the user's wallet ledger to the user or the league's commissioner.
+// Leaving out league_id returns the history across all of the user's leagues, to the user only.
+func (w *WalletHandler) GetWalletHistory(context echo.Context) error {
+	userId, err := uuid.Parse(context.QueryParam("user_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get wallet history params",
+			Args: []interface{}{
+				"userId", context.QueryParam("user_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	leagueId := uuid.Nil
+	if context.QueryParam("league_id") != "" {
+		leagueId, err = uuid.Parse(context.QueryParam("league_id"))
+		if err != nil {
+			newErr := utils.NewError(utils.ErrorParams{
+				Code:    http.StatusBadRequest,
+				Message: "failed to get wallet history params",
+				Args: []interface{}{
+					"leagueId", context.QueryParam("league_id"),
+				},
+				Err: err,
+			})
+			return utils.JSONError(context, newErr)
+		}
+	}
+
+	// Commissioners can only see the history in their own league
+	if leagueId == uuid.Nil {
+		err = w.authService.RequireUser(context, userId)
+	} else {
+		err = w.authService.RequireUserOrLeagueRole(context, userId, leagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+	}
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	transactions, err := w.userService.GetWalletHistory(context, userId, leagueId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, transactions)
+}
+
+// ReconcileWallets checks every wallet in the league against its ledger for the league's
+// commissioner, or only the given user's wallet if user_id is passed in, for the user too
+func (w *WalletHandler) ReconcileWallets(context echo.Context) error {
+	leagueId, err := uuid.Parse(context.QueryParam("league_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get reconcile wallets params",
+			Args: []interface{}{
+				"leagueId", context.QueryParam("league_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	if context.QueryParam("user_id") == "" {
+		err = w.authService.RequireLeagueRole(context, leagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+		if err != nil {
+			return utils.JSONError(context, err)
+		}
+
+		reconciliations, err := w.userService.ReconcileLeagueWallets(context, leagueId)
+		if err != nil {
+			return utils.JSONError(context, err)
+		}
+
+		return context.JSON(http.StatusOK, reconciliations)
+	}
+
+	userId, err := uuid.Parse(context.QueryParam("user_id"))
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to get reconcile wallets params",
+			Args: []interface{}{
+				"userId", context.QueryParam("user_id"),
+			},
+			Err: err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = w.authService.RequireUserOrLeagueRole(context, userId, leagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	reconciliation, err := w.userService.ReconcileUserWallet(context, userId, leagueId)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, []entities.WalletReconciliation{reconciliation})
+}
+
+func (w *WalletHandler) AdjustWallet(context echo.Context) error {
+	var body entities.WalletTransaction
+
+	err := json.NewDecoder(context.Request().Body).Decode(&body)
+	if err != nil {
+		newErr := utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "failed to decode adjust wallet body",
+			Err:     err,
+		})
+		return utils.JSONError(context, newErr)
+	}
+
+	err = w.authService.RequireLeagueRole(context, body.LeagueId, entities.LEAGUE_ROLE_COMMISSIONER)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	updatedFunds, err := w.userService.AdjustUserWallet(context, body.UserId, body.LeagueId, body.Amount)
+	if err != nil {
+		return utils.JSONError(context, err)
+	}
+
+	return context.JSON(http.StatusOK, updatedFunds)
+}
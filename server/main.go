@@ -7,14 +7,28 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
 	"github.com/wilbertthelam/prop-ock/handlers/auction"
+	"github.com/wilbertthelam/prop-ock/handlers/auth"
 	"github.com/wilbertthelam/prop-ock/handlers/health"
+	"github.com/wilbertthelam/prop-ock/handlers/invite"
 	"github.com/wilbertthelam/prop-ock/handlers/league"
 	"github.com/wilbertthelam/prop-ock/handlers/message"
 	"github.com/wilbertthelam/prop-ock/handlers/player"
+	"github.com/wilbertthelam/prop-ock/handlers/player_set"
+	"github.com/wilbertthelam/prop-ock/handlers/roster"
+	"github.com/wilbertthelam/prop-ock/handlers/trade"
+	"github.com/wilbertthelam/prop-ock/handlers/wallet"
 	"github.com/wilbertthelam/prop-ock/handlers/webview"
+	migration_service "github.com/wilbertthelam/prop-ock/services/migration"
+	scheduler_service "github.com/wilbertthelam/prop-ock/services/scheduler"
+	"github.com/wilbertthelam/prop-ock/utils"
 )
 
 func main() {
+	// One-off commands like `prop-ock migrate` run instead of the server
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	// Get Port
 	port := os.Getenv("PORT")
 
@@ -35,46 +49,116 @@ func main() {
 
 	root := InitializeDependencyInjectedModules()
 
+	// Bring the Redis key schema up to date before anything reads from it
+	err := root.migrationService.RunStartupMigrations(utils.NewBackgroundContext(e))
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	// Requests that change anything need an admin API key or a user token
+	authenticate := root.authHandler.Authenticate
+
 	// Routes
 	e.GET("/health", root.healthHandler.GetHealthCheck)
 
+	// Auth
+	e.POST("/api/auth/token", root.authHandler.IssueToken, authenticate)
+
 	// Auction
-	e.POST("/api/auction/create", root.auctionHandler.CreateAuction)
-	e.POST("/api/auction/stop", root.auctionHandler.StopAuction)
+	e.POST("/api/auction/create", root.auctionHandler.CreateAuction, authenticate)
+	e.POST("/api/auction/stop", root.auctionHandler.StopAuction, authenticate)
 	e.POST("/api/auction/bid/make", root.auctionHandler.MakeBid)
 	e.POST("/api/auction/bid/cancel", root.auctionHandler.CancelBid)
 	e.GET("/api/auction/bid", root.auctionHandler.GetBid)
-	e.POST("/api/auction/process", root.auctionHandler.ProcessAuction)
+	e.POST("/api/auction/process", root.auctionHandler.ProcessAuction, authenticate)
 	e.GET("/api/auction/current", root.auctionHandler.GetCurrentAuctionForLeague)
 	e.GET("/api/auction/results", root.auctionHandler.GetAuctionResults)
 	// e.GET("/auction", root.auctionHandler.GetAuction)
 
 	// League
-	e.POST("/api/league/create", root.leagueHandler.CreateLeague)
+	e.GET("/api/league", root.leagueHandler.GetLeague)
+	e.GET("/api/league/user", root.leagueHandler.GetLeaguesForUser)
+	e.POST("/api/league/create", root.leagueHandler.CreateLeague, authenticate)
+	e.POST("/api/league/remove_user", root.leagueHandler.RemoveUserFromLeague, authenticate)
+	e.GET("/api/league/settings", root.leagueHandler.GetLeagueSettings)
+	e.PATCH("/api/league/settings", root.leagueHandler.UpdateLeagueSettings, authenticate)
+	e.GET("/api/league/roles", root.leagueHandler.GetLeagueRoles)
+	e.POST("/api/league/role", root.leagueHandler.SetLeagueRole, authenticate)
+	e.GET("/api/league/waiver_priority", root.leagueHandler.GetWaiverPriority)
 
 	// Players
 	e.GET("/api/player", root.playerHandler.GetPlayer)
+	e.GET("/api/player/list", root.playerHandler.GetAllPlayers)
+	e.GET("/api/player/search", root.playerHandler.SearchPlayers)
+	e.POST("/api/player/create", root.playerHandler.CreatePlayer, authenticate)
+	e.POST("/api/player/update", root.playerHandler.UpdatePlayer, authenticate)
+	e.POST("/api/player/delete", root.playerHandler.DeletePlayer, authenticate)
+	e.POST("/api/player/bulk", root.playerHandler.BulkUpsertPlayers, authenticate)
+
+	// Player sets
+	e.GET("/api/player_set", root.playerSetHandler.GetPlayerSet)
+	e.GET("/api/player_set/league", root.playerSetHandler.GetPlayerSetsForLeague)
+	e.POST("/api/player_set/create", root.playerSetHandler.CreatePlayerSet, authenticate)
+	e.POST("/api/player_set/update", root.playerSetHandler.UpdatePlayerSet, authenticate)
+	e.POST("/api/player_set/delete", root.playerSetHandler.DeletePlayerSet, authenticate)
+
+	// Rosters
+	e.GET("/api/roster", root.rosterHandler.GetRoster)
+	e.GET("/api/roster/league", root.rosterHandler.GetRostersForLeague)
+	e.GET("/api/roster/owner", root.rosterHandler.GetPlayerOwner)
+	e.POST("/api/roster/release", root.rosterHandler.ReleasePlayer, authenticate)
+
+	// Trades
+	e.GET("/api/trade", root.tradeHandler.GetTrade)
+	e.GET("/api/trade/league", root.tradeHandler.GetTradesForLeague)
+	e.POST("/api/trade/propose", root.tradeHandler.ProposeTrade, authenticate)
+	e.POST("/api/trade/counter", root.tradeHandler.CounterTrade, authenticate)
+	e.POST("/api/trade/accept", root.tradeHandler.AcceptTrade, authenticate)
+	e.POST("/api/trade/reject", root.tradeHandler.RejectTrade, authenticate)
+	e.POST("/api/trade/veto", root.tradeHandler.VetoTrade, authenticate)
+
+	// Invites
+	e.GET("/api/invite/league", root.inviteHandler.GetInvitesForLeague, authenticate)
+	e.POST("/api/invite/create", root.inviteHandler.CreateInvite, authenticate)
+	e.POST("/api/invite/revoke", root.inviteHandler.RevokeInvite, authenticate)
+
+	// Wallets
+	e.GET("/api/wallet/history", root.walletHandler.GetWalletHistory, authenticate)
+	e.GET("/api/wallet/reconcile", root.walletHandler.ReconcileWallets, authenticate)
+	e.POST("/api/wallet/adjust", root.walletHandler.AdjustWallet, authenticate)
 
 	// Messenger
-	e.POST("/message/auction/players", root.messageHandler.SendPlayersForBidding)
-	e.POST("/message/auction/results", root.messageHandler.SendWinningBids)
+	e.POST("/message/auction/players", root.messageHandler.SendPlayersForBidding, authenticate)
+	e.POST("/message/auction/results", root.messageHandler.SendWinningBids, authenticate)
 	e.GET("/message/webhook", root.messageHandler.VerifyMessengerWebhook)
 	e.POST("/message/webhook", root.messageHandler.ProcessMessengerWebhook)
 
 	// Webview
 	e.Static("/webview/bid", "../client/public")
 
+	// Background jobs
+	root.schedulerService.Start(e)
+
 	// Start server
 	e.Logger.Fatal(e.Start(":" + port))
 }
 
 type Root struct {
-	healthHandler  *health.HealthHandler
-	messageHandler *message.MessageHandler
-	webviewHandler *webview.WebviewHandler
-	auctionHandler *auction.AuctionHandler
-	leagueHandler  *league.LeagueHandler
-	playerHandler  *player.PlayerHandler
+	healthHandler    *health.HealthHandler
+	messageHandler   *message.MessageHandler
+	webviewHandler   *webview.WebviewHandler
+	auctionHandler   *auction.AuctionHandler
+	leagueHandler    *league.LeagueHandler
+	playerHandler    *player.PlayerHandler
+	playerSetHandler *player_set.PlayerSetHandler
+	walletHandler    *wallet.WalletHandler
+	rosterHandler    *roster.RosterHandler
+	tradeHandler     *trade.TradeHandler
+	inviteHandler    *invite.InviteHandler
+	authHandler      *auth.AuthHandler
+
+	schedulerService *scheduler_service.SchedulerService
+	migrationService *migration_service.MigrationService
 }
 
 func New(
@@ -84,6 +168,14 @@ func New(
 	auctionHandler *auction.AuctionHandler,
 	leagueHandler *league.LeagueHandler,
 	playerHandler *player.PlayerHandler,
+	playerSetHandler *player_set.PlayerSetHandler,
+	walletHandler *wallet.WalletHandler,
+	rosterHandler *roster.RosterHandler,
+	tradeHandler *trade.TradeHandler,
+	inviteHandler *invite.InviteHandler,
+	authHandler *auth.AuthHandler,
+	schedulerService *scheduler_service.SchedulerService,
+	migrationService *migration_service.MigrationService,
 ) *Root {
 	return &Root{
 		healthHandler,
@@ -92,5 +184,13 @@ func New(
 		auctionHandler,
 		leagueHandler,
 		playerHandler,
+		playerSetHandler,
+		walletHandler,
+		rosterHandler,
+		tradeHandler,
+		inviteHandler,
+		authHandler,
+		schedulerService,
+		migrationService,
 	}
 }
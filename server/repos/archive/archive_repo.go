@@ -0,0 +1,20 @@
+package archive_repo
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/entities"
+)
+
+// ArchiveExporter reads everything a store keeps into a portable archive
+type ArchiveExporter interface {
+	ExportArchive(context echo.Context) (entities.Archive, error)
+}
+
+// ArchiveImporter writes an archive into a store and counts what the store holds,
+// so the import can be checked against the archive it came from
+type ArchiveImporter interface {
+	// ImportArchive writes the whole archive or nothing at all.
+	// The store has to be empty, so an import can't be applied twice.
+	ImportArchive(context echo.Context, archive entities.Archive) error
+	GetArchiveSummary(context echo.Context) (entities.ArchiveSummary, error)
+}
@@ -0,0 +1,575 @@
+package archive_repo
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auction_repo "github.com/wilbertthelam/prop-ock/repos/auction"
+	invite_repo "github.com/wilbertthelam/prop-ock/repos/invite"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	player_repo "github.com/wilbertthelam/prop-ock/repos/player"
+	player_set_repo "github.com/wilbertthelam/prop-ock/repos/player_set"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	schedule_repo "github.com/wilbertthelam/prop-ock/repos/schedule"
+	trade_repo "github.com/wilbertthelam/prop-ock/repos/trade"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// How many keys to ask Redis for in each SCAN
+const redisScanCount = 1000
+
+// RedisArchiveRepo finds every league, auction, bid, result, wallet and user by scanning
+// their keys, then reads each one through the Redis repos so the parsing stays in one place
+type RedisArchiveRepo struct {
+	redisClient   *redis.Client
+	auctionRepo   auction_repo.AuctionRepo
+	inviteRepo    invite_repo.InviteRepo
+	leagueRepo    league_repo.LeagueRepo
+	playerRepo    player_repo.PlayerRepo
+	playerSetRepo player_set_repo.PlayerSetRepo
+	rosterRepo    roster_repo.RosterRepo
+	scheduleRepo  schedule_repo.ScheduleRepo
+	tradeRepo     trade_repo.TradeRepo
+	userRepo      user_repo.UserRepo
+}
+
+func NewRedis(redisClient *redis.Client) *RedisArchiveRepo {
+	return &RedisArchiveRepo{
+		redisClient,
+		auction_repo.NewRedis(redisClient),
+		invite_repo.NewRedis(redisClient),
+		league_repo.NewRedis(redisClient),
+		player_repo.NewRedis(redisClient),
+		player_set_repo.NewRedis(redisClient),
+		roster_repo.NewRedis(redisClient),
+		schedule_repo.NewRedis(redisClient),
+		trade_repo.NewRedis(redisClient),
+		user_repo.NewRedis(redisClient),
+	}
+}
+
+func (r *RedisArchiveRepo) ExportArchive(context echo.Context) (entities.Archive, error) {
+	archive := entities.Archive{
+		Version:    entities.ARCHIVE_VERSION,
+		ExportedAt: time.Now().UnixMilli(),
+	}
+
+	// Users are picked up from everything that points at them as well as their own keys,
+	// so bids and wallets from users without a user hash still have someone to belong to
+	userIds := make(map[uuid.UUID]struct{})
+
+	err := r.exportLeagues(context, &archive, userIds)
+	if err != nil {
+		return entities.Archive{}, err
+	}
+
+	err = r.exportPlayers(context, &archive)
+	if err != nil {
+		return entities.Archive{}, err
+	}
+
+	err = r.exportAuctions(context, &archive, userIds)
+	if err != nil {
+		return entities.Archive{}, err
+	}
+
+	archive.AuctionTransitions, err = r.scheduleRepo.GetDueAuctionTransitions(context, math.MaxInt64)
+	if err != nil {
+		return entities.Archive{}, err
+	}
+
+	err = r.exportUsers(context, &archive, userIds)
+	if err != nil {
+		return entities.Archive{}, err
+	}
+
+	return archive, nil
+}
+
+func (r *RedisArchiveRepo) exportLeagues(context echo.Context, archive *entities.Archive, userIds map[uuid.UUID]struct{}) error {
+	leagueIds, err := r.scanIds(context, redis_client.REDIS_LEAGUE_KEY)
+	if err != nil {
+		return err
+	}
+
+	scheduledTradeIds, err := r.tradeRepo.GetDueTradeIds(context, math.MaxInt64)
+	if err != nil {
+		return err
+	}
+
+	isTradeScheduled := make(map[uuid.UUID]bool)
+	for _, tradeId := range scheduledTradeIds {
+		isTradeScheduled[tradeId] = true
+	}
+
+	for _, leagueId := range leagueIds {
+		archivedLeague, err := r.exportLeague(context, leagueId)
+		if err != nil {
+			return err
+		}
+
+		for _, userId := range archivedLeague.League.Members {
+			userIds[userId] = struct{}{}
+		}
+		for userId := range archivedLeague.Roles {
+			userIds[userId] = struct{}{}
+		}
+
+		archive.Leagues = append(archive.Leagues, archivedLeague)
+
+		playerSetIds, err := r.playerSetRepo.GetPlayerSetIdsByLeagueId(context, leagueId)
+		if err != nil {
+			return err
+		}
+
+		for _, playerSetId := range sortIds(playerSetIds) {
+			playerSet, err := r.playerSetRepo.GetPlayerSetByPlayerSetId(context, playerSetId)
+			if err != nil {
+				return err
+			}
+
+			// Sets that were deleted can still be listed under the league
+			if playerSet.Id == uuid.Nil {
+				continue
+			}
+
+			archive.PlayerSets = append(archive.PlayerSets, playerSet)
+		}
+
+		codes, err := r.inviteRepo.GetInviteCodesForLeague(context, leagueId)
+		if err != nil {
+			return err
+		}
+
+		sort.Strings(codes)
+		for _, code := range codes {
+			invite, err := r.inviteRepo.GetInviteByCode(context, code)
+
+			// Redis drops invites once they expire, so there's nothing left to move
+			if utils.IsNotFoundError(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			archive.Invites = append(archive.Invites, invite)
+		}
+
+		tradeIds, err := r.tradeRepo.GetTradeIdsForLeague(context, leagueId)
+		if err != nil {
+			return err
+		}
+
+		for _, tradeId := range sortIds(tradeIds) {
+			trade, err := r.tradeRepo.GetTradeByTradeId(context, tradeId)
+			if err != nil {
+				return err
+			}
+
+			userIds[trade.ProposerId] = struct{}{}
+			userIds[trade.ReceiverId] = struct{}{}
+
+			archivedTrade := entities.ArchivedTrade{
+				Trade: trade,
+			}
+
+			// Trades are scheduled for when they expire until they're accepted,
+			// then for when they go through
+			if isTradeScheduled[tradeId] {
+				archivedTrade.ScheduledAt = trade.ExpiresAt
+				if trade.Status == entities.TRADE_STATUS_ACCEPTED {
+					archivedTrade.ScheduledAt = trade.ProcessAt
+				}
+			}
+
+			archive.Trades = append(archive.Trades, archivedTrade)
+		}
+
+		owners, err := r.rosterRepo.GetPlayerOwners(context, leagueId)
+		if err != nil {
+			return err
+		}
+
+		ownerIds := make(map[uuid.UUID]struct{})
+		for _, userId := range owners {
+			ownerIds[userId] = struct{}{}
+		}
+
+		for _, userId := range sortIdSet(ownerIds) {
+			userIds[userId] = struct{}{}
+
+			roster, err := r.rosterRepo.GetRoster(context, leagueId, userId)
+			if err != nil {
+				return err
+			}
+
+			archive.Rosters = append(archive.Rosters, roster...)
+		}
+	}
+
+	// Counter offers point at the trade they counter, so keep trades in the order they were made
+	sort.SliceStable(archive.Trades, func(i, j int) bool {
+		return archive.Trades[i].Trade.CreatedAt < archive.Trades[j].Trade.CreatedAt
+	})
+
+	return nil
+}
+
+func (r *RedisArchiveRepo) exportLeague(context echo.Context, leagueId uuid.UUID) (entities.ArchivedLeague, error) {
+	league, err := r.leagueRepo.GetLeagueByLeagueId(context, leagueId)
+	if err != nil {
+		return entities.ArchivedLeague{}, err
+	}
+
+	league.Members, err = r.leagueRepo.GetMembersInLeague(context, leagueId)
+	if err != nil {
+		return entities.ArchivedLeague{}, err
+	}
+
+	archivedLeague := entities.ArchivedLeague{
+		League: league,
+	}
+
+	archivedLeague.Settings, err = r.leagueRepo.GetLeagueSettings(context, leagueId)
+	if err != nil {
+		return entities.ArchivedLeague{}, err
+	}
+
+	archivedLeague.Roles, err = r.leagueRepo.GetLeagueRoles(context, leagueId)
+	if err != nil {
+		return entities.ArchivedLeague{}, err
+	}
+
+	archivedLeague.WaiverPriority, err = r.leagueRepo.GetWaiverPriority(context, leagueId)
+	if err != nil {
+		return entities.ArchivedLeague{}, err
+	}
+
+	archivedLeague.CurrentAuctionId, err = r.auctionRepo.GetCurrentAuctionIdByLeagueId(context, leagueId)
+	if err != nil && !utils.IsNotFoundError(err) {
+		return entities.ArchivedLeague{}, err
+	}
+
+	return archivedLeague, nil
+}
+
+func (r *RedisArchiveRepo) exportPlayers(context echo.Context, archive *entities.Archive) error {
+	playerIds, err := r.playerRepo.GetAllPlayerIds(context)
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(playerIds)
+
+	archive.Players, err = r.playerRepo.GetPlayersByPlayerIds(context, playerIds)
+	return err
+}
+
+func (r *RedisArchiveRepo) exportAuctions(context echo.Context, archive *entities.Archive, userIds map[uuid.UUID]struct{}) error {
+	auctionIds, err := r.scanIds(context, redis_client.REDIS_AUCTION_KEY)
+	if err != nil {
+		return err
+	}
+
+	auctionIndexes := make(map[uuid.UUID]int)
+	for _, auctionId := range auctionIds {
+		auction, err := r.auctionRepo.GetAuctionByAuctionId(context, auctionId)
+		if err != nil {
+			return err
+		}
+
+		auctionIndexes[auctionId] = len(archive.Auctions)
+		archive.Auctions = append(archive.Auctions, entities.ArchivedAuction{
+			Auction: auction,
+		})
+	}
+
+	bidKeys, err := r.scanKeys(context, redis_client.GetRedisKeyPattern(redis_client.REDIS_BID_KEY))
+	if err != nil {
+		return err
+	}
+
+	for _, bidKey := range bidKeys {
+		ids, err := redis_client.ParseRedisKeyIds(redis_client.REDIS_BID_KEY, bidKey)
+		if err != nil {
+			return newUnexpectedKeyError(bidKey, err)
+		}
+
+		auctionId, userId := ids[0], ids[1]
+
+		index, ok := auctionIndexes[auctionId]
+		if !ok {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "found bids for an auction that doesn't exist",
+				Args: []interface{}{
+					"key", bidKey,
+				},
+				Err: nil,
+			})
+		}
+
+		bids, err := r.exportBids(context, auctionId, userId)
+		if err != nil {
+			return err
+		}
+
+		userIds[userId] = struct{}{}
+		archive.Auctions[index].Bids = append(archive.Auctions[index].Bids, bids...)
+	}
+
+	for index := range archive.Auctions {
+		auctionId := archive.Auctions[index].Auction.Id
+
+		results, err := r.auctionRepo.GetAuctionResults(context, auctionId)
+		if err != nil {
+			return err
+		}
+
+		for _, result := range results {
+			userIds[result.WinningBid.UserId] = struct{}{}
+			for _, tiedBid := range result.TiedBids {
+				userIds[tiedBid.UserId] = struct{}{}
+			}
+		}
+
+		if len(results) > 0 {
+			archive.Auctions[index].Results = results
+		}
+
+		sort.Slice(archive.Auctions[index].Bids, func(i, j int) bool {
+			bids := archive.Auctions[index].Bids
+			if bids[i].Timestamp != bids[j].Timestamp {
+				return bids[i].Timestamp < bids[j].Timestamp
+			}
+
+			return bids[i].UserId.String()+bids[i].PlayerId < bids[j].UserId.String()+bids[j].PlayerId
+		})
+	}
+
+	return nil
+}
+
+func (r *RedisArchiveRepo) exportBids(context echo.Context, auctionId uuid.UUID, userId uuid.UUID) ([]entities.AuctionBid, error) {
+	bids, err := r.auctionRepo.GetAllUserBids(context, auctionId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamps, err := r.auctionRepo.GetAllUserBidTimestamps(context, auctionId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	auctionBids := make([]entities.AuctionBid, 0, len(bids))
+	for playerId, bid := range bids {
+		auctionBids = append(auctionBids, entities.AuctionBid{
+			AuctionId: auctionId,
+			UserId:    userId,
+			PlayerId:  playerId,
+			Bid:       bid,
+			Timestamp: timestamps[playerId],
+		})
+	}
+
+	return auctionBids, nil
+}
+
+func (r *RedisArchiveRepo) exportUsers(context echo.Context, archive *entities.Archive, userIds map[uuid.UUID]struct{}) error {
+	for _, format := range []string{
+		redis_client.REDIS_USER_KEY,
+		redis_client.REDIS_USER_WALLET_KEY,
+		redis_client.REDIS_USER_LEAGUES_KEY,
+	} {
+		scannedUserIds, err := r.scanIds(context, format)
+		if err != nil {
+			return err
+		}
+
+		for _, userId := range scannedUserIds {
+			userIds[userId] = struct{}{}
+		}
+	}
+
+	// Messenger ids are only kept as part of the relationship key
+	senderPsIdKeys, err := r.scanKeys(context, redis_client.GetRedisKeyPattern(redis_client.REDIS_SENDER_PS_ID_TO_USER_ID_KEY))
+	if err != nil {
+		return err
+	}
+
+	senderPsIds := make(map[uuid.UUID][]string)
+	for _, senderPsIdKey := range senderPsIdKeys {
+		keyIds, err := redis_client.ParseRedisKey(redis_client.REDIS_SENDER_PS_ID_TO_USER_ID_KEY, senderPsIdKey)
+		if err != nil {
+			return newUnexpectedKeyError(senderPsIdKey, err)
+		}
+
+		senderPsId := keyIds[0]
+
+		userId, err := r.userRepo.GetUserIdFromSenderPsId(context, senderPsId)
+		if err != nil {
+			return err
+		}
+
+		userIds[userId] = struct{}{}
+		senderPsIds[userId] = append(senderPsIds[userId], senderPsId)
+	}
+
+	delete(userIds, uuid.Nil)
+
+	for _, userId := range sortIdSet(userIds) {
+		archivedUser, err := r.exportUser(context, userId)
+		if err != nil {
+			return err
+		}
+
+		archivedUser.SenderPsIds = senderPsIds[userId]
+		sort.Strings(archivedUser.SenderPsIds)
+
+		archive.Users = append(archive.Users, archivedUser)
+	}
+
+	return nil
+}
+
+func (r *RedisArchiveRepo) exportUser(context echo.Context, userId uuid.UUID) (entities.ArchivedUser, error) {
+	user, err := r.userRepo.GetUserByUserId(context, userId)
+	if err != nil {
+		return entities.ArchivedUser{}, err
+	}
+
+	// Users only known from what points at them don't have a user hash
+	user.Id = userId
+
+	archivedUser := entities.ArchivedUser{
+		User: user,
+	}
+
+	wallet, err := r.userRepo.GetUserWallet(context, userId)
+	if err != nil {
+		return entities.ArchivedUser{}, err
+	}
+
+	archivedWallets, err := r.userRepo.GetArchivedUserWallets(context, userId)
+	if err != nil {
+		return entities.ArchivedUser{}, err
+	}
+
+	leagueIds := make(map[uuid.UUID]struct{})
+	for leagueId := range wallet {
+		leagueIds[leagueId] = struct{}{}
+	}
+	for leagueId := range archivedWallets {
+		leagueIds[leagueId] = struct{}{}
+	}
+
+	for _, leagueId := range sortIdSet(leagueIds) {
+		leagueWallet, ok := wallet[leagueId]
+		if ok {
+			archivedUser.Wallets = append(archivedUser.Wallets, leagueWallet)
+		}
+
+		archivedWallet, ok := archivedWallets[leagueId]
+		if ok {
+			archivedUser.ArchivedWallets = append(archivedUser.ArchivedWallets, archivedWallet)
+		}
+
+		transactions, err := r.userRepo.GetWalletTransactions(context, userId, leagueId)
+		if err != nil {
+			return entities.ArchivedUser{}, err
+		}
+
+		archivedUser.WalletTransactions = append(archivedUser.WalletTransactions, transactions...)
+	}
+
+	return archivedUser, nil
+}
+
+// scanKeys returns every key matching the pattern. SCAN walks the keyspace in
+// batches rather than blocking Redis like KEYS, but can return a key more than once.
+func (r *RedisArchiveRepo) scanKeys(context echo.Context, pattern string) ([]string, error) {
+	keySet := make(map[string]struct{})
+
+	iterator := r.redisClient.Scan(context.Request().Context(), 0, pattern, redisScanCount).Iterator()
+	for iterator.Next(context.Request().Context()) {
+		keySet[iterator.Val()] = struct{}{}
+	}
+
+	err := iterator.Err()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to scan keys",
+			Args: []interface{}{
+				"pattern", pattern,
+			},
+			Err: err,
+		})
+	}
+
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// scanIds returns the id of every key with the key format, which must have a single id
+func (r *RedisArchiveRepo) scanIds(context echo.Context, format string) ([]uuid.UUID, error) {
+	keys, err := r.scanKeys(context, redis_client.GetRedisKeyPattern(format))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(keys))
+	for _, key := range keys {
+		keyIds, err := redis_client.ParseRedisKeyIds(format, key)
+		if err != nil || len(keyIds) != 1 {
+			return nil, newUnexpectedKeyError(key, err)
+		}
+
+		ids = append(ids, keyIds[0])
+	}
+
+	return ids, nil
+}
+
+func newUnexpectedKeyError(key string, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to parse id from key",
+		Args: []interface{}{
+			"key", key,
+		},
+		Err: err,
+	})
+}
+
+// sortIds sorts the ids so archives come out the same way each time
+func sortIds(ids []uuid.UUID) []uuid.UUID {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+
+	return ids
+}
+
+func sortIdSet(idSet map[uuid.UUID]struct{}) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(idSet))
+	for id := range idSet {
+		ids = append(ids, id)
+	}
+
+	return sortIds(ids)
+}
@@ -0,0 +1,427 @@
+package archive_repo
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auction_repo "github.com/wilbertthelam/prop-ock/repos/auction"
+	invite_repo "github.com/wilbertthelam/prop-ock/repos/invite"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	player_repo "github.com/wilbertthelam/prop-ock/repos/player"
+	player_set_repo "github.com/wilbertthelam/prop-ock/repos/player_set"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	schedule_repo "github.com/wilbertthelam/prop-ock/repos/schedule"
+	trade_repo "github.com/wilbertthelam/prop-ock/repos/trade"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// Tables an archive is written into, in the order they're counted
+var archiveTables = []string{
+	"users",
+	"user_sender_ps_ids",
+	"leagues",
+	"league_settings",
+	"league_members",
+	"league_roles",
+	"waiver_priorities",
+	"league_current_auctions",
+	"players",
+	"player_sets",
+	"player_set_players",
+	"auctions",
+	"bids",
+	"auction_results",
+	"auction_result_tied_bids",
+	"auction_transitions",
+	"wallets",
+	"archived_wallets",
+	"wallet_transactions",
+	"rosters",
+	"trades",
+	"trade_players",
+	"trade_schedule",
+	"invites",
+}
+
+// SqlArchiveRepo writes archives through the SQL repos, going straight to the
+// tables only for bids and wallets, whose repo methods move funds as they write
+type SqlArchiveRepo struct {
+	sqlClient     *redis_client.SqlClient
+	auctionRepo   auction_repo.AuctionRepo
+	inviteRepo    invite_repo.InviteRepo
+	leagueRepo    league_repo.LeagueRepo
+	playerRepo    player_repo.PlayerRepo
+	playerSetRepo player_set_repo.PlayerSetRepo
+	rosterRepo    roster_repo.RosterRepo
+	scheduleRepo  schedule_repo.ScheduleRepo
+	tradeRepo     trade_repo.TradeRepo
+	userRepo      user_repo.UserRepo
+}
+
+func NewSql(sqlClient *redis_client.SqlClient) *SqlArchiveRepo {
+	return &SqlArchiveRepo{
+		sqlClient,
+		auction_repo.NewSql(sqlClient),
+		invite_repo.NewSql(sqlClient),
+		league_repo.NewSql(sqlClient),
+		player_repo.NewSql(sqlClient),
+		player_set_repo.NewSql(sqlClient),
+		roster_repo.NewSql(sqlClient),
+		schedule_repo.NewSql(sqlClient),
+		trade_repo.NewSql(sqlClient),
+		user_repo.NewSql(sqlClient),
+	}
+}
+
+// ImportArchive writes the whole archive or nothing at all.
+// The database has to be empty, so an import can't be applied twice.
+func (s *SqlArchiveRepo) ImportArchive(context echo.Context, archive entities.Archive) error {
+	return s.sqlClient.StartTransaction(context, func() error {
+		summary, err := s.GetArchiveSummary(context)
+		if err != nil {
+			return err
+		}
+
+		for _, table := range archiveTables {
+			if summary.Counts[table] > 0 {
+				return utils.NewError(utils.ErrorParams{
+					Code:    http.StatusConflict,
+					Message: "cannot import an archive into a database that already has data",
+					Args: []interface{}{
+						"table", table,
+						"count", fmt.Sprintf("%v", summary.Counts[table]),
+					},
+					Err: nil,
+				})
+			}
+		}
+
+		// Write parents before anything that points at them
+		for _, importStep := range []func(echo.Context, entities.Archive) error{
+			s.importUsers,
+			s.importLeagues,
+			s.importPlayers,
+			s.importAuctions,
+			s.importWallets,
+			s.importLeagueAssets,
+		} {
+			err = importStep(context, archive)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *SqlArchiveRepo) importUsers(context echo.Context, archive entities.Archive) error {
+	for _, archivedUser := range archive.Users {
+		err := s.userRepo.CreateUser(context, archivedUser.User.Id, archivedUser.User)
+		if err != nil {
+			return err
+		}
+
+		for _, senderPsId := range archivedUser.SenderPsIds {
+			err = s.userRepo.SetSenderPsIdToUserIdRelationship(context, senderPsId, archivedUser.User.Id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *SqlArchiveRepo) importLeagues(context echo.Context, archive entities.Archive) error {
+	for _, archivedLeague := range archive.Leagues {
+		leagueId := archivedLeague.League.Id
+
+		// Roles are imported with the members, so the league is created without an owner
+		err := s.leagueRepo.CreateLeague(context, leagueId, archivedLeague.League, archivedLeague.Settings, uuid.Nil)
+		if err != nil {
+			return err
+		}
+
+		for _, userId := range archivedLeague.League.Members {
+			err = s.leagueRepo.AddUserToLeague(context, userId, leagueId)
+			if err != nil {
+				return err
+			}
+		}
+
+		for userId, role := range archivedLeague.Roles {
+			err = s.leagueRepo.SetLeagueRole(context, leagueId, userId, role)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Moving each user to the back in turn rebuilds the order
+		for _, userId := range archivedLeague.WaiverPriority {
+			err = s.leagueRepo.MoveUserToBackOfWaiverPriority(context, leagueId, userId)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *SqlArchiveRepo) importPlayers(context echo.Context, archive entities.Archive) error {
+	err := s.playerRepo.UpsertPlayers(context, archive.Players)
+	if err != nil {
+		return err
+	}
+
+	for _, playerSet := range archive.PlayerSets {
+		err = s.playerSetRepo.UpsertPlayerSet(context, playerSet.Id, playerSet)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SqlArchiveRepo) importAuctions(context echo.Context, archive entities.Archive) error {
+	for _, archivedAuction := range archive.Auctions {
+		auctionId := archivedAuction.Auction.Id
+
+		err := s.auctionRepo.CreateAuction(context, auctionId, archivedAuction.Auction)
+		if err != nil {
+			return err
+		}
+
+		for _, bid := range archivedAuction.Bids {
+			_, err = s.sqlClient.Exec(
+				context,
+				"INSERT INTO bids (auction_id, user_id, player_id, bid, created_at) VALUES (?, ?, ?, ?, ?)",
+				auctionId,
+				bid.UserId,
+				bid.PlayerId,
+				bid.Bid,
+				bid.Timestamp,
+			)
+			if err != nil {
+				return newImportError("bid", auctionId, err)
+			}
+		}
+
+		if len(archivedAuction.Results) > 0 {
+			err = s.auctionRepo.SaveAuctionResult(context, auctionId, archivedAuction.Results)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, archivedLeague := range archive.Leagues {
+		if archivedLeague.CurrentAuctionId == uuid.Nil {
+			continue
+		}
+
+		err := s.auctionRepo.SetLeagueToAuctionRelationship(context, archivedLeague.League.Id, archivedLeague.CurrentAuctionId)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, transition := range archive.AuctionTransitions {
+		err := s.scheduleRepo.ScheduleAuctionTransition(context, transition.AuctionId, transition.Transition, transition.RunAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SqlArchiveRepo) importWallets(context echo.Context, archive entities.Archive) error {
+	for _, archivedUser := range archive.Users {
+		userId := archivedUser.User.Id
+
+		for _, table := range []struct {
+			name    string
+			wallets []entities.Wallet
+		}{
+			{"wallets", archivedUser.Wallets},
+			{"archived_wallets", archivedUser.ArchivedWallets},
+		} {
+			for _, wallet := range table.wallets {
+				_, err := s.sqlClient.Exec(
+					context,
+					fmt.Sprintf("INSERT INTO %v (user_id, league_id, available, held) VALUES (?, ?, ?, ?)", table.name),
+					userId,
+					wallet.LeagueId,
+					wallet.Available,
+					wallet.Held,
+				)
+				if err != nil {
+					return newImportError("wallet", userId, err)
+				}
+			}
+		}
+
+		for _, transaction := range archivedUser.WalletTransactions {
+			err := s.userRepo.AddWalletTransaction(context, transaction)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// importLeagueAssets writes the rosters, trades and invites, which point at users, leagues and auctions
+func (s *SqlArchiveRepo) importLeagueAssets(context echo.Context, archive entities.Archive) error {
+	for _, rosterPlayer := range archive.Rosters {
+		err := s.rosterRepo.AddPlayerToRoster(context, rosterPlayer)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, archivedTrade := range archive.Trades {
+		err := s.tradeRepo.SaveTrade(context, archivedTrade.Trade, archivedTrade.ScheduledAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, invite := range archive.Invites {
+		_, err := s.inviteRepo.CreateInvite(context, invite)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newImportError(record string, id uuid.UUID, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to import archive",
+		Args: []interface{}{
+			"record", record,
+			"id", id.String(),
+		},
+		Err: err,
+	})
+}
+
+// GetArchiveSummary counts the rows in every table an archive is written into,
+// along with the funds across every wallet
+func (s *SqlArchiveRepo) GetArchiveSummary(context echo.Context) (entities.ArchiveSummary, error) {
+	summary := entities.ArchiveSummary{
+		Counts: make(map[string]int64),
+	}
+
+	for _, table := range archiveTables {
+		var count int64
+		err := s.sqlClient.QueryRow(context, fmt.Sprintf("SELECT COUNT(*) FROM %v", table)).Scan(&count)
+		if err != nil {
+			return entities.ArchiveSummary{}, newGetArchiveSummaryError(table, err)
+		}
+
+		summary.Counts[table] = count
+	}
+
+	err := s.sqlClient.QueryRow(
+		context,
+		"SELECT COALESCE(SUM(available), 0), COALESCE(SUM(held), 0) FROM wallets",
+	).Scan(&summary.WalletAvailable, &summary.WalletHeld)
+	if err != nil {
+		return entities.ArchiveSummary{}, newGetArchiveSummaryError("wallets", err)
+	}
+
+	return summary, nil
+}
+
+func newGetArchiveSummaryError(table string, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to count rows",
+		Args: []interface{}{
+			"table", table,
+		},
+		Err: err,
+	})
+}
+
+// SummarizeArchive counts what the archive will write into each table,
+// so it can be checked against GetArchiveSummary after an import
+func SummarizeArchive(archive entities.Archive) entities.ArchiveSummary {
+	counts := make(map[string]int64)
+	for _, table := range archiveTables {
+		counts[table] = 0
+	}
+
+	var walletAvailable, walletHeld int64
+	for _, archivedUser := range archive.Users {
+		counts["users"]++
+		counts["user_sender_ps_ids"] += int64(len(archivedUser.SenderPsIds))
+		counts["wallets"] += int64(len(archivedUser.Wallets))
+		counts["archived_wallets"] += int64(len(archivedUser.ArchivedWallets))
+		counts["wallet_transactions"] += int64(len(archivedUser.WalletTransactions))
+
+		for _, wallet := range archivedUser.Wallets {
+			walletAvailable += wallet.Available
+			walletHeld += wallet.Held
+		}
+	}
+
+	for _, archivedLeague := range archive.Leagues {
+		counts["leagues"]++
+		counts["league_settings"]++
+		counts["league_members"] += int64(len(archivedLeague.League.Members))
+		counts["league_roles"] += int64(len(archivedLeague.Roles))
+		counts["waiver_priorities"] += int64(len(archivedLeague.WaiverPriority))
+
+		if archivedLeague.CurrentAuctionId != uuid.Nil {
+			counts["league_current_auctions"]++
+		}
+	}
+
+	counts["players"] = int64(len(archive.Players))
+	for _, playerSet := range archive.PlayerSets {
+		counts["player_sets"]++
+		counts["player_set_players"] += int64(len(playerSet.PlayerIds))
+	}
+
+	for _, archivedAuction := range archive.Auctions {
+		counts["auctions"]++
+		counts["bids"] += int64(len(archivedAuction.Bids))
+		counts["auction_results"] += int64(len(archivedAuction.Results))
+
+		for _, result := range archivedAuction.Results {
+			counts["auction_result_tied_bids"] += int64(len(result.TiedBids))
+		}
+	}
+	counts["auction_transitions"] = int64(len(archive.AuctionTransitions))
+
+	counts["rosters"] = int64(len(archive.Rosters))
+	for _, archivedTrade := range archive.Trades {
+		counts["trades"]++
+		counts["trade_players"] += int64(len(archivedTrade.Trade.ProposerPlayerIds) + len(archivedTrade.Trade.ReceiverPlayerIds))
+
+		if archivedTrade.ScheduledAt > 0 {
+			counts["trade_schedule"]++
+		}
+	}
+	counts["invites"] = int64(len(archive.Invites))
+
+	return entities.ArchiveSummary{
+		Counts:          counts,
+		WalletAvailable: walletAvailable,
+		WalletHeld:      walletHeld,
+	}
+}
@@ -1,489 +1,166 @@
 package auction_repo
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	redis_client "github.com/wilbertthelam/prop-ock/db"
 	"github.com/wilbertthelam/prop-ock/entities"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
 	"github.com/wilbertthelam/prop-ock/utils"
 )
 
-type AuctionRepo struct {
-	redisClient *redis.Client
-}
-
-func New(redisClient *redis.Client) *AuctionRepo {
-	return &AuctionRepo{
-		redisClient,
-	}
-}
-
-func generateAuctionRedisKey(auctionId uuid.UUID) string {
-	return fmt.Sprintf("auction:auction_id:%v", auctionId.String())
-}
-
-func generateLeagueToActiveAuctionRelationshipRedisKey(leagueId uuid.UUID) string {
-	return fmt.Sprintf("relationship:league_to_current_auction:league_id:%v", leagueId.String())
-}
-
-func generateBidRedisKey(auctionId uuid.UUID, userId uuid.UUID) string {
-	return fmt.Sprintf("bid:auction_id:%v:user_id:%v", auctionId.String(), userId.String())
-}
-
-func generateAuctionResultsRedisKey(auctionId uuid.UUID) string {
-	return fmt.Sprintf("result:auction_id:%v", auctionId.String())
-}
-
-func (a *AuctionRepo) GetAuctionByAuctionId(context echo.Context, auctionId uuid.UUID) (entities.Auction, error) {
-	// Query Redis for the auction
-	redisAuction, err := a.redisClient.HGetAll(
-		context.Request().Context(),
-		generateAuctionRedisKey(auctionId),
-	).Result()
-	if err != nil {
-		return entities.Auction{}, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to get auction",
-			Args: []interface{}{
-				"auctionId", auctionId.String(),
-			},
-			Err: err,
-		})
-	}
-
-	if len(redisAuction) == 0 {
-		return entities.Auction{}, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusNotFound,
-			Message: "no auction found",
-			Args: []interface{}{
-				"auctionId", auctionId.String(),
-			},
-			Err: nil,
-		})
-	}
-
-	startTime, err := strconv.ParseInt(redisAuction["start_time"], 10, 64)
-	if err != nil {
-		return entities.Auction{}, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to parse start time for auction",
-			Args: []interface{}{
-				"auctionId", auctionId.String(),
-				"startTime", redisAuction["start_time"],
-			},
-			Err: err,
-		})
-	}
-
-	endTime, err := strconv.ParseInt(redisAuction["end_time"], 10, 64)
-	if err != nil {
-		return entities.Auction{}, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to parse end time for auction",
-			Args: []interface{}{
-				"auctionId", auctionId.String(),
-				"endTime", redisAuction["end_time"],
-			},
-			Err: err,
-		})
-	}
-
-	status, err := strconv.ParseInt(redisAuction["status"], 10, 64)
-	if err != nil {
-		return entities.Auction{}, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to parse status for auction",
-			Args: []interface{}{
-				"auctionId", auctionId.String(),
-				"status", redisAuction["status"],
-			},
-			Err: err,
-		})
-	}
-
-	auction := entities.Auction{
-		Id:        uuid.Must(uuid.Parse(redisAuction["id"])),
-		LeagueId:  uuid.Must(uuid.Parse(redisAuction["league_id"])),
-		StartTime: startTime,
-		EndTime:   endTime,
-		Status:    entities.AuctionStatus(status),
-		Name:      redisAuction["name"],
-		Notes:     redisAuction["notes"],
-	}
-
-	return auction, nil
-}
-
-func (a *AuctionRepo) GetCurrentAuctionIdByLeagueId(context echo.Context, leagueId uuid.UUID) (uuid.UUID, error) {
-	// Query Redis for the leagueId
-	auctionId, err := a.redisClient.Get(
-		context.Request().Context(),
-		generateLeagueToActiveAuctionRelationshipRedisKey(leagueId),
-	).Result()
-
-	// If Redis key doesn't exist, then auction doesn't exist
-	if err == redis.Nil {
-		return uuid.Nil, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusNotFound,
-			Message: "current auction does not exist for league id",
-			Args: []interface{}{
-				"leagueId", leagueId.String(),
-			},
-			Err: nil,
-		})
-	}
+type AuctionRepo interface {
+	GetAuctionByAuctionId(context echo.Context, auctionId uuid.UUID) (entities.Auction, error)
+	GetCurrentAuctionIdByLeagueId(context echo.Context, leagueId uuid.UUID) (uuid.UUID, error)
+	SetLeagueToAuctionRelationship(context echo.Context, leagueId uuid.UUID, auctionId uuid.UUID) error
+	CreateAuction(context echo.Context, auctionId uuid.UUID, auction entities.Auction) error
+	// CreateLeagueAuction creates the auction, makes it the current auction of its league
+	// and schedules it to start and stop, in one atomic step
+	CreateLeagueAuction(context echo.Context, auction entities.Auction) error
+	StartAuction(context echo.Context, auctionId uuid.UUID) error
+	StopAuction(context echo.Context, auctionId uuid.UUID) error
+	CloseAuction(context echo.Context, auctionId uuid.UUID) error
+	GetAllUserBids(context echo.Context, auctionId uuid.UUID, userId uuid.UUID) (map[string]int64, error)
+	// GetAllUserBidTimestamps returns when each of the user's bids was placed, keyed on playerId
+	GetAllUserBidTimestamps(context echo.Context, auctionId uuid.UUID, userId uuid.UUID) (map[string]int64, error)
+	GetBid(context echo.Context, auctionId uuid.UUID, userId uuid.UUID, playerId string) (int64, error)
+	// MakeBid places the bid and moves the bid amount from the user's available funds into
+	// their held funds for the league. The auction has to be active and the user under
+	// the bid limits, checked in the same step as the hold. Returns the wallet after the hold.
+	MakeBid(context echo.Context, auctionId uuid.UUID, leagueId uuid.UUID, userId uuid.UUID, playerId string, bid int64, timestamp int64, limits entities.BidLimits) (entities.Wallet, error)
+	// CancelBid removes the bid and moves the bid amount from the user's held funds back
+	// into their available funds for the league. Returns the bid that was canceled and
+	// the wallet after the release.
+	CancelBid(context echo.Context, auctionId uuid.UUID, leagueId uuid.UUID, userId uuid.UUID, playerId string) (int64, entities.Wallet, error)
+	// ClaimAuctionProcessing marks the auction as being processed. Returns false if
+	// another request is already processing it.
+	ClaimAuctionProcessing(context echo.Context, auctionId uuid.UUID, ttl time.Duration) (bool, error)
+	ReleaseAuctionProcessing(context echo.Context, auctionId uuid.UUID) error
+	// SaveAuctionResult stores the processed result of the auction
+	SaveAuctionResult(context echo.Context, auctionId uuid.UUID, auctionResults map[string]entities.AuctionResult) error
+	GetAuctionResults(context echo.Context, auctionId uuid.UUID) (map[string]entities.AuctionResult, error)
+	// SettleAuction applies a processed auction in one atomic step. Every wallet transaction
+	// is applied and added to the wallet ledger, the players won go to their new owners, the
+	// results are saved, tie-break winners go to the back of waiver priority and the auction
+	// is closed. Nothing changes unless the auction is still stopped, its bids are all still
+	// open and nobody owns the players won yet, so settling an auction twice fails cleanly.
+	SettleAuction(context echo.Context, auction entities.Auction, settlement entities.AuctionSettlement) error
+}
+
+// Results of placing a bid, shared by every backend (and the Redis script)
+const (
+	BID_PLACED               int64 = 1
+	BID_MISSING_FUNDS        int64 = 0
+	BID_ALREADY_EXISTS       int64 = -1
+	BID_AUCTION_NOT_ACTIVE   int64 = -2
+	BID_OVER_MAX_BIDS        int64 = -3
+	BID_OVER_ROSTER_SIZE_CAP int64 = -4
+)
 
-	if err != nil {
-		return uuid.Nil, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusNotFound,
-			Message: "failed to get league to current auction relationship",
-			Args: []interface{}{
-				"leagueId", leagueId.String(),
-				"auctionId", auctionId,
-			},
-			Err: err,
-		})
-	}
+// Results of settling an auction, shared by every backend (and the Redis script)
+const (
+	AUCTION_SETTLEMENT_SETTLED            int64 = 1
+	AUCTION_SETTLEMENT_NOT_STOPPED        int64 = 0
+	AUCTION_SETTLEMENT_BIDS_CHANGED       int64 = -1
+	AUCTION_SETTLEMENT_PLAYER_OWNED       int64 = -2
+	AUCTION_SETTLEMENT_MISSING_HELD_FUNDS int64 = -3
+)
 
-	if auctionId == "" {
-		return uuid.Nil, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "dangling league to current auction relationship",
-			Args: []interface{}{
-				"leagueId", leagueId.String(),
-			},
-			Err: nil,
-		})
+// New returns the AuctionRepo for the storage backend picked in the config
+func New(config *config_service.Config, redisClient *redis.Client, memoryStore *redis_client.MemoryStore, sqlClient *redis_client.SqlClient) AuctionRepo {
+	switch config.GetStorageConfig().Backend {
+	case config_service.STORAGE_BACKEND_MEMORY:
+		return NewMemory(memoryStore)
+	case config_service.STORAGE_BACKEND_SQL:
+		return NewSql(sqlClient)
 	}
 
-	return uuid.MustParse(auctionId), nil
+	return NewRedis(redisClient)
 }
 
-func (a *AuctionRepo) SetLeagueToAuctionRelationship(context echo.Context, leagueId uuid.UUID, auctionId uuid.UUID) error {
-	// Upsert the league to auction relationship
-	_, err := redis_client.
-		GetCmdable(context, a.redisClient).
-		Set(
-			context.Request().Context(),
-			generateLeagueToActiveAuctionRelationshipRedisKey(leagueId),
-			auctionId.String(),
-			0,
-		).Result()
-	if err != nil {
+// checkMakeBid turns a bid that was refused into the error for it
+func checkMakeBid(status int64, wallet entities.Wallet, limits entities.BidLimits, args []interface{}) error {
+	newBidError := func(message string, args []interface{}) error {
 		return utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to set league to auction relationship",
-			Args: []interface{}{
-				"auctionId", auctionId.String(),
-				"leagueId", leagueId.String(),
-			},
-			Err: err,
+			Code:    http.StatusBadRequest,
+			Message: message,
+			Args:    args,
+			Err:     nil,
 		})
 	}
 
-	return nil
-}
-
-func (a *AuctionRepo) CreateAuction(context echo.Context, auctionId uuid.UUID, auction entities.Auction) error {
-	// Format for database inserting (array of strings where even index is key, odd index is value)
-	redisAuctionKeyValuePairs := []string{
-		"id", auction.Id.String(),
-		"league_id", auction.LeagueId.String(),
-		"start_time", strconv.FormatInt(auction.StartTime, 10),
-		"end_time", strconv.FormatInt(auction.EndTime, 10),
-		"status", strconv.FormatInt(int64(auction.Status), 10),
-		"name", auction.Name,
-	}
-
-	err := a.updateAuction(context, auctionId, redisAuctionKeyValuePairs)
-	if err != nil {
-		return err
+	switch status {
+	case BID_MISSING_FUNDS:
+		return newBidError("wallet does not have enough funds to hold value", append(args, "available", fmt.Sprintf("%v", wallet.Available)))
+	case BID_ALREADY_EXISTS:
+		return newBidError("cannot make another bids on the same player if bid already exists", args)
+	case BID_AUCTION_NOT_ACTIVE:
+		return newBidError("cannot make bid on a non-active auction", args)
+	case BID_OVER_MAX_BIDS:
+		return newBidError(fmt.Sprintf("you can only bid on %v players per auction", limits.MaxBidsPerAuction), args)
+	case BID_OVER_ROSTER_SIZE_CAP:
+		return newBidError(fmt.Sprintf("your roster and open bids are already at the limit of %v players", limits.RosterSizeCap), args)
 	}
 
 	return nil
 }
 
-func (a *AuctionRepo) StartAuction(context echo.Context, auctionId uuid.UUID) error {
-	redisStatusKeyValuePair := []string{
-		"status", strconv.FormatInt(int64(entities.AUCTION_STATUS_ACTIVE), 10),
+// getBidLimitStatus checks whether a user with bidCount open bids and rosterSize rostered
+// players has room for another bid. The Redis script does the same checks in Lua.
+func getBidLimitStatus(bidCount int64, rosterSize int64, limits entities.BidLimits) int64 {
+	if limits.MaxBidsPerAuction > 0 && bidCount >= limits.MaxBidsPerAuction {
+		return BID_OVER_MAX_BIDS
 	}
 
-	err := a.updateAuction(context, auctionId, redisStatusKeyValuePair)
-	if err != nil {
-		return err
+	if limits.RosterSizeCap > 0 && rosterSize+bidCount >= limits.RosterSizeCap {
+		return BID_OVER_ROSTER_SIZE_CAP
 	}
 
-	return nil
+	return BID_PLACED
 }
 
-func (a *AuctionRepo) StopAuction(context echo.Context, auctionId uuid.UUID) error {
-	redisStatusKeyValuePair := []string{
-		"status", strconv.FormatInt(int64(entities.AUCTION_STATUS_STOPPED), 10),
+// checkAuctionSettlement turns a settlement that was refused into the error for it
+func checkAuctionSettlement(status int64, auction entities.Auction) error {
+	args := []interface{}{
+		"auctionId", auction.Id.String(),
+		"leagueId", auction.LeagueId.String(),
 	}
 
-	err := a.updateAuction(context, auctionId, redisStatusKeyValuePair)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (a *AuctionRepo) CloseAuction(context echo.Context, auctionId uuid.UUID) error {
-	redisStatusKeyValuePair := []string{
-		"status", strconv.FormatInt(int64(entities.AUCTION_STATUS_CLOSED), 10),
-	}
-
-	err := a.updateAuction(context, auctionId, redisStatusKeyValuePair)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (a *AuctionRepo) GetAllUserBids(context echo.Context, auctionId uuid.UUID, userId uuid.UUID) (map[string]int64, error) {
-	rawPlayerBids, err := a.redisClient.HGetAll(
-		context.Request().Context(),
-		generateBidRedisKey(auctionId, userId),
-	).Result()
-	if err != nil {
-		return nil, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to get all of a user's bids",
-			Args: []interface{}{
-				"auctionId", auctionId.String(),
-				"userId", userId.String(),
-			},
-			Err: err,
-		})
-	}
-
-	bids := make(map[string]int64)
-	for playerId, bidString := range rawPlayerBids {
-		bid, err := strconv.ParseInt(bidString, 10, 64)
-		if err != nil {
-			return nil, utils.NewError(utils.ErrorParams{
-				Code:    http.StatusInternalServerError,
-				Message: "failed to parse a bid when trying to get all of a user's bids",
-				Args: []interface{}{
-					"auctionId", auctionId.String(),
-					"userId", userId.String(),
-				},
-				Err: err,
-			})
-		}
-
-		bids[playerId] = bid
-	}
-
-	return bids, nil
-}
-
-func (a *AuctionRepo) GetBid(context echo.Context, auctionId uuid.UUID, userId uuid.UUID, playerId string) (int64, error) {
-	bidString, err := a.redisClient.HGet(
-		context.Request().Context(),
-		generateBidRedisKey(auctionId, userId),
-		playerId,
-	).Result()
-
-	// If Redis key doesn't exist, then bid doesn't exist
-	if err == redis.Nil {
-		return -1, nil
-	}
-
-	if err != nil {
-		return -1, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to get a bid for a player",
-			Args: []interface{}{
-				"auctionId", auctionId.String(),
-				"userId", userId.String(),
-				"playerId", playerId,
-			},
-			Err: err,
-		})
-	}
-
-	bid, err := strconv.ParseInt(bidString, 10, 64)
-	if err != nil {
-		return -1, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to parse bid amount for a player",
-			Args: []interface{}{
-				"auctionId", auctionId.String(),
-				"userId", userId.String(),
-				"playerId", playerId,
-				"bid", bidString,
-			},
-			Err: err,
-		})
-	}
-
-	return bid, nil
-}
-
-func (a *AuctionRepo) MakeBid(context echo.Context, auctionId uuid.UUID, userId uuid.UUID, playerId string, bid int64) error {
-	redisBidKeyValuePair := []string{
-		playerId, strconv.FormatInt(bid, 10),
-	}
-
-	_, err := redis_client.
-		GetCmdable(context, a.redisClient).
-		HSet(
-			context.Request().Context(),
-			generateBidRedisKey(auctionId, userId),
-			redisBidKeyValuePair,
-		).Result()
-	if err != nil {
+	switch status {
+	case AUCTION_SETTLEMENT_NOT_STOPPED:
 		return utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to make a bid",
-			Args: []interface{}{
-				"auctionId", auctionId.String(),
-				"userId", userId.String(),
-				"playerId", playerId,
-				"bid", fmt.Sprintf("%v", bid),
-			},
-			Err: err,
+			Code:    http.StatusBadRequest,
+			Message: "cannot close an auction that is not stopped",
+			Args:    args,
+			Err:     nil,
 		})
-	}
-
-	return nil
-}
-
-func (a *AuctionRepo) CancelBid(context echo.Context, auctionId uuid.UUID, userId uuid.UUID, playerId string) error {
-	_, err := redis_client.
-		GetCmdable(context, a.redisClient).
-		HDel(
-			context.Request().Context(),
-			generateBidRedisKey(auctionId, userId),
-			playerId,
-		).Result()
-	if err != nil {
+	case AUCTION_SETTLEMENT_BIDS_CHANGED:
 		return utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to cancel a bid",
-			Args: []interface{}{
-				"auctionId", auctionId.String(),
-				"userId", userId.String(),
-				"playerId", playerId,
-			},
-			Err: err,
+			Code:    http.StatusConflict,
+			Message: "bids changed while the auction was being processed, try again",
+			Args:    args,
+			Err:     nil,
 		})
-	}
-
-	return nil
-}
-
-func (a *AuctionRepo) updateAuction(context echo.Context, auctionId uuid.UUID, keyValuePairs []string) error {
-	_, err := redis_client.
-		GetCmdable(context, a.redisClient).
-		HSet(
-			context.Request().Context(),
-			generateAuctionRedisKey(auctionId),
-			keyValuePairs,
-		).Result()
-	if err != nil {
+	case AUCTION_SETTLEMENT_PLAYER_OWNED:
 		return utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to update auction fields",
-			Args: append(
-				[]interface{}{"auctionId", auctionId.String()},
-				utils.MapStringSliceToInterfaceSlice(keyValuePairs)...,
-			),
-			Err: err,
+			Code:    http.StatusBadRequest,
+			Message: "player is already owned in this league",
+			Args:    args,
+			Err:     nil,
 		})
-	}
-
-	return nil
-}
-
-// SaveAuctionResults stores the processed result of the auction into the DB
-func (a *AuctionRepo) SaveAuctionResult(context echo.Context, auctionId uuid.UUID, playerBidMap map[string][]entities.AuctionBid) error {
-	playerBidMapSize := len(playerBidMap)
-	if playerBidMapSize == 0 {
-		return nil
-	}
-
-	serializedPlayerBidMap := make(map[string]string, playerBidMapSize)
-	for playerId, bid := range playerBidMap {
-		serializedBid, err := json.Marshal(bid)
-		if err != nil {
-			return utils.NewError(utils.ErrorParams{
-				Code:    http.StatusInternalServerError,
-				Message: "failed to save marshal player bid in saving auction result",
-				Args: []interface{}{
-					"auctionId", auctionId.String(),
-					"playerId", playerId,
-				},
-				Err: err,
-			})
-		}
-		serializedPlayerBidMap[playerId] = string(serializedBid)
-	}
-
-	_, err := a.redisClient.HSet(
-		context.Request().Context(),
-		generateAuctionResultsRedisKey(auctionId),
-		serializedPlayerBidMap,
-	).Result()
-	if err != nil {
+	case AUCTION_SETTLEMENT_MISSING_HELD_FUNDS:
 		return utils.NewError(utils.ErrorParams{
 			Code:    http.StatusInternalServerError,
-			Message: "failed to save auction results",
-			Args: []interface{}{
-				"auctionId", auctionId.String(),
-				"playerBidMap", fmt.Sprintf("%+v", serializedPlayerBidMap),
-			},
-			Err: err,
+			Message: "wallet does not have the funds held for bid",
+			Args:    args,
+			Err:     nil,
 		})
 	}
 
 	return nil
 }
-
-func (a *AuctionRepo) GetAuctionResults(context echo.Context, auctionId uuid.UUID) (map[string][]entities.AuctionBid, error) {
-	rawResults, err := a.redisClient.HGetAll(
-		context.Request().Context(),
-		generateAuctionResultsRedisKey(auctionId),
-	).Result()
-	if err != nil {
-		return nil, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to get auction results",
-			Args: []interface{}{
-				"auctionId", auctionId.String(),
-			},
-			Err: err,
-		})
-	}
-
-	auctionResults := make(map[string][]entities.AuctionBid)
-	for playerId, serializedBid := range rawResults {
-		var auctionBid []entities.AuctionBid
-		err := json.Unmarshal([]byte(serializedBid), &auctionBid)
-		if err != nil {
-			return nil, utils.NewError(utils.ErrorParams{
-				Code:    http.StatusInternalServerError,
-				Message: "failed to unmarshal auction bid in get auction results",
-				Args: []interface{}{
-					"auctionId", auctionId.String(),
-					"playerId", playerId,
-					"serializedBid", serializedBid,
-				},
-				Err: err,
-			})
-		}
-
-		auctionResults[playerId] = auctionBid
-	}
-
-	return auctionResults, nil
-}
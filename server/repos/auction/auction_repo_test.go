@@ -0,0 +1,420 @@
+package auction_repo
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/wilbertthelam/prop-ock/entities"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/test_utils"
+)
+
+const (
+	parallelBidCount   = 20
+	parallelBidValue   = 10
+	startingWalletFund = 1000
+)
+
+// bidTestRepos are the repos a bid test needs, all on the same backend
+type bidTestRepos struct {
+	auctionRepo AuctionRepo
+	leagueRepo  league_repo.LeagueRepo
+	rosterRepo  roster_repo.RosterRepo
+	userRepo    user_repo.UserRepo
+}
+
+func TestParallelBids(t *testing.T) {
+	test_utils.RunOnEveryBackend(t, func(t *testing.T, backend test_utils.Backend) {
+		runParallelBidTests(t, bidTestRepos{
+			New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			league_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			roster_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			user_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+		})
+	})
+}
+
+func runParallelBidTests(t *testing.T, repos bidTestRepos) {
+	t.Run("parallel bids stay under the max bids cap", func(t *testing.T) {
+		auction, userId := setUpBidTest(t, repos)
+		limits := entities.BidLimits{MaxBidsPerAuction: 3}
+
+		placedCount := makeParallelBids(repos, auction, userId, limits)
+		checkBidsPlaced(t, repos, auction, userId, placedCount, 3)
+	})
+
+	t.Run("parallel bids stay under the roster size cap", func(t *testing.T) {
+		auction, userId := setUpBidTest(t, repos)
+		limits := entities.BidLimits{RosterSizeCap: 4}
+
+		err := repos.rosterRepo.AddPlayerToRoster(test_utils.NewContext(), entities.RosterPlayer{
+			PlayerId:   "rostered_player",
+			UserId:     userId,
+			LeagueId:   auction.LeagueId,
+			AuctionId:  auction.Id,
+			Price:      1,
+			AcquiredAt: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		placedCount := makeParallelBids(repos, auction, userId, limits)
+		checkBidsPlaced(t, repos, auction, userId, placedCount, 3)
+	})
+
+	t.Run("bids on a stopped auction don't hold funds", func(t *testing.T) {
+		auction, userId := setUpBidTest(t, repos)
+
+		err := repos.auctionRepo.StopAuction(test_utils.NewContext(), auction.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		placedCount := makeParallelBids(repos, auction, userId, entities.BidLimits{})
+		checkBidsPlaced(t, repos, auction, userId, placedCount, 0)
+	})
+
+	t.Run("parallel bids without caps all hold funds", func(t *testing.T) {
+		auction, userId := setUpBidTest(t, repos)
+
+		placedCount := makeParallelBids(repos, auction, userId, entities.BidLimits{})
+		checkBidsPlaced(t, repos, auction, userId, placedCount, parallelBidCount)
+	})
+}
+
+// setUpBidTest creates an active auction in a new league, and a member with funds to bid
+func setUpBidTest(t *testing.T, repos bidTestRepos) (entities.Auction, uuid.UUID) {
+	context := test_utils.NewContext()
+	leagueId := uuid.New()
+	userId := uuid.New()
+	auction := entities.Auction{
+		Id:          uuid.New(),
+		LeagueId:    leagueId,
+		PlayerSetId: uuid.New(),
+		StartTime:   1,
+		EndTime:     2,
+		Status:      entities.AUCTION_STATUS_ACTIVE,
+		PricingMode: entities.AUCTION_PRICING_MODE_FIRST_PRICE,
+		Name:        "parallel bids",
+	}
+
+	err := repos.userRepo.CreateUser(context, userId, entities.User{Id: userId, Name: "bidder"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repos.leagueRepo.CreateLeague(context, leagueId, entities.League{Id: leagueId, Name: "parallel bids"}, entities.NewDefaultLeagueSettings(leagueId), uuid.Nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repos.auctionRepo.CreateAuction(context, auction.Id, auction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repos.userRepo.AddFundsToUserWallet(context, userId, leagueId, startingWalletFund)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return auction, userId
+}
+
+// makeParallelBids bids on a different player from each goroutine and returns how many bids were placed
+func makeParallelBids(repos bidTestRepos, auction entities.Auction, userId uuid.UUID, limits entities.BidLimits) int64 {
+	var waitGroup sync.WaitGroup
+	var mutex sync.Mutex
+	var placedCount int64
+
+	start := make(chan struct{})
+	for index := 0; index < parallelBidCount; index++ {
+		waitGroup.Add(1)
+		go func(index int) {
+			defer waitGroup.Done()
+			<-start
+
+			_, err := repos.auctionRepo.MakeBid(
+				test_utils.NewContext(),
+				auction.Id,
+				auction.LeagueId,
+				userId,
+				fmt.Sprintf("player_%v", index),
+				parallelBidValue,
+				int64(index),
+				limits,
+			)
+			if err == nil {
+				mutex.Lock()
+				placedCount++
+				mutex.Unlock()
+			}
+		}(index)
+	}
+
+	close(start)
+	waitGroup.Wait()
+
+	return placedCount
+}
+
+// checkBidsPlaced checks exactly the expected number of bids went through, and that
+// the funds held match the bids that were saved
+func checkBidsPlaced(t *testing.T, repos bidTestRepos, auction entities.Auction, userId uuid.UUID, placedCount int64, expectedCount int64) {
+	context := test_utils.NewContext()
+
+	if placedCount != expectedCount {
+		t.Errorf("placed %v bids, expected %v", placedCount, expectedCount)
+	}
+
+	bids, err := repos.auctionRepo.GetAllUserBids(context, auction.Id, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if int64(len(bids)) != expectedCount {
+		t.Errorf("saved %v bids, expected %v", len(bids), expectedCount)
+	}
+
+	wallets, err := repos.userRepo.GetUserWallet(context, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallet := wallets[auction.LeagueId]
+	expectedHeld := expectedCount * parallelBidValue
+	if wallet.Held != expectedHeld || wallet.Available != startingWalletFund-expectedHeld {
+		t.Errorf("wallet is %+v, expected %v held and %v available", wallet, expectedHeld, startingWalletFund-expectedHeld)
+	}
+}
+
+const (
+	settledPlayerId = "settled_player"
+	winningBidValue = 40
+	losingBidValue  = 25
+)
+
+// settlementTest is a stopped auction where two members bid on the same player, and the
+// settlement that processing it would apply
+type settlementTest struct {
+	auction    entities.Auction
+	winnerId   uuid.UUID
+	loserId    uuid.UUID
+	settlement entities.AuctionSettlement
+}
+
+func TestSettleAuction(t *testing.T) {
+	test_utils.RunOnEveryBackend(t, func(t *testing.T, backend test_utils.Backend) {
+		runSettleAuctionTests(t, bidTestRepos{
+			New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			league_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			roster_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			user_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+		})
+	})
+}
+
+func runSettleAuctionTests(t *testing.T, repos bidTestRepos) {
+	t.Run("settling again changes nothing", func(t *testing.T) {
+		test := setUpSettlementTest(t, repos)
+
+		err := repos.auctionRepo.SettleAuction(test_utils.NewContext(), test.auction, test.settlement)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = repos.auctionRepo.SettleAuction(test_utils.NewContext(), test.auction, test.settlement)
+		if err == nil {
+			t.Error("settled an auction that was already closed")
+		}
+
+		checkSettlement(t, repos, test, entities.AUCTION_STATUS_CLOSED, test.winnerId)
+		checkWalletAndLedger(t, repos, test.auction, test.winnerId, startingWalletFund-winningBidValue, 0, 1)
+		checkWalletAndLedger(t, repos, test.auction, test.loserId, startingWalletFund, 0, 1)
+
+		waiverPriority, err := repos.leagueRepo.GetWaiverPriority(test_utils.NewContext(), test.auction.LeagueId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(waiverPriority) != 2 || waiverPriority[1] != test.winnerId {
+			t.Errorf("waiver priority is %v, expected the winner %v moved to the back once", waiverPriority, test.winnerId)
+		}
+	})
+
+	t.Run("nothing changes when a player won is already owned", func(t *testing.T) {
+		test := setUpSettlementTest(t, repos)
+
+		err := repos.rosterRepo.AddPlayerToRoster(test_utils.NewContext(), entities.RosterPlayer{
+			PlayerId:   settledPlayerId,
+			UserId:     test.loserId,
+			LeagueId:   test.auction.LeagueId,
+			Price:      1,
+			AcquiredAt: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = repos.auctionRepo.SettleAuction(test_utils.NewContext(), test.auction, test.settlement)
+		if err == nil {
+			t.Error("settled an auction for a player who's already owned")
+		}
+
+		checkSettlement(t, repos, test, entities.AUCTION_STATUS_STOPPED, test.loserId)
+		checkWalletAndLedger(t, repos, test.auction, test.winnerId, startingWalletFund-winningBidValue, winningBidValue, 0)
+		checkWalletAndLedger(t, repos, test.auction, test.loserId, startingWalletFund-losingBidValue, losingBidValue, 0)
+	})
+
+	t.Run("nothing changes when a bid was canceled", func(t *testing.T) {
+		test := setUpSettlementTest(t, repos)
+
+		_, _, err := repos.auctionRepo.CancelBid(test_utils.NewContext(), test.auction.Id, test.auction.LeagueId, test.loserId, settledPlayerId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = repos.auctionRepo.SettleAuction(test_utils.NewContext(), test.auction, test.settlement)
+		if err == nil {
+			t.Error("settled an auction from a bid that was canceled")
+		}
+
+		checkSettlement(t, repos, test, entities.AUCTION_STATUS_STOPPED, uuid.Nil)
+		checkWalletAndLedger(t, repos, test.auction, test.winnerId, startingWalletFund-winningBidValue, winningBidValue, 0)
+		checkWalletAndLedger(t, repos, test.auction, test.loserId, startingWalletFund, 0, 0)
+	})
+}
+
+// setUpSettlementTest stops an auction where the winner outbid the loser on one player,
+// and builds the settlement that pays the winner's bid and refunds the loser
+func setUpSettlementTest(t *testing.T, repos bidTestRepos) settlementTest {
+	context := test_utils.NewContext()
+	auction, winnerId := setUpBidTest(t, repos)
+	test := settlementTest{
+		auction:  auction,
+		winnerId: winnerId,
+		loserId:  uuid.New(),
+	}
+
+	err := repos.userRepo.CreateUser(context, test.loserId, entities.User{Id: test.loserId, Name: "bidder"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repos.userRepo.AddFundsToUserWallet(context, test.loserId, auction.LeagueId, startingWalletFund)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bids := []entities.AuctionBid{
+		{AuctionId: auction.Id, UserId: test.winnerId, PlayerId: settledPlayerId, Bid: winningBidValue, Timestamp: 1},
+		{AuctionId: auction.Id, UserId: test.loserId, PlayerId: settledPlayerId, Bid: losingBidValue, Timestamp: 2},
+	}
+
+	for _, bid := range bids {
+		err = repos.leagueRepo.AddUserToLeague(context, bid.UserId, auction.LeagueId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = repos.leagueRepo.MoveUserToBackOfWaiverPriority(context, auction.LeagueId, bid.UserId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = repos.auctionRepo.MakeBid(context, auction.Id, auction.LeagueId, bid.UserId, bid.PlayerId, bid.Bid, bid.Timestamp, entities.BidLimits{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = repos.auctionRepo.StopAuction(context, auction.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.settlement = entities.AuctionSettlement{
+		Results: map[string]entities.AuctionResult{
+			settledPlayerId: {PlayerId: settledPlayerId, WinningBid: bids[0], Price: winningBidValue},
+		},
+		Bids: bids,
+		WalletTransactions: []entities.WalletTransaction{
+			entities.NewWalletTransaction(test.loserId, auction.LeagueId, losingBidValue, losingBidValue*-1, entities.WALLET_TRANSACTION_REASON_REFUND, auction.Id, settledPlayerId),
+			entities.NewWalletTransaction(test.winnerId, auction.LeagueId, 0, winningBidValue*-1, entities.WALLET_TRANSACTION_REASON_WINNING_BID, auction.Id, settledPlayerId),
+		},
+		RosterPlayers: []entities.RosterPlayer{
+			{PlayerId: settledPlayerId, UserId: test.winnerId, LeagueId: auction.LeagueId, AuctionId: auction.Id, Price: winningBidValue, AcquiredAt: 1},
+		},
+		WaiverPriorityMoves: []uuid.UUID{test.winnerId},
+	}
+
+	return test
+}
+
+// checkSettlement checks the auction's status, who owns the player and that results were
+// only saved if the auction was closed
+func checkSettlement(t *testing.T, repos bidTestRepos, test settlementTest, expectedStatus entities.AuctionStatus, expectedOwner uuid.UUID) {
+	context := test_utils.NewContext()
+
+	auction, err := repos.auctionRepo.GetAuctionByAuctionId(context, test.auction.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if auction.Status != expectedStatus {
+		t.Errorf("auction status is %v, expected %v", auction.Status, expectedStatus)
+	}
+
+	owner, err := repos.rosterRepo.GetPlayerOwner(context, test.auction.LeagueId, settledPlayerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if owner != expectedOwner {
+		t.Errorf("%v is owned by %v, expected %v", settledPlayerId, owner, expectedOwner)
+	}
+
+	results, err := repos.auctionRepo.GetAuctionResults(context, test.auction.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	isClosed := expectedStatus == entities.AUCTION_STATUS_CLOSED
+	if (len(results) > 0) != isClosed {
+		t.Errorf("auction results are %+v with the auction in status %v", results, expectedStatus)
+	}
+}
+
+// checkWalletAndLedger checks the user's wallet and how many settlement entries their
+// wallet ledger has
+func checkWalletAndLedger(t *testing.T, repos bidTestRepos, auction entities.Auction, userId uuid.UUID, expectedAvailable int64, expectedHeld int64, expectedLedgerCount int) {
+	context := test_utils.NewContext()
+
+	wallets, err := repos.userRepo.GetUserWallet(context, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallet := wallets[auction.LeagueId]
+	if wallet.Available != expectedAvailable || wallet.Held != expectedHeld {
+		t.Errorf("wallet is %+v, expected %v available and %v held", wallet, expectedAvailable, expectedHeld)
+	}
+
+	transactions, err := repos.userRepo.GetWalletTransactions(context, userId, auction.LeagueId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transactions) != expectedLedgerCount {
+		t.Fatalf("wallet ledger is %+v, expected %v entries", transactions, expectedLedgerCount)
+	}
+
+	if expectedLedgerCount > 0 && (transactions[0].Balance != expectedAvailable || transactions[0].HeldBalance != expectedHeld) {
+		t.Errorf("wallet ledger ends at %+v, expected %v available and %v held", transactions[0], expectedAvailable, expectedHeld)
+	}
+}
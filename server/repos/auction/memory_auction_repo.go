@@ -0,0 +1,412 @@
+package auction_repo
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	schedule_repo "github.com/wilbertthelam/prop-ock/repos/schedule"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// MemoryAuctionRepo keeps auctions, bids and results in the memory store. A user's
+// bids and bid timestamps in an auction are each a map keyed on playerId.
+type MemoryAuctionRepo struct {
+	memoryStore *redis_client.MemoryStore
+}
+
+func NewMemory(memoryStore *redis_client.MemoryStore) *MemoryAuctionRepo {
+	return &MemoryAuctionRepo{
+		memoryStore,
+	}
+}
+
+func (a *MemoryAuctionRepo) GetAuctionByAuctionId(context echo.Context, auctionId uuid.UUID) (entities.Auction, error) {
+	var auction entities.Auction
+	err := a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		value, ok := values.Get(redis_client.GenerateAuctionRedisKey(auctionId))
+		if !ok {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusNotFound,
+				Message: "no auction found",
+				Args: []interface{}{
+					"auctionId", auctionId.String(),
+				},
+				Err: nil,
+			})
+		}
+
+		auction = value.(entities.Auction)
+		return nil
+	})
+
+	return auction, err
+}
+
+func (a *MemoryAuctionRepo) GetCurrentAuctionIdByLeagueId(context echo.Context, leagueId uuid.UUID) (uuid.UUID, error) {
+	auctionId := uuid.Nil
+	err := a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		value, ok := values.Get(redis_client.GenerateLeagueToCurrentAuctionRedisKey(leagueId))
+		if !ok {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusNotFound,
+				Message: "current auction does not exist for league id",
+				Args: []interface{}{
+					"leagueId", leagueId.String(),
+				},
+				Err: nil,
+			})
+		}
+
+		auctionId = value.(uuid.UUID)
+		return nil
+	})
+
+	return auctionId, err
+}
+
+func (a *MemoryAuctionRepo) SetLeagueToAuctionRelationship(context echo.Context, leagueId uuid.UUID, auctionId uuid.UUID) error {
+	return a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Set(redis_client.GenerateLeagueToCurrentAuctionRedisKey(leagueId), auctionId)
+		return nil
+	})
+}
+
+func (a *MemoryAuctionRepo) CreateAuction(context echo.Context, auctionId uuid.UUID, auction entities.Auction) error {
+	return a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Set(redis_client.GenerateAuctionRedisKey(auctionId), auction)
+		return nil
+	})
+}
+
+// CreateLeagueAuction creates the auction, makes it the current auction of its league
+// and schedules it to start and stop, in one atomic step
+func (a *MemoryAuctionRepo) CreateLeagueAuction(context echo.Context, auction entities.Auction) error {
+	return a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Set(redis_client.GenerateAuctionRedisKey(auction.Id), auction)
+		values.Set(redis_client.GenerateLeagueToCurrentAuctionRedisKey(auction.LeagueId), auction.Id)
+		schedule_repo.ScheduleMemoryAuctionTransition(values, auction.Id, entities.AUCTION_TRANSITION_START, auction.StartTime)
+		schedule_repo.ScheduleMemoryAuctionTransition(values, auction.Id, entities.AUCTION_TRANSITION_STOP, auction.EndTime)
+		return nil
+	})
+}
+
+func (a *MemoryAuctionRepo) StartAuction(context echo.Context, auctionId uuid.UUID) error {
+	return a.setAuctionStatus(context, auctionId, entities.AUCTION_STATUS_ACTIVE)
+}
+
+func (a *MemoryAuctionRepo) StopAuction(context echo.Context, auctionId uuid.UUID) error {
+	return a.setAuctionStatus(context, auctionId, entities.AUCTION_STATUS_STOPPED)
+}
+
+func (a *MemoryAuctionRepo) CloseAuction(context echo.Context, auctionId uuid.UUID) error {
+	return a.setAuctionStatus(context, auctionId, entities.AUCTION_STATUS_CLOSED)
+}
+
+func (a *MemoryAuctionRepo) setAuctionStatus(context echo.Context, auctionId uuid.UUID, status entities.AuctionStatus) error {
+	return a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		value, ok := values.Get(redis_client.GenerateAuctionRedisKey(auctionId))
+		if !ok {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to update auction fields",
+				Args: []interface{}{
+					"auctionId", auctionId.String(),
+					"status", fmt.Sprintf("%v", status),
+				},
+				Err: nil,
+			})
+		}
+
+		auction := value.(entities.Auction)
+		auction.Status = status
+		values.Set(redis_client.GenerateAuctionRedisKey(auctionId), auction)
+
+		return nil
+	})
+}
+
+func (a *MemoryAuctionRepo) GetAllUserBids(context echo.Context, auctionId uuid.UUID, userId uuid.UUID) (map[string]int64, error) {
+	return a.getBidValues(context, redis_client.GenerateBidRedisKey(auctionId, userId))
+}
+
+// GetAllUserBidTimestamps returns when each of the user's bids was placed, keyed on playerId
+func (a *MemoryAuctionRepo) GetAllUserBidTimestamps(context echo.Context, auctionId uuid.UUID, userId uuid.UUID) (map[string]int64, error) {
+	return a.getBidValues(context, redis_client.GenerateBidTimestampRedisKey(auctionId, userId))
+}
+
+func (a *MemoryAuctionRepo) getBidValues(context echo.Context, key string) (map[string]int64, error) {
+	bidValues := make(map[string]int64)
+	err := a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		for playerId, bidValue := range getMemoryBidValues(values, key) {
+			bidValues[playerId] = bidValue
+		}
+
+		return nil
+	})
+
+	return bidValues, err
+}
+
+func getMemoryBidValues(values redis_client.MemoryValues, key string) map[string]int64 {
+	value, ok := values.Get(key)
+	if !ok {
+		return make(map[string]int64)
+	}
+
+	return value.(map[string]int64)
+}
+
+func (a *MemoryAuctionRepo) GetBid(context echo.Context, auctionId uuid.UUID, userId uuid.UUID, playerId string) (int64, error) {
+	bid := int64(-1)
+	err := a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		// If the player isn't in the user's bids, then bid doesn't exist
+		playerBid, ok := getMemoryBidValues(values, redis_client.GenerateBidRedisKey(auctionId, userId))[playerId]
+		if ok {
+			bid = playerBid
+		}
+
+		return nil
+	})
+
+	return bid, err
+}
+
+// MakeBid places the bid and moves the bid amount from the user's available funds into
+// their held funds for the league. Returns the wallet after the hold.
+func (a *MemoryAuctionRepo) MakeBid(context echo.Context, auctionId uuid.UUID, leagueId uuid.UUID, userId uuid.UUID, playerId string, bid int64, timestamp int64, limits entities.BidLimits) (entities.Wallet, error) {
+	args := []interface{}{
+		"auctionId", auctionId.String(),
+		"leagueId", leagueId.String(),
+		"userId", userId.String(),
+		"playerId", playerId,
+		"bid", fmt.Sprintf("%v", bid),
+	}
+
+	var wallet entities.Wallet
+	err := a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		auction, ok := values.Get(redis_client.GenerateAuctionRedisKey(auctionId))
+		if !ok || auction.(entities.Auction).Status != entities.AUCTION_STATUS_ACTIVE {
+			return checkMakeBid(BID_AUCTION_NOT_ACTIVE, wallet, limits, args)
+		}
+
+		bids := getMemoryBidValues(values, redis_client.GenerateBidRedisKey(auctionId, userId))
+		if _, ok := bids[playerId]; ok {
+			return checkMakeBid(BID_ALREADY_EXISTS, wallet, limits, args)
+		}
+
+		rosterSize := roster_repo.GetMemoryRosterSize(values, leagueId, userId)
+		status := getBidLimitStatus(int64(len(bids)), rosterSize, limits)
+		if status != BID_PLACED {
+			return checkMakeBid(status, wallet, limits, args)
+		}
+
+		wallet, status = user_repo.AdjustMemoryWalletFunds(values, userId, leagueId, bid*-1, bid)
+		if status != user_repo.WALLET_ADJUSTMENT_APPLIED {
+			return checkMakeBid(BID_MISSING_FUNDS, wallet, limits, args)
+		}
+
+		bids[playerId] = bid
+		values.Set(redis_client.GenerateBidRedisKey(auctionId, userId), bids)
+
+		// Keep track of when the bid came in for breaking ties
+		timestamps := getMemoryBidValues(values, redis_client.GenerateBidTimestampRedisKey(auctionId, userId))
+		timestamps[playerId] = timestamp
+		values.Set(redis_client.GenerateBidTimestampRedisKey(auctionId, userId), timestamps)
+
+		return nil
+	})
+	if err != nil {
+		return entities.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// CancelBid removes the bid and moves the bid amount from the user's held funds back
+// into their available funds for the league. Returns the bid that was canceled and
+// the wallet after the release.
+func (a *MemoryAuctionRepo) CancelBid(context echo.Context, auctionId uuid.UUID, leagueId uuid.UUID, userId uuid.UUID, playerId string) (int64, entities.Wallet, error) {
+	args := []interface{}{
+		"auctionId", auctionId.String(),
+		"leagueId", leagueId.String(),
+		"userId", userId.String(),
+		"playerId", playerId,
+	}
+
+	var bid int64
+	var wallet entities.Wallet
+	err := a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		bids := getMemoryBidValues(values, redis_client.GenerateBidRedisKey(auctionId, userId))
+
+		var ok bool
+		bid, ok = bids[playerId]
+		if !ok {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusBadRequest,
+				Message: "cannot cancel bid that doesn't exist for player",
+				Args:    args,
+				Err:     nil,
+			})
+		}
+
+		var status int64
+		wallet, status = user_repo.AdjustMemoryWalletFunds(values, userId, leagueId, bid, bid*-1)
+		if status != user_repo.WALLET_ADJUSTMENT_APPLIED {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "wallet does not have the funds held for bid",
+				Args:    append(args, "held", fmt.Sprintf("%v", wallet.Held)),
+				Err:     nil,
+			})
+		}
+
+		delete(bids, playerId)
+		values.Set(redis_client.GenerateBidRedisKey(auctionId, userId), bids)
+
+		timestamps := getMemoryBidValues(values, redis_client.GenerateBidTimestampRedisKey(auctionId, userId))
+		delete(timestamps, playerId)
+		values.Set(redis_client.GenerateBidTimestampRedisKey(auctionId, userId), timestamps)
+
+		return nil
+	})
+	if err != nil {
+		return 0, entities.Wallet{}, err
+	}
+
+	return bid, wallet, nil
+}
+
+// ClaimAuctionProcessing marks the auction as being processed. Returns false if
+// another request is already processing it.
+func (a *MemoryAuctionRepo) ClaimAuctionProcessing(context echo.Context, auctionId uuid.UUID, ttl time.Duration) (bool, error) {
+	isClaimed := false
+	err := a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		if _, ok := values.Get(redis_client.GenerateAuctionProcessingRedisKey(auctionId)); ok {
+			return nil
+		}
+
+		values.Set(redis_client.GenerateAuctionProcessingRedisKey(auctionId), time.Now().UnixMilli())
+		values.ExpireAt(redis_client.GenerateAuctionProcessingRedisKey(auctionId), time.Now().Add(ttl))
+		isClaimed = true
+
+		return nil
+	})
+
+	return isClaimed, err
+}
+
+func (a *MemoryAuctionRepo) ReleaseAuctionProcessing(context echo.Context, auctionId uuid.UUID) error {
+	return a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Delete(redis_client.GenerateAuctionProcessingRedisKey(auctionId))
+		return nil
+	})
+}
+
+// SaveAuctionResult stores the processed result of the auction
+func (a *MemoryAuctionRepo) SaveAuctionResult(context echo.Context, auctionId uuid.UUID, auctionResults map[string]entities.AuctionResult) error {
+	return a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		savedAuctionResults := getMemoryAuctionResults(values, auctionId)
+		for playerId, auctionResult := range auctionResults {
+			savedAuctionResults[playerId] = auctionResult
+		}
+
+		values.Set(redis_client.GenerateAuctionResultsRedisKey(auctionId), savedAuctionResults)
+
+		return nil
+	})
+}
+
+// SettleAuction applies a processed auction in one atomic step. Nothing changes unless
+// the auction is still stopped, its bids are all still open and nobody owns the players
+// won yet.
+func (a *MemoryAuctionRepo) SettleAuction(context echo.Context, auction entities.Auction, settlement entities.AuctionSettlement) error {
+	return a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		value, ok := values.Get(redis_client.GenerateAuctionRedisKey(auction.Id))
+		if !ok || value.(entities.Auction).Status != entities.AUCTION_STATUS_STOPPED {
+			return checkAuctionSettlement(AUCTION_SETTLEMENT_NOT_STOPPED, auction)
+		}
+
+		for _, bid := range settlement.Bids {
+			openBid, ok := getMemoryBidValues(values, redis_client.GenerateBidRedisKey(auction.Id, bid.UserId))[bid.PlayerId]
+			if !ok || openBid != bid.Bid {
+				return checkAuctionSettlement(AUCTION_SETTLEMENT_BIDS_CHANGED, auction)
+			}
+		}
+
+		for _, rosterPlayer := range settlement.RosterPlayers {
+			if roster_repo.GetMemoryPlayerOwner(values, auction.LeagueId, rosterPlayer.PlayerId) != uuid.Nil {
+				return checkAuctionSettlement(AUCTION_SETTLEMENT_PLAYER_OWNED, auction)
+			}
+		}
+
+		transactions := append([]entities.WalletTransaction{}, settlement.WalletTransactions...)
+		for index, transaction := range transactions {
+			wallet, status := user_repo.AdjustMemoryWalletFunds(values, transaction.UserId, auction.LeagueId, transaction.Amount, transaction.HeldAmount)
+			if status != user_repo.WALLET_ADJUSTMENT_APPLIED {
+				// The memory store doesn't roll back, so undo the funds that already moved
+				for _, appliedTransaction := range transactions[:index] {
+					user_repo.AdjustMemoryWalletFunds(values, appliedTransaction.UserId, auction.LeagueId, appliedTransaction.Amount*-1, appliedTransaction.HeldAmount*-1)
+				}
+
+				return checkAuctionSettlement(AUCTION_SETTLEMENT_MISSING_HELD_FUNDS, auction)
+			}
+
+			transactions[index].Balance = wallet.Available
+			transactions[index].HeldBalance = wallet.Held
+		}
+
+		for _, transaction := range transactions {
+			user_repo.AddMemoryWalletTransaction(values, transaction)
+		}
+
+		for _, rosterPlayer := range settlement.RosterPlayers {
+			roster_repo.AddMemoryRosterPlayer(values, rosterPlayer)
+		}
+
+		savedAuctionResults := getMemoryAuctionResults(values, auction.Id)
+		for playerId, auctionResult := range settlement.Results {
+			savedAuctionResults[playerId] = auctionResult
+		}
+		values.Set(redis_client.GenerateAuctionResultsRedisKey(auction.Id), savedAuctionResults)
+
+		for _, userId := range settlement.WaiverPriorityMoves {
+			league_repo.MoveMemoryUserToBackOfWaiverPriority(values, auction.LeagueId, userId)
+		}
+
+		closedAuction := value.(entities.Auction)
+		closedAuction.Status = entities.AUCTION_STATUS_CLOSED
+		values.Set(redis_client.GenerateAuctionRedisKey(auction.Id), closedAuction)
+
+		return nil
+	})
+}
+
+func (a *MemoryAuctionRepo) GetAuctionResults(context echo.Context, auctionId uuid.UUID) (map[string]entities.AuctionResult, error) {
+	auctionResults := make(map[string]entities.AuctionResult)
+	err := a.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		for playerId, auctionResult := range getMemoryAuctionResults(values, auctionId) {
+			auctionResults[playerId] = auctionResult
+		}
+
+		return nil
+	})
+
+	return auctionResults, err
+}
+
+func getMemoryAuctionResults(values redis_client.MemoryValues, auctionId uuid.UUID) map[string]entities.AuctionResult {
+	value, ok := values.Get(redis_client.GenerateAuctionResultsRedisKey(auctionId))
+	if !ok {
+		return make(map[string]entities.AuctionResult)
+	}
+
+	return value.(map[string]entities.AuctionResult)
+}
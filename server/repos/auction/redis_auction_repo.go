@@ -0,0 +1,994 @@
+package auction_repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	schedule_repo "github.com/wilbertthelam/prop-ock/repos/schedule"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RedisAuctionRepo struct {
+	redisClient *redis.Client
+}
+
+func NewRedis(redisClient *redis.Client) *RedisAuctionRepo {
+	return &RedisAuctionRepo{
+		redisClient,
+	}
+}
+
+func (a *RedisAuctionRepo) GetAuctionByAuctionId(context echo.Context, auctionId uuid.UUID) (entities.Auction, error) {
+	// Query Redis for the auction
+	redisAuction, err := a.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GenerateAuctionRedisKey(auctionId),
+	).Result()
+	if err != nil {
+		return entities.Auction{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get auction",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	if len(redisAuction) == 0 {
+		return entities.Auction{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "no auction found",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	startTime, err := strconv.ParseInt(redisAuction["start_time"], 10, 64)
+	if err != nil {
+		return entities.Auction{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to parse start time for auction",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"startTime", redisAuction["start_time"],
+			},
+			Err: err,
+		})
+	}
+
+	endTime, err := strconv.ParseInt(redisAuction["end_time"], 10, 64)
+	if err != nil {
+		return entities.Auction{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to parse end time for auction",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"endTime", redisAuction["end_time"],
+			},
+			Err: err,
+		})
+	}
+
+	status, err := strconv.ParseInt(redisAuction["status"], 10, 64)
+	if err != nil {
+		return entities.Auction{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to parse status for auction",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"status", redisAuction["status"],
+			},
+			Err: err,
+		})
+	}
+
+	// Auctions created before player sets existed won't have one
+	playerSetId := uuid.Nil
+	if redisAuction["player_set_id"] != "" {
+		playerSetId, err = uuid.Parse(redisAuction["player_set_id"])
+		if err != nil {
+			return entities.Auction{}, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse player set id for auction",
+				Args: []interface{}{
+					"auctionId", auctionId.String(),
+					"playerSetId", redisAuction["player_set_id"],
+				},
+				Err: err,
+			})
+		}
+	}
+
+	// Auctions created before pricing modes existed always charged the full bid
+	pricingMode := int64(entities.AUCTION_PRICING_MODE_FIRST_PRICE)
+	if redisAuction["pricing_mode"] != "" {
+		pricingMode, err = strconv.ParseInt(redisAuction["pricing_mode"], 10, 64)
+		if err != nil {
+			return entities.Auction{}, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse pricing mode for auction",
+				Args: []interface{}{
+					"auctionId", auctionId.String(),
+					"pricingMode", redisAuction["pricing_mode"],
+				},
+				Err: err,
+			})
+		}
+	}
+
+	auction := entities.Auction{
+		Id:          uuid.Must(uuid.Parse(redisAuction["id"])),
+		LeagueId:    uuid.Must(uuid.Parse(redisAuction["league_id"])),
+		PlayerSetId: playerSetId,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Status:      entities.AuctionStatus(status),
+		PricingMode: entities.AuctionPricingMode(pricingMode),
+		Name:        redisAuction["name"],
+		Notes:       redisAuction["notes"],
+	}
+
+	return auction, nil
+}
+
+func (a *RedisAuctionRepo) GetCurrentAuctionIdByLeagueId(context echo.Context, leagueId uuid.UUID) (uuid.UUID, error) {
+	// Query Redis for the leagueId
+	auctionId, err := a.redisClient.Get(
+		context.Request().Context(),
+		redis_client.GenerateLeagueToCurrentAuctionRedisKey(leagueId),
+	).Result()
+
+	// If Redis key doesn't exist, then auction doesn't exist
+	if err == redis.Nil {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "current auction does not exist for league id",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	if err != nil {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get league to current auction relationship",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"auctionId", auctionId,
+			},
+			Err: err,
+		})
+	}
+
+	if auctionId == "" {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "dangling league to current auction relationship",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	return uuid.MustParse(auctionId), nil
+}
+
+func (a *RedisAuctionRepo) SetLeagueToAuctionRelationship(context echo.Context, leagueId uuid.UUID, auctionId uuid.UUID) error {
+	// Upsert the league to auction relationship
+	_, err := a.redisClient.Set(
+		context.Request().Context(),
+		redis_client.GenerateLeagueToCurrentAuctionRedisKey(leagueId),
+		auctionId.String(),
+		0,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to set league to auction relationship",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func (a *RedisAuctionRepo) CreateAuction(context echo.Context, auctionId uuid.UUID, auction entities.Auction) error {
+	// Format for database inserting (array of strings where even index is key, odd index is value)
+	redisAuctionKeyValuePairs := []string{
+		"id", auction.Id.String(),
+		"league_id", auction.LeagueId.String(),
+		"player_set_id", auction.PlayerSetId.String(),
+		"start_time", strconv.FormatInt(auction.StartTime, 10),
+		"end_time", strconv.FormatInt(auction.EndTime, 10),
+		"status", strconv.FormatInt(int64(auction.Status), 10),
+		"pricing_mode", strconv.FormatInt(int64(auction.PricingMode), 10),
+		"name", auction.Name,
+	}
+
+	err := a.updateAuction(context, auctionId, redisAuctionKeyValuePairs)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createLeagueAuctionScript writes the auction, points its league at it and schedules it
+// to start and stop in one step, so the scheduler never sees an auction the league
+// doesn't point at, or a league pointing at an auction that will never open
+var createLeagueAuctionScript = redis.NewScript(`
+redis.call('HSET', KEYS[1], unpack(ARGV, 6))
+redis.call('SET', KEYS[2], ARGV[1])
+redis.call('ZADD', KEYS[3], ARGV[3], ARGV[2], ARGV[5], ARGV[4])
+
+return 1
+`)
+
+// CreateLeagueAuction creates the auction, makes it the current auction of its league
+// and schedules it to start and stop, in one atomic step
+func (a *RedisAuctionRepo) CreateLeagueAuction(context echo.Context, auction entities.Auction) error {
+	scriptArgs := []interface{}{
+		auction.Id.String(),
+		schedule_repo.GenerateAuctionTransitionMember(auction.Id, entities.AUCTION_TRANSITION_START),
+		auction.StartTime,
+		schedule_repo.GenerateAuctionTransitionMember(auction.Id, entities.AUCTION_TRANSITION_STOP),
+		auction.EndTime,
+		"id", auction.Id.String(),
+		"league_id", auction.LeagueId.String(),
+		"player_set_id", auction.PlayerSetId.String(),
+		"start_time", strconv.FormatInt(auction.StartTime, 10),
+		"end_time", strconv.FormatInt(auction.EndTime, 10),
+		"status", strconv.FormatInt(int64(auction.Status), 10),
+		"pricing_mode", strconv.FormatInt(int64(auction.PricingMode), 10),
+		"name", auction.Name,
+	}
+
+	_, err := createLeagueAuctionScript.Run(
+		context.Request().Context(),
+		a.redisClient,
+		[]string{
+			redis_client.GenerateAuctionRedisKey(auction.Id),
+			redis_client.GenerateLeagueToCurrentAuctionRedisKey(auction.LeagueId),
+			redis_client.GenerateAuctionTransitionsRedisKey(),
+		},
+		scriptArgs...,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to create league auction",
+			Args: []interface{}{
+				"auctionId", auction.Id.String(),
+				"leagueId", auction.LeagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func (a *RedisAuctionRepo) StartAuction(context echo.Context, auctionId uuid.UUID) error {
+	redisStatusKeyValuePair := []string{
+		"status", strconv.FormatInt(int64(entities.AUCTION_STATUS_ACTIVE), 10),
+	}
+
+	err := a.updateAuction(context, auctionId, redisStatusKeyValuePair)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (a *RedisAuctionRepo) StopAuction(context echo.Context, auctionId uuid.UUID) error {
+	redisStatusKeyValuePair := []string{
+		"status", strconv.FormatInt(int64(entities.AUCTION_STATUS_STOPPED), 10),
+	}
+
+	err := a.updateAuction(context, auctionId, redisStatusKeyValuePair)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (a *RedisAuctionRepo) CloseAuction(context echo.Context, auctionId uuid.UUID) error {
+	redisStatusKeyValuePair := []string{
+		"status", strconv.FormatInt(int64(entities.AUCTION_STATUS_CLOSED), 10),
+	}
+
+	err := a.updateAuction(context, auctionId, redisStatusKeyValuePair)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (a *RedisAuctionRepo) GetAllUserBids(context echo.Context, auctionId uuid.UUID, userId uuid.UUID) (map[string]int64, error) {
+	rawPlayerBids, err := a.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GenerateBidRedisKey(auctionId, userId),
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get all of a user's bids",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	bids := make(map[string]int64)
+	for playerId, bidString := range rawPlayerBids {
+		bid, err := strconv.ParseInt(bidString, 10, 64)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse a bid when trying to get all of a user's bids",
+				Args: []interface{}{
+					"auctionId", auctionId.String(),
+					"userId", userId.String(),
+				},
+				Err: err,
+			})
+		}
+
+		bids[playerId] = bid
+	}
+
+	return bids, nil
+}
+
+// GetAllUserBidTimestamps returns when each of the user's bids was placed, keyed on playerId
+func (a *RedisAuctionRepo) GetAllUserBidTimestamps(context echo.Context, auctionId uuid.UUID, userId uuid.UUID) (map[string]int64, error) {
+	rawTimestamps, err := a.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GenerateBidTimestampRedisKey(auctionId, userId),
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get all of a user's bid timestamps",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	timestamps := make(map[string]int64)
+	for playerId, timestampString := range rawTimestamps {
+		timestamp, err := strconv.ParseInt(timestampString, 10, 64)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse a bid timestamp when trying to get all of a user's bid timestamps",
+				Args: []interface{}{
+					"auctionId", auctionId.String(),
+					"userId", userId.String(),
+					"playerId", playerId,
+				},
+				Err: err,
+			})
+		}
+
+		timestamps[playerId] = timestamp
+	}
+
+	return timestamps, nil
+}
+
+func (a *RedisAuctionRepo) GetBid(context echo.Context, auctionId uuid.UUID, userId uuid.UUID, playerId string) (int64, error) {
+	bidString, err := a.redisClient.HGet(
+		context.Request().Context(),
+		redis_client.GenerateBidRedisKey(auctionId, userId),
+		playerId,
+	).Result()
+
+	// If Redis key doesn't exist, then bid doesn't exist
+	if err == redis.Nil {
+		return -1, nil
+	}
+
+	if err != nil {
+		return -1, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get a bid for a player",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"userId", userId.String(),
+				"playerId", playerId,
+			},
+			Err: err,
+		})
+	}
+
+	bid, err := strconv.ParseInt(bidString, 10, 64)
+	if err != nil {
+		return -1, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to parse bid amount for a player",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"userId", userId.String(),
+				"playerId", playerId,
+				"bid", bidString,
+			},
+			Err: err,
+		})
+	}
+
+	return bid, nil
+}
+
+// makeBidScript places the bid and holds the funds for it in one step, so the auction
+// status and bid limit checks, the check for an existing bid, the funds check, the hold
+// and the bid write can't interleave with another request. Returns
+// { status, available, held }, where status is one of the BID_ results.
+var makeBidScript = redis.NewScript(`
+if redis.call('HGET', KEYS[5], 'status') ~= ARGV[5] then
+	return { -2, 0, 0 }
+end
+
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+	return { -1, 0, 0 }
+end
+
+local bidCount = redis.call('HLEN', KEYS[1])
+local maxBidsPerAuction = tonumber(ARGV[6])
+local rosterSizeCap = tonumber(ARGV[7])
+if maxBidsPerAuction > 0 and bidCount >= maxBidsPerAuction then
+	return { -3, 0, 0 }
+end
+if rosterSizeCap > 0 and redis.call('HLEN', KEYS[6]) + bidCount >= rosterSizeCap then
+	return { -4, 0, 0 }
+end
+
+local bid = tonumber(ARGV[2])
+local available = tonumber(redis.call('HGET', KEYS[3], ARGV[4]) or '0')
+local held = tonumber(redis.call('HGET', KEYS[4], ARGV[4]) or '0')
+
+if available < bid then
+	return { 0, available, held }
+end
+
+available = redis.call('HINCRBY', KEYS[3], ARGV[4], -bid)
+held = redis.call('HINCRBY', KEYS[4], ARGV[4], bid)
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+
+return { 1, available, held }
+`)
+
+// cancelBidScript removes the bid and releases the funds held for it in one step.
+// Returns { status, bid, available, held } where status is 1 when the bid was
+// canceled and -1 when there was no bid on the player.
+var cancelBidScript = redis.NewScript(`
+local bid = redis.call('HGET', KEYS[1], ARGV[1])
+if not bid then
+	return { -1, 0, 0, 0 }
+end
+
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+local available = redis.call('HINCRBY', KEYS[3], ARGV[2], bid)
+local held = redis.call('HINCRBY', KEYS[4], ARGV[2], -bid)
+
+return { 1, tonumber(bid), available, held }
+`)
+
+// MakeBid places the bid and moves the bid amount from the user's available funds into
+// their held funds for the league. Returns the wallet after the hold.
+func (a *RedisAuctionRepo) MakeBid(context echo.Context, auctionId uuid.UUID, leagueId uuid.UUID, userId uuid.UUID, playerId string, bid int64, timestamp int64, limits entities.BidLimits) (entities.Wallet, error) {
+	args := []interface{}{
+		"auctionId", auctionId.String(),
+		"leagueId", leagueId.String(),
+		"userId", userId.String(),
+		"playerId", playerId,
+		"bid", fmt.Sprintf("%v", bid),
+	}
+
+	result, err := makeBidScript.Run(
+		context.Request().Context(),
+		a.redisClient,
+		[]string{
+			redis_client.GenerateBidRedisKey(auctionId, userId),
+			// Keep track of when the bid came in for breaking ties
+			redis_client.GenerateBidTimestampRedisKey(auctionId, userId),
+			redis_client.GenerateUserWalletRedisKey(userId),
+			redis_client.GenerateUserHeldWalletRedisKey(userId),
+			redis_client.GenerateAuctionRedisKey(auctionId),
+			redis_client.GenerateRosterRedisKey(leagueId, userId),
+		},
+		playerId,
+		bid,
+		timestamp,
+		leagueId.String(),
+		strconv.FormatInt(int64(entities.AUCTION_STATUS_ACTIVE), 10),
+		limits.MaxBidsPerAuction,
+		limits.RosterSizeCap,
+	).Int64Slice()
+	if err != nil {
+		return entities.Wallet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to make a bid",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	status, wallet := result[0], entities.Wallet{
+		LeagueId:  leagueId,
+		Available: result[1],
+		Held:      result[2],
+	}
+
+	err = checkMakeBid(status, wallet, limits, args)
+	if err != nil {
+		return entities.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// CancelBid removes the bid and moves the bid amount from the user's held funds back
+// into their available funds for the league. Returns the bid that was canceled and
+// the wallet after the release.
+func (a *RedisAuctionRepo) CancelBid(context echo.Context, auctionId uuid.UUID, leagueId uuid.UUID, userId uuid.UUID, playerId string) (int64, entities.Wallet, error) {
+	args := []interface{}{
+		"auctionId", auctionId.String(),
+		"leagueId", leagueId.String(),
+		"userId", userId.String(),
+		"playerId", playerId,
+	}
+
+	result, err := cancelBidScript.Run(
+		context.Request().Context(),
+		a.redisClient,
+		[]string{
+			redis_client.GenerateBidRedisKey(auctionId, userId),
+			redis_client.GenerateBidTimestampRedisKey(auctionId, userId),
+			redis_client.GenerateUserWalletRedisKey(userId),
+			redis_client.GenerateUserHeldWalletRedisKey(userId),
+		},
+		playerId,
+		leagueId.String(),
+	).Int64Slice()
+	if err != nil {
+		return 0, entities.Wallet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to cancel a bid",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	if result[0] < 0 {
+		return 0, entities.Wallet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "cannot cancel bid that doesn't exist for player",
+			Args:    args,
+			Err:     nil,
+		})
+	}
+
+	return result[1], entities.Wallet{
+		LeagueId:  leagueId,
+		Available: result[2],
+		Held:      result[3],
+	}, nil
+}
+
+// ClaimAuctionProcessing marks the auction as being processed. Returns false if
+// another request is already processing it.
+func (a *RedisAuctionRepo) ClaimAuctionProcessing(context echo.Context, auctionId uuid.UUID, ttl time.Duration) (bool, error) {
+	isClaimed, err := a.redisClient.SetNX(
+		context.Request().Context(),
+		redis_client.GenerateAuctionProcessingRedisKey(auctionId),
+		time.Now().UnixMilli(),
+		ttl,
+	).Result()
+	if err != nil {
+		return false, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to claim auction processing",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return isClaimed, nil
+}
+
+func (a *RedisAuctionRepo) ReleaseAuctionProcessing(context echo.Context, auctionId uuid.UUID) error {
+	_, err := a.redisClient.Del(
+		context.Request().Context(),
+		redis_client.GenerateAuctionProcessingRedisKey(auctionId),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to release auction processing",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func (a *RedisAuctionRepo) updateAuction(context echo.Context, auctionId uuid.UUID, keyValuePairs []string) error {
+	_, err := a.redisClient.HSet(
+		context.Request().Context(),
+		redis_client.GenerateAuctionRedisKey(auctionId),
+		keyValuePairs,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to update auction fields",
+			Args: append(
+				[]interface{}{"auctionId", auctionId.String()},
+				utils.MapStringSliceToInterfaceSlice(keyValuePairs)...,
+			),
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// SaveAuctionResult stores the processed result of the auction into the DB
+func (a *RedisAuctionRepo) SaveAuctionResult(context echo.Context, auctionId uuid.UUID, auctionResults map[string]entities.AuctionResult) error {
+	auctionResultsSize := len(auctionResults)
+	if auctionResultsSize == 0 {
+		return nil
+	}
+
+	serializedAuctionResults := make(map[string]string, auctionResultsSize)
+	for playerId, auctionResult := range auctionResults {
+		serializedAuctionResult, err := json.Marshal(auctionResult)
+		if err != nil {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to marshal player result in saving auction result",
+				Args: []interface{}{
+					"auctionId", auctionId.String(),
+					"playerId", playerId,
+				},
+				Err: err,
+			})
+		}
+		serializedAuctionResults[playerId] = string(serializedAuctionResult)
+	}
+
+	_, err := a.redisClient.HSet(
+		context.Request().Context(),
+		redis_client.GenerateAuctionResultsRedisKey(auctionId),
+		serializedAuctionResults,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to save auction results",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"auctionResults", fmt.Sprintf("%+v", serializedAuctionResults),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// settleAuctionScript applies a processed auction in one step, so a retry can't move funds
+// or hand out players a second time. Each user in the settlement has five keys, starting at
+// KEYS[5]: their bids, wallet, held wallet, wallet ledger and roster. Users are referred to
+// by their position in that list. Every check runs before anything is written, and the
+// wallet checks add up each user's moves in order. Returns one of the AUCTION_SETTLEMENT_ results.
+var settleAuctionScript = redis.NewScript(user_repo.REDIS_WALLET_LUA_FUNCTIONS + `
+if redis.call('HGET', KEYS[1], 'status') ~= ARGV[2] then
+	return 0
+end
+
+local function getUserKey(userIndex, offset)
+	return KEYS[4 + (tonumber(userIndex) - 1) * 5 + offset]
+end
+
+local userIds = {}
+local cursor = 9
+for _ = 1, tonumber(ARGV[4]) do
+	table.insert(userIds, ARGV[cursor])
+	cursor = cursor + 1
+end
+
+for _ = 1, tonumber(ARGV[5]) do
+	if redis.call('HGET', getUserKey(ARGV[cursor], 1), ARGV[cursor + 1]) ~= ARGV[cursor + 2] then
+		return -1
+	end
+	cursor = cursor + 3
+end
+
+local firstTransaction = cursor
+local balances = {}
+for _ = 1, tonumber(ARGV[6]) do
+	local balance = balances[ARGV[cursor]]
+	if not balance then
+		balance = {
+			tonumber(redis.call('HGET', getUserKey(ARGV[cursor], 2), ARGV[1]) or '0'),
+			tonumber(redis.call('HGET', getUserKey(ARGV[cursor], 3), ARGV[1]) or '0'),
+		}
+		balances[ARGV[cursor]] = balance
+	end
+
+	balance[1] = balance[1] + tonumber(ARGV[cursor + 1])
+	balance[2] = balance[2] + tonumber(ARGV[cursor + 2])
+	if balance[1] < 0 or balance[2] < 0 then
+		return -3
+	end
+	cursor = cursor + 4
+end
+
+local firstRosterPlayer = cursor
+for _ = 1, tonumber(ARGV[7]) do
+	if redis.call('HEXISTS', KEYS[3], ARGV[cursor + 1]) == 1 then
+		return -2
+	end
+	cursor = cursor + 3
+end
+
+cursor = firstTransaction
+for _ = 1, tonumber(ARGV[6]) do
+	local userIndex = ARGV[cursor]
+	adjustWallet(getUserKey(userIndex, 2), getUserKey(userIndex, 3), getUserKey(userIndex, 4), ARGV[1], tonumber(ARGV[cursor + 1]), tonumber(ARGV[cursor + 2]), ARGV[cursor + 3])
+	cursor = cursor + 4
+end
+
+for _ = 1, tonumber(ARGV[7]) do
+	redis.call('HSET', getUserKey(ARGV[cursor], 5), ARGV[cursor + 1], ARGV[cursor + 2])
+	redis.call('HSET', KEYS[3], ARGV[cursor + 1], userIds[tonumber(ARGV[cursor])])
+	cursor = cursor + 3
+end
+
+for _ = 1, tonumber(ARGV[8]) do
+	redis.call('HSET', KEYS[2], ARGV[cursor], ARGV[cursor + 1])
+	cursor = cursor + 2
+end
+
+for index = cursor, #ARGV do
+	local userId = userIds[tonumber(ARGV[index])]
+	redis.call('LREM', KEYS[4], 0, userId)
+	redis.call('RPUSH', KEYS[4], userId)
+end
+
+redis.call('HSET', KEYS[1], 'status', ARGV[3])
+
+return 1
+`)
+
+// SettleAuction applies a processed auction in one atomic step. Nothing changes unless
+// the auction is still stopped, its bids are all still open and nobody owns the players
+// won yet.
+func (a *RedisAuctionRepo) SettleAuction(context echo.Context, auction entities.Auction, settlement entities.AuctionSettlement) error {
+	newSettleAuctionError := func(message string, err error) error {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: message,
+			Args: []interface{}{
+				"auctionId", auction.Id.String(),
+				"leagueId", auction.LeagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	keys := []string{
+		redis_client.GenerateAuctionRedisKey(auction.Id),
+		redis_client.GenerateAuctionResultsRedisKey(auction.Id),
+		redis_client.GeneratePlayerToOwnerRedisKey(auction.LeagueId),
+		redis_client.GenerateLeagueWaiverPriorityRedisKey(auction.LeagueId),
+	}
+
+	// Give every user in the settlement their keys, and refer to them by position after that
+	userIds := []interface{}{}
+	userIndexes := make(map[uuid.UUID]int)
+	getUserIndex := func(userId uuid.UUID) int {
+		userIndex, ok := userIndexes[userId]
+		if ok {
+			return userIndex
+		}
+
+		userIds = append(userIds, userId.String())
+		userIndex = len(userIds)
+		userIndexes[userId] = userIndex
+		keys = append(
+			keys,
+			redis_client.GenerateBidRedisKey(auction.Id, userId),
+			redis_client.GenerateUserWalletRedisKey(userId),
+			redis_client.GenerateUserHeldWalletRedisKey(userId),
+			redis_client.GenerateUserWalletLedgerRedisKey(userId, auction.LeagueId),
+			redis_client.GenerateRosterRedisKey(auction.LeagueId, userId),
+		)
+
+		return userIndex
+	}
+
+	bidArgs := []interface{}{}
+	for _, bid := range settlement.Bids {
+		bidArgs = append(bidArgs, getUserIndex(bid.UserId), bid.PlayerId, strconv.FormatInt(bid.Bid, 10))
+	}
+
+	transactionArgs := []interface{}{}
+	for _, transaction := range settlement.WalletTransactions {
+		serializedTransaction, err := user_repo.SerializeRedisWalletTransaction(transaction)
+		if err != nil {
+			return err
+		}
+
+		transactionArgs = append(transactionArgs, getUserIndex(transaction.UserId), transaction.Amount, transaction.HeldAmount, serializedTransaction)
+	}
+
+	rosterPlayerArgs := []interface{}{}
+	for _, rosterPlayer := range settlement.RosterPlayers {
+		serializedRosterPlayer, err := json.Marshal(rosterPlayer)
+		if err != nil {
+			return newSettleAuctionError("failed to serialize roster player", err)
+		}
+
+		rosterPlayerArgs = append(rosterPlayerArgs, getUserIndex(rosterPlayer.UserId), rosterPlayer.PlayerId, string(serializedRosterPlayer))
+	}
+
+	resultArgs := []interface{}{}
+	for playerId, auctionResult := range settlement.Results {
+		serializedAuctionResult, err := json.Marshal(auctionResult)
+		if err != nil {
+			return newSettleAuctionError("failed to marshal player result in settling auction", err)
+		}
+
+		resultArgs = append(resultArgs, playerId, string(serializedAuctionResult))
+	}
+
+	waiverPriorityArgs := []interface{}{}
+	for _, userId := range settlement.WaiverPriorityMoves {
+		waiverPriorityArgs = append(waiverPriorityArgs, getUserIndex(userId))
+	}
+
+	scriptArgs := []interface{}{
+		auction.LeagueId.String(),
+		strconv.FormatInt(int64(entities.AUCTION_STATUS_STOPPED), 10),
+		strconv.FormatInt(int64(entities.AUCTION_STATUS_CLOSED), 10),
+		len(userIds),
+		len(settlement.Bids),
+		len(settlement.WalletTransactions),
+		len(settlement.RosterPlayers),
+		len(settlement.Results),
+	}
+	scriptArgs = append(scriptArgs, userIds...)
+	scriptArgs = append(scriptArgs, bidArgs...)
+	scriptArgs = append(scriptArgs, transactionArgs...)
+	scriptArgs = append(scriptArgs, rosterPlayerArgs...)
+	scriptArgs = append(scriptArgs, resultArgs...)
+	scriptArgs = append(scriptArgs, waiverPriorityArgs...)
+
+	result, err := settleAuctionScript.Run(
+		context.Request().Context(),
+		a.redisClient,
+		keys,
+		scriptArgs...,
+	).Int64()
+	if err != nil {
+		return newSettleAuctionError("failed to settle auction", err)
+	}
+
+	return checkAuctionSettlement(result, auction)
+}
+
+func (a *RedisAuctionRepo) GetAuctionResults(context echo.Context, auctionId uuid.UUID) (map[string]entities.AuctionResult, error) {
+	rawResults, err := a.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GenerateAuctionResultsRedisKey(auctionId),
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get auction results",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	auctionResults := make(map[string]entities.AuctionResult)
+	for playerId, serializedAuctionResult := range rawResults {
+		auctionResult, err := unmarshalAuctionResult(playerId, serializedAuctionResult)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to unmarshal auction result in get auction results",
+				Args: []interface{}{
+					"auctionId", auctionId.String(),
+					"playerId", playerId,
+					"serializedAuctionResult", serializedAuctionResult,
+				},
+				Err: err,
+			})
+		}
+
+		auctionResults[playerId] = auctionResult
+	}
+
+	return auctionResults, nil
+}
+
+// unmarshalAuctionResult reads a saved result. Results saved before tie-breaks existed
+// are a list of the highest bids, in which case the first bid is treated as the winner.
+func unmarshalAuctionResult(playerId string, serializedAuctionResult string) (entities.AuctionResult, error) {
+	if strings.HasPrefix(serializedAuctionResult, "[") {
+		var highestBids []entities.AuctionBid
+		err := json.Unmarshal([]byte(serializedAuctionResult), &highestBids)
+		if err != nil {
+			return entities.AuctionResult{}, err
+		}
+
+		if len(highestBids) == 0 {
+			return entities.AuctionResult{PlayerId: playerId}, nil
+		}
+
+		auctionResult := entities.AuctionResult{
+			PlayerId:   playerId,
+			WinningBid: highestBids[0],
+			Price:      highestBids[0].Bid,
+		}
+		if len(highestBids) > 1 {
+			auctionResult.TiedBids = highestBids
+		}
+
+		return auctionResult, nil
+	}
+
+	var auctionResult entities.AuctionResult
+	err := json.Unmarshal([]byte(serializedAuctionResult), &auctionResult)
+	if err != nil {
+		return entities.AuctionResult{}, err
+	}
+
+	// Results saved before pricing modes existed were always charged the full bid
+	if auctionResult.Price == 0 {
+		auctionResult.Price = auctionResult.WinningBid.Bid
+	}
+
+	return auctionResult, nil
+}
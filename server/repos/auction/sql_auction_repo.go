@@ -0,0 +1,815 @@
+package auction_repo
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	schedule_repo "github.com/wilbertthelam/prop-ock/repos/schedule"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// SqlAuctionRepo keeps auctions, bids and results in their own tables. Every bid
+// and result points at its auction and user, so neither can be left dangling.
+type SqlAuctionRepo struct {
+	sqlClient *redis_client.SqlClient
+}
+
+func NewSql(sqlClient *redis_client.SqlClient) *SqlAuctionRepo {
+	return &SqlAuctionRepo{
+		sqlClient,
+	}
+}
+
+func (a *SqlAuctionRepo) GetAuctionByAuctionId(context echo.Context, auctionId uuid.UUID) (entities.Auction, error) {
+	var auction entities.Auction
+	err := a.sqlClient.QueryRow(
+		context,
+		`SELECT id, league_id, player_set_id, start_time, end_time, status, pricing_mode, name, notes
+		FROM auctions WHERE id = ?`,
+		auctionId,
+	).Scan(
+		&auction.Id,
+		&auction.LeagueId,
+		&auction.PlayerSetId,
+		&auction.StartTime,
+		&auction.EndTime,
+		&auction.Status,
+		&auction.PricingMode,
+		&auction.Name,
+		&auction.Notes,
+	)
+	if err == sql.ErrNoRows {
+		return entities.Auction{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "no auction found",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+			},
+			Err: nil,
+		})
+	}
+	if err != nil {
+		return entities.Auction{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get auction",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return auction, nil
+}
+
+func (a *SqlAuctionRepo) GetCurrentAuctionIdByLeagueId(context echo.Context, leagueId uuid.UUID) (uuid.UUID, error) {
+	var auctionId uuid.UUID
+	err := a.sqlClient.QueryRow(
+		context,
+		"SELECT auction_id FROM league_current_auctions WHERE league_id = ?",
+		leagueId,
+	).Scan(&auctionId)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "current auction does not exist for league id",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: nil,
+		})
+	}
+	if err != nil {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get league to current auction relationship",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return auctionId, nil
+}
+
+func (a *SqlAuctionRepo) SetLeagueToAuctionRelationship(context echo.Context, leagueId uuid.UUID, auctionId uuid.UUID) error {
+	_, err := a.sqlClient.Exec(
+		context,
+		`INSERT INTO league_current_auctions (league_id, auction_id) VALUES (?, ?)
+		ON CONFLICT (league_id) DO UPDATE SET auction_id = excluded.auction_id`,
+		leagueId,
+		auctionId,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to set league to auction relationship",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"auctionId", auctionId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func (a *SqlAuctionRepo) CreateAuction(context echo.Context, auctionId uuid.UUID, auction entities.Auction) error {
+	_, err := a.sqlClient.Exec(
+		context,
+		`INSERT INTO auctions (id, league_id, player_set_id, start_time, end_time, status, pricing_mode, name, notes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			league_id = excluded.league_id,
+			player_set_id = excluded.player_set_id,
+			start_time = excluded.start_time,
+			end_time = excluded.end_time,
+			status = excluded.status,
+			pricing_mode = excluded.pricing_mode,
+			name = excluded.name,
+			notes = excluded.notes`,
+		auctionId,
+		auction.LeagueId,
+		auction.PlayerSetId,
+		auction.StartTime,
+		auction.EndTime,
+		auction.Status,
+		auction.PricingMode,
+		auction.Name,
+		auction.Notes,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to update auction fields",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// CreateLeagueAuction creates the auction, makes it the current auction of its league
+// and schedules it to start and stop, in one atomic step
+func (a *SqlAuctionRepo) CreateLeagueAuction(context echo.Context, auction entities.Auction) error {
+	return a.sqlClient.StartTransaction(context, func() error {
+		err := a.CreateAuction(context, auction.Id, auction)
+		if err != nil {
+			return err
+		}
+
+		// The auction has to exist before the league can point at it
+		err = a.SetLeagueToAuctionRelationship(context, auction.LeagueId, auction.Id)
+		if err != nil {
+			return err
+		}
+
+		err = schedule_repo.ScheduleSqlAuctionTransition(context, a.sqlClient, auction.Id, entities.AUCTION_TRANSITION_START, auction.StartTime)
+		if err != nil {
+			return err
+		}
+
+		return schedule_repo.ScheduleSqlAuctionTransition(context, a.sqlClient, auction.Id, entities.AUCTION_TRANSITION_STOP, auction.EndTime)
+	})
+}
+
+func (a *SqlAuctionRepo) StartAuction(context echo.Context, auctionId uuid.UUID) error {
+	return a.setAuctionStatus(context, auctionId, entities.AUCTION_STATUS_ACTIVE)
+}
+
+func (a *SqlAuctionRepo) StopAuction(context echo.Context, auctionId uuid.UUID) error {
+	return a.setAuctionStatus(context, auctionId, entities.AUCTION_STATUS_STOPPED)
+}
+
+func (a *SqlAuctionRepo) CloseAuction(context echo.Context, auctionId uuid.UUID) error {
+	return a.setAuctionStatus(context, auctionId, entities.AUCTION_STATUS_CLOSED)
+}
+
+func (a *SqlAuctionRepo) setAuctionStatus(context echo.Context, auctionId uuid.UUID, status entities.AuctionStatus) error {
+	result, err := a.sqlClient.Exec(
+		context,
+		"UPDATE auctions SET status = ? WHERE id = ?",
+		status,
+		auctionId,
+	)
+	if err == nil {
+		var updatedCount int64
+		updatedCount, err = result.RowsAffected()
+		if err == nil && updatedCount == 0 {
+			err = sql.ErrNoRows
+		}
+	}
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to update auction fields",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"status", fmt.Sprintf("%v", status),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func (a *SqlAuctionRepo) GetAllUserBids(context echo.Context, auctionId uuid.UUID, userId uuid.UUID) (map[string]int64, error) {
+	bids, err := a.getBidValues(context, "bid", auctionId, userId)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get all of a user's bids",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return bids, nil
+}
+
+// GetAllUserBidTimestamps returns when each of the user's bids was placed, keyed on playerId
+func (a *SqlAuctionRepo) GetAllUserBidTimestamps(context echo.Context, auctionId uuid.UUID, userId uuid.UUID) (map[string]int64, error) {
+	timestamps, err := a.getBidValues(context, "created_at", auctionId, userId)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get all of a user's bid timestamps",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return timestamps, nil
+}
+
+// getBidValues returns a column of the user's bids keyed on playerId
+func (a *SqlAuctionRepo) getBidValues(context echo.Context, column string, auctionId uuid.UUID, userId uuid.UUID) (map[string]int64, error) {
+	rows, err := a.sqlClient.Query(
+		context,
+		fmt.Sprintf("SELECT player_id, %v FROM bids WHERE auction_id = ? AND user_id = ?", column),
+		auctionId,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bidValues := make(map[string]int64)
+	for rows.Next() {
+		var playerId string
+		var bidValue int64
+		err = rows.Scan(&playerId, &bidValue)
+		if err != nil {
+			return nil, err
+		}
+
+		bidValues[playerId] = bidValue
+	}
+
+	return bidValues, rows.Err()
+}
+
+func (a *SqlAuctionRepo) GetBid(context echo.Context, auctionId uuid.UUID, userId uuid.UUID, playerId string) (int64, error) {
+	var bid int64
+	err := a.sqlClient.QueryRow(
+		context,
+		"SELECT bid FROM bids WHERE auction_id = ? AND user_id = ? AND player_id = ?",
+		auctionId,
+		userId,
+		playerId,
+	).Scan(&bid)
+
+	// If the player isn't in the user's bids, then bid doesn't exist
+	if err == sql.ErrNoRows {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get a bid for a player",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"userId", userId.String(),
+				"playerId", playerId,
+			},
+			Err: err,
+		})
+	}
+
+	return bid, nil
+}
+
+// MakeBid places the bid and moves the bid amount from the user's available funds into
+// their held funds for the league, in one transaction. Returns the wallet after the hold.
+func (a *SqlAuctionRepo) MakeBid(context echo.Context, auctionId uuid.UUID, leagueId uuid.UUID, userId uuid.UUID, playerId string, bid int64, timestamp int64, limits entities.BidLimits) (entities.Wallet, error) {
+	args := []interface{}{
+		"auctionId", auctionId.String(),
+		"leagueId", leagueId.String(),
+		"userId", userId.String(),
+		"playerId", playerId,
+		"bid", fmt.Sprintf("%v", bid),
+	}
+
+	newMakeBidError := func(err error) error {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to make a bid",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	var wallet entities.Wallet
+	err := a.sqlClient.StartTransaction(context, func() error {
+		// The no-op update locks the auction row until the bid commits, so stopping the
+		// auction waits for bids in flight and parallel bids are counted one at a time
+		result, err := a.sqlClient.Exec(
+			context,
+			"UPDATE auctions SET status = status WHERE id = ? AND status = ?",
+			auctionId,
+			entities.AUCTION_STATUS_ACTIVE,
+		)
+		if err != nil {
+			return newMakeBidError(err)
+		}
+
+		activeCount, err := result.RowsAffected()
+		if err != nil {
+			return newMakeBidError(err)
+		}
+
+		if activeCount == 0 {
+			return checkMakeBid(BID_AUCTION_NOT_ACTIVE, wallet, limits, args)
+		}
+
+		var bidCount, rosterSize int64
+		err = a.sqlClient.QueryRow(
+			context,
+			`SELECT
+				(SELECT COUNT(*) FROM bids WHERE auction_id = ? AND user_id = ?),
+				(SELECT COUNT(*) FROM rosters WHERE league_id = ? AND user_id = ?)`,
+			auctionId,
+			userId,
+			leagueId,
+			userId,
+		).Scan(&bidCount, &rosterSize)
+		if err != nil {
+			return newMakeBidError(err)
+		}
+
+		// The timestamp is kept for breaking ties
+		result, err = a.sqlClient.Exec(
+			context,
+			`INSERT INTO bids (auction_id, user_id, player_id, bid, created_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (auction_id, user_id, player_id) DO NOTHING`,
+			auctionId,
+			userId,
+			playerId,
+			bid,
+			timestamp,
+		)
+		if err != nil {
+			return newMakeBidError(err)
+		}
+
+		insertedCount, err := result.RowsAffected()
+		if err != nil {
+			return newMakeBidError(err)
+		}
+
+		if insertedCount == 0 {
+			return checkMakeBid(BID_ALREADY_EXISTS, wallet, limits, args)
+		}
+
+		status := getBidLimitStatus(bidCount, rosterSize, limits)
+		if status != BID_PLACED {
+			return checkMakeBid(status, wallet, limits, args)
+		}
+
+		wallet, status, err = user_repo.AdjustSqlWalletFunds(context, a.sqlClient, userId, leagueId, bid*-1, bid)
+		if err != nil {
+			return err
+		}
+
+		if status != user_repo.WALLET_ADJUSTMENT_APPLIED {
+			return checkMakeBid(BID_MISSING_FUNDS, wallet, limits, args)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return entities.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// CancelBid removes the bid and moves the bid amount from the user's held funds back
+// into their available funds for the league, in one transaction. Returns the bid that
+// was canceled and the wallet after the release.
+func (a *SqlAuctionRepo) CancelBid(context echo.Context, auctionId uuid.UUID, leagueId uuid.UUID, userId uuid.UUID, playerId string) (int64, entities.Wallet, error) {
+	args := []interface{}{
+		"auctionId", auctionId.String(),
+		"leagueId", leagueId.String(),
+		"userId", userId.String(),
+		"playerId", playerId,
+	}
+
+	var bid int64
+	var wallet entities.Wallet
+	err := a.sqlClient.StartTransaction(context, func() error {
+		err := a.sqlClient.QueryRow(
+			context,
+			"DELETE FROM bids WHERE auction_id = ? AND user_id = ? AND player_id = ? RETURNING bid",
+			auctionId,
+			userId,
+			playerId,
+		).Scan(&bid)
+		if err == sql.ErrNoRows {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusBadRequest,
+				Message: "cannot cancel bid that doesn't exist for player",
+				Args:    args,
+				Err:     nil,
+			})
+		}
+		if err != nil {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to cancel a bid",
+				Args:    args,
+				Err:     err,
+			})
+		}
+
+		var status int64
+		wallet, status, err = user_repo.AdjustSqlWalletFunds(context, a.sqlClient, userId, leagueId, bid, bid*-1)
+		if err != nil {
+			return err
+		}
+
+		if status != user_repo.WALLET_ADJUSTMENT_APPLIED {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "wallet does not have the funds held for bid",
+				Args:    append(args, "held", fmt.Sprintf("%v", wallet.Held)),
+				Err:     nil,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, entities.Wallet{}, err
+	}
+
+	return bid, wallet, nil
+}
+
+// ClaimAuctionProcessing marks the auction as being processed. Returns false if
+// another request is already processing it. Claims that have expired can be taken over.
+func (a *SqlAuctionRepo) ClaimAuctionProcessing(context echo.Context, auctionId uuid.UUID, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	result, err := a.sqlClient.Exec(
+		context,
+		`INSERT INTO auction_processing_claims (auction_id, expires_at) VALUES (?, ?)
+		ON CONFLICT (auction_id) DO UPDATE SET expires_at = excluded.expires_at
+		WHERE auction_processing_claims.expires_at <= ?`,
+		auctionId,
+		now.Add(ttl).UnixMilli(),
+		now.UnixMilli(),
+	)
+	if err != nil {
+		return false, newClaimAuctionProcessingError(auctionId, err)
+	}
+
+	claimedCount, err := result.RowsAffected()
+	if err != nil {
+		return false, newClaimAuctionProcessingError(auctionId, err)
+	}
+
+	return claimedCount > 0, nil
+}
+
+func newClaimAuctionProcessingError(auctionId uuid.UUID, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to claim auction processing",
+		Args: []interface{}{
+			"auctionId", auctionId.String(),
+		},
+		Err: err,
+	})
+}
+
+func (a *SqlAuctionRepo) ReleaseAuctionProcessing(context echo.Context, auctionId uuid.UUID) error {
+	_, err := a.sqlClient.Exec(
+		context,
+		"DELETE FROM auction_processing_claims WHERE auction_id = ?",
+		auctionId,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to release auction processing",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// SaveAuctionResult stores the processed result of the auction, with each
+// result's tied bids kept in order alongside it
+func (a *SqlAuctionRepo) SaveAuctionResult(context echo.Context, auctionId uuid.UUID, auctionResults map[string]entities.AuctionResult) error {
+	return a.sqlClient.StartTransaction(context, func() error {
+		for playerId, auctionResult := range auctionResults {
+			err := a.saveAuctionResult(context, auctionId, playerId, auctionResult)
+			if err != nil {
+				return utils.NewError(utils.ErrorParams{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to save auction results",
+					Args: []interface{}{
+						"auctionId", auctionId.String(),
+						"playerId", playerId,
+					},
+					Err: err,
+				})
+			}
+		}
+
+		return nil
+	})
+}
+
+func (a *SqlAuctionRepo) saveAuctionResult(context echo.Context, auctionId uuid.UUID, playerId string, auctionResult entities.AuctionResult) error {
+	_, err := a.sqlClient.Exec(
+		context,
+		`INSERT INTO auction_results (
+			auction_id, player_id, winning_user_id, winning_bid, winning_bid_created_at,
+			price, tie_break_policy, tie_break_seed
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (auction_id, player_id) DO UPDATE SET
+			winning_user_id = excluded.winning_user_id,
+			winning_bid = excluded.winning_bid,
+			winning_bid_created_at = excluded.winning_bid_created_at,
+			price = excluded.price,
+			tie_break_policy = excluded.tie_break_policy,
+			tie_break_seed = excluded.tie_break_seed`,
+		auctionId,
+		playerId,
+		auctionResult.WinningBid.UserId,
+		auctionResult.WinningBid.Bid,
+		auctionResult.WinningBid.Timestamp,
+		auctionResult.Price,
+		auctionResult.TieBreakPolicy,
+		auctionResult.TieBreakSeed,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.sqlClient.Exec(
+		context,
+		"DELETE FROM auction_result_tied_bids WHERE auction_id = ? AND player_id = ?",
+		auctionId,
+		playerId,
+	)
+	if err != nil {
+		return err
+	}
+
+	for index, tiedBid := range auctionResult.TiedBids {
+		_, err = a.sqlClient.Exec(
+			context,
+			`INSERT INTO auction_result_tied_bids (auction_id, player_id, user_id, bid, created_at, sort_order)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			auctionId,
+			playerId,
+			tiedBid.UserId,
+			tiedBid.Bid,
+			tiedBid.Timestamp,
+			index,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SettleAuction applies a processed auction in one transaction. Closing the auction is
+// the first write, so a second settlement of the same auction finds it already closed.
+func (a *SqlAuctionRepo) SettleAuction(context echo.Context, auction entities.Auction, settlement entities.AuctionSettlement) error {
+	newSettleAuctionError := func(message string, err error) error {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: message,
+			Args: []interface{}{
+				"auctionId", auction.Id.String(),
+				"leagueId", auction.LeagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return a.sqlClient.StartTransaction(context, func() error {
+		result, err := a.sqlClient.Exec(
+			context,
+			"UPDATE auctions SET status = ? WHERE id = ? AND status = ?",
+			entities.AUCTION_STATUS_CLOSED,
+			auction.Id,
+			entities.AUCTION_STATUS_STOPPED,
+		)
+		if err != nil {
+			return newSettleAuctionError("failed to close auction", err)
+		}
+
+		closedCount, err := result.RowsAffected()
+		if err != nil {
+			return newSettleAuctionError("failed to close auction", err)
+		}
+
+		if closedCount == 0 {
+			return checkAuctionSettlement(AUCTION_SETTLEMENT_NOT_STOPPED, auction)
+		}
+
+		for _, bid := range settlement.Bids {
+			var openBid int64
+			err = a.sqlClient.QueryRow(
+				context,
+				"SELECT bid FROM bids WHERE auction_id = ? AND user_id = ? AND player_id = ?",
+				auction.Id,
+				bid.UserId,
+				bid.PlayerId,
+			).Scan(&openBid)
+			if err == sql.ErrNoRows || (err == nil && openBid != bid.Bid) {
+				return checkAuctionSettlement(AUCTION_SETTLEMENT_BIDS_CHANGED, auction)
+			}
+			if err != nil {
+				return newSettleAuctionError("failed to get bid", err)
+			}
+		}
+
+		for _, transaction := range settlement.WalletTransactions {
+			wallet, status, err := user_repo.AdjustSqlWalletFunds(context, a.sqlClient, transaction.UserId, auction.LeagueId, transaction.Amount, transaction.HeldAmount)
+			if err != nil {
+				return err
+			}
+
+			if status != user_repo.WALLET_ADJUSTMENT_APPLIED {
+				return checkAuctionSettlement(AUCTION_SETTLEMENT_MISSING_HELD_FUNDS, auction)
+			}
+
+			transaction.Balance = wallet.Available
+			transaction.HeldBalance = wallet.Held
+
+			err = user_repo.AddSqlWalletTransaction(context, a.sqlClient, transaction)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, rosterPlayer := range settlement.RosterPlayers {
+			isAdded, err := roster_repo.AddSqlRosterPlayer(context, a.sqlClient, rosterPlayer)
+			if err != nil {
+				return err
+			}
+
+			if !isAdded {
+				return checkAuctionSettlement(AUCTION_SETTLEMENT_PLAYER_OWNED, auction)
+			}
+		}
+
+		for playerId, auctionResult := range settlement.Results {
+			err = a.saveAuctionResult(context, auction.Id, playerId, auctionResult)
+			if err != nil {
+				return newSettleAuctionError("failed to save auction results", err)
+			}
+		}
+
+		for _, userId := range settlement.WaiverPriorityMoves {
+			err = league_repo.MoveSqlUserToBackOfWaiverPriority(context, a.sqlClient, auction.LeagueId, userId)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (a *SqlAuctionRepo) GetAuctionResults(context echo.Context, auctionId uuid.UUID) (map[string]entities.AuctionResult, error) {
+	auctionResults, err := a.getAuctionResults(context, auctionId)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get auction results",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return auctionResults, nil
+}
+
+func (a *SqlAuctionRepo) getAuctionResults(context echo.Context, auctionId uuid.UUID) (map[string]entities.AuctionResult, error) {
+	rows, err := a.sqlClient.Query(
+		context,
+		`SELECT player_id, winning_user_id, winning_bid, winning_bid_created_at, price, tie_break_policy, tie_break_seed
+		FROM auction_results WHERE auction_id = ?`,
+		auctionId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	auctionResults := make(map[string]entities.AuctionResult)
+	for rows.Next() {
+		auctionResult := entities.AuctionResult{
+			WinningBid: entities.AuctionBid{
+				AuctionId: auctionId,
+			},
+		}
+
+		err = rows.Scan(
+			&auctionResult.PlayerId,
+			&auctionResult.WinningBid.UserId,
+			&auctionResult.WinningBid.Bid,
+			&auctionResult.WinningBid.Timestamp,
+			&auctionResult.Price,
+			&auctionResult.TieBreakPolicy,
+			&auctionResult.TieBreakSeed,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		auctionResult.WinningBid.PlayerId = auctionResult.PlayerId
+		auctionResults[auctionResult.PlayerId] = auctionResult
+	}
+
+	// Finish with the results before reading the tied bids, since
+	// SQLite only has the one connection to run them on
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = a.sqlClient.Query(
+		context,
+		`SELECT player_id, user_id, bid, created_at FROM auction_result_tied_bids
+		WHERE auction_id = ? ORDER BY player_id, sort_order`,
+		auctionId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tiedBid := entities.AuctionBid{
+			AuctionId: auctionId,
+		}
+
+		err = rows.Scan(&tiedBid.PlayerId, &tiedBid.UserId, &tiedBid.Bid, &tiedBid.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		auctionResult := auctionResults[tiedBid.PlayerId]
+		auctionResult.TiedBids = append(auctionResult.TiedBids, tiedBid)
+		auctionResults[tiedBid.PlayerId] = auctionResult
+	}
+
+	return auctionResults, rows.Err()
+}
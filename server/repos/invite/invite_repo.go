@@ -0,0 +1,46 @@
+package invite_repo
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+)
+
+type InviteRepo interface {
+	GetInviteByCode(context echo.Context, code string) (entities.LeagueInvite, error)
+	// GetInviteCodesForLeague returns the codes of every invite made for the league,
+	// including ones that have since expired
+	GetInviteCodesForLeague(context echo.Context, leagueId uuid.UUID) ([]string, error)
+	// CreateInvite stores the invite until it expires.
+	// Returns false if an invite with the same code already exists.
+	CreateInvite(context echo.Context, invite entities.LeagueInvite) (bool, error)
+	// RedeemInvite claims a use of the invite and adds the user to its league in one atomic
+	// step, putting them at the back of the waiver order and granting the starting wallet
+	// with its ledger entry. Nothing changes unless this call is the one that added the
+	// user. Returns one of the INVITE_REDEMPTION_ results.
+	RedeemInvite(context echo.Context, invite entities.LeagueInvite, userId uuid.UUID, startingWallet entities.WalletTransaction) (int64, error)
+	DeleteInvite(context echo.Context, leagueId uuid.UUID, code string) error
+}
+
+// Results of redeeming an invite, shared by every backend (and the Redis script)
+const (
+	INVITE_REDEMPTION_REDEEMED       int64 = 1
+	INVITE_REDEMPTION_USED_UP        int64 = 0
+	INVITE_REDEMPTION_ALREADY_MEMBER int64 = -1
+	INVITE_REDEMPTION_MISSING_INVITE int64 = -2
+)
+
+// New returns the InviteRepo for the storage backend picked in the config
+func New(config *config_service.Config, redisClient *redis.Client, memoryStore *redis_client.MemoryStore, sqlClient *redis_client.SqlClient) InviteRepo {
+	switch config.GetStorageConfig().Backend {
+	case config_service.STORAGE_BACKEND_MEMORY:
+		return NewMemory(memoryStore)
+	case config_service.STORAGE_BACKEND_SQL:
+		return NewSql(sqlClient)
+	}
+
+	return NewRedis(redisClient)
+}
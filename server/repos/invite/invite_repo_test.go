@@ -0,0 +1,203 @@
+package invite_repo
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wilbertthelam/prop-ock/entities"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/test_utils"
+)
+
+const (
+	parallelRedeemCount = 20
+	startingWalletFund  = 100
+)
+
+// inviteTestRepos are the repos an invite test needs, all on the same backend
+type inviteTestRepos struct {
+	inviteRepo InviteRepo
+	leagueRepo league_repo.LeagueRepo
+	userRepo   user_repo.UserRepo
+}
+
+func TestParallelRedemptions(t *testing.T) {
+	test_utils.RunOnEveryBackend(t, func(t *testing.T, backend test_utils.Backend) {
+		runParallelRedemptionTests(t, inviteTestRepos{
+			New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			league_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			user_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+		})
+	})
+}
+
+func runParallelRedemptionTests(t *testing.T, repos inviteTestRepos) {
+	t.Run("the same user redeeming in parallel joins once", func(t *testing.T) {
+		invite := setUpInviteTest(t, repos, 0)
+		userId := createUser(t, repos)
+
+		results := redeemInParallel(t, repos, invite, func(int) uuid.UUID { return userId })
+		checkResults(t, results, INVITE_REDEMPTION_REDEEMED, 1, INVITE_REDEMPTION_ALREADY_MEMBER)
+		checkInviteUses(t, repos, invite, 1)
+		checkMember(t, repos, invite, userId)
+	})
+
+	t.Run("users racing for the last use can't all join", func(t *testing.T) {
+		invite := setUpInviteTest(t, repos, 1)
+		userIds := make([]uuid.UUID, parallelRedeemCount)
+		for index := range userIds {
+			userIds[index] = createUser(t, repos)
+		}
+
+		results := redeemInParallel(t, repos, invite, func(index int) uuid.UUID { return userIds[index] })
+		checkResults(t, results, INVITE_REDEMPTION_REDEEMED, 1, INVITE_REDEMPTION_USED_UP)
+		checkInviteUses(t, repos, invite, 1)
+
+		for index, result := range results {
+			if result == INVITE_REDEMPTION_REDEEMED {
+				checkMember(t, repos, invite, userIds[index])
+			}
+		}
+	})
+}
+
+// setUpInviteTest creates a league and an invite to it with the given max uses
+func setUpInviteTest(t *testing.T, repos inviteTestRepos, maxUses int64) entities.LeagueInvite {
+	context := test_utils.NewContext()
+	invite := entities.LeagueInvite{
+		Code:      uuid.New().String(),
+		LeagueId:  uuid.New(),
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(time.Hour).UnixMilli(),
+		CreatedAt: time.Now().UnixMilli(),
+	}
+
+	err := repos.leagueRepo.CreateLeague(context, invite.LeagueId, entities.League{Id: invite.LeagueId, Name: "invites"}, entities.NewDefaultLeagueSettings(invite.LeagueId), uuid.Nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	isCreated, err := repos.inviteRepo.CreateInvite(context, invite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isCreated {
+		t.Fatalf("invite %v already exists", invite.Code)
+	}
+
+	return invite
+}
+
+func createUser(t *testing.T, repos inviteTestRepos) uuid.UUID {
+	userId := uuid.New()
+	err := repos.userRepo.CreateUser(test_utils.NewContext(), userId, entities.User{Id: userId, Name: "invitee"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return userId
+}
+
+// redeemInParallel redeems the invite from every goroutine, for the user picked by its
+// index, and returns each redemption's result
+func redeemInParallel(t *testing.T, repos inviteTestRepos, invite entities.LeagueInvite, getUserId func(index int) uuid.UUID) []int64 {
+	var waitGroup sync.WaitGroup
+	results := make([]int64, parallelRedeemCount)
+
+	start := make(chan struct{})
+	for index := 0; index < parallelRedeemCount; index++ {
+		waitGroup.Add(1)
+		go func(index int) {
+			defer waitGroup.Done()
+			<-start
+
+			userId := getUserId(index)
+			startingWallet := entities.NewWalletTransaction(userId, invite.LeagueId, startingWalletFund, 0, entities.WALLET_TRANSACTION_REASON_STARTING_GRANT, uuid.Nil, "")
+
+			result, err := repos.inviteRepo.RedeemInvite(test_utils.NewContext(), invite, userId, startingWallet)
+			if err != nil {
+				t.Error(err)
+			}
+
+			results[index] = result
+		}(index)
+	}
+
+	close(start)
+	waitGroup.Wait()
+
+	return results
+}
+
+// checkResults checks exactly the expected number of redemptions went through, and that
+// every other one was refused for the expected reason
+func checkResults(t *testing.T, results []int64, expectedResult int64, expectedCount int, otherResult int64) {
+	count := 0
+	for _, result := range results {
+		if result == expectedResult {
+			count++
+		} else if result != otherResult {
+			t.Errorf("redemption returned %v, expected %v or %v", result, expectedResult, otherResult)
+		}
+	}
+
+	if count != expectedCount {
+		t.Errorf("%v redemptions returned %v, expected %v", count, expectedResult, expectedCount)
+	}
+}
+
+func checkInviteUses(t *testing.T, repos inviteTestRepos, invite entities.LeagueInvite, expectedUses int64) {
+	storedInvite, err := repos.inviteRepo.GetInviteByCode(test_utils.NewContext(), invite.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if storedInvite.Uses != expectedUses {
+		t.Errorf("invite has %v uses, expected %v", storedInvite.Uses, expectedUses)
+	}
+}
+
+// checkMember checks the user joined the league once, with a single starting wallet grant
+func checkMember(t *testing.T, repos inviteTestRepos, invite entities.LeagueInvite, userId uuid.UUID) {
+	context := test_utils.NewContext()
+
+	isMember, err := repos.leagueRepo.IsUserMemberOfLeague(context, userId, invite.LeagueId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isMember {
+		t.Errorf("%v isn't a member of the league", userId)
+	}
+
+	waiverPriority, err := repos.leagueRepo.GetWaiverPriority(context, invite.LeagueId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(waiverPriority) != 1 || waiverPriority[0] != userId {
+		t.Errorf("waiver priority is %v, expected only %v", waiverPriority, userId)
+	}
+
+	wallets, err := repos.userRepo.GetUserWallet(context, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wallets[invite.LeagueId].Available != startingWalletFund {
+		t.Errorf("wallet is %+v, expected %v available", wallets[invite.LeagueId], startingWalletFund)
+	}
+
+	transactions, err := repos.userRepo.GetWalletTransactions(context, userId, invite.LeagueId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transactions) != 1 || transactions[0].Balance != startingWalletFund {
+		t.Errorf("wallet ledger is %+v, expected a single grant of %v", transactions, startingWalletFund)
+	}
+}
@@ -0,0 +1,133 @@
+package invite_repo
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// MemoryInviteRepo keeps invites in the memory store, which drops them once they expire
+type MemoryInviteRepo struct {
+	memoryStore *redis_client.MemoryStore
+}
+
+func NewMemory(memoryStore *redis_client.MemoryStore) *MemoryInviteRepo {
+	return &MemoryInviteRepo{
+		memoryStore,
+	}
+}
+
+func (i *MemoryInviteRepo) GetInviteByCode(context echo.Context, code string) (entities.LeagueInvite, error) {
+	var invite entities.LeagueInvite
+	err := i.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		value, ok := values.Get(redis_client.GenerateInviteRedisKey(code))
+		if !ok {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusNotFound,
+				Message: "no invite found",
+				Args: []interface{}{
+					"code", code,
+				},
+				Err: nil,
+			})
+		}
+
+		invite = value.(entities.LeagueInvite)
+		return nil
+	})
+
+	return invite, err
+}
+
+// GetInviteCodesForLeague returns the codes of every invite made for the league,
+// including ones that have since expired
+func (i *MemoryInviteRepo) GetInviteCodesForLeague(context echo.Context, leagueId uuid.UUID) ([]string, error) {
+	var codes []string
+	err := i.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		codes = values.SMembers(redis_client.GenerateLeagueToInvitesRedisKey(leagueId))
+		return nil
+	})
+
+	return codes, err
+}
+
+// CreateInvite stores the invite until it expires.
+// Returns false if an invite with the same code already exists.
+func (i *MemoryInviteRepo) CreateInvite(context echo.Context, invite entities.LeagueInvite) (bool, error) {
+	isCreated := false
+	err := i.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		_, ok := values.Get(redis_client.GenerateInviteRedisKey(invite.Code))
+		if ok {
+			return nil
+		}
+
+		values.Set(redis_client.GenerateInviteRedisKey(invite.Code), invite)
+		values.ExpireAt(redis_client.GenerateInviteRedisKey(invite.Code), time.UnixMilli(invite.ExpiresAt))
+		values.SAdd(redis_client.GenerateLeagueToInvitesRedisKey(invite.LeagueId), invite.Code)
+
+		isCreated = true
+		return nil
+	})
+
+	return isCreated, err
+}
+
+// RedeemInvite claims a use of the invite and adds the user to its league in one atomic
+// step, putting them at the back of the waiver order and granting the starting wallet
+// with its ledger entry. Nothing changes unless this call is the one that added the
+// user. Returns one of the INVITE_REDEMPTION_ results.
+func (i *MemoryInviteRepo) RedeemInvite(context echo.Context, invite entities.LeagueInvite, userId uuid.UUID, startingWallet entities.WalletTransaction) (int64, error) {
+	result := INVITE_REDEMPTION_MISSING_INVITE
+	err := i.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		storedInvite, ok := values.Get(redis_client.GenerateInviteRedisKey(invite.Code))
+		if !ok {
+			return nil
+		}
+
+		if values.SIsMember(redis_client.GenerateLeagueMembersRedisKey(invite.LeagueId), userId.String()) {
+			result = INVITE_REDEMPTION_ALREADY_MEMBER
+			return nil
+		}
+
+		currentInvite := storedInvite.(entities.LeagueInvite)
+		if currentInvite.MaxUses > 0 && currentInvite.Uses >= currentInvite.MaxUses {
+			result = INVITE_REDEMPTION_USED_UP
+			return nil
+		}
+
+		// Setting the invite clears its expiry, so put it back afterwards
+		currentInvite.Uses++
+		values.Set(redis_client.GenerateInviteRedisKey(invite.Code), currentInvite)
+		values.ExpireAt(redis_client.GenerateInviteRedisKey(invite.Code), time.UnixMilli(currentInvite.ExpiresAt))
+
+		league_repo.AddMemoryLeagueMember(values, userId, invite.LeagueId)
+
+		if startingWallet.Amount > 0 {
+			wallet, _ := user_repo.AdjustMemoryWalletFunds(values, userId, invite.LeagueId, startingWallet.Amount, 0)
+			startingWallet.Balance = wallet.Available
+			startingWallet.HeldBalance = wallet.Held
+			user_repo.AddMemoryWalletTransaction(values, startingWallet)
+		}
+
+		result = INVITE_REDEMPTION_REDEEMED
+		return nil
+	})
+
+	return result, err
+}
+
+func (i *MemoryInviteRepo) DeleteInvite(context echo.Context, leagueId uuid.UUID, code string) error {
+	return i.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Delete(redis_client.GenerateInviteRedisKey(code))
+		values.SRem(redis_client.GenerateLeagueToInvitesRedisKey(leagueId), code)
+
+		return nil
+	})
+}
@@ -0,0 +1,289 @@
+package invite_repo
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RedisInviteRepo struct {
+	redisClient *redis.Client
+}
+
+func NewRedis(redisClient *redis.Client) *RedisInviteRepo {
+	return &RedisInviteRepo{
+		redisClient,
+	}
+}
+
+func (i *RedisInviteRepo) GetInviteByCode(context echo.Context, code string) (entities.LeagueInvite, error) {
+	redisInvite, err := i.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GenerateInviteRedisKey(code),
+	).Result()
+	if err != nil {
+		return entities.LeagueInvite{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get invite",
+			Args: []interface{}{
+				"code", code,
+			},
+			Err: err,
+		})
+	}
+
+	if len(redisInvite) == 0 {
+		return entities.LeagueInvite{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "no invite found",
+			Args: []interface{}{
+				"code", code,
+			},
+			Err: nil,
+		})
+	}
+
+	leagueId, err := uuid.Parse(redisInvite["league_id"])
+	if err != nil {
+		return entities.LeagueInvite{}, newParseInviteFieldError(code, "league_id", redisInvite["league_id"], err)
+	}
+
+	invite := entities.LeagueInvite{
+		Code:     code,
+		LeagueId: leagueId,
+	}
+
+	inviteFields := []struct {
+		name  string
+		value *int64
+	}{
+		{"max_uses", &invite.MaxUses},
+		{"uses", &invite.Uses},
+		{"expires_at", &invite.ExpiresAt},
+		{"created_at", &invite.CreatedAt},
+	}
+
+	for _, inviteField := range inviteFields {
+		*inviteField.value, err = strconv.ParseInt(redisInvite[inviteField.name], 10, 64)
+		if err != nil {
+			return entities.LeagueInvite{}, newParseInviteFieldError(code, inviteField.name, redisInvite[inviteField.name], err)
+		}
+	}
+
+	return invite, nil
+}
+
+// GetInviteCodesForLeague returns the codes of every invite made for the league,
+// including ones that have since expired
+func (i *RedisInviteRepo) GetInviteCodesForLeague(context echo.Context, leagueId uuid.UUID) ([]string, error) {
+	codes, err := i.redisClient.SMembers(
+		context.Request().Context(),
+		redis_client.GenerateLeagueToInvitesRedisKey(leagueId),
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get invites for league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return codes, nil
+}
+
+// createInviteScript claims the code, saves the invite with its expiry and lists it under
+// its league in one step, so an invite is never seen half written or without its expiry.
+// Returns 1 when the invite was created and 0 when the code was already taken.
+var createInviteScript = redis.NewScript(`
+if redis.call('HSETNX', KEYS[1], 'league_id', ARGV[1]) == 0 then
+	return 0
+end
+
+redis.call('HSET', KEYS[1], unpack(ARGV, 4))
+redis.call('PEXPIREAT', KEYS[1], ARGV[3])
+redis.call('SADD', KEYS[2], ARGV[2])
+
+return 1
+`)
+
+// CreateInvite stores the invite and has Redis delete it once it expires.
+// Returns false if an invite with the same code already exists.
+func (i *RedisInviteRepo) CreateInvite(context echo.Context, invite entities.LeagueInvite) (bool, error) {
+	redisInviteKeyValuePairs := []string{
+		"max_uses", strconv.FormatInt(invite.MaxUses, 10),
+		"uses", strconv.FormatInt(invite.Uses, 10),
+		"expires_at", strconv.FormatInt(invite.ExpiresAt, 10),
+		"created_at", strconv.FormatInt(invite.CreatedAt, 10),
+	}
+
+	scriptArgs := []interface{}{
+		invite.LeagueId.String(),
+		invite.Code,
+		invite.ExpiresAt,
+	}
+	scriptArgs = append(scriptArgs, utils.MapStringSliceToInterfaceSlice(redisInviteKeyValuePairs)...)
+
+	isCreated, err := createInviteScript.Run(
+		context.Request().Context(),
+		i.redisClient,
+		[]string{
+			redis_client.GenerateInviteRedisKey(invite.Code),
+			redis_client.GenerateLeagueToInvitesRedisKey(invite.LeagueId),
+		},
+		scriptArgs...,
+	).Int64()
+	if err != nil {
+		return false, newInviteWriteError("failed to create invite", invite, err)
+	}
+
+	return isCreated == 1, nil
+}
+
+// redeemInviteScript claims a use of the invite, adds the user to the league and grants the
+// starting wallet in one step, so two redemptions racing for the last use, or the same user
+// redeeming twice, can't both get in, and a failure can't leave a use claimed without the
+// member. Returns one of the INVITE_REDEMPTION_ results.
+var redeemInviteScript = redis.NewScript(user_repo.REDIS_WALLET_LUA_FUNCTIONS + `
+local invite = redis.call('HMGET', KEYS[1], 'max_uses', 'uses')
+if not invite[1] or not invite[2] then
+	return -2
+end
+
+if redis.call('SISMEMBER', KEYS[2], ARGV[1]) == 1 then
+	return -1
+end
+
+local maxUses = tonumber(invite[1])
+if maxUses > 0 and tonumber(invite[2]) >= maxUses then
+	return 0
+end
+
+redis.call('HINCRBY', KEYS[1], 'uses', 1)
+redis.call('SADD', KEYS[2], ARGV[1])
+redis.call('SADD', KEYS[3], ARGV[2])
+redis.call('LREM', KEYS[4], 0, ARGV[1])
+redis.call('RPUSH', KEYS[4], ARGV[1])
+
+adjustWallet(KEYS[5], KEYS[6], KEYS[7], ARGV[2], tonumber(ARGV[3]), 0, ARGV[4])
+
+return 1
+`)
+
+// RedeemInvite claims a use of the invite and adds the user to its league in one atomic
+// step, putting them at the back of the waiver order and granting the starting wallet
+// with its ledger entry. Nothing changes unless this call is the one that added the
+// user. Returns one of the INVITE_REDEMPTION_ results.
+func (i *RedisInviteRepo) RedeemInvite(context echo.Context, invite entities.LeagueInvite, userId uuid.UUID, startingWallet entities.WalletTransaction) (int64, error) {
+	serializedStartingWallet := ""
+	if startingWallet.Amount > 0 {
+		var err error
+		serializedStartingWallet, err = user_repo.SerializeRedisWalletTransaction(startingWallet)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := redeemInviteScript.Run(
+		context.Request().Context(),
+		i.redisClient,
+		[]string{
+			redis_client.GenerateInviteRedisKey(invite.Code),
+			redis_client.GenerateLeagueMembersRedisKey(invite.LeagueId),
+			redis_client.GenerateUserLeaguesRedisKey(userId),
+			redis_client.GenerateLeagueWaiverPriorityRedisKey(invite.LeagueId),
+			redis_client.GenerateUserWalletRedisKey(userId),
+			redis_client.GenerateUserHeldWalletRedisKey(userId),
+			redis_client.GenerateUserWalletLedgerRedisKey(userId, invite.LeagueId),
+		},
+		userId.String(),
+		invite.LeagueId.String(),
+		startingWallet.Amount,
+		serializedStartingWallet,
+	).Int64()
+	if err != nil {
+		return 0, newRedeemInviteError(invite, userId, err)
+	}
+
+	return result, nil
+}
+
+// deleteInviteScript deletes the invite and takes it out of its league in one step
+var deleteInviteScript = redis.NewScript(`
+redis.call('DEL', KEYS[1])
+redis.call('SREM', KEYS[2], ARGV[1])
+
+return 1
+`)
+
+func (i *RedisInviteRepo) DeleteInvite(context echo.Context, leagueId uuid.UUID, code string) error {
+	_, err := deleteInviteScript.Run(
+		context.Request().Context(),
+		i.redisClient,
+		[]string{
+			redis_client.GenerateInviteRedisKey(code),
+			redis_client.GenerateLeagueToInvitesRedisKey(leagueId),
+		},
+		code,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to delete invite",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"code", code,
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func newParseInviteFieldError(code string, field string, value string, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to parse invite field",
+		Args: []interface{}{
+			"code", code,
+			"field", field,
+			"value", value,
+		},
+		Err: err,
+	})
+}
+
+func newRedeemInviteError(invite entities.LeagueInvite, userId uuid.UUID, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to redeem invite",
+		Args: []interface{}{
+			"code", invite.Code,
+			"leagueId", invite.LeagueId.String(),
+			"userId", userId.String(),
+		},
+		Err: err,
+	})
+}
+
+func newInviteWriteError(message string, invite entities.LeagueInvite, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: message,
+		Args: []interface{}{
+			"code", invite.Code,
+			"leagueId", invite.LeagueId.String(),
+		},
+		Err: err,
+	})
+}
@@ -0,0 +1,239 @@
+package invite_repo
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// SqlInviteRepo keeps invites in the invites table. Expired invites stay in the
+// table so the league can still list them, but can't be looked up by code.
+type SqlInviteRepo struct {
+	sqlClient *redis_client.SqlClient
+}
+
+func NewSql(sqlClient *redis_client.SqlClient) *SqlInviteRepo {
+	return &SqlInviteRepo{
+		sqlClient,
+	}
+}
+
+func (i *SqlInviteRepo) GetInviteByCode(context echo.Context, code string) (entities.LeagueInvite, error) {
+	var invite entities.LeagueInvite
+	err := i.sqlClient.QueryRow(
+		context,
+		`SELECT code, league_id, max_uses, uses, expires_at, created_at FROM invites
+		WHERE code = ? AND expires_at > ?`,
+		code,
+		time.Now().UnixMilli(),
+	).Scan(
+		&invite.Code,
+		&invite.LeagueId,
+		&invite.MaxUses,
+		&invite.Uses,
+		&invite.ExpiresAt,
+		&invite.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return entities.LeagueInvite{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "no invite found",
+			Args: []interface{}{
+				"code", code,
+			},
+			Err: nil,
+		})
+	}
+	if err != nil {
+		return entities.LeagueInvite{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get invite",
+			Args: []interface{}{
+				"code", code,
+			},
+			Err: err,
+		})
+	}
+
+	return invite, nil
+}
+
+// GetInviteCodesForLeague returns the codes of every invite made for the league,
+// including ones that have since expired
+func (i *SqlInviteRepo) GetInviteCodesForLeague(context echo.Context, leagueId uuid.UUID) ([]string, error) {
+	codes, err := i.sqlClient.QueryStrings(
+		context,
+		"SELECT code FROM invites WHERE league_id = ? ORDER BY code",
+		leagueId,
+	)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get invites for league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return codes, nil
+}
+
+// CreateInvite stores the invite, taking over the code if an earlier invite with it has expired.
+// Returns false if an invite with the same code already exists.
+func (i *SqlInviteRepo) CreateInvite(context echo.Context, invite entities.LeagueInvite) (bool, error) {
+	result, err := i.sqlClient.Exec(
+		context,
+		`INSERT INTO invites (code, league_id, max_uses, uses, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (code) DO UPDATE SET
+			league_id = excluded.league_id,
+			max_uses = excluded.max_uses,
+			uses = excluded.uses,
+			expires_at = excluded.expires_at,
+			created_at = excluded.created_at
+		WHERE invites.expires_at <= ?`,
+		invite.Code,
+		invite.LeagueId,
+		invite.MaxUses,
+		invite.Uses,
+		invite.ExpiresAt,
+		invite.CreatedAt,
+		time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return false, newInviteWriteError("failed to create invite", invite, err)
+	}
+
+	createdCount, err := result.RowsAffected()
+	if err != nil {
+		return false, newInviteWriteError("failed to create invite", invite, err)
+	}
+
+	return createdCount > 0, nil
+}
+
+// RedeemInvite claims a use of the invite and adds the user to its league in one
+// transaction, putting them at the back of the waiver order and granting the starting
+// wallet with its ledger entry. Nothing changes unless this call is the one that added
+// the user. Returns one of the INVITE_REDEMPTION_ results.
+func (i *SqlInviteRepo) RedeemInvite(context echo.Context, invite entities.LeagueInvite, userId uuid.UUID, startingWallet entities.WalletTransaction) (int64, error) {
+	result := INVITE_REDEMPTION_REDEEMED
+	err := i.sqlClient.StartTransaction(context, func() error {
+		// Claiming the use locks the invite, so redemptions racing for the last use wait on each other
+		claimResult, err := i.sqlClient.Exec(
+			context,
+			`UPDATE invites SET uses = uses + 1
+			WHERE code = ? AND expires_at > ? AND (max_uses = 0 OR uses < max_uses)`,
+			invite.Code,
+			time.Now().UnixMilli(),
+		)
+		if err != nil {
+			return newRedeemInviteError(invite, userId, err)
+		}
+
+		claimedCount, err := claimResult.RowsAffected()
+		if err != nil {
+			return newRedeemInviteError(invite, userId, err)
+		}
+
+		if claimedCount == 0 {
+			result, err = i.getUnclaimedInviteResult(context, invite, userId)
+			return err
+		}
+
+		isAdded, err := league_repo.AddSqlLeagueMember(context, i.sqlClient, userId, invite.LeagueId)
+		if err != nil {
+			return err
+		}
+
+		if !isAdded {
+			// Give the use back in the same transaction, so the invite ends up as it was
+			result = INVITE_REDEMPTION_ALREADY_MEMBER
+			_, err = i.sqlClient.Exec(context, "UPDATE invites SET uses = uses - 1 WHERE code = ?", invite.Code)
+			if err != nil {
+				return newRedeemInviteError(invite, userId, err)
+			}
+
+			return nil
+		}
+
+		if startingWallet.Amount <= 0 {
+			return nil
+		}
+
+		wallet, _, err := user_repo.AdjustSqlWalletFunds(context, i.sqlClient, userId, invite.LeagueId, startingWallet.Amount, 0)
+		if err != nil {
+			return err
+		}
+
+		startingWallet.Balance = wallet.Available
+		startingWallet.HeldBalance = wallet.Held
+
+		return user_repo.AddSqlWalletTransaction(context, i.sqlClient, startingWallet)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return result, nil
+}
+
+// getUnclaimedInviteResult works out why a use of the invite couldn't be claimed
+func (i *SqlInviteRepo) getUnclaimedInviteResult(context echo.Context, invite entities.LeagueInvite, userId uuid.UUID) (int64, error) {
+	var memberCount, inviteCount int64
+	err := i.sqlClient.QueryRow(
+		context,
+		`SELECT
+			(SELECT COUNT(*) FROM league_members WHERE league_id = ? AND user_id = ?),
+			(SELECT COUNT(*) FROM invites WHERE code = ? AND expires_at > ?)`,
+		invite.LeagueId,
+		userId,
+		invite.Code,
+		time.Now().UnixMilli(),
+	).Scan(&memberCount, &inviteCount)
+	if err != nil {
+		return 0, newRedeemInviteError(invite, userId, err)
+	}
+
+	if memberCount > 0 {
+		return INVITE_REDEMPTION_ALREADY_MEMBER, nil
+	}
+
+	if inviteCount > 0 {
+		return INVITE_REDEMPTION_USED_UP, nil
+	}
+
+	return INVITE_REDEMPTION_MISSING_INVITE, nil
+}
+
+func (i *SqlInviteRepo) DeleteInvite(context echo.Context, leagueId uuid.UUID, code string) error {
+	_, err := i.sqlClient.Exec(
+		context,
+		"DELETE FROM invites WHERE code = ? AND league_id = ?",
+		code,
+		leagueId,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to delete invite",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"code", code,
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
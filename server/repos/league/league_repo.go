@@ -1,173 +1,56 @@
 package league_repo
 
 import (
-	"fmt"
-	"net/http"
-
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
 	"github.com/wilbertthelam/prop-ock/entities"
-	"github.com/wilbertthelam/prop-ock/utils"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
 )
 
-type LeagueRepo struct {
-	redisClient *redis.Client
-}
-
-func New(redisClient *redis.Client) *LeagueRepo {
-	return &LeagueRepo{
-		redisClient,
-	}
-}
-
-func generateLeagueRedisKey(leagueId uuid.UUID) string {
-	return fmt.Sprintf("league:league_id:%v", leagueId.String())
-}
-
-func generateLeagueMembersRelationshipKey(leagueId uuid.UUID) string {
-	return fmt.Sprintf("relationship:league_to_user:league_id:%v", leagueId.String())
-}
-
-func (l *LeagueRepo) GetLeagueByLeagueId(context echo.Context, leagueId uuid.UUID) (entities.League, error) {
-	redisLeague, err := l.redisClient.HGetAll(
-		context.Request().Context(),
-		generateLeagueRedisKey(leagueId),
-	).Result()
-	if err != nil {
-		return entities.League{}, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to get league",
-			Args: []interface{}{
-				"leagueId", leagueId.String(),
-			},
-			Err: err,
-		})
-	}
-
-	// If league is not found, then return an empty league
-	if len(redisLeague) == 0 {
-		return entities.League{}, nil
-	}
-
-	league := entities.League{
-		Id:   uuid.Must(uuid.Parse(redisLeague["id"])),
-		Name: redisLeague["name"],
-	}
-
-	return league, nil
-}
-
-func (l *LeagueRepo) CreateLeague(context echo.Context, leagueId uuid.UUID, league entities.League) error {
-	// Format for database inserting (array of strings where even index is key, odd index is value)
-	redisLeagueKeyValuePairs := []string{
-		"id", league.Id.String(),
-		"name", league.Name,
-	}
-
-	err := l.updateLeague(context, leagueId, redisLeagueKeyValuePairs)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (l *LeagueRepo) updateLeague(context echo.Context, leagueId uuid.UUID, keyValuePairs []string) error {
-	_, err := l.redisClient.HSet(
-		context.Request().Context(),
-		generateLeagueRedisKey(leagueId),
-		keyValuePairs,
-	).Result()
-	if err != nil {
-		return utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to update league fields",
-			Args: append(
-				[]interface{}{"leagueId", leagueId.String()},
-				utils.MapStringSliceToInterfaceSlice(keyValuePairs)...,
-			),
-			Err: err,
-		})
-	}
-
-	return nil
-}
-
-func (l *LeagueRepo) IsUserMemberOfLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) (bool, error) {
-	isMember, err := l.redisClient.SIsMember(
-		context.Request().Context(),
-		generateLeagueMembersRelationshipKey(leagueId),
-		userId.String(),
-	).Result()
-	if err != nil {
-		return false, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to check if user is in league",
-			Args: []interface{}{
-				"userId", userId.String(),
-				"leagueId", leagueId.String(),
-			},
-			Err: err,
-		})
-	}
-
-	return isMember, nil
-}
-
-func (l *LeagueRepo) AddUserToLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) error {
-	_, err := l.redisClient.SAdd(
-		context.Request().Context(),
-		generateLeagueMembersRelationshipKey(leagueId),
-		userId.String(),
-	).Result()
-	if err != nil {
-		return utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to save marshal player bid in saving auction result",
-			Args: []interface{}{
-				"userId", userId.String(),
-				"leagueId", leagueId.String(),
-			},
-			Err: err,
-		})
-	}
-
-	return nil
-}
-
-func (l *LeagueRepo) GetMembersInLeague(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
-	stringUserIds, err := l.redisClient.SMembers(
-		context.Request().Context(),
-		generateLeagueMembersRelationshipKey(leagueId),
-	).Result()
-	if err != nil {
-		return nil, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to get users in league",
-			Args: []interface{}{
-				"leagueId", leagueId.String(),
-			},
-			Err: err,
-		})
-	}
-
-	userIds := make([]uuid.UUID, len(stringUserIds))
-	for index, stringUserId := range stringUserIds {
-		userId, err := uuid.Parse(stringUserId)
-		if err != nil {
-			return nil, utils.NewError(utils.ErrorParams{
-				Code:    http.StatusInternalServerError,
-				Message: "failed to parse userId from Redis string to uuid",
-				Args: []interface{}{
-					"userId", stringUserId,
-				},
-				Err: err,
-			})
-		}
-
-		userIds[index] = userId
-	}
-
-	return userIds, nil
+type LeagueRepo interface {
+	GetLeagueByLeagueId(context echo.Context, leagueId uuid.UUID) (entities.League, error)
+	// CreateLeague creates the league with its settings, and makes the owner its owner unless
+	// they're left empty, in one atomic step
+	CreateLeague(context echo.Context, leagueId uuid.UUID, league entities.League, settings entities.LeagueSettings, ownerId uuid.UUID) error
+	// GetLeagueSettings returns the league's rules, using the defaults for anything never set.
+	// Leagues from before settings existed kept their tie-break policy and release refund
+	// on the league hash, so those are read from there when the settings don't have them.
+	GetLeagueSettings(context echo.Context, leagueId uuid.UUID) (entities.LeagueSettings, error)
+	SaveLeagueSettings(context echo.Context, leagueId uuid.UUID, settings entities.LeagueSettings) error
+	// GetLeagueRoles returns every user in the league with a stored role
+	GetLeagueRoles(context echo.Context, leagueId uuid.UUID) (map[uuid.UUID]entities.LeagueRole, error)
+	// GetLeagueRole returns the user's stored role, or an invalid role if they don't have one
+	GetLeagueRole(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) (entities.LeagueRole, error)
+	SetLeagueRole(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, role entities.LeagueRole) error
+	RemoveLeagueRole(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error
+	// TransferLeagueOwnership makes the user the league's owner and any other owner a
+	// commissioner, in one atomic step
+	TransferLeagueOwnership(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error
+	IsUserMemberOfLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) (bool, error)
+	// AddUserToLeague adds the user to the league's members, their list of leagues and
+	// the back of the league's waiver order
+	AddUserToLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) error
+	// RemoveUserFromLeague drops the user from the league's members, their list of
+	// leagues and the league's waiver order
+	RemoveUserFromLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) error
+	GetWaiverPriority(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error)
+	// MoveUserToBackOfWaiverPriority drops the user to the lowest waiver priority,
+	// adding them to the order if they weren't in it yet
+	MoveUserToBackOfWaiverPriority(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error
+	GetLeaguesForUser(context echo.Context, userId uuid.UUID) ([]uuid.UUID, error)
+	GetMembersInLeague(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error)
+}
+
+// New returns the LeagueRepo for the storage backend picked in the config
+func New(config *config_service.Config, redisClient *redis.Client, memoryStore *redis_client.MemoryStore, sqlClient *redis_client.SqlClient) LeagueRepo {
+	switch config.GetStorageConfig().Backend {
+	case config_service.STORAGE_BACKEND_MEMORY:
+		return NewMemory(memoryStore)
+	case config_service.STORAGE_BACKEND_SQL:
+		return NewSql(sqlClient)
+	}
+
+	return NewRedis(redisClient)
 }
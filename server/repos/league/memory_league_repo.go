@@ -0,0 +1,278 @@
+package league_repo
+
+import (
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+)
+
+// MemoryLeagueRepo keeps leagues, their members, roles and waiver order in the memory store
+type MemoryLeagueRepo struct {
+	memoryStore *redis_client.MemoryStore
+}
+
+func NewMemory(memoryStore *redis_client.MemoryStore) *MemoryLeagueRepo {
+	return &MemoryLeagueRepo{
+		memoryStore,
+	}
+}
+
+func (l *MemoryLeagueRepo) GetLeagueByLeagueId(context echo.Context, leagueId uuid.UUID) (entities.League, error) {
+	var league entities.League
+	err := l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		// If league is not found, then return an empty league
+		value, ok := values.Get(redis_client.GenerateLeagueRedisKey(leagueId))
+		if ok {
+			league = value.(entities.League)
+		}
+
+		return nil
+	})
+
+	return league, err
+}
+
+// CreateLeague creates the league with its settings, and makes the owner its owner unless
+// they're left empty
+func (l *MemoryLeagueRepo) CreateLeague(context echo.Context, leagueId uuid.UUID, league entities.League, settings entities.LeagueSettings, ownerId uuid.UUID) error {
+	settings.LeagueId = leagueId
+
+	return l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Set(redis_client.GenerateLeagueRedisKey(leagueId), league)
+		values.Set(redis_client.GenerateLeagueSettingsRedisKey(leagueId), settings)
+
+		if ownerId != uuid.Nil {
+			roles := getMemoryLeagueRoles(values, leagueId)
+			roles[ownerId] = entities.LEAGUE_ROLE_OWNER
+			values.Set(redis_client.GenerateLeagueRolesRedisKey(leagueId), roles)
+		}
+
+		return nil
+	})
+}
+
+// GetLeagueSettings returns the league's rules, using the defaults if they were never saved
+func (l *MemoryLeagueRepo) GetLeagueSettings(context echo.Context, leagueId uuid.UUID) (entities.LeagueSettings, error) {
+	settings := entities.NewDefaultLeagueSettings(leagueId)
+	err := l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		value, ok := values.Get(redis_client.GenerateLeagueSettingsRedisKey(leagueId))
+		if ok {
+			settings = value.(entities.LeagueSettings)
+		}
+
+		return nil
+	})
+
+	return settings, err
+}
+
+func (l *MemoryLeagueRepo) SaveLeagueSettings(context echo.Context, leagueId uuid.UUID, settings entities.LeagueSettings) error {
+	settings.LeagueId = leagueId
+
+	return l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Set(redis_client.GenerateLeagueSettingsRedisKey(leagueId), settings)
+		return nil
+	})
+}
+
+// GetLeagueRoles returns every user in the league with a stored role
+func (l *MemoryLeagueRepo) GetLeagueRoles(context echo.Context, leagueId uuid.UUID) (map[uuid.UUID]entities.LeagueRole, error) {
+	roles := make(map[uuid.UUID]entities.LeagueRole)
+	err := l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		for userId, role := range getMemoryLeagueRoles(values, leagueId) {
+			roles[userId] = role
+		}
+
+		return nil
+	})
+
+	return roles, err
+}
+
+// GetLeagueRole returns the user's stored role, or an invalid role if they don't have one
+func (l *MemoryLeagueRepo) GetLeagueRole(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) (entities.LeagueRole, error) {
+	role := entities.LEAGUE_ROLE_INVALID
+	err := l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		storedRole, ok := getMemoryLeagueRoles(values, leagueId)[userId]
+		if ok {
+			role = storedRole
+		}
+
+		return nil
+	})
+
+	return role, err
+}
+
+func (l *MemoryLeagueRepo) SetLeagueRole(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, role entities.LeagueRole) error {
+	return l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		roles := getMemoryLeagueRoles(values, leagueId)
+		roles[userId] = role
+		values.Set(redis_client.GenerateLeagueRolesRedisKey(leagueId), roles)
+
+		return nil
+	})
+}
+
+func (l *MemoryLeagueRepo) RemoveLeagueRole(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error {
+	return l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		roles := getMemoryLeagueRoles(values, leagueId)
+		delete(roles, userId)
+		values.Set(redis_client.GenerateLeagueRolesRedisKey(leagueId), roles)
+
+		return nil
+	})
+}
+
+// TransferLeagueOwnership makes the user the league's owner and any other owner a commissioner
+func (l *MemoryLeagueRepo) TransferLeagueOwnership(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error {
+	return l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		roles := getMemoryLeagueRoles(values, leagueId)
+		for roleUserId, role := range roles {
+			if role == entities.LEAGUE_ROLE_OWNER {
+				roles[roleUserId] = entities.LEAGUE_ROLE_COMMISSIONER
+			}
+		}
+
+		roles[userId] = entities.LEAGUE_ROLE_OWNER
+		values.Set(redis_client.GenerateLeagueRolesRedisKey(leagueId), roles)
+
+		return nil
+	})
+}
+
+func getMemoryLeagueRoles(values redis_client.MemoryValues, leagueId uuid.UUID) map[uuid.UUID]entities.LeagueRole {
+	value, ok := values.Get(redis_client.GenerateLeagueRolesRedisKey(leagueId))
+	if !ok {
+		return make(map[uuid.UUID]entities.LeagueRole)
+	}
+
+	return value.(map[uuid.UUID]entities.LeagueRole)
+}
+
+func (l *MemoryLeagueRepo) IsUserMemberOfLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) (bool, error) {
+	isMember := false
+	err := l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		isMember = values.SIsMember(redis_client.GenerateLeagueMembersRedisKey(leagueId), userId.String())
+		return nil
+	})
+
+	return isMember, err
+}
+
+// AddUserToLeague adds the user to the league's members, their list of leagues and
+// the back of the league's waiver order
+func (l *MemoryLeagueRepo) AddUserToLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) error {
+	return l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		AddMemoryLeagueMember(values, userId, leagueId)
+		return nil
+	})
+}
+
+// AddMemoryLeagueMember adds the user to the league and to the back of its waiver order
+// inside a memory store update, so other repos can add a member alongside their own writes.
+// Returns false without changing anything if the user was already a member.
+func AddMemoryLeagueMember(values redis_client.MemoryValues, userId uuid.UUID, leagueId uuid.UUID) bool {
+	if values.SIsMember(redis_client.GenerateLeagueMembersRedisKey(leagueId), userId.String()) {
+		return false
+	}
+
+	values.SAdd(redis_client.GenerateLeagueMembersRedisKey(leagueId), userId.String())
+	values.SAdd(redis_client.GenerateUserLeaguesRedisKey(userId), leagueId.String())
+
+	userIds := removeUserId(getMemoryWaiverPriority(values, leagueId), userId)
+	values.Set(redis_client.GenerateLeagueWaiverPriorityRedisKey(leagueId), append(userIds, userId))
+
+	return true
+}
+
+// RemoveUserFromLeague drops the user from the league's members, their list of
+// leagues and the league's waiver order
+func (l *MemoryLeagueRepo) RemoveUserFromLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) error {
+	return l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.SRem(redis_client.GenerateLeagueMembersRedisKey(leagueId), userId.String())
+		values.SRem(redis_client.GenerateUserLeaguesRedisKey(userId), leagueId.String())
+		values.Set(redis_client.GenerateLeagueWaiverPriorityRedisKey(leagueId), removeUserId(getMemoryWaiverPriority(values, leagueId), userId))
+
+		return nil
+	})
+}
+
+func (l *MemoryLeagueRepo) GetWaiverPriority(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
+	var userIds []uuid.UUID
+	err := l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		userIds = append([]uuid.UUID{}, getMemoryWaiverPriority(values, leagueId)...)
+		return nil
+	})
+
+	return userIds, err
+}
+
+// MoveUserToBackOfWaiverPriority drops the user to the lowest waiver priority,
+// adding them to the order if they weren't in it yet
+func (l *MemoryLeagueRepo) MoveUserToBackOfWaiverPriority(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error {
+	return l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		MoveMemoryUserToBackOfWaiverPriority(values, leagueId, userId)
+		return nil
+	})
+}
+
+// MoveMemoryUserToBackOfWaiverPriority drops the user to the lowest waiver priority. It's
+// exported so settling an auction can move tie-break winners alongside its own writes. The
+// memory store must already be locked.
+func MoveMemoryUserToBackOfWaiverPriority(values redis_client.MemoryValues, leagueId uuid.UUID, userId uuid.UUID) {
+	userIds := removeUserId(getMemoryWaiverPriority(values, leagueId), userId)
+	values.Set(redis_client.GenerateLeagueWaiverPriorityRedisKey(leagueId), append(userIds, userId))
+}
+
+func getMemoryWaiverPriority(values redis_client.MemoryValues, leagueId uuid.UUID) []uuid.UUID {
+	value, ok := values.Get(redis_client.GenerateLeagueWaiverPriorityRedisKey(leagueId))
+	if !ok {
+		return []uuid.UUID{}
+	}
+
+	return value.([]uuid.UUID)
+}
+
+// removeUserId returns a new list without the user in it
+func removeUserId(userIds []uuid.UUID, userId uuid.UUID) []uuid.UUID {
+	remainingUserIds := make([]uuid.UUID, 0, len(userIds))
+	for _, remainingUserId := range userIds {
+		if remainingUserId != userId {
+			remainingUserIds = append(remainingUserIds, remainingUserId)
+		}
+	}
+
+	return remainingUserIds
+}
+
+func (l *MemoryLeagueRepo) GetLeaguesForUser(context echo.Context, userId uuid.UUID) ([]uuid.UUID, error) {
+	var leagueIds []uuid.UUID
+	err := l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		leagueIds = parseMemoryIds(values.SMembers(redis_client.GenerateUserLeaguesRedisKey(userId)))
+		return nil
+	})
+
+	return leagueIds, err
+}
+
+func (l *MemoryLeagueRepo) GetMembersInLeague(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
+	var userIds []uuid.UUID
+	err := l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		userIds = parseMemoryIds(values.SMembers(redis_client.GenerateLeagueMembersRedisKey(leagueId)))
+		return nil
+	})
+
+	return userIds, err
+}
+
+// parseMemoryIds reads back ids the memory repo saved itself, so they always parse
+func parseMemoryIds(stringIds []string) []uuid.UUID {
+	ids := make([]uuid.UUID, len(stringIds))
+	for index, stringId := range stringIds {
+		ids[index] = uuid.MustParse(stringId)
+	}
+
+	return ids
+}
@@ -0,0 +1,630 @@
+package league_repo
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RedisLeagueRepo struct {
+	redisClient *redis.Client
+}
+
+func NewRedis(redisClient *redis.Client) *RedisLeagueRepo {
+	return &RedisLeagueRepo{
+		redisClient,
+	}
+}
+
+func (l *RedisLeagueRepo) GetLeagueByLeagueId(context echo.Context, leagueId uuid.UUID) (entities.League, error) {
+	redisLeague, err := l.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GenerateLeagueRedisKey(leagueId),
+	).Result()
+	if err != nil {
+		return entities.League{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	// If league is not found, then return an empty league
+	if len(redisLeague) == 0 {
+		return entities.League{}, nil
+	}
+
+	league := entities.League{
+		Id:   uuid.Must(uuid.Parse(redisLeague["id"])),
+		Name: redisLeague["name"],
+	}
+
+	return league, nil
+}
+
+// createLeagueScript writes the league, its settings and its owner in one step, so a league
+// can't be left without the owner it was created for. ARGV[3] is how many of the fields
+// after it belong to the league hash, the rest are its settings.
+var createLeagueScript = redis.NewScript(`
+local settingsIndex = 4 + tonumber(ARGV[3])
+
+redis.call('HSET', KEYS[1], unpack(ARGV, 4, settingsIndex - 1))
+redis.call('HSET', KEYS[2], unpack(ARGV, settingsIndex))
+
+if ARGV[1] ~= '' then
+	redis.call('HSET', KEYS[3], ARGV[1], ARGV[2])
+end
+
+return 1
+`)
+
+// CreateLeague creates the league with its settings, and makes the owner its owner unless
+// they're left empty, in one atomic step
+func (l *RedisLeagueRepo) CreateLeague(context echo.Context, leagueId uuid.UUID, league entities.League, settings entities.LeagueSettings, ownerId uuid.UUID) error {
+	// Format for database inserting (array of strings where even index is key, odd index is value)
+	redisLeagueKeyValuePairs := []string{
+		"id", league.Id.String(),
+		"name", league.Name,
+	}
+
+	rawOwnerId := ""
+	if ownerId != uuid.Nil {
+		rawOwnerId = ownerId.String()
+	}
+
+	scriptArgs := []interface{}{
+		rawOwnerId,
+		strconv.FormatInt(int64(entities.LEAGUE_ROLE_OWNER), 10),
+		len(redisLeagueKeyValuePairs),
+	}
+	scriptArgs = append(scriptArgs, utils.MapStringSliceToInterfaceSlice(redisLeagueKeyValuePairs)...)
+	scriptArgs = append(scriptArgs, utils.MapStringSliceToInterfaceSlice(getRedisLeagueSettingsKeyValuePairs(settings))...)
+
+	_, err := createLeagueScript.Run(
+		context.Request().Context(),
+		l.redisClient,
+		[]string{
+			redis_client.GenerateLeagueRedisKey(leagueId),
+			redis_client.GenerateLeagueSettingsRedisKey(leagueId),
+			redis_client.GenerateLeagueRolesRedisKey(leagueId),
+		},
+		scriptArgs...,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to create league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"ownerId", ownerId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// GetLeagueSettings returns the league's rules, using the defaults for anything never set
+func (l *RedisLeagueRepo) GetLeagueSettings(context echo.Context, leagueId uuid.UUID) (entities.LeagueSettings, error) {
+	redisSettings, err := l.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GenerateLeagueSettingsRedisKey(leagueId),
+	).Result()
+	if err != nil {
+		return entities.LeagueSettings{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get league settings",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	settings := entities.NewDefaultLeagueSettings(leagueId)
+	settingFields := []struct {
+		name  string
+		value *int64
+	}{
+		{"starting_wallet", &settings.StartingWallet},
+		{"min_bid", &settings.MinBid},
+		{"bid_increment", &settings.BidIncrement},
+		{"max_bids_per_auction", &settings.MaxBidsPerAuction},
+		{"roster_size_cap", &settings.RosterSizeCap},
+		{"auction_duration", &settings.AuctionDuration},
+		{"release_refund_percentage", &settings.ReleaseRefundPercentage},
+	}
+
+	for _, settingField := range settingFields {
+		if redisSettings[settingField.name] == "" {
+			continue
+		}
+
+		*settingField.value, err = strconv.ParseInt(redisSettings[settingField.name], 10, 64)
+		if err != nil {
+			return entities.LeagueSettings{}, newParseLeagueSettingError(leagueId, settingField.name, redisSettings[settingField.name], err)
+		}
+	}
+
+	if redisSettings["tie_break_policy"] != "" {
+		rawTieBreakPolicy, err := strconv.ParseInt(redisSettings["tie_break_policy"], 10, 64)
+		if err != nil {
+			return entities.LeagueSettings{}, newParseLeagueSettingError(leagueId, "tie_break_policy", redisSettings["tie_break_policy"], err)
+		}
+
+		settings.TieBreakPolicy = entities.TieBreakPolicy(rawTieBreakPolicy)
+	}
+
+	return settings, nil
+}
+
+func (l *RedisLeagueRepo) SaveLeagueSettings(context echo.Context, leagueId uuid.UUID, settings entities.LeagueSettings) error {
+	_, err := l.redisClient.HSet(
+		context.Request().Context(),
+		redis_client.GenerateLeagueSettingsRedisKey(leagueId),
+		getRedisLeagueSettingsKeyValuePairs(settings),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to save league settings",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"settings", fmt.Sprintf("%+v", settings),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// getRedisLeagueSettingsKeyValuePairs formats the settings for the settings hash
+// (array of strings where even index is key, odd index is value)
+func getRedisLeagueSettingsKeyValuePairs(settings entities.LeagueSettings) []string {
+	return []string{
+		"starting_wallet", strconv.FormatInt(settings.StartingWallet, 10),
+		"min_bid", strconv.FormatInt(settings.MinBid, 10),
+		"bid_increment", strconv.FormatInt(settings.BidIncrement, 10),
+		"max_bids_per_auction", strconv.FormatInt(settings.MaxBidsPerAuction, 10),
+		"roster_size_cap", strconv.FormatInt(settings.RosterSizeCap, 10),
+		"auction_duration", strconv.FormatInt(settings.AuctionDuration, 10),
+		"tie_break_policy", strconv.FormatInt(int64(settings.TieBreakPolicy), 10),
+		"release_refund_percentage", strconv.FormatInt(settings.ReleaseRefundPercentage, 10),
+	}
+}
+
+func newParseLeagueSettingError(leagueId uuid.UUID, field string, value string, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to parse league setting",
+		Args: []interface{}{
+			"leagueId", leagueId.String(),
+			"field", field,
+			"value", value,
+		},
+		Err: err,
+	})
+}
+
+// GetLeagueRoles returns every user in the league with a stored role
+func (l *RedisLeagueRepo) GetLeagueRoles(context echo.Context, leagueId uuid.UUID) (map[uuid.UUID]entities.LeagueRole, error) {
+	redisRoles, err := l.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GenerateLeagueRolesRedisKey(leagueId),
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get league roles",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	roles := make(map[uuid.UUID]entities.LeagueRole, len(redisRoles))
+	for rawUserId, rawRole := range redisRoles {
+		userId, err := uuid.Parse(rawUserId)
+		if err != nil {
+			return nil, newParseLeagueRoleError(leagueId, rawUserId, rawRole, err)
+		}
+
+		role, err := strconv.ParseInt(rawRole, 10, 64)
+		if err != nil {
+			return nil, newParseLeagueRoleError(leagueId, rawUserId, rawRole, err)
+		}
+
+		roles[userId] = entities.LeagueRole(role)
+	}
+
+	return roles, nil
+}
+
+// GetLeagueRole returns the user's stored role, or an invalid role if they don't have one
+func (l *RedisLeagueRepo) GetLeagueRole(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) (entities.LeagueRole, error) {
+	rawRole, err := l.redisClient.HGet(
+		context.Request().Context(),
+		redis_client.GenerateLeagueRolesRedisKey(leagueId),
+		userId.String(),
+	).Result()
+	if err == redis.Nil {
+		return entities.LEAGUE_ROLE_INVALID, nil
+	}
+	if err != nil {
+		return entities.LEAGUE_ROLE_INVALID, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get league role",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	role, err := strconv.ParseInt(rawRole, 10, 64)
+	if err != nil {
+		return entities.LEAGUE_ROLE_INVALID, newParseLeagueRoleError(leagueId, userId.String(), rawRole, err)
+	}
+
+	return entities.LeagueRole(role), nil
+}
+
+func (l *RedisLeagueRepo) SetLeagueRole(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, role entities.LeagueRole) error {
+	_, err := l.redisClient.HSet(
+		context.Request().Context(),
+		redis_client.GenerateLeagueRolesRedisKey(leagueId),
+		userId.String(),
+		strconv.FormatInt(int64(role), 10),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to set league role",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"userId", userId.String(),
+				"role", fmt.Sprintf("%v", role),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func (l *RedisLeagueRepo) RemoveLeagueRole(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error {
+	_, err := l.redisClient.HDel(
+		context.Request().Context(),
+		redis_client.GenerateLeagueRolesRedisKey(leagueId),
+		userId.String(),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to remove league role",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// transferLeagueOwnershipScript demotes every owner to commissioner and makes the user the
+// owner in one step, so the league is never left with no owner or two
+var transferLeagueOwnershipScript = redis.NewScript(`
+local roles = redis.call('HGETALL', KEYS[1])
+for index = 1, #roles, 2 do
+	if roles[index + 1] == ARGV[2] then
+		redis.call('HSET', KEYS[1], roles[index], ARGV[3])
+	end
+end
+
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+
+return 1
+`)
+
+// TransferLeagueOwnership makes the user the league's owner and any other owner a
+// commissioner, in one atomic step
+func (l *RedisLeagueRepo) TransferLeagueOwnership(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error {
+	_, err := transferLeagueOwnershipScript.Run(
+		context.Request().Context(),
+		l.redisClient,
+		[]string{
+			redis_client.GenerateLeagueRolesRedisKey(leagueId),
+		},
+		userId.String(),
+		strconv.FormatInt(int64(entities.LEAGUE_ROLE_OWNER), 10),
+		strconv.FormatInt(int64(entities.LEAGUE_ROLE_COMMISSIONER), 10),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to transfer league ownership",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func newParseLeagueRoleError(leagueId uuid.UUID, userId string, role string, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to parse league role",
+		Args: []interface{}{
+			"leagueId", leagueId.String(),
+			"userId", userId,
+			"role", role,
+		},
+		Err: err,
+	})
+}
+
+func (l *RedisLeagueRepo) IsUserMemberOfLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) (bool, error) {
+	isMember, err := l.redisClient.SIsMember(
+		context.Request().Context(),
+		redis_client.GenerateLeagueMembersRedisKey(leagueId),
+		userId.String(),
+	).Result()
+	if err != nil {
+		return false, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to check if user is in league",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return isMember, nil
+}
+
+// addUserToLeagueScript adds the user to the league's members, keeps the reverse
+// relationship so we can look up every league a user belongs to, and puts them at the
+// back of the waiver order, in one step
+var addUserToLeagueScript = redis.NewScript(`
+redis.call('SADD', KEYS[1], ARGV[1])
+redis.call('SADD', KEYS[2], ARGV[2])
+redis.call('LREM', KEYS[3], 0, ARGV[1])
+redis.call('RPUSH', KEYS[3], ARGV[1])
+
+return 1
+`)
+
+// AddUserToLeague adds the user to the league's members, their list of leagues and
+// the back of the league's waiver order, in one atomic step
+func (l *RedisLeagueRepo) AddUserToLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) error {
+	_, err := addUserToLeagueScript.Run(
+		context.Request().Context(),
+		l.redisClient,
+		[]string{
+			redis_client.GenerateLeagueMembersRedisKey(leagueId),
+			redis_client.GenerateUserLeaguesRedisKey(userId),
+			redis_client.GenerateLeagueWaiverPriorityRedisKey(leagueId),
+		},
+		userId.String(),
+		leagueId.String(),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to add user to league",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// removeUserFromLeagueScript drops the user from the league's members, their list of
+// leagues and the league's waiver order in one step
+var removeUserFromLeagueScript = redis.NewScript(`
+redis.call('SREM', KEYS[1], ARGV[1])
+redis.call('SREM', KEYS[2], ARGV[2])
+redis.call('LREM', KEYS[3], 0, ARGV[1])
+
+return 1
+`)
+
+// RemoveUserFromLeague drops the user from the league's members, their list of
+// leagues and the league's waiver order, in one atomic step
+func (l *RedisLeagueRepo) RemoveUserFromLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) error {
+	_, err := removeUserFromLeagueScript.Run(
+		context.Request().Context(),
+		l.redisClient,
+		[]string{
+			redis_client.GenerateLeagueMembersRedisKey(leagueId),
+			redis_client.GenerateUserLeaguesRedisKey(userId),
+			redis_client.GenerateLeagueWaiverPriorityRedisKey(leagueId),
+		},
+		userId.String(),
+		leagueId.String(),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to remove user from league",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func (l *RedisLeagueRepo) GetWaiverPriority(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
+	stringUserIds, err := l.redisClient.LRange(
+		context.Request().Context(),
+		redis_client.GenerateLeagueWaiverPriorityRedisKey(leagueId),
+		0,
+		-1,
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get waiver priority for league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	userIds := make([]uuid.UUID, len(stringUserIds))
+	for index, stringUserId := range stringUserIds {
+		userId, err := uuid.Parse(stringUserId)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse userId from Redis string to uuid",
+				Args: []interface{}{
+					"userId", stringUserId,
+				},
+				Err: err,
+			})
+		}
+
+		userIds[index] = userId
+	}
+
+	return userIds, nil
+}
+
+// moveUserToBackOfWaiverPriorityScript takes the user out of the waiver order and puts
+// them back at the end in one step, so they can't be missing from it in between
+var moveUserToBackOfWaiverPriorityScript = redis.NewScript(`
+redis.call('LREM', KEYS[1], 0, ARGV[1])
+redis.call('RPUSH', KEYS[1], ARGV[1])
+
+return 1
+`)
+
+// MoveUserToBackOfWaiverPriority drops the user to the lowest waiver priority,
+// adding them to the order if they weren't in it yet
+func (l *RedisLeagueRepo) MoveUserToBackOfWaiverPriority(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error {
+	_, err := moveUserToBackOfWaiverPriorityScript.Run(
+		context.Request().Context(),
+		l.redisClient,
+		[]string{
+			redis_client.GenerateLeagueWaiverPriorityRedisKey(leagueId),
+		},
+		userId.String(),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to move user to back of waiver priority",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func (l *RedisLeagueRepo) GetLeaguesForUser(context echo.Context, userId uuid.UUID) ([]uuid.UUID, error) {
+	stringLeagueIds, err := l.redisClient.SMembers(
+		context.Request().Context(),
+		redis_client.GenerateUserLeaguesRedisKey(userId),
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get leagues for user",
+			Args: []interface{}{
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	leagueIds := make([]uuid.UUID, len(stringLeagueIds))
+	for index, stringLeagueId := range stringLeagueIds {
+		leagueId, err := uuid.Parse(stringLeagueId)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse leagueId from Redis string to uuid",
+				Args: []interface{}{
+					"leagueId", stringLeagueId,
+				},
+				Err: err,
+			})
+		}
+
+		leagueIds[index] = leagueId
+	}
+
+	return leagueIds, nil
+}
+
+func (l *RedisLeagueRepo) GetMembersInLeague(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
+	stringUserIds, err := l.redisClient.SMembers(
+		context.Request().Context(),
+		redis_client.GenerateLeagueMembersRedisKey(leagueId),
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get users in league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	userIds := make([]uuid.UUID, len(stringUserIds))
+	for index, stringUserId := range stringUserIds {
+		userId, err := uuid.Parse(stringUserId)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse userId from Redis string to uuid",
+				Args: []interface{}{
+					"userId", stringUserId,
+				},
+				Err: err,
+			})
+		}
+
+		userIds[index] = userId
+	}
+
+	return userIds, nil
+}
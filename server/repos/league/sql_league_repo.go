@@ -0,0 +1,535 @@
+package league_repo
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// SqlLeagueRepo keeps leagues in the leagues table, with their settings, members,
+// roles and waiver order each in their own table keyed on the league
+type SqlLeagueRepo struct {
+	sqlClient *redis_client.SqlClient
+}
+
+func NewSql(sqlClient *redis_client.SqlClient) *SqlLeagueRepo {
+	return &SqlLeagueRepo{
+		sqlClient,
+	}
+}
+
+func (l *SqlLeagueRepo) GetLeagueByLeagueId(context echo.Context, leagueId uuid.UUID) (entities.League, error) {
+	var league entities.League
+	err := l.sqlClient.QueryRow(
+		context,
+		"SELECT id, name FROM leagues WHERE id = ?",
+		leagueId,
+	).Scan(&league.Id, &league.Name)
+
+	// If league is not found, then return an empty league
+	if err == sql.ErrNoRows {
+		return entities.League{}, nil
+	}
+	if err != nil {
+		return entities.League{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return league, nil
+}
+
+// CreateLeague creates the league with its settings, and makes the owner its owner unless
+// they're left empty, in one transaction
+func (l *SqlLeagueRepo) CreateLeague(context echo.Context, leagueId uuid.UUID, league entities.League, settings entities.LeagueSettings, ownerId uuid.UUID) error {
+	return l.sqlClient.StartTransaction(context, func() error {
+		_, err := l.sqlClient.Exec(
+			context,
+			`INSERT INTO leagues (id, name) VALUES (?, ?)
+			ON CONFLICT (id) DO UPDATE SET name = excluded.name`,
+			leagueId,
+			league.Name,
+		)
+		if err != nil {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to update league fields",
+				Args: []interface{}{
+					"leagueId", leagueId.String(),
+				},
+				Err: err,
+			})
+		}
+
+		err = l.SaveLeagueSettings(context, leagueId, settings)
+		if err != nil {
+			return err
+		}
+
+		if ownerId == uuid.Nil {
+			return nil
+		}
+
+		return l.SetLeagueRole(context, leagueId, ownerId, entities.LEAGUE_ROLE_OWNER)
+	})
+}
+
+// GetLeagueSettings returns the league's rules, using the defaults if they were never saved
+func (l *SqlLeagueRepo) GetLeagueSettings(context echo.Context, leagueId uuid.UUID) (entities.LeagueSettings, error) {
+	settings := entities.NewDefaultLeagueSettings(leagueId)
+	err := l.sqlClient.QueryRow(
+		context,
+		`SELECT starting_wallet, min_bid, bid_increment, max_bids_per_auction, roster_size_cap,
+			auction_duration, tie_break_policy, release_refund_percentage
+		FROM league_settings WHERE league_id = ?`,
+		leagueId,
+	).Scan(
+		&settings.StartingWallet,
+		&settings.MinBid,
+		&settings.BidIncrement,
+		&settings.MaxBidsPerAuction,
+		&settings.RosterSizeCap,
+		&settings.AuctionDuration,
+		&settings.TieBreakPolicy,
+		&settings.ReleaseRefundPercentage,
+	)
+	if err == sql.ErrNoRows {
+		return entities.NewDefaultLeagueSettings(leagueId), nil
+	}
+	if err != nil {
+		return entities.LeagueSettings{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get league settings",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return settings, nil
+}
+
+func (l *SqlLeagueRepo) SaveLeagueSettings(context echo.Context, leagueId uuid.UUID, settings entities.LeagueSettings) error {
+	_, err := l.sqlClient.Exec(
+		context,
+		`INSERT INTO league_settings (
+			league_id, starting_wallet, min_bid, bid_increment, max_bids_per_auction,
+			roster_size_cap, auction_duration, tie_break_policy, release_refund_percentage
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (league_id) DO UPDATE SET
+			starting_wallet = excluded.starting_wallet,
+			min_bid = excluded.min_bid,
+			bid_increment = excluded.bid_increment,
+			max_bids_per_auction = excluded.max_bids_per_auction,
+			roster_size_cap = excluded.roster_size_cap,
+			auction_duration = excluded.auction_duration,
+			tie_break_policy = excluded.tie_break_policy,
+			release_refund_percentage = excluded.release_refund_percentage`,
+		leagueId,
+		settings.StartingWallet,
+		settings.MinBid,
+		settings.BidIncrement,
+		settings.MaxBidsPerAuction,
+		settings.RosterSizeCap,
+		settings.AuctionDuration,
+		settings.TieBreakPolicy,
+		settings.ReleaseRefundPercentage,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to save league settings",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// GetLeagueRoles returns every user in the league with a stored role
+func (l *SqlLeagueRepo) GetLeagueRoles(context echo.Context, leagueId uuid.UUID) (map[uuid.UUID]entities.LeagueRole, error) {
+	newGetLeagueRolesError := func(err error) error {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get league roles",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	rows, err := l.sqlClient.Query(
+		context,
+		"SELECT user_id, role FROM league_roles WHERE league_id = ?",
+		leagueId,
+	)
+	if err != nil {
+		return nil, newGetLeagueRolesError(err)
+	}
+	defer rows.Close()
+
+	roles := make(map[uuid.UUID]entities.LeagueRole)
+	for rows.Next() {
+		var userId uuid.UUID
+		var role entities.LeagueRole
+		err = rows.Scan(&userId, &role)
+		if err != nil {
+			return nil, newGetLeagueRolesError(err)
+		}
+
+		roles[userId] = role
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, newGetLeagueRolesError(err)
+	}
+
+	return roles, nil
+}
+
+// GetLeagueRole returns the user's stored role, or an invalid role if they don't have one
+func (l *SqlLeagueRepo) GetLeagueRole(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) (entities.LeagueRole, error) {
+	var role entities.LeagueRole
+	err := l.sqlClient.QueryRow(
+		context,
+		"SELECT role FROM league_roles WHERE league_id = ? AND user_id = ?",
+		leagueId,
+		userId,
+	).Scan(&role)
+	if err == sql.ErrNoRows {
+		return entities.LEAGUE_ROLE_INVALID, nil
+	}
+	if err != nil {
+		return entities.LEAGUE_ROLE_INVALID, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get league role",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return role, nil
+}
+
+func (l *SqlLeagueRepo) SetLeagueRole(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, role entities.LeagueRole) error {
+	_, err := l.sqlClient.Exec(
+		context,
+		`INSERT INTO league_roles (league_id, user_id, role) VALUES (?, ?, ?)
+		ON CONFLICT (league_id, user_id) DO UPDATE SET role = excluded.role`,
+		leagueId,
+		userId,
+		role,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to set league role",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"userId", userId.String(),
+				"role", fmt.Sprintf("%v", role),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func (l *SqlLeagueRepo) RemoveLeagueRole(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error {
+	_, err := l.sqlClient.Exec(
+		context,
+		"DELETE FROM league_roles WHERE league_id = ? AND user_id = ?",
+		leagueId,
+		userId,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to remove league role",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// TransferLeagueOwnership makes the user the league's owner and any other owner a
+// commissioner, in one transaction
+func (l *SqlLeagueRepo) TransferLeagueOwnership(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error {
+	return l.sqlClient.StartTransaction(context, func() error {
+		_, err := l.sqlClient.Exec(
+			context,
+			"UPDATE league_roles SET role = ? WHERE league_id = ? AND role = ?",
+			entities.LEAGUE_ROLE_COMMISSIONER,
+			leagueId,
+			entities.LEAGUE_ROLE_OWNER,
+		)
+		if err != nil {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to demote league owners",
+				Args: []interface{}{
+					"leagueId", leagueId.String(),
+				},
+				Err: err,
+			})
+		}
+
+		return l.SetLeagueRole(context, leagueId, userId, entities.LEAGUE_ROLE_OWNER)
+	})
+}
+
+func (l *SqlLeagueRepo) IsUserMemberOfLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) (bool, error) {
+	var memberCount int64
+	err := l.sqlClient.QueryRow(
+		context,
+		"SELECT COUNT(*) FROM league_members WHERE league_id = ? AND user_id = ?",
+		leagueId,
+		userId,
+	).Scan(&memberCount)
+	if err != nil {
+		return false, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to check if user is in league",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return memberCount > 0, nil
+}
+
+// AddUserToLeague adds the user to the league's members and the back of the league's
+// waiver order, in one transaction
+func (l *SqlLeagueRepo) AddUserToLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) error {
+	return l.sqlClient.StartTransaction(context, func() error {
+		_, err := AddSqlLeagueMember(context, l.sqlClient, userId, leagueId)
+		return err
+	})
+}
+
+// AddSqlLeagueMember adds the user to the league and to the back of its waiver order, so
+// other repos can add a member inside their own transaction. Returns false without changing
+// anything if the user was already a member.
+func AddSqlLeagueMember(context echo.Context, sqlClient *redis_client.SqlClient, userId uuid.UUID, leagueId uuid.UUID) (bool, error) {
+	args := []interface{}{
+		"userId", userId.String(),
+		"leagueId", leagueId.String(),
+	}
+
+	result, err := sqlClient.Exec(
+		context,
+		`INSERT INTO league_members (league_id, user_id) VALUES (?, ?)
+		ON CONFLICT (league_id, user_id) DO NOTHING`,
+		leagueId,
+		userId,
+	)
+	if err != nil {
+		return false, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to add user to league",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	addedCount, err := result.RowsAffected()
+	if err != nil {
+		return false, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to check if user was added to league",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	if addedCount == 0 {
+		return false, nil
+	}
+
+	_, err = sqlClient.Exec(
+		context,
+		`INSERT INTO waiver_priorities (league_id, user_id, priority) VALUES (
+			?, ?, (SELECT COALESCE(MAX(priority), 0) + 1 FROM waiver_priorities WHERE league_id = ?)
+		)
+		ON CONFLICT (league_id, user_id) DO UPDATE SET priority = excluded.priority`,
+		leagueId,
+		userId,
+		leagueId,
+	)
+	if err != nil {
+		return false, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to add user to back of waiver priority",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	return true, nil
+}
+
+// RemoveUserFromLeague drops the user from the league's members and the league's waiver order
+func (l *SqlLeagueRepo) RemoveUserFromLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) error {
+	return l.sqlClient.StartTransaction(context, func() error {
+		_, err := l.sqlClient.Exec(
+			context,
+			"DELETE FROM league_members WHERE league_id = ? AND user_id = ?",
+			leagueId,
+			userId,
+		)
+		if err != nil {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to remove user from league",
+				Args: []interface{}{
+					"userId", userId.String(),
+					"leagueId", leagueId.String(),
+				},
+				Err: err,
+			})
+		}
+
+		_, err = l.sqlClient.Exec(
+			context,
+			"DELETE FROM waiver_priorities WHERE league_id = ? AND user_id = ?",
+			leagueId,
+			userId,
+		)
+		if err != nil {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to remove user from waiver priority",
+				Args: []interface{}{
+					"userId", userId.String(),
+					"leagueId", leagueId.String(),
+				},
+				Err: err,
+			})
+		}
+
+		return nil
+	})
+}
+
+func (l *SqlLeagueRepo) GetWaiverPriority(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
+	userIds, err := l.sqlClient.QueryUuids(
+		context,
+		"SELECT user_id FROM waiver_priorities WHERE league_id = ? ORDER BY priority",
+		leagueId,
+	)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get waiver priority for league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return userIds, nil
+}
+
+// MoveUserToBackOfWaiverPriority drops the user to the lowest waiver priority,
+// adding them to the order if they weren't in it yet
+func (l *SqlLeagueRepo) MoveUserToBackOfWaiverPriority(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error {
+	return MoveSqlUserToBackOfWaiverPriority(context, l.sqlClient, leagueId, userId)
+}
+
+// MoveSqlUserToBackOfWaiverPriority drops the user to the lowest waiver priority, so other
+// repos can move a user inside their own transaction, like settling an auction
+func MoveSqlUserToBackOfWaiverPriority(context echo.Context, sqlClient *redis_client.SqlClient, leagueId uuid.UUID, userId uuid.UUID) error {
+	_, err := sqlClient.Exec(
+		context,
+		`INSERT INTO waiver_priorities (league_id, user_id, priority) VALUES (
+			?, ?, (SELECT COALESCE(MAX(priority), 0) + 1 FROM waiver_priorities WHERE league_id = ?)
+		)
+		ON CONFLICT (league_id, user_id) DO UPDATE SET priority = excluded.priority`,
+		leagueId,
+		userId,
+		leagueId,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to add user to back of waiver priority",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func (l *SqlLeagueRepo) GetLeaguesForUser(context echo.Context, userId uuid.UUID) ([]uuid.UUID, error) {
+	leagueIds, err := l.sqlClient.QueryUuids(
+		context,
+		"SELECT league_id FROM league_members WHERE user_id = ? ORDER BY league_id",
+		userId,
+	)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get leagues for user",
+			Args: []interface{}{
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return leagueIds, nil
+}
+
+func (l *SqlLeagueRepo) GetMembersInLeague(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
+	userIds, err := l.sqlClient.QueryUuids(
+		context,
+		"SELECT user_id FROM league_members WHERE league_id = ? ORDER BY user_id",
+		leagueId,
+	)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get users in league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return userIds, nil
+}
@@ -0,0 +1,160 @@
+package member_repo
+
+import (
+	"net/http"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auction_repo "github.com/wilbertthelam/prop-ock/repos/auction"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// MemberRepo takes users out of leagues, which touches everything they hold in the league
+type MemberRepo interface {
+	// RemoveLeagueMember takes the user out of the league in one atomic step. Their open bids
+	// in the league's current auction are canceled and refunded, with each refund recorded in
+	// their wallet ledger, their roster is released, their wallet for the league is archived,
+	// and their role, membership and waiver spot are dropped. Fails without changing anything
+	// if the user isn't in the league. Returns the archived wallet.
+	RemoveLeagueMember(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) (entities.Wallet, error)
+}
+
+// New returns the MemberRepo for the storage backend picked in the config
+func New(config *config_service.Config, redisClient *redis.Client, memoryStore *redis_client.MemoryStore, sqlClient *redis_client.SqlClient) MemberRepo {
+	switch config.GetStorageConfig().Backend {
+	case config_service.STORAGE_BACKEND_MEMORY:
+		return NewMemory(memoryStore)
+	case config_service.STORAGE_BACKEND_SQL:
+		return NewSql(sqlClient)
+	}
+
+	return NewRedis(redisClient)
+}
+
+// memberRepos are the repos that hold a member's state, for backends whose transactions
+// keep every write made through them together
+type memberRepos struct {
+	auctionRepo auction_repo.AuctionRepo
+	leagueRepo  league_repo.LeagueRepo
+	rosterRepo  roster_repo.RosterRepo
+	userRepo    user_repo.UserRepo
+}
+
+// removeLeagueMember removes the member through each repo inside one transaction
+func removeLeagueMember(context echo.Context, transactor redis_client.Transactor, repos memberRepos, leagueId uuid.UUID, userId uuid.UUID) (entities.Wallet, error) {
+	var archivedWallet entities.Wallet
+	err := transactor.StartTransaction(context, func() error {
+		isMember, err := repos.leagueRepo.IsUserMemberOfLeague(context, userId, leagueId)
+		if err != nil {
+			return err
+		}
+
+		if !isMember {
+			return newNotLeagueMemberError(leagueId, userId)
+		}
+
+		err = cancelLeavingMemberBids(context, repos, leagueId, userId)
+		if err != nil {
+			return err
+		}
+
+		rosterPlayers, err := repos.rosterRepo.GetRoster(context, leagueId, userId)
+		if err != nil {
+			return err
+		}
+
+		for _, rosterPlayer := range rosterPlayers {
+			err = repos.rosterRepo.RemovePlayerFromRoster(context, leagueId, userId, rosterPlayer.PlayerId)
+			if err != nil {
+				return err
+			}
+		}
+
+		archivedWallet, err = repos.userRepo.ArchiveUserWallet(context, userId, leagueId)
+		if err != nil {
+			return err
+		}
+
+		// Commissioners who leave stop running the league
+		err = repos.leagueRepo.RemoveLeagueRole(context, leagueId, userId)
+		if err != nil {
+			return err
+		}
+
+		return repos.leagueRepo.RemoveUserFromLeague(context, userId, leagueId)
+	})
+	if err != nil {
+		return entities.Wallet{}, err
+	}
+
+	return archivedWallet, nil
+}
+
+// cancelLeavingMemberBids cancels and refunds every bid the user has open in the league's
+// current auction. Bids in auctions that were already processed are settled, so they stay.
+func cancelLeavingMemberBids(context echo.Context, repos memberRepos, leagueId uuid.UUID, userId uuid.UUID) error {
+	auctionId, err := repos.auctionRepo.GetCurrentAuctionIdByLeagueId(context, leagueId)
+	if utils.IsNotFoundError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	auction, err := repos.auctionRepo.GetAuctionByAuctionId(context, auctionId)
+	if err != nil {
+		return err
+	}
+
+	if !isRefundableAuctionStatus(auction.Status) {
+		return nil
+	}
+
+	bids, err := repos.auctionRepo.GetAllUserBids(context, auctionId, userId)
+	if err != nil {
+		return err
+	}
+
+	for playerId := range bids {
+		bid, wallet, err := repos.auctionRepo.CancelBid(context, auctionId, leagueId, userId, playerId)
+		if err != nil {
+			return err
+		}
+
+		refund := entities.NewWalletTransaction(userId, leagueId, bid, bid*-1, entities.WALLET_TRANSACTION_REASON_BID_CANCEL, auctionId, playerId)
+		refund.Balance = wallet.Available
+		refund.HeldBalance = wallet.Held
+
+		err = repos.userRepo.AddWalletTransaction(context, refund)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isRefundableAuctionStatus checks the auction hasn't been processed yet, so the funds
+// for its bids are still held
+func isRefundableAuctionStatus(status entities.AuctionStatus) bool {
+	return status == entities.AUCTION_STATUS_ACTIVE || status == entities.AUCTION_STATUS_STOPPED
+}
+
+func newNotLeagueMemberError(leagueId uuid.UUID, userId uuid.UUID) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusBadRequest,
+		Message: "user is not a member of this league",
+		Args: []interface{}{
+			"userId", userId.String(),
+			"leagueId", leagueId.String(),
+		},
+		Err: nil,
+	})
+}
@@ -0,0 +1,241 @@
+package member_repo
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auction_repo "github.com/wilbertthelam/prop-ock/repos/auction"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/test_utils"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+const (
+	startingWalletFund = 100
+	openBid            = 30
+	rosterPlayerId     = "roster_player"
+	biddedPlayerId     = "bidded_player"
+)
+
+// memberTestRepos are the repos a member test needs, all on the same backend
+type memberTestRepos struct {
+	memberRepo  MemberRepo
+	auctionRepo auction_repo.AuctionRepo
+	leagueRepo  league_repo.LeagueRepo
+	rosterRepo  roster_repo.RosterRepo
+	userRepo    user_repo.UserRepo
+}
+
+// memberTest is a league with a member who holds a player and an open bid
+type memberTest struct {
+	leagueId  uuid.UUID
+	userId    uuid.UUID
+	auctionId uuid.UUID
+}
+
+func TestRemoveLeagueMember(t *testing.T) {
+	test_utils.RunOnEveryBackend(t, func(t *testing.T, backend test_utils.Backend) {
+		runRemoveLeagueMemberTests(t, memberTestRepos{
+			New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			auction_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			league_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			roster_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			user_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+		})
+	})
+}
+
+func runRemoveLeagueMemberTests(t *testing.T, repos memberTestRepos) {
+	t.Run("the member leaves with everything they hold", func(t *testing.T) {
+		test := setUpMemberTest(t, repos)
+
+		archivedWallet, err := repos.memberRepo.RemoveLeagueMember(test_utils.NewContext(), test.leagueId, test.userId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if archivedWallet.Available != startingWalletFund || archivedWallet.Held != 0 {
+			t.Errorf("archived wallet is %+v, expected %v available and nothing held", archivedWallet, startingWalletFund)
+		}
+
+		checkRemoved(t, repos, test)
+	})
+
+	t.Run("removing the member again changes nothing", func(t *testing.T) {
+		test := setUpMemberTest(t, repos)
+
+		_, err := repos.memberRepo.RemoveLeagueMember(test_utils.NewContext(), test.leagueId, test.userId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = repos.memberRepo.RemoveLeagueMember(test_utils.NewContext(), test.leagueId, test.userId)
+		userErr, ok := err.(*utils.Error)
+		if !ok || userErr.Code != http.StatusBadRequest {
+			t.Fatalf("expected the second removal to be refused, got %v", err)
+		}
+
+		checkRemoved(t, repos, test)
+	})
+}
+
+// setUpMemberTest creates a league with a funded member who owns one player and has a bid
+// open on another in the league's active auction
+func setUpMemberTest(t *testing.T, repos memberTestRepos) memberTest {
+	context := test_utils.NewContext()
+	test := memberTest{
+		leagueId:  uuid.New(),
+		userId:    uuid.New(),
+		auctionId: uuid.New(),
+	}
+
+	err := repos.leagueRepo.CreateLeague(context, test.leagueId, entities.League{Id: test.leagueId, Name: "members"}, entities.NewDefaultLeagueSettings(test.leagueId), uuid.Nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repos.userRepo.CreateUser(context, test.userId, entities.User{Id: test.userId, Name: "member"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repos.leagueRepo.AddUserToLeague(context, test.userId, test.leagueId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repos.leagueRepo.SetLeagueRole(context, test.leagueId, test.userId, entities.LEAGUE_ROLE_COMMISSIONER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repos.userRepo.AddFundsToUserWallet(context, test.userId, test.leagueId, startingWalletFund)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repos.rosterRepo.AddPlayerToRoster(context, entities.RosterPlayer{
+		PlayerId:   rosterPlayerId,
+		UserId:     test.userId,
+		LeagueId:   test.leagueId,
+		Price:      1,
+		AcquiredAt: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repos.auctionRepo.CreateAuction(context, test.auctionId, entities.Auction{
+		Id:       test.auctionId,
+		LeagueId: test.leagueId,
+		Status:   entities.AUCTION_STATUS_ACTIVE,
+		Name:     "members",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repos.auctionRepo.SetLeagueToAuctionRelationship(context, test.leagueId, test.auctionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repos.auctionRepo.MakeBid(context, test.auctionId, test.leagueId, test.userId, biddedPlayerId, openBid, 1, entities.BidLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return test
+}
+
+// checkRemoved checks the member is out of the league, their bid was refunded once, their
+// player is back in the pool and their wallet was archived
+func checkRemoved(t *testing.T, repos memberTestRepos, test memberTest) {
+	context := test_utils.NewContext()
+
+	isMember, err := repos.leagueRepo.IsUserMemberOfLeague(context, test.userId, test.leagueId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if isMember {
+		t.Errorf("%v is still a member of the league", test.userId)
+	}
+
+	waiverPriority, err := repos.leagueRepo.GetWaiverPriority(context, test.leagueId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(waiverPriority) != 0 {
+		t.Errorf("waiver priority is %v, expected nobody", waiverPriority)
+	}
+
+	roles, err := repos.leagueRepo.GetLeagueRoles(context, test.leagueId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := roles[test.userId]; ok {
+		t.Errorf("%v still has a role in the league", test.userId)
+	}
+
+	bids, err := repos.auctionRepo.GetAllUserBids(context, test.auctionId, test.userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bids) != 0 {
+		t.Errorf("bids are %v, expected none", bids)
+	}
+
+	owner, err := repos.rosterRepo.GetPlayerOwner(context, test.leagueId, rosterPlayerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if owner != uuid.Nil {
+		t.Errorf("%v is still owned by %v", rosterPlayerId, owner)
+	}
+
+	wallets, err := repos.userRepo.GetUserWallet(context, test.userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := wallets[test.leagueId]; ok {
+		t.Errorf("wallet is %+v, expected it to be archived", wallets[test.leagueId])
+	}
+
+	archivedWallets, err := repos.userRepo.GetArchivedUserWallets(context, test.userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if archivedWallets[test.leagueId].Available != startingWalletFund || archivedWallets[test.leagueId].Held != 0 {
+		t.Errorf("archived wallet is %+v, expected %v available and nothing held", archivedWallets[test.leagueId], startingWalletFund)
+	}
+
+	transactions, err := repos.userRepo.GetWalletTransactions(context, test.userId, test.leagueId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refunds := 0
+	for _, transaction := range transactions {
+		if transaction.Reason == entities.WALLET_TRANSACTION_REASON_BID_CANCEL {
+			refunds++
+			if transaction.Amount != openBid || transaction.Balance != startingWalletFund {
+				t.Errorf("refund is %+v, expected %v back for a balance of %v", transaction, openBid, startingWalletFund)
+			}
+		}
+	}
+
+	if refunds != 1 {
+		t.Errorf("wallet ledger is %+v, expected a single refund", transactions)
+	}
+}
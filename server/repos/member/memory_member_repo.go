@@ -0,0 +1,40 @@
+package member_repo
+
+import (
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auction_repo "github.com/wilbertthelam/prop-ock/repos/auction"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+)
+
+// MemoryMemberRepo removes members through the other memory repos while holding the
+// store's lock, so nothing else sees the member half removed
+type MemoryMemberRepo struct {
+	memoryStore *redis_client.MemoryStore
+	repos       memberRepos
+}
+
+func NewMemory(memoryStore *redis_client.MemoryStore) *MemoryMemberRepo {
+	return &MemoryMemberRepo{
+		memoryStore,
+		memberRepos{
+			auction_repo.NewMemory(memoryStore),
+			league_repo.NewMemory(memoryStore),
+			roster_repo.NewMemory(memoryStore),
+			user_repo.NewMemory(memoryStore),
+		},
+	}
+}
+
+// RemoveLeagueMember takes the user out of the league in one atomic step. Their open bids
+// in the league's current auction are canceled and refunded, with each refund recorded in
+// their wallet ledger, their roster is released, their wallet for the league is archived,
+// and their role, membership and waiver spot are dropped. Fails without changing anything
+// if the user isn't in the league. Returns the archived wallet.
+func (m *MemoryMemberRepo) RemoveLeagueMember(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) (entities.Wallet, error) {
+	return removeLeagueMember(context, m.memoryStore, m.repos, leagueId, userId)
+}
@@ -0,0 +1,176 @@
+package member_repo
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auction_repo "github.com/wilbertthelam/prop-ock/repos/auction"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RedisMemberRepo struct {
+	redisClient *redis.Client
+	auctionRepo auction_repo.AuctionRepo
+}
+
+func NewRedis(redisClient *redis.Client) *RedisMemberRepo {
+	return &RedisMemberRepo{
+		redisClient,
+		auction_repo.NewRedis(redisClient),
+	}
+}
+
+// removeLeagueMemberScript removes the member and everything they hold in the league in one
+// step. The refund for each bid is built before the script runs, so the bids are only
+// refunded if they're still exactly the ones that were read. The archived wallet matches
+// the one ArchiveUserWallet writes. Returns { status, available, held } with the archived
+// wallet, where status is 1 when the member was removed, 0 when they weren't in the league
+// and -1 when their bids changed since they were read.
+var removeLeagueMemberScript = redis.NewScript(user_repo.REDIS_WALLET_LUA_FUNCTIONS + `
+if redis.call('SISMEMBER', KEYS[1], ARGV[1]) == 0 then
+	return { 0, 0, 0 }
+end
+
+if (redis.call('GET', KEYS[5]) or '') ~= ARGV[3] then
+	return { -1, 0, 0 }
+end
+
+local auctionStatus = redis.call('HGET', KEYS[6], 'status')
+if ARGV[3] ~= '' and (auctionStatus == ARGV[4] or auctionStatus == ARGV[5]) then
+	if redis.call('HLEN', KEYS[7]) ~= (#ARGV - 5) / 3 then
+		return { -1, 0, 0 }
+	end
+
+	for index = 6, #ARGV, 3 do
+		if redis.call('HGET', KEYS[7], ARGV[index]) ~= ARGV[index + 1] then
+			return { -1, 0, 0 }
+		end
+	end
+
+	for index = 6, #ARGV, 3 do
+		local bid = tonumber(ARGV[index + 1])
+		adjustWallet(KEYS[11], KEYS[12], KEYS[13], ARGV[2], bid, -bid, ARGV[index + 2])
+	end
+
+	redis.call('DEL', KEYS[7], KEYS[8])
+end
+
+for _, playerId in ipairs(redis.call('HKEYS', KEYS[9])) do
+	if redis.call('HGET', KEYS[10], playerId) == ARGV[1] then
+		redis.call('HDEL', KEYS[10], playerId)
+	end
+end
+redis.call('DEL', KEYS[9])
+
+local available = redis.call('HGET', KEYS[11], ARGV[2]) or '0'
+local held = redis.call('HGET', KEYS[12], ARGV[2]) or '0'
+redis.call('HSET', KEYS[14], ARGV[2], '{"league_id":"' .. ARGV[2] .. '","available":' .. available .. ',"held":' .. held .. '}')
+redis.call('HDEL', KEYS[11], ARGV[2])
+redis.call('HDEL', KEYS[12], ARGV[2])
+
+redis.call('HDEL', KEYS[4], ARGV[1])
+redis.call('SREM', KEYS[2], ARGV[2])
+redis.call('LREM', KEYS[3], 0, ARGV[1])
+redis.call('SREM', KEYS[1], ARGV[1])
+
+return { 1, tonumber(available), tonumber(held) }
+`)
+
+// RemoveLeagueMember takes the user out of the league in one atomic step. Their open bids
+// in the league's current auction are canceled and refunded, with each refund recorded in
+// their wallet ledger, their roster is released, their wallet for the league is archived,
+// and their role, membership and waiver spot are dropped. Fails without changing anything
+// if the user isn't in the league. Returns the archived wallet.
+func (m *RedisMemberRepo) RemoveLeagueMember(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) (entities.Wallet, error) {
+	args := []interface{}{
+		"leagueId", leagueId.String(),
+		"userId", userId.String(),
+	}
+
+	scriptArgs := []interface{}{
+		userId.String(),
+		leagueId.String(),
+		"",
+		strconv.FormatInt(int64(entities.AUCTION_STATUS_ACTIVE), 10),
+		strconv.FormatInt(int64(entities.AUCTION_STATUS_STOPPED), 10),
+	}
+
+	// The script checks these are still the user's bids before refunding them
+	auctionId, err := m.auctionRepo.GetCurrentAuctionIdByLeagueId(context, leagueId)
+	if err != nil && !utils.IsNotFoundError(err) {
+		return entities.Wallet{}, err
+	}
+
+	if err == nil {
+		scriptArgs[2] = auctionId.String()
+
+		bids, err := m.auctionRepo.GetAllUserBids(context, auctionId, userId)
+		if err != nil {
+			return entities.Wallet{}, err
+		}
+
+		for playerId, bid := range bids {
+			refund := entities.NewWalletTransaction(userId, leagueId, bid, bid*-1, entities.WALLET_TRANSACTION_REASON_BID_CANCEL, auctionId, playerId)
+			serializedRefund, err := user_repo.SerializeRedisWalletTransaction(refund)
+			if err != nil {
+				return entities.Wallet{}, err
+			}
+
+			scriptArgs = append(scriptArgs, playerId, strconv.FormatInt(bid, 10), serializedRefund)
+		}
+	}
+
+	result, err := removeLeagueMemberScript.Run(
+		context.Request().Context(),
+		m.redisClient,
+		[]string{
+			redis_client.GenerateLeagueMembersRedisKey(leagueId),
+			redis_client.GenerateUserLeaguesRedisKey(userId),
+			redis_client.GenerateLeagueWaiverPriorityRedisKey(leagueId),
+			redis_client.GenerateLeagueRolesRedisKey(leagueId),
+			redis_client.GenerateLeagueToCurrentAuctionRedisKey(leagueId),
+			redis_client.GenerateAuctionRedisKey(auctionId),
+			redis_client.GenerateBidRedisKey(auctionId, userId),
+			redis_client.GenerateBidTimestampRedisKey(auctionId, userId),
+			redis_client.GenerateRosterRedisKey(leagueId, userId),
+			redis_client.GeneratePlayerToOwnerRedisKey(leagueId),
+			redis_client.GenerateUserWalletRedisKey(userId),
+			redis_client.GenerateUserHeldWalletRedisKey(userId),
+			redis_client.GenerateUserWalletLedgerRedisKey(userId, leagueId),
+			redis_client.GenerateUserArchivedWalletRedisKey(userId),
+		},
+		scriptArgs...,
+	).Int64Slice()
+	if err != nil {
+		return entities.Wallet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to remove user from league",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	switch result[0] {
+	case 0:
+		return entities.Wallet{}, newNotLeagueMemberError(leagueId, userId)
+	case -1:
+		return entities.Wallet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusConflict,
+			Message: "the user's bids changed while they were leaving the league, try again",
+			Args:    args,
+			Err:     nil,
+		})
+	}
+
+	return entities.Wallet{
+		LeagueId:  leagueId,
+		Available: result[1],
+		Held:      result[2],
+	}, nil
+}
@@ -0,0 +1,40 @@
+package member_repo
+
+import (
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auction_repo "github.com/wilbertthelam/prop-ock/repos/auction"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+)
+
+// SqlMemberRepo removes members through the other SQL repos inside one transaction, so a
+// failure part way through rolls every step back
+type SqlMemberRepo struct {
+	sqlClient *redis_client.SqlClient
+	repos     memberRepos
+}
+
+func NewSql(sqlClient *redis_client.SqlClient) *SqlMemberRepo {
+	return &SqlMemberRepo{
+		sqlClient,
+		memberRepos{
+			auction_repo.NewSql(sqlClient),
+			league_repo.NewSql(sqlClient),
+			roster_repo.NewSql(sqlClient),
+			user_repo.NewSql(sqlClient),
+		},
+	}
+}
+
+// RemoveLeagueMember takes the user out of the league in one transaction. Their open bids
+// in the league's current auction are canceled and refunded, with each refund recorded in
+// their wallet ledger, their roster is released, their wallet for the league is archived,
+// and their role, membership and waiver spot are dropped. Fails without changing anything
+// if the user isn't in the league. Returns the archived wallet.
+func (s *SqlMemberRepo) RemoveLeagueMember(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) (entities.Wallet, error) {
+	return removeLeagueMember(context, s.sqlClient, s.repos, leagueId, userId)
+}
@@ -0,0 +1,76 @@
+package message_repo
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+)
+
+// MemoryMessageRepo keeps conversation state and webhook event claims in the memory store
+type MemoryMessageRepo struct {
+	memoryStore *redis_client.MemoryStore
+}
+
+func NewMemory(memoryStore *redis_client.MemoryStore) *MemoryMessageRepo {
+	return &MemoryMessageRepo{
+		memoryStore,
+	}
+}
+
+// GetMessageState returns where the user is in the conversation.
+// Users with no state (or whose state expired) are in STATE_INVALID.
+func (m *MemoryMessageRepo) GetMessageState(context echo.Context, userId uuid.UUID) (entities.MessageState, error) {
+	state := entities.STATE_INVALID
+	err := m.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		value, ok := values.Get(redis_client.GenerateMessageStateRedisKey(userId))
+		if ok {
+			state = value.(entities.MessageState)
+		}
+
+		return nil
+	})
+
+	return state, err
+}
+
+// SetMessageState saves the user's state, which expires after the given TTL
+func (m *MemoryMessageRepo) SetMessageState(context echo.Context, userId uuid.UUID, state entities.MessageState, ttl time.Duration) error {
+	return m.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Set(redis_client.GenerateMessageStateRedisKey(userId), state)
+		values.ExpireAt(redis_client.GenerateMessageStateRedisKey(userId), time.Now().Add(ttl))
+
+		return nil
+	})
+}
+
+// ClaimWebhookEvent marks a webhook event as being processed. Returns false if
+// the event was already claimed, which happens when Messenger retries a delivery.
+func (m *MemoryMessageRepo) ClaimWebhookEvent(context echo.Context, eventId string, ttl time.Duration) (bool, error) {
+	isClaimed := false
+	err := m.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		_, ok := values.Get(redis_client.GenerateWebhookEventRedisKey(eventId))
+		if ok {
+			return nil
+		}
+
+		values.Set(redis_client.GenerateWebhookEventRedisKey(eventId), time.Now().UnixMilli())
+		values.ExpireAt(redis_client.GenerateWebhookEventRedisKey(eventId), time.Now().Add(ttl))
+
+		isClaimed = true
+		return nil
+	})
+
+	return isClaimed, err
+}
+
+// ReleaseWebhookEvent lets a webhook event be processed again, so
+// a retry from Messenger can pick up an event that failed
+func (m *MemoryMessageRepo) ReleaseWebhookEvent(context echo.Context, eventId string) error {
+	return m.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Delete(redis_client.GenerateWebhookEventRedisKey(eventId))
+		return nil
+	})
+}
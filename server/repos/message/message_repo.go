@@ -0,0 +1,38 @@
+package message_repo
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+)
+
+type MessageRepo interface {
+	// GetMessageState returns where the user is in the conversation.
+	// Users with no state (or whose state expired) are in STATE_INVALID.
+	GetMessageState(context echo.Context, userId uuid.UUID) (entities.MessageState, error)
+	// SetMessageState saves the user's state, which expires after the given TTL
+	SetMessageState(context echo.Context, userId uuid.UUID, state entities.MessageState, ttl time.Duration) error
+	// ClaimWebhookEvent marks a webhook event as being processed. Returns false if
+	// the event was already claimed, which happens when Messenger retries a delivery.
+	ClaimWebhookEvent(context echo.Context, eventId string, ttl time.Duration) (bool, error)
+	// ReleaseWebhookEvent lets a webhook event be processed again, so
+	// a retry from Messenger can pick up an event that failed
+	ReleaseWebhookEvent(context echo.Context, eventId string) error
+}
+
+// New returns the MessageRepo for the storage backend picked in the config
+func New(config *config_service.Config, redisClient *redis.Client, memoryStore *redis_client.MemoryStore, sqlClient *redis_client.SqlClient) MessageRepo {
+	switch config.GetStorageConfig().Backend {
+	case config_service.STORAGE_BACKEND_MEMORY:
+		return NewMemory(memoryStore)
+	case config_service.STORAGE_BACKEND_SQL:
+		return NewSql(sqlClient)
+	}
+
+	return NewRedis(redisClient)
+}
@@ -0,0 +1,129 @@
+package message_repo
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RedisMessageRepo struct {
+	redisClient *redis.Client
+}
+
+func NewRedis(redisClient *redis.Client) *RedisMessageRepo {
+	return &RedisMessageRepo{
+		redisClient,
+	}
+}
+
+// GetMessageState returns where the user is in the conversation.
+// Users with no state (or whose state expired) are in STATE_INVALID.
+func (m *RedisMessageRepo) GetMessageState(context echo.Context, userId uuid.UUID) (entities.MessageState, error) {
+	rawState, err := m.redisClient.Get(
+		context.Request().Context(),
+		redis_client.GenerateMessageStateRedisKey(userId),
+	).Result()
+	if err == redis.Nil {
+		return entities.STATE_INVALID, nil
+	}
+	if err != nil {
+		return entities.STATE_INVALID, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get message state",
+			Args: []interface{}{
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	state, err := strconv.ParseInt(rawState, 10, 64)
+	if err != nil {
+		return entities.STATE_INVALID, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to parse message state",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"state", rawState,
+			},
+			Err: err,
+		})
+	}
+
+	return entities.MessageState(state), nil
+}
+
+// SetMessageState saves the user's state, which expires after the given TTL
+func (m *RedisMessageRepo) SetMessageState(context echo.Context, userId uuid.UUID, state entities.MessageState, ttl time.Duration) error {
+	_, err := m.redisClient.Set(
+		context.Request().Context(),
+		redis_client.GenerateMessageStateRedisKey(userId),
+		strconv.FormatInt(int64(state), 10),
+		ttl,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to set message state",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"state", fmt.Sprintf("%v", state),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// ClaimWebhookEvent marks a webhook event as being processed. Returns false if
+// the event was already claimed, which happens when Messenger retries a delivery.
+func (m *RedisMessageRepo) ClaimWebhookEvent(context echo.Context, eventId string, ttl time.Duration) (bool, error) {
+	isClaimed, err := m.redisClient.SetNX(
+		context.Request().Context(),
+		redis_client.GenerateWebhookEventRedisKey(eventId),
+		time.Now().UnixMilli(),
+		ttl,
+	).Result()
+	if err != nil {
+		return false, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to claim webhook event",
+			Args: []interface{}{
+				"eventId", eventId,
+			},
+			Err: err,
+		})
+	}
+
+	return isClaimed, nil
+}
+
+// ReleaseWebhookEvent lets a webhook event be processed again, so
+// a retry from Messenger can pick up an event that failed
+func (m *RedisMessageRepo) ReleaseWebhookEvent(context echo.Context, eventId string) error {
+	_, err := m.redisClient.Del(
+		context.Request().Context(),
+		redis_client.GenerateWebhookEventRedisKey(eventId),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to release webhook event",
+			Args: []interface{}{
+				"eventId", eventId,
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package message_repo
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// SqlMessageRepo keeps conversation state and webhook event claims in their own
+// tables. Rows carry when they expire, and expired rows are treated as missing.
+type SqlMessageRepo struct {
+	sqlClient *redis_client.SqlClient
+}
+
+func NewSql(sqlClient *redis_client.SqlClient) *SqlMessageRepo {
+	return &SqlMessageRepo{
+		sqlClient,
+	}
+}
+
+// GetMessageState returns where the user is in the conversation.
+// Users with no state (or whose state expired) are in STATE_INVALID.
+func (m *SqlMessageRepo) GetMessageState(context echo.Context, userId uuid.UUID) (entities.MessageState, error) {
+	var state entities.MessageState
+	err := m.sqlClient.QueryRow(
+		context,
+		"SELECT state FROM message_states WHERE user_id = ? AND expires_at > ?",
+		userId,
+		time.Now().UnixMilli(),
+	).Scan(&state)
+	if err == sql.ErrNoRows {
+		return entities.STATE_INVALID, nil
+	}
+	if err != nil {
+		return entities.STATE_INVALID, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get message state",
+			Args: []interface{}{
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return state, nil
+}
+
+// SetMessageState saves the user's state, which expires after the given TTL
+func (m *SqlMessageRepo) SetMessageState(context echo.Context, userId uuid.UUID, state entities.MessageState, ttl time.Duration) error {
+	_, err := m.sqlClient.Exec(
+		context,
+		`INSERT INTO message_states (user_id, state, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET state = excluded.state, expires_at = excluded.expires_at`,
+		userId,
+		state,
+		time.Now().Add(ttl).UnixMilli(),
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to set message state",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"state", fmt.Sprintf("%v", state),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// ClaimWebhookEvent marks a webhook event as being processed. Returns false if
+// the event was already claimed, which happens when Messenger retries a delivery.
+func (m *SqlMessageRepo) ClaimWebhookEvent(context echo.Context, eventId string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	result, err := m.sqlClient.Exec(
+		context,
+		`INSERT INTO webhook_events (event_id, expires_at) VALUES (?, ?)
+		ON CONFLICT (event_id) DO UPDATE SET expires_at = excluded.expires_at
+		WHERE webhook_events.expires_at <= ?`,
+		eventId,
+		now.Add(ttl).UnixMilli(),
+		now.UnixMilli(),
+	)
+	if err != nil {
+		return false, newClaimWebhookEventError(eventId, err)
+	}
+
+	claimedCount, err := result.RowsAffected()
+	if err != nil {
+		return false, newClaimWebhookEventError(eventId, err)
+	}
+
+	return claimedCount > 0, nil
+}
+
+func newClaimWebhookEventError(eventId string, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to claim webhook event",
+		Args: []interface{}{
+			"eventId", eventId,
+		},
+		Err: err,
+	})
+}
+
+// ReleaseWebhookEvent lets a webhook event be processed again, so
+// a retry from Messenger can pick up an event that failed
+func (m *SqlMessageRepo) ReleaseWebhookEvent(context echo.Context, eventId string) error {
+	_, err := m.sqlClient.Exec(context, "DELETE FROM webhook_events WHERE event_id = ?", eventId)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to release webhook event",
+			Args: []interface{}{
+				"eventId", eventId,
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package player_repo
+
+import (
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+)
+
+// MemoryPlayerRepo keeps the player catalog in the memory store
+type MemoryPlayerRepo struct {
+	memoryStore *redis_client.MemoryStore
+}
+
+func NewMemory(memoryStore *redis_client.MemoryStore) *MemoryPlayerRepo {
+	return &MemoryPlayerRepo{
+		memoryStore,
+	}
+}
+
+func (l *MemoryPlayerRepo) GetPlayerByPlayerId(context echo.Context, playerId string) (entities.Player, error) {
+	var player entities.Player
+	err := l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		// If player is not found, then return an empty player
+		value, ok := values.Get(redis_client.GeneratePlayerRedisKey(playerId))
+		if ok {
+			player = value.(entities.Player)
+		}
+
+		return nil
+	})
+
+	return player, err
+}
+
+// GetPlayersByPlayerIds fetches a batch of players at once.
+// Players that don't exist are left out of the result.
+func (l *MemoryPlayerRepo) GetPlayersByPlayerIds(context echo.Context, playerIds []string) ([]entities.Player, error) {
+	players := make([]entities.Player, 0, len(playerIds))
+	err := l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		for _, playerId := range playerIds {
+			value, ok := values.Get(redis_client.GeneratePlayerRedisKey(playerId))
+			if ok {
+				players = append(players, value.(entities.Player))
+			}
+		}
+
+		return nil
+	})
+
+	return players, err
+}
+
+func (l *MemoryPlayerRepo) GetAllPlayerIds(context echo.Context) ([]string, error) {
+	var playerIds []string
+	err := l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		playerIds = values.SMembers(redis_client.GeneratePlayerCatalogRedisKey())
+		return nil
+	})
+
+	return playerIds, err
+}
+
+// UpsertPlayers writes every field of each player and adds them to the catalog
+func (l *MemoryPlayerRepo) UpsertPlayers(context echo.Context, players []entities.Player) error {
+	return l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		for _, player := range players {
+			values.Set(redis_client.GeneratePlayerRedisKey(player.Id), player)
+			values.SAdd(redis_client.GeneratePlayerCatalogRedisKey(), player.Id)
+		}
+
+		return nil
+	})
+}
+
+func (l *MemoryPlayerRepo) DeletePlayer(context echo.Context, playerId string) error {
+	return l.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Delete(redis_client.GeneratePlayerRedisKey(playerId))
+		values.SRem(redis_client.GeneratePlayerCatalogRedisKey(), playerId)
+
+		return nil
+	})
+}
@@ -1,92 +1,32 @@
 package player_repo
 
 import (
-	"fmt"
-	"net/http"
-
 	"github.com/go-redis/redis/v8"
 	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
 	"github.com/wilbertthelam/prop-ock/entities"
-	"github.com/wilbertthelam/prop-ock/utils"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
 )
 
-type PlayerRepo struct {
-	redisClient *redis.Client
-}
-
-func New(redisClient *redis.Client) *PlayerRepo {
-	return &PlayerRepo{
-		redisClient,
-	}
-}
-
-func generatePlayerRedisKey(playerId string) string {
-	return fmt.Sprintf("player:player_id:%v", playerId)
-}
-
-func (l *PlayerRepo) GetPlayerByPlayerId(context echo.Context, playerId string) (entities.Player, error) {
-	redisPlayer, err := l.redisClient.HGetAll(
-		context.Request().Context(),
-		generatePlayerRedisKey(playerId),
-	).Result()
-	if err != nil {
-		return entities.Player{}, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to get player",
-			Args: []interface{}{
-				"playerId", playerId,
-			},
-			Err: err,
-		})
-	}
-
-	// If player is not found, then return an empty player
-	if len(redisPlayer) == 0 {
-		return entities.Player{}, nil
-	}
-
-	player := entities.Player{
-		Id:    redisPlayer["id"],
-		Name:  redisPlayer["name"],
-		Image: redisPlayer["image"],
-	}
-
-	return player, nil
-}
-
-func (l *PlayerRepo) CreatePlayer(context echo.Context, playerId string, player entities.Player) error {
-	// Format for database inserting (array of strings where even index is key, odd index is value)
-	redisPlayerKeyValuePairs := []string{
-		"id", player.Id,
-		"name", player.Name,
-		"image", player.Image,
-	}
-
-	err := l.updatePlayer(context, playerId, redisPlayerKeyValuePairs)
-	if err != nil {
-		return err
-	}
-
-	return nil
+type PlayerRepo interface {
+	GetPlayerByPlayerId(context echo.Context, playerId string) (entities.Player, error)
+	// GetPlayersByPlayerIds fetches a batch of players in a single round trip.
+	// Players that don't exist are left out of the result.
+	GetPlayersByPlayerIds(context echo.Context, playerIds []string) ([]entities.Player, error)
+	GetAllPlayerIds(context echo.Context) ([]string, error)
+	// UpsertPlayers writes every field of each player and adds them to the catalog, in one atomic step
+	UpsertPlayers(context echo.Context, players []entities.Player) error
+	DeletePlayer(context echo.Context, playerId string) error
 }
 
-func (l *PlayerRepo) updatePlayer(context echo.Context, playerId string, keyValuePairs []string) error {
-	_, err := l.redisClient.HSet(
-		context.Request().Context(),
-		generatePlayerRedisKey(playerId),
-		keyValuePairs,
-	).Result()
-	if err != nil {
-		return utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to update player fields",
-			Args: append(
-				[]interface{}{"playerId", playerId},
-				utils.MapStringSliceToInterfaceSlice(keyValuePairs)...,
-			),
-			Err: err,
-		})
+// New returns the PlayerRepo for the storage backend picked in the config
+func New(config *config_service.Config, redisClient *redis.Client, memoryStore *redis_client.MemoryStore, sqlClient *redis_client.SqlClient) PlayerRepo {
+	switch config.GetStorageConfig().Backend {
+	case config_service.STORAGE_BACKEND_MEMORY:
+		return NewMemory(memoryStore)
+	case config_service.STORAGE_BACKEND_SQL:
+		return NewSql(sqlClient)
 	}
 
-	return nil
+	return NewRedis(redisClient)
 }
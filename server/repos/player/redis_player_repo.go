@@ -0,0 +1,191 @@
+package player_repo
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RedisPlayerRepo struct {
+	redisClient *redis.Client
+}
+
+func NewRedis(redisClient *redis.Client) *RedisPlayerRepo {
+	return &RedisPlayerRepo{
+		redisClient,
+	}
+}
+
+func (l *RedisPlayerRepo) GetPlayerByPlayerId(context echo.Context, playerId string) (entities.Player, error) {
+	redisPlayer, err := l.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GeneratePlayerRedisKey(playerId),
+	).Result()
+	if err != nil {
+		return entities.Player{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get player",
+			Args: []interface{}{
+				"playerId", playerId,
+			},
+			Err: err,
+		})
+	}
+
+	// If player is not found, then return an empty player
+	if len(redisPlayer) == 0 {
+		return entities.Player{}, nil
+	}
+
+	return mapRedisPlayerToPlayer(redisPlayer), nil
+}
+
+// GetPlayersByPlayerIds fetches a batch of players in a single round trip.
+// Players that don't exist are left out of the result.
+func (l *RedisPlayerRepo) GetPlayersByPlayerIds(context echo.Context, playerIds []string) ([]entities.Player, error) {
+	pipeline := l.redisClient.Pipeline()
+
+	commands := make([]*redis.StringStringMapCmd, len(playerIds))
+	for index, playerId := range playerIds {
+		commands[index] = pipeline.HGetAll(
+			context.Request().Context(),
+			redis_client.GeneratePlayerRedisKey(playerId),
+		)
+	}
+
+	_, err := pipeline.Exec(context.Request().Context())
+	if err != nil && err != redis.Nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get players",
+			Args: []interface{}{
+				"playerIds", fmt.Sprintf("%v", playerIds),
+			},
+			Err: err,
+		})
+	}
+
+	players := make([]entities.Player, 0, len(playerIds))
+	for _, command := range commands {
+		redisPlayer := command.Val()
+		if len(redisPlayer) == 0 {
+			continue
+		}
+
+		players = append(players, mapRedisPlayerToPlayer(redisPlayer))
+	}
+
+	return players, nil
+}
+
+func (l *RedisPlayerRepo) GetAllPlayerIds(context echo.Context) ([]string, error) {
+	playerIds, err := l.redisClient.SMembers(
+		context.Request().Context(),
+		redis_client.GeneratePlayerCatalogRedisKey(),
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get all playerIds",
+			Err:     err,
+		})
+	}
+
+	return playerIds, nil
+}
+
+// upsertPlayersScript writes every player and adds them to the catalog in one step.
+// KEYS[1] is the catalog and each key after it a player, with that player's fields
+// in the same order in ARGV.
+var upsertPlayersScript = redis.NewScript(`
+for index = 2, #KEYS do
+	local field = (index - 2) * 5
+	redis.call('HSET', KEYS[index], 'id', ARGV[field + 1], 'name', ARGV[field + 2], 'image', ARGV[field + 3], 'team', ARGV[field + 4], 'position', ARGV[field + 5])
+	redis.call('SADD', KEYS[1], ARGV[field + 1])
+end
+
+return 1
+`)
+
+// UpsertPlayers writes every field of each player and adds them to the catalog, in one atomic step
+func (l *RedisPlayerRepo) UpsertPlayers(context echo.Context, players []entities.Player) error {
+	if len(players) == 0 {
+		return nil
+	}
+
+	keys := []string{
+		redis_client.GeneratePlayerCatalogRedisKey(),
+	}
+
+	scriptArgs := make([]interface{}, 0, len(players)*5)
+	for _, player := range players {
+		keys = append(keys, redis_client.GeneratePlayerRedisKey(player.Id))
+		scriptArgs = append(scriptArgs, player.Id, player.Name, player.Image, player.Team, player.Position)
+	}
+
+	_, err := upsertPlayersScript.Run(
+		context.Request().Context(),
+		l.redisClient,
+		keys,
+		scriptArgs...,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to upsert players",
+			Args: []interface{}{
+				"playerCount", fmt.Sprintf("%v", len(players)),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// deletePlayerScript deletes the player and takes them out of the catalog in one step
+var deletePlayerScript = redis.NewScript(`
+redis.call('DEL', KEYS[1])
+redis.call('SREM', KEYS[2], ARGV[1])
+
+return 1
+`)
+
+func (l *RedisPlayerRepo) DeletePlayer(context echo.Context, playerId string) error {
+	_, err := deletePlayerScript.Run(
+		context.Request().Context(),
+		l.redisClient,
+		[]string{
+			redis_client.GeneratePlayerRedisKey(playerId),
+			redis_client.GeneratePlayerCatalogRedisKey(),
+		},
+		playerId,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to delete player",
+			Args: []interface{}{
+				"playerId", playerId,
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func mapRedisPlayerToPlayer(redisPlayer map[string]string) entities.Player {
+	return entities.Player{
+		Id:       redisPlayer["id"],
+		Name:     redisPlayer["name"],
+		Image:    redisPlayer["image"],
+		Team:     redisPlayer["team"],
+		Position: redisPlayer["position"],
+	}
+}
@@ -0,0 +1,178 @@
+package player_repo
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// SqlPlayerRepo keeps the player catalog in the players table
+type SqlPlayerRepo struct {
+	sqlClient *redis_client.SqlClient
+}
+
+func NewSql(sqlClient *redis_client.SqlClient) *SqlPlayerRepo {
+	return &SqlPlayerRepo{
+		sqlClient,
+	}
+}
+
+func (l *SqlPlayerRepo) GetPlayerByPlayerId(context echo.Context, playerId string) (entities.Player, error) {
+	var player entities.Player
+	err := l.sqlClient.QueryRow(
+		context,
+		"SELECT id, name, image, team, position FROM players WHERE id = ?",
+		playerId,
+	).Scan(&player.Id, &player.Name, &player.Image, &player.Team, &player.Position)
+
+	// If player is not found, then return an empty player
+	if err == sql.ErrNoRows {
+		return entities.Player{}, nil
+	}
+	if err != nil {
+		return entities.Player{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get player",
+			Args: []interface{}{
+				"playerId", playerId,
+			},
+			Err: err,
+		})
+	}
+
+	return player, nil
+}
+
+// GetPlayersByPlayerIds fetches a batch of players in a single query.
+// Players that don't exist are left out of the result.
+func (l *SqlPlayerRepo) GetPlayersByPlayerIds(context echo.Context, playerIds []string) ([]entities.Player, error) {
+	if len(playerIds) == 0 {
+		return []entities.Player{}, nil
+	}
+
+	playersById, err := l.getPlayersById(context, playerIds)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get players",
+			Args: []interface{}{
+				"playerIds", fmt.Sprintf("%v", playerIds),
+			},
+			Err: err,
+		})
+	}
+
+	// Keep the players in the order they were asked for
+	players := make([]entities.Player, 0, len(playerIds))
+	for _, playerId := range playerIds {
+		player, ok := playersById[playerId]
+		if ok {
+			players = append(players, player)
+		}
+	}
+
+	return players, nil
+}
+
+func (l *SqlPlayerRepo) getPlayersById(context echo.Context, playerIds []string) (map[string]entities.Player, error) {
+	args := make([]interface{}, 0, len(playerIds))
+	for _, playerId := range playerIds {
+		args = append(args, playerId)
+	}
+
+	rows, err := l.sqlClient.Query(
+		context,
+		fmt.Sprintf(
+			"SELECT id, name, image, team, position FROM players WHERE id IN (%v)",
+			strings.TrimSuffix(strings.Repeat("?, ", len(playerIds)), ", "),
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	playersById := make(map[string]entities.Player)
+	for rows.Next() {
+		var player entities.Player
+		err = rows.Scan(&player.Id, &player.Name, &player.Image, &player.Team, &player.Position)
+		if err != nil {
+			return nil, err
+		}
+
+		playersById[player.Id] = player
+	}
+
+	return playersById, rows.Err()
+}
+
+func (l *SqlPlayerRepo) GetAllPlayerIds(context echo.Context) ([]string, error) {
+	playerIds, err := l.sqlClient.QueryStrings(context, "SELECT id FROM players ORDER BY id")
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get all playerIds",
+			Err:     err,
+		})
+	}
+
+	return playerIds, nil
+}
+
+// UpsertPlayers writes every field of each player, which also adds them to the catalog,
+// in one transaction
+func (l *SqlPlayerRepo) UpsertPlayers(context echo.Context, players []entities.Player) error {
+	return l.sqlClient.StartTransaction(context, func() error {
+		for _, player := range players {
+			_, err := l.sqlClient.Exec(
+				context,
+				`INSERT INTO players (id, name, image, team, position) VALUES (?, ?, ?, ?, ?)
+				ON CONFLICT (id) DO UPDATE SET
+					name = excluded.name,
+					image = excluded.image,
+					team = excluded.team,
+					position = excluded.position`,
+				player.Id,
+				player.Name,
+				player.Image,
+				player.Team,
+				player.Position,
+			)
+			if err != nil {
+				return utils.NewError(utils.ErrorParams{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to update player fields",
+					Args: []interface{}{
+						"playerId", player.Id,
+					},
+					Err: err,
+				})
+			}
+		}
+
+		return nil
+	})
+}
+
+func (l *SqlPlayerRepo) DeletePlayer(context echo.Context, playerId string) error {
+	_, err := l.sqlClient.Exec(context, "DELETE FROM players WHERE id = ?", playerId)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to delete player",
+			Args: []interface{}{
+				"playerId", playerId,
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package player_set_repo
+
+import (
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+)
+
+// MemoryPlayerSetRepo keeps player sets in the memory store, with each set's
+// players kept as a set like in Redis
+type MemoryPlayerSetRepo struct {
+	memoryStore *redis_client.MemoryStore
+}
+
+func NewMemory(memoryStore *redis_client.MemoryStore) *MemoryPlayerSetRepo {
+	return &MemoryPlayerSetRepo{
+		memoryStore,
+	}
+}
+
+func (p *MemoryPlayerSetRepo) GetPlayerSetByPlayerSetId(context echo.Context, playerSetId uuid.UUID) (entities.PlayerSet, error) {
+	var playerSet entities.PlayerSet
+	err := p.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		// If player set is not found, then return an empty player set
+		value, ok := values.Get(redis_client.GeneratePlayerSetRedisKey(playerSetId))
+		if !ok {
+			return nil
+		}
+
+		playerSet = value.(entities.PlayerSet)
+		playerSet.PlayerIds = values.SMembers(redis_client.GeneratePlayerSetPlayersRedisKey(playerSetId))
+
+		return nil
+	})
+
+	return playerSet, err
+}
+
+func (p *MemoryPlayerSetRepo) GetPlayerSetIdsByLeagueId(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
+	var playerSetIds []uuid.UUID
+	err := p.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		for _, playerSetId := range values.SMembers(redis_client.GenerateLeaguePlayerSetsRedisKey(leagueId)) {
+			playerSetIds = append(playerSetIds, uuid.MustParse(playerSetId))
+		}
+
+		return nil
+	})
+
+	return playerSetIds, err
+}
+
+func (p *MemoryPlayerSetRepo) IsPlayerInPlayerSet(context echo.Context, playerSetId uuid.UUID, playerId string) (bool, error) {
+	isMember := false
+	err := p.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		isMember = values.SIsMember(redis_client.GeneratePlayerSetPlayersRedisKey(playerSetId), playerId)
+		return nil
+	})
+
+	return isMember, err
+}
+
+// UpsertPlayerSet saves the player set fields and replaces its players with the given list
+func (p *MemoryPlayerSetRepo) UpsertPlayerSet(context echo.Context, playerSetId uuid.UUID, playerSet entities.PlayerSet) error {
+	playerIds := playerSet.PlayerIds
+	playerSet.PlayerIds = nil
+
+	return p.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Set(redis_client.GeneratePlayerSetRedisKey(playerSetId), playerSet)
+
+		values.Delete(redis_client.GeneratePlayerSetPlayersRedisKey(playerSetId))
+		if len(playerIds) > 0 {
+			values.SAdd(redis_client.GeneratePlayerSetPlayersRedisKey(playerSetId), playerIds...)
+		}
+
+		values.SAdd(redis_client.GenerateLeaguePlayerSetsRedisKey(playerSet.LeagueId), playerSetId.String())
+
+		return nil
+	})
+}
+
+func (p *MemoryPlayerSetRepo) DeletePlayerSet(context echo.Context, playerSetId uuid.UUID, leagueId uuid.UUID) error {
+	return p.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Delete(redis_client.GeneratePlayerSetRedisKey(playerSetId))
+		values.Delete(redis_client.GeneratePlayerSetPlayersRedisKey(playerSetId))
+		values.SRem(redis_client.GenerateLeaguePlayerSetsRedisKey(leagueId), playerSetId.String())
+
+		return nil
+	})
+}
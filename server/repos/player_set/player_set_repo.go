@@ -0,0 +1,32 @@
+package player_set_repo
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+)
+
+type PlayerSetRepo interface {
+	GetPlayerSetByPlayerSetId(context echo.Context, playerSetId uuid.UUID) (entities.PlayerSet, error)
+	GetPlayerSetIdsByLeagueId(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error)
+	IsPlayerInPlayerSet(context echo.Context, playerSetId uuid.UUID, playerId string) (bool, error)
+	// UpsertPlayerSet saves the player set fields and replaces its players with the given list,
+	// in one atomic step
+	UpsertPlayerSet(context echo.Context, playerSetId uuid.UUID, playerSet entities.PlayerSet) error
+	DeletePlayerSet(context echo.Context, playerSetId uuid.UUID, leagueId uuid.UUID) error
+}
+
+// New returns the PlayerSetRepo for the storage backend picked in the config
+func New(config *config_service.Config, redisClient *redis.Client, memoryStore *redis_client.MemoryStore, sqlClient *redis_client.SqlClient) PlayerSetRepo {
+	switch config.GetStorageConfig().Backend {
+	case config_service.STORAGE_BACKEND_MEMORY:
+		return NewMemory(memoryStore)
+	case config_service.STORAGE_BACKEND_SQL:
+		return NewSql(sqlClient)
+	}
+
+	return NewRedis(redisClient)
+}
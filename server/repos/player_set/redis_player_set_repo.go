@@ -0,0 +1,226 @@
+package player_set_repo
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RedisPlayerSetRepo struct {
+	redisClient *redis.Client
+}
+
+func NewRedis(redisClient *redis.Client) *RedisPlayerSetRepo {
+	return &RedisPlayerSetRepo{
+		redisClient,
+	}
+}
+
+func (p *RedisPlayerSetRepo) GetPlayerSetByPlayerSetId(context echo.Context, playerSetId uuid.UUID) (entities.PlayerSet, error) {
+	redisPlayerSet, err := p.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GeneratePlayerSetRedisKey(playerSetId),
+	).Result()
+	if err != nil {
+		return entities.PlayerSet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get player set",
+			Args: []interface{}{
+				"playerSetId", playerSetId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	// If player set is not found, then return an empty player set
+	if len(redisPlayerSet) == 0 {
+		return entities.PlayerSet{}, nil
+	}
+
+	playerIds, err := p.redisClient.SMembers(
+		context.Request().Context(),
+		redis_client.GeneratePlayerSetPlayersRedisKey(playerSetId),
+	).Result()
+	if err != nil {
+		return entities.PlayerSet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get players in player set",
+			Args: []interface{}{
+				"playerSetId", playerSetId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	// Redis sets are unordered, so keep the order stable for anyone displaying them
+	sort.Strings(playerIds)
+
+	playerSet := entities.PlayerSet{
+		Id:        uuid.MustParse(redisPlayerSet["id"]),
+		LeagueId:  uuid.MustParse(redisPlayerSet["league_id"]),
+		Name:      redisPlayerSet["name"],
+		PlayerIds: playerIds,
+	}
+
+	return playerSet, nil
+}
+
+func (p *RedisPlayerSetRepo) GetPlayerSetIdsByLeagueId(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
+	stringPlayerSetIds, err := p.redisClient.SMembers(
+		context.Request().Context(),
+		redis_client.GenerateLeaguePlayerSetsRedisKey(leagueId),
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get player sets in league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	playerSetIds := make([]uuid.UUID, len(stringPlayerSetIds))
+	for index, stringPlayerSetId := range stringPlayerSetIds {
+		playerSetId, err := uuid.Parse(stringPlayerSetId)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse playerSetId from Redis string to uuid",
+				Args: []interface{}{
+					"playerSetId", stringPlayerSetId,
+				},
+				Err: err,
+			})
+		}
+
+		playerSetIds[index] = playerSetId
+	}
+
+	return playerSetIds, nil
+}
+
+func (p *RedisPlayerSetRepo) IsPlayerInPlayerSet(context echo.Context, playerSetId uuid.UUID, playerId string) (bool, error) {
+	isMember, err := p.redisClient.SIsMember(
+		context.Request().Context(),
+		redis_client.GeneratePlayerSetPlayersRedisKey(playerSetId),
+		playerId,
+	).Result()
+	if err != nil {
+		return false, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to check if player is in player set",
+			Args: []interface{}{
+				"playerSetId", playerSetId.String(),
+				"playerId", playerId,
+			},
+			Err: err,
+		})
+	}
+
+	return isMember, nil
+}
+
+// upsertPlayerSetScript saves the player set, replaces its players and lists it under its
+// league in one step, so the set is never seen with its players half replaced. ARGV[2] is
+// how many of the fields after it belong to the player set hash, the rest are its players.
+var upsertPlayerSetScript = redis.NewScript(`
+local playersIndex = 3 + tonumber(ARGV[2])
+
+redis.call('HSET', KEYS[1], unpack(ARGV, 3, playersIndex - 1))
+
+redis.call('DEL', KEYS[2])
+if #ARGV >= playersIndex then
+	redis.call('SADD', KEYS[2], unpack(ARGV, playersIndex))
+end
+
+redis.call('SADD', KEYS[3], ARGV[1])
+
+return 1
+`)
+
+// UpsertPlayerSet saves the player set fields and replaces its players with the given list,
+// in one atomic step
+func (p *RedisPlayerSetRepo) UpsertPlayerSet(context echo.Context, playerSetId uuid.UUID, playerSet entities.PlayerSet) error {
+	// Format for database inserting (array of strings where even index is key, odd index is value)
+	redisPlayerSetKeyValuePairs := []string{
+		"id", playerSet.Id.String(),
+		"league_id", playerSet.LeagueId.String(),
+		"name", playerSet.Name,
+	}
+
+	scriptArgs := []interface{}{
+		playerSetId.String(),
+		len(redisPlayerSetKeyValuePairs),
+	}
+	scriptArgs = append(scriptArgs, utils.MapStringSliceToInterfaceSlice(redisPlayerSetKeyValuePairs)...)
+	scriptArgs = append(scriptArgs, utils.MapStringSliceToInterfaceSlice(playerSet.PlayerIds)...)
+
+	_, err := upsertPlayerSetScript.Run(
+		context.Request().Context(),
+		p.redisClient,
+		[]string{
+			redis_client.GeneratePlayerSetRedisKey(playerSetId),
+			redis_client.GeneratePlayerSetPlayersRedisKey(playerSetId),
+			redis_client.GenerateLeaguePlayerSetsRedisKey(playerSet.LeagueId),
+		},
+		scriptArgs...,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to upsert player set",
+			Args: []interface{}{
+				"playerSetId", playerSetId.String(),
+				"leagueId", playerSet.LeagueId.String(),
+				"playerIds", fmt.Sprintf("%v", playerSet.PlayerIds),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// deletePlayerSetScript deletes the player set and its players and takes it out of its
+// league in one step
+var deletePlayerSetScript = redis.NewScript(`
+redis.call('DEL', KEYS[1], KEYS[2])
+redis.call('SREM', KEYS[3], ARGV[1])
+
+return 1
+`)
+
+func (p *RedisPlayerSetRepo) DeletePlayerSet(context echo.Context, playerSetId uuid.UUID, leagueId uuid.UUID) error {
+	_, err := deletePlayerSetScript.Run(
+		context.Request().Context(),
+		p.redisClient,
+		[]string{
+			redis_client.GeneratePlayerSetRedisKey(playerSetId),
+			redis_client.GeneratePlayerSetPlayersRedisKey(playerSetId),
+			redis_client.GenerateLeaguePlayerSetsRedisKey(leagueId),
+		},
+		playerSetId.String(),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to delete player set",
+			Args: []interface{}{
+				"playerSetId", playerSetId.String(),
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package player_set_repo
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// SqlPlayerSetRepo keeps player sets in the player_sets table, with each
+// set's players in player_set_players
+type SqlPlayerSetRepo struct {
+	sqlClient *redis_client.SqlClient
+}
+
+func NewSql(sqlClient *redis_client.SqlClient) *SqlPlayerSetRepo {
+	return &SqlPlayerSetRepo{
+		sqlClient,
+	}
+}
+
+func (p *SqlPlayerSetRepo) GetPlayerSetByPlayerSetId(context echo.Context, playerSetId uuid.UUID) (entities.PlayerSet, error) {
+	var playerSet entities.PlayerSet
+	err := p.sqlClient.QueryRow(
+		context,
+		"SELECT id, league_id, name FROM player_sets WHERE id = ?",
+		playerSetId,
+	).Scan(&playerSet.Id, &playerSet.LeagueId, &playerSet.Name)
+
+	// If player set is not found, then return an empty player set
+	if err == sql.ErrNoRows {
+		return entities.PlayerSet{}, nil
+	}
+	if err != nil {
+		return entities.PlayerSet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get player set",
+			Args: []interface{}{
+				"playerSetId", playerSetId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	playerSet.PlayerIds, err = p.sqlClient.QueryStrings(
+		context,
+		"SELECT player_id FROM player_set_players WHERE player_set_id = ? ORDER BY player_id",
+		playerSetId,
+	)
+	if err != nil {
+		return entities.PlayerSet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get players in player set",
+			Args: []interface{}{
+				"playerSetId", playerSetId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return playerSet, nil
+}
+
+func (p *SqlPlayerSetRepo) GetPlayerSetIdsByLeagueId(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
+	playerSetIds, err := p.sqlClient.QueryUuids(
+		context,
+		"SELECT id FROM player_sets WHERE league_id = ? ORDER BY id",
+		leagueId,
+	)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get player sets in league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return playerSetIds, nil
+}
+
+func (p *SqlPlayerSetRepo) IsPlayerInPlayerSet(context echo.Context, playerSetId uuid.UUID, playerId string) (bool, error) {
+	var memberCount int64
+	err := p.sqlClient.QueryRow(
+		context,
+		"SELECT COUNT(*) FROM player_set_players WHERE player_set_id = ? AND player_id = ?",
+		playerSetId,
+		playerId,
+	).Scan(&memberCount)
+	if err != nil {
+		return false, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to check if player is in player set",
+			Args: []interface{}{
+				"playerSetId", playerSetId.String(),
+				"playerId", playerId,
+			},
+			Err: err,
+		})
+	}
+
+	return memberCount > 0, nil
+}
+
+// UpsertPlayerSet saves the player set fields and replaces its players with the given list
+func (p *SqlPlayerSetRepo) UpsertPlayerSet(context echo.Context, playerSetId uuid.UUID, playerSet entities.PlayerSet) error {
+	return p.sqlClient.StartTransaction(context, func() error {
+		_, err := p.sqlClient.Exec(
+			context,
+			`INSERT INTO player_sets (id, league_id, name) VALUES (?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET league_id = excluded.league_id, name = excluded.name`,
+			playerSetId,
+			playerSet.LeagueId,
+			playerSet.Name,
+		)
+		if err != nil {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to update player set fields",
+				Args: []interface{}{
+					"playerSetId", playerSetId.String(),
+				},
+				Err: err,
+			})
+		}
+
+		_, err = p.sqlClient.Exec(
+			context,
+			"DELETE FROM player_set_players WHERE player_set_id = ?",
+			playerSetId,
+		)
+		if err != nil {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to clear players from player set",
+				Args: []interface{}{
+					"playerSetId", playerSetId.String(),
+				},
+				Err: err,
+			})
+		}
+
+		for _, playerId := range playerSet.PlayerIds {
+			_, err = p.sqlClient.Exec(
+				context,
+				`INSERT INTO player_set_players (player_set_id, player_id) VALUES (?, ?)
+				ON CONFLICT (player_set_id, player_id) DO NOTHING`,
+				playerSetId,
+				playerId,
+			)
+			if err != nil {
+				return utils.NewError(utils.ErrorParams{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to add players to player set",
+					Args: []interface{}{
+						"playerSetId", playerSetId.String(),
+						"playerId", playerId,
+					},
+					Err: err,
+				})
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeletePlayerSet removes the player set, and its players along with it
+func (p *SqlPlayerSetRepo) DeletePlayerSet(context echo.Context, playerSetId uuid.UUID, leagueId uuid.UUID) error {
+	_, err := p.sqlClient.Exec(
+		context,
+		"DELETE FROM player_sets WHERE id = ? AND league_id = ?",
+		playerSetId,
+		leagueId,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to delete player set",
+			Args: []interface{}{
+				"playerSetId", playerSetId.String(),
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
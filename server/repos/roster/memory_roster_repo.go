@@ -0,0 +1,212 @@
+package roster_repo
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+)
+
+// MemoryRosterRepo keeps each user's roster as a map of playerId to roster player,
+// alongside a map of playerId to owner for the whole league
+type MemoryRosterRepo struct {
+	memoryStore *redis_client.MemoryStore
+}
+
+func NewMemory(memoryStore *redis_client.MemoryStore) *MemoryRosterRepo {
+	return &MemoryRosterRepo{
+		memoryStore,
+	}
+}
+
+// GetRoster returns every player the user owns in the league, sorted by when they were acquired
+func (r *MemoryRosterRepo) GetRoster(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) ([]entities.RosterPlayer, error) {
+	var rosterPlayers []entities.RosterPlayer
+	err := r.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		roster := getMemoryRoster(values, leagueId, userId)
+
+		rosterPlayers = make([]entities.RosterPlayer, 0, len(roster))
+		for _, rosterPlayer := range roster {
+			rosterPlayers = append(rosterPlayers, rosterPlayer)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(rosterPlayers, func(i, j int) bool {
+		if rosterPlayers[i].AcquiredAt == rosterPlayers[j].AcquiredAt {
+			return rosterPlayers[i].PlayerId < rosterPlayers[j].PlayerId
+		}
+		return rosterPlayers[i].AcquiredAt < rosterPlayers[j].AcquiredAt
+	})
+
+	return rosterPlayers, nil
+}
+
+// GetPlayerOwner returns the user that owns the player in the league, or an empty id if nobody does
+func (r *MemoryRosterRepo) GetPlayerOwner(context echo.Context, leagueId uuid.UUID, playerId string) (uuid.UUID, error) {
+	userId := uuid.Nil
+	err := r.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		owner, ok := getMemoryPlayerOwners(values, leagueId)[playerId]
+		if ok {
+			userId = owner
+		}
+
+		return nil
+	})
+
+	return userId, err
+}
+
+// GetPlayerOwners returns every owned player in the league keyed on playerId
+func (r *MemoryRosterRepo) GetPlayerOwners(context echo.Context, leagueId uuid.UUID) (map[string]uuid.UUID, error) {
+	owners := make(map[string]uuid.UUID)
+	err := r.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		for playerId, userId := range getMemoryPlayerOwners(values, leagueId) {
+			owners[playerId] = userId
+		}
+
+		return nil
+	})
+
+	return owners, err
+}
+
+// AddPlayerToRoster saves the player to the user's roster and marks the user as the player's owner
+func (r *MemoryRosterRepo) AddPlayerToRoster(context echo.Context, rosterPlayer entities.RosterPlayer) error {
+	return r.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		AddMemoryRosterPlayer(values, rosterPlayer)
+		return nil
+	})
+}
+
+// AddMemoryRosterPlayer saves the player to the user's roster and marks the user as the
+// player's owner. It's exported so settling an auction can hand out the players won
+// alongside its own writes. The memory store must already be locked.
+func AddMemoryRosterPlayer(values redis_client.MemoryValues, rosterPlayer entities.RosterPlayer) {
+	roster := getMemoryRoster(values, rosterPlayer.LeagueId, rosterPlayer.UserId)
+	roster[rosterPlayer.PlayerId] = rosterPlayer
+	values.Set(redis_client.GenerateRosterRedisKey(rosterPlayer.LeagueId, rosterPlayer.UserId), roster)
+
+	owners := getMemoryPlayerOwners(values, rosterPlayer.LeagueId)
+	owners[rosterPlayer.PlayerId] = rosterPlayer.UserId
+	values.Set(redis_client.GeneratePlayerToOwnerRedisKey(rosterPlayer.LeagueId), owners)
+}
+
+// RemovePlayerFromRoster takes the player off the user's roster and clears their owner.
+// Fails with a not found error if the player wasn't on the roster.
+func (r *MemoryRosterRepo) RemovePlayerFromRoster(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, playerId string) error {
+	return r.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		return removeMemoryRosterPlayer(values, leagueId, userId, playerId)
+	})
+}
+
+// ReleasePlayerFromRoster takes the player off the user's roster and refunds the user in
+// one atomic step, recording the refund transaction in their wallet ledger. Fails with a
+// not found error if the player wasn't on the roster, without refunding anything.
+func (r *MemoryRosterRepo) ReleasePlayerFromRoster(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, playerId string, refund entities.WalletTransaction) (entities.Wallet, error) {
+	var wallet entities.Wallet
+	err := r.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		err := removeMemoryRosterPlayer(values, leagueId, userId, playerId)
+		if err != nil {
+			return err
+		}
+
+		// Adding funds can't be refused, so the release never needs undoing
+		wallet, _ = user_repo.AdjustMemoryWalletFunds(values, userId, leagueId, refund.Amount, 0)
+		if refund.Amount > 0 {
+			refund.Balance = wallet.Available
+			refund.HeldBalance = wallet.Held
+			user_repo.AddMemoryWalletTransaction(values, refund)
+		}
+
+		return nil
+	})
+
+	return wallet, err
+}
+
+func removeMemoryRosterPlayer(values redis_client.MemoryValues, leagueId uuid.UUID, userId uuid.UUID, playerId string) error {
+	roster := getMemoryRoster(values, leagueId, userId)
+	if _, ok := roster[playerId]; !ok {
+		return newPlayerNotOnRosterError([]interface{}{
+			"leagueId", leagueId.String(),
+			"userId", userId.String(),
+			"playerId", playerId,
+		})
+	}
+
+	delete(roster, playerId)
+	values.Set(redis_client.GenerateRosterRedisKey(leagueId, userId), roster)
+
+	owners := getMemoryPlayerOwners(values, leagueId)
+	delete(owners, playerId)
+	values.Set(redis_client.GeneratePlayerToOwnerRedisKey(leagueId), owners)
+
+	return nil
+}
+
+// GetMemoryRosterSize counts the players the user owns in the league. It's exported so
+// placing a bid can check the roster cap alongside its own writes. The memory store must
+// already be locked.
+func GetMemoryRosterSize(values redis_client.MemoryValues, leagueId uuid.UUID, userId uuid.UUID) int64 {
+	return int64(len(getMemoryRoster(values, leagueId, userId)))
+}
+
+// HasMemoryRosterPlayer checks the user owns the player in the league. It's exported
+// so a trade can check every player before moving any. The memory store must already be locked.
+func HasMemoryRosterPlayer(values redis_client.MemoryValues, leagueId uuid.UUID, userId uuid.UUID, playerId string) bool {
+	_, ok := getMemoryRoster(values, leagueId, userId)[playerId]
+	return ok
+}
+
+// GetMemoryPlayerOwner returns the user that owns the player in the league, or an empty id
+// if nobody does. It's exported so settling an auction can check every player won before
+// changing anything. The memory store must already be locked.
+func GetMemoryPlayerOwner(values redis_client.MemoryValues, leagueId uuid.UUID, playerId string) uuid.UUID {
+	return getMemoryPlayerOwners(values, leagueId)[playerId]
+}
+
+// TransferMemoryRosterPlayer moves the player from one user's roster to another's. It's
+// exported so a trade can move players alongside funds. The memory store must already be locked.
+func TransferMemoryRosterPlayer(values redis_client.MemoryValues, leagueId uuid.UUID, fromUserId uuid.UUID, toUserId uuid.UUID, playerId string, acquiredAt int64) {
+	fromRoster := getMemoryRoster(values, leagueId, fromUserId)
+	rosterPlayer := fromRoster[playerId]
+	delete(fromRoster, playerId)
+	values.Set(redis_client.GenerateRosterRedisKey(leagueId, fromUserId), fromRoster)
+
+	rosterPlayer.UserId = toUserId
+	rosterPlayer.AcquiredAt = acquiredAt
+
+	toRoster := getMemoryRoster(values, leagueId, toUserId)
+	toRoster[playerId] = rosterPlayer
+	values.Set(redis_client.GenerateRosterRedisKey(leagueId, toUserId), toRoster)
+
+	owners := getMemoryPlayerOwners(values, leagueId)
+	owners[playerId] = toUserId
+	values.Set(redis_client.GeneratePlayerToOwnerRedisKey(leagueId), owners)
+}
+
+func getMemoryRoster(values redis_client.MemoryValues, leagueId uuid.UUID, userId uuid.UUID) map[string]entities.RosterPlayer {
+	value, ok := values.Get(redis_client.GenerateRosterRedisKey(leagueId, userId))
+	if !ok {
+		return make(map[string]entities.RosterPlayer)
+	}
+
+	return value.(map[string]entities.RosterPlayer)
+}
+
+func getMemoryPlayerOwners(values redis_client.MemoryValues, leagueId uuid.UUID) map[string]uuid.UUID {
+	value, ok := values.Get(redis_client.GeneratePlayerToOwnerRedisKey(leagueId))
+	if !ok {
+		return make(map[string]uuid.UUID)
+	}
+
+	return value.(map[string]uuid.UUID)
+}
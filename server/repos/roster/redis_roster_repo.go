@@ -0,0 +1,326 @@
+package roster_repo
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RedisRosterRepo struct {
+	redisClient *redis.Client
+}
+
+func NewRedis(redisClient *redis.Client) *RedisRosterRepo {
+	return &RedisRosterRepo{
+		redisClient,
+	}
+}
+
+// GetRoster returns every player the user owns in the league, sorted by when they were acquired
+func (r *RedisRosterRepo) GetRoster(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) ([]entities.RosterPlayer, error) {
+	redisRoster, err := r.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GenerateRosterRedisKey(leagueId, userId),
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get roster",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	rosterPlayers := make([]entities.RosterPlayer, 0, len(redisRoster))
+	for playerId, serializedRosterPlayer := range redisRoster {
+		var rosterPlayer entities.RosterPlayer
+		err = json.Unmarshal([]byte(serializedRosterPlayer), &rosterPlayer)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse roster player",
+				Args: []interface{}{
+					"leagueId", leagueId.String(),
+					"userId", userId.String(),
+					"playerId", playerId,
+				},
+				Err: err,
+			})
+		}
+
+		rosterPlayers = append(rosterPlayers, rosterPlayer)
+	}
+
+	sort.Slice(rosterPlayers, func(i, j int) bool {
+		if rosterPlayers[i].AcquiredAt == rosterPlayers[j].AcquiredAt {
+			return rosterPlayers[i].PlayerId < rosterPlayers[j].PlayerId
+		}
+		return rosterPlayers[i].AcquiredAt < rosterPlayers[j].AcquiredAt
+	})
+
+	return rosterPlayers, nil
+}
+
+// GetPlayerOwner returns the user that owns the player in the league, or an empty id if nobody does
+func (r *RedisRosterRepo) GetPlayerOwner(context echo.Context, leagueId uuid.UUID, playerId string) (uuid.UUID, error) {
+	rawUserId, err := r.redisClient.HGet(
+		context.Request().Context(),
+		redis_client.GeneratePlayerToOwnerRedisKey(leagueId),
+		playerId,
+	).Result()
+	if err == redis.Nil {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get player owner",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"playerId", playerId,
+			},
+			Err: err,
+		})
+	}
+
+	userId, err := uuid.Parse(rawUserId)
+	if err != nil {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to parse player owner",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"playerId", playerId,
+				"userId", rawUserId,
+			},
+			Err: err,
+		})
+	}
+
+	return userId, nil
+}
+
+// GetPlayerOwners returns every owned player in the league keyed on playerId
+func (r *RedisRosterRepo) GetPlayerOwners(context echo.Context, leagueId uuid.UUID) (map[string]uuid.UUID, error) {
+	rawOwners, err := r.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GeneratePlayerToOwnerRedisKey(leagueId),
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get player owners",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	owners := make(map[string]uuid.UUID, len(rawOwners))
+	for playerId, rawUserId := range rawOwners {
+		userId, err := uuid.Parse(rawUserId)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse player owner",
+				Args: []interface{}{
+					"leagueId", leagueId.String(),
+					"playerId", playerId,
+					"userId", rawUserId,
+				},
+				Err: err,
+			})
+		}
+
+		owners[playerId] = userId
+	}
+
+	return owners, nil
+}
+
+// addPlayerToRosterScript saves the player to the roster and marks their owner in one
+// step, so a player is never on a roster without an owner or the other way round
+var addPlayerToRosterScript = redis.NewScript(`
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+
+return 1
+`)
+
+// AddPlayerToRoster saves the player to the user's roster and marks the user as the player's owner
+func (r *RedisRosterRepo) AddPlayerToRoster(context echo.Context, rosterPlayer entities.RosterPlayer) error {
+	serializedRosterPlayer, err := json.Marshal(rosterPlayer)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to serialize roster player",
+			Args: []interface{}{
+				"leagueId", rosterPlayer.LeagueId.String(),
+				"userId", rosterPlayer.UserId.String(),
+				"playerId", rosterPlayer.PlayerId,
+			},
+			Err: err,
+		})
+	}
+
+	_, err = addPlayerToRosterScript.Run(
+		context.Request().Context(),
+		r.redisClient,
+		[]string{
+			redis_client.GenerateRosterRedisKey(rosterPlayer.LeagueId, rosterPlayer.UserId),
+			redis_client.GeneratePlayerToOwnerRedisKey(rosterPlayer.LeagueId),
+		},
+		rosterPlayer.PlayerId,
+		string(serializedRosterPlayer),
+		rosterPlayer.UserId.String(),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to add player to roster",
+			Args: []interface{}{
+				"leagueId", rosterPlayer.LeagueId.String(),
+				"userId", rosterPlayer.UserId.String(),
+				"playerId", rosterPlayer.PlayerId,
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// removePlayerFromRosterScript takes the player off the roster and clears their owner
+// in one step. Returns 1 when the player was removed and 0 when they weren't on the roster,
+// so only one of two requests releasing the same player goes on to refund it.
+var removePlayerFromRosterScript = redis.NewScript(`
+if redis.call('HDEL', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+
+if redis.call('HGET', KEYS[2], ARGV[1]) == ARGV[2] then
+	redis.call('HDEL', KEYS[2], ARGV[1])
+end
+
+return 1
+`)
+
+// RemovePlayerFromRoster takes the player off the user's roster and clears their owner.
+// Fails with a not found error if the player wasn't on the roster.
+func (r *RedisRosterRepo) RemovePlayerFromRoster(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, playerId string) error {
+	args := []interface{}{
+		"leagueId", leagueId.String(),
+		"userId", userId.String(),
+		"playerId", playerId,
+	}
+
+	removedCount, err := removePlayerFromRosterScript.Run(
+		context.Request().Context(),
+		r.redisClient,
+		[]string{
+			redis_client.GenerateRosterRedisKey(leagueId, userId),
+			redis_client.GeneratePlayerToOwnerRedisKey(leagueId),
+		},
+		playerId,
+		userId.String(),
+	).Int64()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to remove player from roster",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	if removedCount == 0 {
+		return newPlayerNotOnRosterError(args)
+	}
+
+	return nil
+}
+
+// releasePlayerFromRosterScript takes the player off the roster, clears their owner and
+// refunds the user in one step, so a player can't be released without the refund or
+// refunded twice. Returns { 1, available, held } with the wallet after the refund, or
+// { 0, 0, 0 } when the player wasn't on the roster.
+var releasePlayerFromRosterScript = redis.NewScript(user_repo.REDIS_WALLET_LUA_FUNCTIONS + `
+if redis.call('HDEL', KEYS[1], ARGV[1]) == 0 then
+	return { 0, 0, 0 }
+end
+
+if redis.call('HGET', KEYS[2], ARGV[1]) == ARGV[2] then
+	redis.call('HDEL', KEYS[2], ARGV[1])
+end
+
+local wallet = adjustWallet(KEYS[3], KEYS[4], KEYS[5], ARGV[3], tonumber(ARGV[4]), 0, ARGV[5])
+
+return { 1, wallet[1], wallet[2] }
+`)
+
+// ReleasePlayerFromRoster takes the player off the user's roster and refunds the user in
+// one atomic step, recording the refund transaction in their wallet ledger. Fails with a
+// not found error if the player wasn't on the roster, without refunding anything.
+func (r *RedisRosterRepo) ReleasePlayerFromRoster(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, playerId string, refund entities.WalletTransaction) (entities.Wallet, error) {
+	args := []interface{}{
+		"leagueId", leagueId.String(),
+		"userId", userId.String(),
+		"playerId", playerId,
+	}
+
+	serializedRefund := ""
+	if refund.Amount > 0 {
+		var err error
+		serializedRefund, err = user_repo.SerializeRedisWalletTransaction(refund)
+		if err != nil {
+			return entities.Wallet{}, err
+		}
+	}
+
+	result, err := releasePlayerFromRosterScript.Run(
+		context.Request().Context(),
+		r.redisClient,
+		[]string{
+			redis_client.GenerateRosterRedisKey(leagueId, userId),
+			redis_client.GeneratePlayerToOwnerRedisKey(leagueId),
+			redis_client.GenerateUserWalletRedisKey(userId),
+			redis_client.GenerateUserHeldWalletRedisKey(userId),
+			redis_client.GenerateUserWalletLedgerRedisKey(userId, leagueId),
+		},
+		playerId,
+		userId.String(),
+		leagueId.String(),
+		refund.Amount,
+		serializedRefund,
+	).Int64Slice()
+	if err != nil {
+		return entities.Wallet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to release player from roster",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	if result[0] == 0 {
+		return entities.Wallet{}, newPlayerNotOnRosterError(args)
+	}
+
+	return entities.Wallet{
+		LeagueId:  leagueId,
+		Available: result[1],
+		Held:      result[2],
+	}, nil
+}
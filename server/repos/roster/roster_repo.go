@@ -0,0 +1,54 @@
+package roster_repo
+
+import (
+	"net/http"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RosterRepo interface {
+	// GetRoster returns every player the user owns in the league, sorted by when they were acquired
+	GetRoster(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) ([]entities.RosterPlayer, error)
+	// GetPlayerOwner returns the user that owns the player in the league, or an empty id if nobody does
+	GetPlayerOwner(context echo.Context, leagueId uuid.UUID, playerId string) (uuid.UUID, error)
+	// GetPlayerOwners returns every owned player in the league keyed on playerId
+	GetPlayerOwners(context echo.Context, leagueId uuid.UUID) (map[string]uuid.UUID, error)
+	// AddPlayerToRoster saves the player to the user's roster and marks the user as the player's owner
+	AddPlayerToRoster(context echo.Context, rosterPlayer entities.RosterPlayer) error
+	// RemovePlayerFromRoster takes the player off the user's roster and clears their owner.
+	// Fails with a not found error if the player wasn't on the roster, so two requests
+	// removing the same player can't both act on it.
+	RemovePlayerFromRoster(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, playerId string) error
+	// ReleasePlayerFromRoster takes the player off the user's roster and refunds the user in
+	// one atomic step, recording the refund transaction in their wallet ledger. Refunds of
+	// nothing leave the wallet alone. Fails with a not found error if the player wasn't on
+	// the roster, without refunding anything. Returns the user's wallet for the league.
+	ReleasePlayerFromRoster(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, playerId string, refund entities.WalletTransaction) (entities.Wallet, error)
+}
+
+// New returns the RosterRepo for the storage backend picked in the config
+func New(config *config_service.Config, redisClient *redis.Client, memoryStore *redis_client.MemoryStore, sqlClient *redis_client.SqlClient) RosterRepo {
+	switch config.GetStorageConfig().Backend {
+	case config_service.STORAGE_BACKEND_MEMORY:
+		return NewMemory(memoryStore)
+	case config_service.STORAGE_BACKEND_SQL:
+		return NewSql(sqlClient)
+	}
+
+	return NewRedis(redisClient)
+}
+
+func newPlayerNotOnRosterError(args []interface{}) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusNotFound,
+		Message: "player is not on the user's roster",
+		Args:    args,
+		Err:     nil,
+	})
+}
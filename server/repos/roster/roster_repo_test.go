@@ -0,0 +1,125 @@
+package roster_repo
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/wilbertthelam/prop-ock/entities"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/test_utils"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+const (
+	parallelReleaseCount = 20
+	releaseRefund        = 5
+)
+
+// rosterTestRepos are the repos a roster test needs, all on the same backend
+type rosterTestRepos struct {
+	rosterRepo RosterRepo
+	leagueRepo league_repo.LeagueRepo
+	userRepo   user_repo.UserRepo
+}
+
+func TestParallelReleases(t *testing.T) {
+	test_utils.RunOnEveryBackend(t, func(t *testing.T, backend test_utils.Backend) {
+		runParallelReleaseTest(t, rosterTestRepos{
+			New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			league_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			user_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+		})
+	})
+}
+
+// runParallelReleaseTest releases the same player from every goroutine. Only one
+// release can succeed, and only that one refunds the player.
+func runParallelReleaseTest(t *testing.T, repos rosterTestRepos) {
+	context := test_utils.NewContext()
+	leagueId := uuid.New()
+	userId := uuid.New()
+	playerId := "released_player"
+
+	err := repos.leagueRepo.CreateLeague(context, leagueId, entities.League{Id: leagueId, Name: "parallel releases"}, entities.NewDefaultLeagueSettings(leagueId), uuid.Nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repos.userRepo.CreateUser(context, userId, entities.User{Id: userId, Name: "owner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repos.rosterRepo.AddPlayerToRoster(context, entities.RosterPlayer{
+		PlayerId:   playerId,
+		UserId:     userId,
+		LeagueId:   leagueId,
+		Price:      10,
+		AcquiredAt: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var waitGroup sync.WaitGroup
+	var mutex sync.Mutex
+	var releasedCount int
+	var notFoundCount int
+
+	start := make(chan struct{})
+	for index := 0; index < parallelReleaseCount; index++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			<-start
+
+			refund := entities.NewWalletTransaction(userId, leagueId, releaseRefund, 0, entities.WALLET_TRANSACTION_REASON_RELEASE_REFUND, uuid.Nil, playerId)
+			_, err := repos.rosterRepo.ReleasePlayerFromRoster(test_utils.NewContext(), leagueId, userId, playerId, refund)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err == nil {
+				releasedCount++
+			} else if utils.IsNotFoundError(err) {
+				notFoundCount++
+			} else {
+				t.Error(err)
+			}
+		}()
+	}
+
+	close(start)
+	waitGroup.Wait()
+
+	if releasedCount != 1 || notFoundCount != parallelReleaseCount-1 {
+		t.Errorf("released the player %v times and missed them %v times, expected 1 and %v", releasedCount, notFoundCount, parallelReleaseCount-1)
+	}
+
+	ownerId, err := repos.rosterRepo.GetPlayerOwner(context, leagueId, playerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ownerId != uuid.Nil {
+		t.Errorf("player is still owned by %v", ownerId)
+	}
+	wallets, err := repos.userRepo.GetUserWallet(context, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wallets[leagueId].Available != releaseRefund {
+		t.Errorf("wallet is %+v after the release, expected %v available", wallets[leagueId], releaseRefund)
+	}
+
+	transactions, err := repos.userRepo.GetWalletTransactions(context, userId, leagueId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transactions) != 1 || transactions[0].Amount != releaseRefund || transactions[0].Balance != releaseRefund {
+		t.Errorf("wallet ledger is %+v, expected a single refund of %v", transactions, releaseRefund)
+	}
+}
@@ -0,0 +1,297 @@
+package roster_repo
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// SqlRosterRepo keeps rosters in the rosters table. A player can only be on one
+// roster per league, so the row for the player also says who owns them.
+type SqlRosterRepo struct {
+	sqlClient *redis_client.SqlClient
+}
+
+func NewSql(sqlClient *redis_client.SqlClient) *SqlRosterRepo {
+	return &SqlRosterRepo{
+		sqlClient,
+	}
+}
+
+// GetRoster returns every player the user owns in the league, sorted by when they were acquired
+func (r *SqlRosterRepo) GetRoster(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) ([]entities.RosterPlayer, error) {
+	rows, err := r.sqlClient.Query(
+		context,
+		`SELECT player_id, user_id, league_id, auction_id, price, acquired_at FROM rosters
+		WHERE league_id = ? AND user_id = ? ORDER BY acquired_at, player_id`,
+		leagueId,
+		userId,
+	)
+	if err != nil {
+		return nil, newGetRosterError(leagueId, userId, err)
+	}
+	defer rows.Close()
+
+	rosterPlayers := []entities.RosterPlayer{}
+	for rows.Next() {
+		var rosterPlayer entities.RosterPlayer
+		var auctionId uuid.NullUUID
+		err = rows.Scan(
+			&rosterPlayer.PlayerId,
+			&rosterPlayer.UserId,
+			&rosterPlayer.LeagueId,
+			&auctionId,
+			&rosterPlayer.Price,
+			&rosterPlayer.AcquiredAt,
+		)
+		if err != nil {
+			return nil, newGetRosterError(leagueId, userId, err)
+		}
+
+		rosterPlayer.AuctionId = auctionId.UUID
+		rosterPlayers = append(rosterPlayers, rosterPlayer)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, newGetRosterError(leagueId, userId, err)
+	}
+
+	return rosterPlayers, nil
+}
+
+func newGetRosterError(leagueId uuid.UUID, userId uuid.UUID, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to get roster",
+		Args: []interface{}{
+			"leagueId", leagueId.String(),
+			"userId", userId.String(),
+		},
+		Err: err,
+	})
+}
+
+// GetPlayerOwner returns the user that owns the player in the league, or an empty id if nobody does
+func (r *SqlRosterRepo) GetPlayerOwner(context echo.Context, leagueId uuid.UUID, playerId string) (uuid.UUID, error) {
+	var userId uuid.UUID
+	err := r.sqlClient.QueryRow(
+		context,
+		"SELECT user_id FROM rosters WHERE league_id = ? AND player_id = ?",
+		leagueId,
+		playerId,
+	).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get player owner",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"playerId", playerId,
+			},
+			Err: err,
+		})
+	}
+
+	return userId, nil
+}
+
+// GetPlayerOwners returns every owned player in the league keyed on playerId
+func (r *SqlRosterRepo) GetPlayerOwners(context echo.Context, leagueId uuid.UUID) (map[string]uuid.UUID, error) {
+	owners, err := r.getPlayerOwners(context, leagueId)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get player owners",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return owners, nil
+}
+
+func (r *SqlRosterRepo) getPlayerOwners(context echo.Context, leagueId uuid.UUID) (map[string]uuid.UUID, error) {
+	rows, err := r.sqlClient.Query(
+		context,
+		"SELECT player_id, user_id FROM rosters WHERE league_id = ?",
+		leagueId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owners := make(map[string]uuid.UUID)
+	for rows.Next() {
+		var playerId string
+		var userId uuid.UUID
+		err = rows.Scan(&playerId, &userId)
+		if err != nil {
+			return nil, err
+		}
+
+		owners[playerId] = userId
+	}
+
+	return owners, rows.Err()
+}
+
+// AddPlayerToRoster saves the player to the user's roster, which also marks the user as the player's owner
+func (r *SqlRosterRepo) AddPlayerToRoster(context echo.Context, rosterPlayer entities.RosterPlayer) error {
+	_, err := r.sqlClient.Exec(
+		context,
+		`INSERT INTO rosters (league_id, player_id, user_id, auction_id, price, acquired_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (league_id, player_id) DO UPDATE SET
+			user_id = excluded.user_id,
+			auction_id = excluded.auction_id,
+			price = excluded.price,
+			acquired_at = excluded.acquired_at`,
+		rosterPlayer.LeagueId,
+		rosterPlayer.PlayerId,
+		rosterPlayer.UserId,
+		redis_client.NullUuid(rosterPlayer.AuctionId),
+		rosterPlayer.Price,
+		rosterPlayer.AcquiredAt,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to add player to roster",
+			Args: []interface{}{
+				"leagueId", rosterPlayer.LeagueId.String(),
+				"userId", rosterPlayer.UserId.String(),
+				"playerId", rosterPlayer.PlayerId,
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// AddSqlRosterPlayer saves the player to the user's roster, so other repos can hand out a
+// player inside their own transaction, like settling an auction. Returns false without
+// changing anything if someone in the league already owns the player.
+func AddSqlRosterPlayer(context echo.Context, sqlClient *redis_client.SqlClient, rosterPlayer entities.RosterPlayer) (bool, error) {
+	args := []interface{}{
+		"leagueId", rosterPlayer.LeagueId.String(),
+		"userId", rosterPlayer.UserId.String(),
+		"playerId", rosterPlayer.PlayerId,
+	}
+
+	result, err := sqlClient.Exec(
+		context,
+		`INSERT INTO rosters (league_id, player_id, user_id, auction_id, price, acquired_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (league_id, player_id) DO NOTHING`,
+		rosterPlayer.LeagueId,
+		rosterPlayer.PlayerId,
+		rosterPlayer.UserId,
+		redis_client.NullUuid(rosterPlayer.AuctionId),
+		rosterPlayer.Price,
+		rosterPlayer.AcquiredAt,
+	)
+	if err != nil {
+		return false, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to add player to roster",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	addedCount, err := result.RowsAffected()
+	if err != nil {
+		return false, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to check if player was added to roster",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	return addedCount > 0, nil
+}
+
+// RemovePlayerFromRoster takes the player off the user's roster, which also clears their owner.
+// Fails with a not found error if the player wasn't on the roster.
+func (r *SqlRosterRepo) RemovePlayerFromRoster(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, playerId string) error {
+	args := []interface{}{
+		"leagueId", leagueId.String(),
+		"userId", userId.String(),
+		"playerId", playerId,
+	}
+
+	result, err := r.sqlClient.Exec(
+		context,
+		"DELETE FROM rosters WHERE league_id = ? AND user_id = ? AND player_id = ?",
+		leagueId,
+		userId,
+		playerId,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to remove player from roster",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	removedCount, err := result.RowsAffected()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to remove player from roster",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	if removedCount == 0 {
+		return newPlayerNotOnRosterError(args)
+	}
+
+	return nil
+}
+
+// ReleasePlayerFromRoster takes the player off the user's roster and refunds the user in
+// one atomic step, recording the refund transaction in their wallet ledger. Fails with a
+// not found error if the player wasn't on the roster, without refunding anything.
+func (r *SqlRosterRepo) ReleasePlayerFromRoster(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, playerId string, refund entities.WalletTransaction) (entities.Wallet, error) {
+	var wallet entities.Wallet
+	err := r.sqlClient.StartTransaction(context, func() error {
+		err := r.RemovePlayerFromRoster(context, leagueId, userId, playerId)
+		if err != nil {
+			return err
+		}
+
+		wallet, _, err = user_repo.AdjustSqlWalletFunds(context, r.sqlClient, userId, leagueId, refund.Amount, 0)
+		if err != nil || refund.Amount <= 0 {
+			return err
+		}
+
+		refund.Balance = wallet.Available
+		refund.HeldBalance = wallet.Held
+
+		return user_repo.AddSqlWalletTransaction(context, r.sqlClient, refund)
+	})
+	if err != nil {
+		return entities.Wallet{}, err
+	}
+
+	return wallet, nil
+}
@@ -0,0 +1,77 @@
+package schedule_repo
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// MemoryScheduleRepo keeps pending transitions in a sorted set in the memory store,
+// scored the same way as in Redis
+type MemoryScheduleRepo struct {
+	memoryStore *redis_client.MemoryStore
+}
+
+func NewMemory(memoryStore *redis_client.MemoryStore) *MemoryScheduleRepo {
+	return &MemoryScheduleRepo{
+		memoryStore,
+	}
+}
+
+func (s *MemoryScheduleRepo) ScheduleAuctionTransition(context echo.Context, auctionId uuid.UUID, transition entities.AuctionTransition, runAt int64) error {
+	return s.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		ScheduleMemoryAuctionTransition(values, auctionId, transition, runAt)
+		return nil
+	})
+}
+
+// ScheduleMemoryAuctionTransition queues up the transition to run at the given time.
+// It's exported so other memory repos can schedule transitions alongside their own
+// writes. The memory store must already be locked.
+func ScheduleMemoryAuctionTransition(values redis_client.MemoryValues, auctionId uuid.UUID, transition entities.AuctionTransition, runAt int64) {
+	values.ZAdd(redis_client.GenerateAuctionTransitionsRedisKey(), GenerateAuctionTransitionMember(auctionId, transition), runAt)
+}
+
+// GetDueAuctionTransitions returns every pending transition scheduled at or before the given time
+func (s *MemoryScheduleRepo) GetDueAuctionTransitions(context echo.Context, now int64) ([]entities.ScheduledAuctionTransition, error) {
+	var transitions []entities.ScheduledAuctionTransition
+	err := s.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		members := values.ZRangeByScore(redis_client.GenerateAuctionTransitionsRedisKey(), now)
+
+		transitions = make([]entities.ScheduledAuctionTransition, len(members))
+		for index, member := range members {
+			transition, err := parseAuctionTransitionMember(member)
+			if err != nil {
+				return utils.NewError(utils.ErrorParams{
+					Code:    http.StatusInternalServerError,
+					Message: "failed to parse scheduled auction transition",
+					Args: []interface{}{
+						"member", member,
+					},
+					Err: err,
+				})
+			}
+
+			transition.RunAt, _ = values.ZScore(redis_client.GenerateAuctionTransitionsRedisKey(), member)
+			transitions[index] = transition
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transitions, nil
+}
+
+func (s *MemoryScheduleRepo) RemoveAuctionTransition(context echo.Context, auctionId uuid.UUID, transition entities.AuctionTransition) error {
+	return s.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.ZRem(redis_client.GenerateAuctionTransitionsRedisKey(), GenerateAuctionTransitionMember(auctionId, transition))
+		return nil
+	})
+}
@@ -0,0 +1,143 @@
+package schedule_repo
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RedisScheduleRepo struct {
+	redisClient *redis.Client
+}
+
+func NewRedis(redisClient *redis.Client) *RedisScheduleRepo {
+	return &RedisScheduleRepo{
+		redisClient,
+	}
+}
+
+// GenerateAuctionTransitionMember returns the sorted set member for a pending transition.
+// It's exported so other Redis repos can schedule transitions in their own scripts.
+func GenerateAuctionTransitionMember(auctionId uuid.UUID, transition entities.AuctionTransition) string {
+	return fmt.Sprintf("%v:%v", auctionId.String(), int64(transition))
+}
+
+func (s *RedisScheduleRepo) ScheduleAuctionTransition(context echo.Context, auctionId uuid.UUID, transition entities.AuctionTransition, runAt int64) error {
+	_, err := s.redisClient.ZAdd(
+		context.Request().Context(),
+		redis_client.GenerateAuctionTransitionsRedisKey(),
+		&redis.Z{
+			Score:  float64(runAt),
+			Member: GenerateAuctionTransitionMember(auctionId, transition),
+		},
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to schedule auction transition",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"transition", fmt.Sprintf("%v", transition),
+				"runAt", fmt.Sprintf("%v", runAt),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// GetDueAuctionTransitions returns every pending transition scheduled at or before the given time
+func (s *RedisScheduleRepo) GetDueAuctionTransitions(context echo.Context, now int64) ([]entities.ScheduledAuctionTransition, error) {
+	rawTransitions, err := s.redisClient.ZRangeByScoreWithScores(
+		context.Request().Context(),
+		redis_client.GenerateAuctionTransitionsRedisKey(),
+		&redis.ZRangeBy{
+			Min: "-inf",
+			Max: strconv.FormatInt(now, 10),
+		},
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get due auction transitions",
+			Args: []interface{}{
+				"now", fmt.Sprintf("%v", now),
+			},
+			Err: err,
+		})
+	}
+
+	transitions := make([]entities.ScheduledAuctionTransition, len(rawTransitions))
+	for index, rawTransition := range rawTransitions {
+		member := rawTransition.Member.(string)
+
+		transition, err := parseAuctionTransitionMember(member)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse scheduled auction transition",
+				Args: []interface{}{
+					"member", member,
+				},
+				Err: err,
+			})
+		}
+
+		transition.RunAt = int64(rawTransition.Score)
+		transitions[index] = transition
+	}
+
+	return transitions, nil
+}
+
+func (s *RedisScheduleRepo) RemoveAuctionTransition(context echo.Context, auctionId uuid.UUID, transition entities.AuctionTransition) error {
+	_, err := s.redisClient.ZRem(
+		context.Request().Context(),
+		redis_client.GenerateAuctionTransitionsRedisKey(),
+		GenerateAuctionTransitionMember(auctionId, transition),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to remove scheduled auction transition",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"transition", fmt.Sprintf("%v", transition),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func parseAuctionTransitionMember(member string) (entities.ScheduledAuctionTransition, error) {
+	parts := strings.Split(member, ":")
+	if len(parts) != 2 {
+		return entities.ScheduledAuctionTransition{}, fmt.Errorf("malformed auction transition member: %v", member)
+	}
+
+	auctionId, err := uuid.Parse(parts[0])
+	if err != nil {
+		return entities.ScheduledAuctionTransition{}, err
+	}
+
+	transition, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return entities.ScheduledAuctionTransition{}, err
+	}
+
+	return entities.ScheduledAuctionTransition{
+		AuctionId:  auctionId,
+		Transition: entities.AuctionTransition(transition),
+	}, nil
+}
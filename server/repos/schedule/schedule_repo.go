@@ -0,0 +1,29 @@
+package schedule_repo
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+)
+
+type ScheduleRepo interface {
+	ScheduleAuctionTransition(context echo.Context, auctionId uuid.UUID, transition entities.AuctionTransition, runAt int64) error
+	// GetDueAuctionTransitions returns every pending transition scheduled at or before the given time
+	GetDueAuctionTransitions(context echo.Context, now int64) ([]entities.ScheduledAuctionTransition, error)
+	RemoveAuctionTransition(context echo.Context, auctionId uuid.UUID, transition entities.AuctionTransition) error
+}
+
+// New returns the ScheduleRepo for the storage backend picked in the config
+func New(config *config_service.Config, redisClient *redis.Client, memoryStore *redis_client.MemoryStore, sqlClient *redis_client.SqlClient) ScheduleRepo {
+	switch config.GetStorageConfig().Backend {
+	case config_service.STORAGE_BACKEND_MEMORY:
+		return NewMemory(memoryStore)
+	case config_service.STORAGE_BACKEND_SQL:
+		return NewSql(sqlClient)
+	}
+
+	return NewRedis(redisClient)
+}
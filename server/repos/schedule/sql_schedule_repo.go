@@ -0,0 +1,120 @@
+package schedule_repo
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// SqlScheduleRepo keeps pending transitions in the auction_transitions table,
+// indexed on when they should run
+type SqlScheduleRepo struct {
+	sqlClient *redis_client.SqlClient
+}
+
+func NewSql(sqlClient *redis_client.SqlClient) *SqlScheduleRepo {
+	return &SqlScheduleRepo{
+		sqlClient,
+	}
+}
+
+func (s *SqlScheduleRepo) ScheduleAuctionTransition(context echo.Context, auctionId uuid.UUID, transition entities.AuctionTransition, runAt int64) error {
+	return ScheduleSqlAuctionTransition(context, s.sqlClient, auctionId, transition, runAt)
+}
+
+// ScheduleSqlAuctionTransition queues up the transition to run at the given time.
+// It's exported so other SQL repos can schedule transitions in the same transaction.
+func ScheduleSqlAuctionTransition(context echo.Context, sqlClient *redis_client.SqlClient, auctionId uuid.UUID, transition entities.AuctionTransition, runAt int64) error {
+	_, err := sqlClient.Exec(
+		context,
+		`INSERT INTO auction_transitions (auction_id, transition, run_at) VALUES (?, ?, ?)
+		ON CONFLICT (auction_id, transition) DO UPDATE SET run_at = excluded.run_at`,
+		auctionId,
+		transition,
+		runAt,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to schedule auction transition",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"transition", fmt.Sprintf("%v", transition),
+				"runAt", fmt.Sprintf("%v", runAt),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// GetDueAuctionTransitions returns every pending transition scheduled at or before the given time
+func (s *SqlScheduleRepo) GetDueAuctionTransitions(context echo.Context, now int64) ([]entities.ScheduledAuctionTransition, error) {
+	transitions, err := s.getDueAuctionTransitions(context, now)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get due auction transitions",
+			Args: []interface{}{
+				"now", fmt.Sprintf("%v", now),
+			},
+			Err: err,
+		})
+	}
+
+	return transitions, nil
+}
+
+func (s *SqlScheduleRepo) getDueAuctionTransitions(context echo.Context, now int64) ([]entities.ScheduledAuctionTransition, error) {
+	rows, err := s.sqlClient.Query(
+		context,
+		`SELECT auction_id, transition, run_at FROM auction_transitions
+		WHERE run_at <= ? ORDER BY run_at, auction_id, transition`,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := []entities.ScheduledAuctionTransition{}
+	for rows.Next() {
+		var transition entities.ScheduledAuctionTransition
+		err = rows.Scan(&transition.AuctionId, &transition.Transition, &transition.RunAt)
+		if err != nil {
+			return nil, err
+		}
+
+		transitions = append(transitions, transition)
+	}
+
+	return transitions, rows.Err()
+}
+
+func (s *SqlScheduleRepo) RemoveAuctionTransition(context echo.Context, auctionId uuid.UUID, transition entities.AuctionTransition) error {
+	_, err := s.sqlClient.Exec(
+		context,
+		"DELETE FROM auction_transitions WHERE auction_id = ? AND transition = ?",
+		auctionId,
+		transition,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to remove scheduled auction transition",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"transition", fmt.Sprintf("%v", transition),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package trade_repo
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// MemoryTradeRepo keeps trades and the trade schedule in the memory store
+type MemoryTradeRepo struct {
+	memoryStore *redis_client.MemoryStore
+}
+
+func NewMemory(memoryStore *redis_client.MemoryStore) *MemoryTradeRepo {
+	return &MemoryTradeRepo{
+		memoryStore,
+	}
+}
+
+func (t *MemoryTradeRepo) GetTradeByTradeId(context echo.Context, tradeId uuid.UUID) (entities.Trade, error) {
+	var trade entities.Trade
+	err := t.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		value, ok := values.Get(redis_client.GenerateTradeRedisKey(tradeId))
+		if !ok {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusNotFound,
+				Message: "no trade found",
+				Args: []interface{}{
+					"tradeId", tradeId.String(),
+				},
+				Err: nil,
+			})
+		}
+
+		trade = copyTrade(value.(entities.Trade))
+		return nil
+	})
+
+	return trade, err
+}
+
+func (t *MemoryTradeRepo) GetTradeIdsForLeague(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
+	var tradeIds []uuid.UUID
+	err := t.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		for _, tradeId := range values.SMembers(redis_client.GenerateLeagueToTradesRedisKey(leagueId)) {
+			tradeIds = append(tradeIds, uuid.MustParse(tradeId))
+		}
+
+		return nil
+	})
+
+	return tradeIds, err
+}
+
+// SaveTrade creates or overwrites the trade, makes sure it's listed under its league and
+// schedules it to be looked at again at runAt, or takes it off the schedule when runAt is 0
+func (t *MemoryTradeRepo) SaveTrade(context echo.Context, trade entities.Trade, runAt int64) error {
+	return t.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		saveMemoryTrade(values, trade, runAt)
+		return nil
+	})
+}
+
+// CounterTrade saves the countered trade off the schedule and the counter offer scheduled to expire
+func (t *MemoryTradeRepo) CounterTrade(context echo.Context, trade entities.Trade, counterTrade entities.Trade) error {
+	return t.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		saveMemoryTrade(values, trade, 0)
+		saveMemoryTrade(values, counterTrade, counterTrade.ExpiresAt)
+
+		return nil
+	})
+}
+
+func saveMemoryTrade(values redis_client.MemoryValues, trade entities.Trade, runAt int64) {
+	values.Set(redis_client.GenerateTradeRedisKey(trade.Id), copyTrade(trade))
+	values.SAdd(redis_client.GenerateLeagueToTradesRedisKey(trade.LeagueId), trade.Id.String())
+
+	if runAt > 0 {
+		values.ZAdd(redis_client.GenerateScheduledTradesRedisKey(), trade.Id.String(), runAt)
+	} else {
+		values.ZRem(redis_client.GenerateScheduledTradesRedisKey(), trade.Id.String())
+	}
+}
+
+// copyTrade copies the trade's player lists so callers changing
+// a trade don't change the one kept in the store
+func copyTrade(trade entities.Trade) entities.Trade {
+	trade.ProposerPlayerIds = append([]string(nil), trade.ProposerPlayerIds...)
+	trade.ReceiverPlayerIds = append([]string(nil), trade.ReceiverPlayerIds...)
+
+	return trade
+}
+
+// GetDueTradeIds returns every trade scheduled at or before the given time
+func (t *MemoryTradeRepo) GetDueTradeIds(context echo.Context, now int64) ([]uuid.UUID, error) {
+	var tradeIds []uuid.UUID
+	err := t.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		for _, tradeId := range values.ZRangeByScore(redis_client.GenerateScheduledTradesRedisKey(), now) {
+			tradeIds = append(tradeIds, uuid.MustParse(tradeId))
+		}
+
+		return nil
+	})
+
+	return tradeIds, err
+}
+
+func (t *MemoryTradeRepo) RemoveScheduledTrade(context echo.Context, tradeId uuid.UUID) error {
+	return t.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.ZRem(redis_client.GenerateScheduledTradesRedisKey(), tradeId.String())
+		return nil
+	})
+}
+
+// ExchangeTradeAssets moves every player and dollar in the trade, records the funds each
+// side sends and receives in their wallet ledgers, and saves the trade off the schedule,
+// in one atomic step. If either side no longer has what they're trading away, nothing
+// moves and the trade isn't saved.
+func (t *MemoryTradeRepo) ExchangeTradeAssets(context echo.Context, trade entities.Trade, acquiredAt int64) error {
+	return t.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		for _, playerId := range trade.ProposerPlayerIds {
+			if !roster_repo.HasMemoryRosterPlayer(values, trade.LeagueId, trade.ProposerId, playerId) {
+				return checkTradeExchange(TRADE_EXCHANGE_MISSING_PLAYER, trade)
+			}
+		}
+
+		for _, playerId := range trade.ReceiverPlayerIds {
+			if !roster_repo.HasMemoryRosterPlayer(values, trade.LeagueId, trade.ReceiverId, playerId) {
+				return checkTradeExchange(TRADE_EXCHANGE_MISSING_PLAYER, trade)
+			}
+		}
+
+		transactions := getTradeWalletTransactions(trade)
+		for index, transaction := range transactions {
+			wallet, status := user_repo.AdjustMemoryWalletFunds(values, transaction.UserId, trade.LeagueId, transaction.Amount, 0)
+			if status != user_repo.WALLET_ADJUSTMENT_APPLIED {
+				// The memory store doesn't roll back, so undo the funds that already moved
+				for _, appliedTransaction := range transactions[:index] {
+					user_repo.AdjustMemoryWalletFunds(values, appliedTransaction.UserId, trade.LeagueId, appliedTransaction.Amount*-1, 0)
+				}
+
+				return checkTradeExchange(TRADE_EXCHANGE_MISSING_FUNDS, trade)
+			}
+
+			transactions[index].Balance = wallet.Available
+			transactions[index].HeldBalance = wallet.Held
+		}
+
+		for _, transaction := range transactions {
+			user_repo.AddMemoryWalletTransaction(values, transaction)
+		}
+
+		for _, playerId := range trade.ProposerPlayerIds {
+			roster_repo.TransferMemoryRosterPlayer(values, trade.LeagueId, trade.ProposerId, trade.ReceiverId, playerId, acquiredAt)
+		}
+
+		for _, playerId := range trade.ReceiverPlayerIds {
+			roster_repo.TransferMemoryRosterPlayer(values, trade.LeagueId, trade.ReceiverId, trade.ProposerId, playerId, acquiredAt)
+		}
+
+		saveMemoryTrade(values, trade, 0)
+
+		return nil
+	})
+}
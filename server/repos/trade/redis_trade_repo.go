@@ -0,0 +1,455 @@
+package trade_repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RedisTradeRepo struct {
+	redisClient *redis.Client
+}
+
+func NewRedis(redisClient *redis.Client) *RedisTradeRepo {
+	return &RedisTradeRepo{
+		redisClient,
+	}
+}
+
+func (t *RedisTradeRepo) GetTradeByTradeId(context echo.Context, tradeId uuid.UUID) (entities.Trade, error) {
+	serializedTrade, err := t.redisClient.Get(
+		context.Request().Context(),
+		redis_client.GenerateTradeRedisKey(tradeId),
+	).Result()
+	if err == redis.Nil {
+		return entities.Trade{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "no trade found",
+			Args: []interface{}{
+				"tradeId", tradeId.String(),
+			},
+			Err: nil,
+		})
+	}
+	if err != nil {
+		return entities.Trade{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get trade",
+			Args: []interface{}{
+				"tradeId", tradeId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	var trade entities.Trade
+	err = json.Unmarshal([]byte(serializedTrade), &trade)
+	if err != nil {
+		return entities.Trade{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to unmarshal trade",
+			Args: []interface{}{
+				"tradeId", tradeId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return trade, nil
+}
+
+func (t *RedisTradeRepo) GetTradeIdsForLeague(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
+	rawTradeIds, err := t.redisClient.SMembers(
+		context.Request().Context(),
+		redis_client.GenerateLeagueToTradesRedisKey(leagueId),
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get trades for league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	tradeIds := make([]uuid.UUID, len(rawTradeIds))
+	for index, rawTradeId := range rawTradeIds {
+		tradeIds[index], err = uuid.Parse(rawTradeId)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse trade id for league",
+				Args: []interface{}{
+					"leagueId", leagueId.String(),
+					"tradeId", rawTradeId,
+				},
+				Err: err,
+			})
+		}
+	}
+
+	return tradeIds, nil
+}
+
+// redisSaveTradeLuaFunction saves a trade as a Lua function, so every script that changes
+// a trade keeps it listed under its league and its schedule in step with it. The trade is
+// scheduled at runAt, or taken off the schedule when runAt is 0.
+const redisSaveTradeLuaFunction = `
+local function saveTrade(tradeKey, leagueTradesKey, scheduleKey, tradeId, serializedTrade, runAt)
+	redis.call('SET', tradeKey, serializedTrade)
+	redis.call('SADD', leagueTradesKey, tradeId)
+
+	if tonumber(runAt) > 0 then
+		redis.call('ZADD', scheduleKey, runAt, tradeId)
+	else
+		redis.call('ZREM', scheduleKey, tradeId)
+	end
+end
+`
+
+var saveTradeScript = redis.NewScript(redisSaveTradeLuaFunction + `
+saveTrade(KEYS[1], KEYS[2], KEYS[3], ARGV[1], ARGV[2], ARGV[3])
+
+return 1
+`)
+
+// SaveTrade creates or overwrites the trade, makes sure it's listed under its league and
+// schedules it to be looked at again at runAt, or takes it off the schedule when runAt
+// is 0, in one atomic step
+func (t *RedisTradeRepo) SaveTrade(context echo.Context, trade entities.Trade, runAt int64) error {
+	serializedTrade, err := serializeRedisTrade(trade)
+	if err != nil {
+		return err
+	}
+
+	_, err = saveTradeScript.Run(
+		context.Request().Context(),
+		t.redisClient,
+		[]string{
+			redis_client.GenerateTradeRedisKey(trade.Id),
+			redis_client.GenerateLeagueToTradesRedisKey(trade.LeagueId),
+			redis_client.GenerateScheduledTradesRedisKey(),
+		},
+		trade.Id.String(),
+		serializedTrade,
+		runAt,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to save trade",
+			Args: []interface{}{
+				"tradeId", trade.Id.String(),
+				"runAt", fmt.Sprintf("%v", runAt),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// counterTradeScript saves the countered trade off the schedule and the counter offer
+// scheduled to expire in one step, so the receiver can't be left with neither
+var counterTradeScript = redis.NewScript(redisSaveTradeLuaFunction + `
+saveTrade(KEYS[1], KEYS[3], KEYS[4], ARGV[1], ARGV[2], 0)
+saveTrade(KEYS[2], KEYS[3], KEYS[4], ARGV[3], ARGV[4], ARGV[5])
+
+return 1
+`)
+
+// CounterTrade saves the countered trade off the schedule and the counter offer scheduled
+// to expire, in one atomic step
+func (t *RedisTradeRepo) CounterTrade(context echo.Context, trade entities.Trade, counterTrade entities.Trade) error {
+	serializedTrade, err := serializeRedisTrade(trade)
+	if err != nil {
+		return err
+	}
+
+	serializedCounterTrade, err := serializeRedisTrade(counterTrade)
+	if err != nil {
+		return err
+	}
+
+	_, err = counterTradeScript.Run(
+		context.Request().Context(),
+		t.redisClient,
+		[]string{
+			redis_client.GenerateTradeRedisKey(trade.Id),
+			redis_client.GenerateTradeRedisKey(counterTrade.Id),
+			redis_client.GenerateLeagueToTradesRedisKey(trade.LeagueId),
+			redis_client.GenerateScheduledTradesRedisKey(),
+		},
+		trade.Id.String(),
+		serializedTrade,
+		counterTrade.Id.String(),
+		serializedCounterTrade,
+		counterTrade.ExpiresAt,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to save counter trade",
+			Args: []interface{}{
+				"tradeId", trade.Id.String(),
+				"counterTradeId", counterTrade.Id.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func serializeRedisTrade(trade entities.Trade) (string, error) {
+	serializedTrade, err := json.Marshal(trade)
+	if err != nil {
+		return "", utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to serialize trade",
+			Args: []interface{}{
+				"tradeId", trade.Id.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return string(serializedTrade), nil
+}
+
+// GetDueTradeIds returns every trade scheduled at or before the given time
+func (t *RedisTradeRepo) GetDueTradeIds(context echo.Context, now int64) ([]uuid.UUID, error) {
+	rawTradeIds, err := t.redisClient.ZRangeByScore(
+		context.Request().Context(),
+		redis_client.GenerateScheduledTradesRedisKey(),
+		&redis.ZRangeBy{
+			Min: "-inf",
+			Max: strconv.FormatInt(now, 10),
+		},
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get due trades",
+			Args: []interface{}{
+				"now", fmt.Sprintf("%v", now),
+			},
+			Err: err,
+		})
+	}
+
+	tradeIds := make([]uuid.UUID, len(rawTradeIds))
+	for index, rawTradeId := range rawTradeIds {
+		tradeIds[index], err = uuid.Parse(rawTradeId)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse scheduled trade id",
+				Args: []interface{}{
+					"tradeId", rawTradeId,
+				},
+				Err: err,
+			})
+		}
+	}
+
+	return tradeIds, nil
+}
+
+func (t *RedisTradeRepo) RemoveScheduledTrade(context echo.Context, tradeId uuid.UUID) error {
+	_, err := t.redisClient.ZRem(
+		context.Request().Context(),
+		redis_client.GenerateScheduledTradesRedisKey(),
+		tradeId.String(),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to remove scheduled trade",
+			Args: []interface{}{
+				"tradeId", tradeId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// exchangeTradeAssetsScript moves every player and dollar in the trade, appends each move
+// of funds to the ledger of the side it belongs to, and saves the trade off the schedule,
+// in one step, so a release, a bid or another trade can't land between the checks and the
+// moves, the ledger can't miss an exchange that went through, and a trade that went through
+// can't be processed again. Each player is only moved if their roster entry is still the
+// one read before the script ran. Returns one of the TRADE_EXCHANGE_ results.
+var exchangeTradeAssetsScript = redis.NewScript(user_repo.REDIS_WALLET_LUA_FUNCTIONS + redisSaveTradeLuaFunction + `
+local proposerFunds = tonumber(ARGV[4])
+local receiverFunds = tonumber(ARGV[5])
+local proposerPlayerCount = tonumber(ARGV[6])
+local firstPlayerIndex = 10 + tonumber(ARGV[7]) * 3
+
+local players = {}
+for index = firstPlayerIndex, #ARGV, 3 do
+	local fromRoster, toRoster, toUserId = KEYS[1], KEYS[2], ARGV[3]
+	if #players >= proposerPlayerCount then
+		fromRoster, toRoster, toUserId = KEYS[2], KEYS[1], ARGV[2]
+	end
+
+	if redis.call('HGET', fromRoster, ARGV[index]) ~= ARGV[index + 1] then
+		return -1
+	end
+
+	table.insert(players, { fromRoster, toRoster, toUserId, ARGV[index], ARGV[index + 2] })
+end
+
+if checkWallet(KEYS[4], KEYS[5], ARGV[1], -proposerFunds, 0) ~= 1 or checkWallet(KEYS[6], KEYS[7], ARGV[1], -receiverFunds, 0) ~= 1 then
+	return 0
+end
+
+for _, player in ipairs(players) do
+	redis.call('HDEL', player[1], player[4])
+	redis.call('HSET', player[2], player[4], player[5])
+	redis.call('HSET', KEYS[3], player[4], player[3])
+end
+
+for index = 10, firstPlayerIndex - 1, 3 do
+	if ARGV[index] == ARGV[2] then
+		adjustWallet(KEYS[4], KEYS[5], KEYS[8], ARGV[1], tonumber(ARGV[index + 1]), 0, ARGV[index + 2])
+	else
+		adjustWallet(KEYS[6], KEYS[7], KEYS[9], ARGV[1], tonumber(ARGV[index + 1]), 0, ARGV[index + 2])
+	end
+end
+
+saveTrade(KEYS[10], KEYS[11], KEYS[12], ARGV[8], ARGV[9], 0)
+
+return 1
+`)
+
+// ExchangeTradeAssets moves every player and dollar in the trade, records the funds each
+// side sends and receives in their wallet ledgers, and saves the trade off the schedule,
+// in one atomic step. If either side no longer has what they're trading away, nothing
+// moves and the trade isn't saved.
+func (t *RedisTradeRepo) ExchangeTradeAssets(context echo.Context, trade entities.Trade, acquiredAt int64) error {
+	args := []interface{}{
+		"tradeId", trade.Id.String(),
+		"leagueId", trade.LeagueId.String(),
+	}
+
+	newExchangeTradeAssetsError := func(message string, err error) error {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: message,
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	serializedTrade, err := serializeRedisTrade(trade)
+	if err != nil {
+		return err
+	}
+
+	transactions := getTradeWalletTransactions(trade)
+	scriptArgs := []interface{}{
+		trade.LeagueId.String(),
+		trade.ProposerId.String(),
+		trade.ReceiverId.String(),
+		trade.ProposerFunds,
+		trade.ReceiverFunds,
+		len(trade.ProposerPlayerIds),
+		len(transactions),
+		trade.Id.String(),
+		serializedTrade,
+	}
+
+	for _, transaction := range transactions {
+		serializedTransaction, err := user_repo.SerializeRedisWalletTransaction(transaction)
+		if err != nil {
+			return err
+		}
+
+		scriptArgs = append(scriptArgs, transaction.UserId.String(), transaction.Amount, serializedTransaction)
+	}
+
+	for _, side := range []struct {
+		fromUserId uuid.UUID
+		toUserId   uuid.UUID
+		playerIds  []string
+	}{
+		{trade.ProposerId, trade.ReceiverId, trade.ProposerPlayerIds},
+		{trade.ReceiverId, trade.ProposerId, trade.ReceiverPlayerIds},
+	} {
+		if len(side.playerIds) == 0 {
+			continue
+		}
+
+		// The script only moves each player if this is still their roster entry
+		serializedRosterPlayers, err := t.redisClient.HMGet(
+			context.Request().Context(),
+			redis_client.GenerateRosterRedisKey(trade.LeagueId, side.fromUserId),
+			side.playerIds...,
+		).Result()
+		if err != nil {
+			return newExchangeTradeAssetsError("failed to get traded players", err)
+		}
+
+		for index, serializedRosterPlayer := range serializedRosterPlayers {
+			currentValue, ok := serializedRosterPlayer.(string)
+			if !ok {
+				return checkTradeExchange(TRADE_EXCHANGE_MISSING_PLAYER, trade)
+			}
+
+			var rosterPlayer entities.RosterPlayer
+			err = json.Unmarshal([]byte(currentValue), &rosterPlayer)
+			if err != nil {
+				return newExchangeTradeAssetsError("failed to parse traded player", err)
+			}
+
+			rosterPlayer.UserId = side.toUserId
+			rosterPlayer.AcquiredAt = acquiredAt
+
+			newValue, err := json.Marshal(rosterPlayer)
+			if err != nil {
+				return newExchangeTradeAssetsError("failed to serialize traded player", err)
+			}
+
+			scriptArgs = append(scriptArgs, side.playerIds[index], currentValue, string(newValue))
+		}
+	}
+
+	result, err := exchangeTradeAssetsScript.Run(
+		context.Request().Context(),
+		t.redisClient,
+		[]string{
+			redis_client.GenerateRosterRedisKey(trade.LeagueId, trade.ProposerId),
+			redis_client.GenerateRosterRedisKey(trade.LeagueId, trade.ReceiverId),
+			redis_client.GeneratePlayerToOwnerRedisKey(trade.LeagueId),
+			redis_client.GenerateUserWalletRedisKey(trade.ProposerId),
+			redis_client.GenerateUserHeldWalletRedisKey(trade.ProposerId),
+			redis_client.GenerateUserWalletRedisKey(trade.ReceiverId),
+			redis_client.GenerateUserHeldWalletRedisKey(trade.ReceiverId),
+			redis_client.GenerateUserWalletLedgerRedisKey(trade.ProposerId, trade.LeagueId),
+			redis_client.GenerateUserWalletLedgerRedisKey(trade.ReceiverId, trade.LeagueId),
+			redis_client.GenerateTradeRedisKey(trade.Id),
+			redis_client.GenerateLeagueToTradesRedisKey(trade.LeagueId),
+			redis_client.GenerateScheduledTradesRedisKey(),
+		},
+		scriptArgs...,
+	).Int64()
+	if err != nil {
+		return newExchangeTradeAssetsError("failed to exchange trade assets", err)
+	}
+
+	return checkTradeExchange(result, trade)
+}
@@ -0,0 +1,370 @@
+package trade_repo
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// SqlTradeRepo keeps trades in the trades table, with the players each side
+// gives up in trade_players and the trade schedule in trade_schedule
+type SqlTradeRepo struct {
+	sqlClient *redis_client.SqlClient
+}
+
+func NewSql(sqlClient *redis_client.SqlClient) *SqlTradeRepo {
+	return &SqlTradeRepo{
+		sqlClient,
+	}
+}
+
+func (t *SqlTradeRepo) GetTradeByTradeId(context echo.Context, tradeId uuid.UUID) (entities.Trade, error) {
+	var trade entities.Trade
+	var counterOfTradeId uuid.NullUUID
+	err := t.sqlClient.QueryRow(
+		context,
+		`SELECT id, league_id, proposer_id, receiver_id, proposer_funds, receiver_funds, status,
+			counter_of_trade_id, created_at, expires_at, process_at, updated_at
+		FROM trades WHERE id = ?`,
+		tradeId,
+	).Scan(
+		&trade.Id,
+		&trade.LeagueId,
+		&trade.ProposerId,
+		&trade.ReceiverId,
+		&trade.ProposerFunds,
+		&trade.ReceiverFunds,
+		&trade.Status,
+		&counterOfTradeId,
+		&trade.CreatedAt,
+		&trade.ExpiresAt,
+		&trade.ProcessAt,
+		&trade.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return entities.Trade{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "no trade found",
+			Args: []interface{}{
+				"tradeId", tradeId.String(),
+			},
+			Err: nil,
+		})
+	}
+	if err == nil {
+		trade.CounterOfTradeId = counterOfTradeId.UUID
+		err = t.getTradePlayers(context, &trade)
+	}
+	if err != nil {
+		return entities.Trade{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get trade",
+			Args: []interface{}{
+				"tradeId", tradeId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return trade, nil
+}
+
+// getTradePlayers fills in the players each side of the trade gives up
+func (t *SqlTradeRepo) getTradePlayers(context echo.Context, trade *entities.Trade) error {
+	rows, err := t.sqlClient.Query(
+		context,
+		"SELECT player_id, user_id FROM trade_players WHERE trade_id = ? ORDER BY sort_order",
+		trade.Id,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var playerId string
+		var userId uuid.UUID
+		err = rows.Scan(&playerId, &userId)
+		if err != nil {
+			return err
+		}
+
+		if userId == trade.ProposerId {
+			trade.ProposerPlayerIds = append(trade.ProposerPlayerIds, playerId)
+		} else {
+			trade.ReceiverPlayerIds = append(trade.ReceiverPlayerIds, playerId)
+		}
+	}
+
+	return rows.Err()
+}
+
+func (t *SqlTradeRepo) GetTradeIdsForLeague(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
+	tradeIds, err := t.sqlClient.QueryUuids(
+		context,
+		"SELECT id FROM trades WHERE league_id = ? ORDER BY created_at, id",
+		leagueId,
+	)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get trades for league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return tradeIds, nil
+}
+
+// SaveTrade creates or overwrites the trade, which also lists it under its league, and
+// schedules it to be looked at again at runAt, or takes it off the schedule when runAt
+// is 0, in one transaction
+func (t *SqlTradeRepo) SaveTrade(context echo.Context, trade entities.Trade, runAt int64) error {
+	err := t.sqlClient.StartTransaction(context, func() error {
+		return t.saveTrade(context, trade, runAt)
+	})
+	if err != nil {
+		return newSaveTradeError(trade, err)
+	}
+
+	return nil
+}
+
+// CounterTrade saves the countered trade off the schedule and the counter offer scheduled
+// to expire, in one transaction
+func (t *SqlTradeRepo) CounterTrade(context echo.Context, trade entities.Trade, counterTrade entities.Trade) error {
+	return t.sqlClient.StartTransaction(context, func() error {
+		err := t.saveTrade(context, trade, 0)
+		if err != nil {
+			return newSaveTradeError(trade, err)
+		}
+
+		err = t.saveTrade(context, counterTrade, counterTrade.ExpiresAt)
+		if err != nil {
+			return newSaveTradeError(counterTrade, err)
+		}
+
+		return nil
+	})
+}
+
+func (t *SqlTradeRepo) saveTrade(context echo.Context, trade entities.Trade, runAt int64) error {
+	_, err := t.sqlClient.Exec(
+		context,
+		`INSERT INTO trades (
+			id, league_id, proposer_id, receiver_id, proposer_funds, receiver_funds, status,
+			counter_of_trade_id, created_at, expires_at, process_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			league_id = excluded.league_id,
+			proposer_id = excluded.proposer_id,
+			receiver_id = excluded.receiver_id,
+			proposer_funds = excluded.proposer_funds,
+			receiver_funds = excluded.receiver_funds,
+			status = excluded.status,
+			counter_of_trade_id = excluded.counter_of_trade_id,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at,
+			process_at = excluded.process_at,
+			updated_at = excluded.updated_at`,
+		trade.Id,
+		trade.LeagueId,
+		trade.ProposerId,
+		trade.ReceiverId,
+		trade.ProposerFunds,
+		trade.ReceiverFunds,
+		trade.Status,
+		redis_client.NullUuid(trade.CounterOfTradeId),
+		trade.CreatedAt,
+		trade.ExpiresAt,
+		trade.ProcessAt,
+		trade.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.sqlClient.Exec(context, "DELETE FROM trade_players WHERE trade_id = ?", trade.Id)
+	if err != nil {
+		return err
+	}
+
+	sortOrder := 0
+	for _, side := range []struct {
+		userId    uuid.UUID
+		playerIds []string
+	}{
+		{trade.ProposerId, trade.ProposerPlayerIds},
+		{trade.ReceiverId, trade.ReceiverPlayerIds},
+	} {
+		for _, playerId := range side.playerIds {
+			_, err = t.sqlClient.Exec(
+				context,
+				"INSERT INTO trade_players (trade_id, player_id, user_id, sort_order) VALUES (?, ?, ?, ?)",
+				trade.Id,
+				playerId,
+				side.userId,
+				sortOrder,
+			)
+			if err != nil {
+				return err
+			}
+
+			sortOrder++
+		}
+	}
+
+	if runAt == 0 {
+		_, err = t.sqlClient.Exec(context, "DELETE FROM trade_schedule WHERE trade_id = ?", trade.Id)
+		return err
+	}
+
+	_, err = t.sqlClient.Exec(
+		context,
+		`INSERT INTO trade_schedule (trade_id, run_at) VALUES (?, ?)
+		ON CONFLICT (trade_id) DO UPDATE SET run_at = excluded.run_at`,
+		trade.Id,
+		runAt,
+	)
+	return err
+}
+
+func newSaveTradeError(trade entities.Trade, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to save trade",
+		Args: []interface{}{
+			"tradeId", trade.Id.String(),
+		},
+		Err: err,
+	})
+}
+
+// GetDueTradeIds returns every trade scheduled at or before the given time
+func (t *SqlTradeRepo) GetDueTradeIds(context echo.Context, now int64) ([]uuid.UUID, error) {
+	tradeIds, err := t.sqlClient.QueryUuids(
+		context,
+		"SELECT trade_id FROM trade_schedule WHERE run_at <= ? ORDER BY run_at, trade_id",
+		now,
+	)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get due trades",
+			Args: []interface{}{
+				"now", fmt.Sprintf("%v", now),
+			},
+			Err: err,
+		})
+	}
+
+	return tradeIds, nil
+}
+
+func (t *SqlTradeRepo) RemoveScheduledTrade(context echo.Context, tradeId uuid.UUID) error {
+	_, err := t.sqlClient.Exec(context, "DELETE FROM trade_schedule WHERE trade_id = ?", tradeId)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to remove scheduled trade",
+			Args: []interface{}{
+				"tradeId", tradeId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// ExchangeTradeAssets moves every player and dollar in the trade, records the funds each
+// side sends and receives in their wallet ledgers, and saves the trade off the schedule,
+// in one transaction. If either side no longer has what they're trading away, nothing
+// moves and the trade isn't saved.
+func (t *SqlTradeRepo) ExchangeTradeAssets(context echo.Context, trade entities.Trade, acquiredAt int64) error {
+	newExchangeTradeAssetsError := func(err error) error {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to exchange trade assets",
+			Args: []interface{}{
+				"tradeId", trade.Id.String(),
+				"leagueId", trade.LeagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return t.sqlClient.StartTransaction(context, func() error {
+		for _, side := range []struct {
+			fromUserId uuid.UUID
+			toUserId   uuid.UUID
+			playerIds  []string
+		}{
+			{trade.ProposerId, trade.ReceiverId, trade.ProposerPlayerIds},
+			{trade.ReceiverId, trade.ProposerId, trade.ReceiverPlayerIds},
+		} {
+			for _, playerId := range side.playerIds {
+				// Matching on the current owner means a player released or traded
+				// away since the trade was validated isn't moved
+				result, err := t.sqlClient.Exec(
+					context,
+					`UPDATE rosters SET user_id = ?, acquired_at = ?
+					WHERE league_id = ? AND player_id = ? AND user_id = ?`,
+					side.toUserId,
+					acquiredAt,
+					trade.LeagueId,
+					playerId,
+					side.fromUserId,
+				)
+				if err != nil {
+					return newExchangeTradeAssetsError(err)
+				}
+
+				updatedCount, err := result.RowsAffected()
+				if err != nil {
+					return newExchangeTradeAssetsError(err)
+				}
+
+				if updatedCount == 0 {
+					return checkTradeExchange(TRADE_EXCHANGE_MISSING_PLAYER, trade)
+				}
+			}
+		}
+
+		for _, transaction := range getTradeWalletTransactions(trade) {
+			wallet, status, err := user_repo.AdjustSqlWalletFunds(context, t.sqlClient, transaction.UserId, trade.LeagueId, transaction.Amount, 0)
+			if err != nil {
+				return err
+			}
+
+			if status != user_repo.WALLET_ADJUSTMENT_APPLIED {
+				return checkTradeExchange(TRADE_EXCHANGE_MISSING_FUNDS, trade)
+			}
+
+			transaction.Balance = wallet.Available
+			transaction.HeldBalance = wallet.Held
+
+			err = user_repo.AddSqlWalletTransaction(context, t.sqlClient, transaction)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := t.saveTrade(context, trade, 0)
+		if err != nil {
+			return newSaveTradeError(trade, err)
+		}
+
+		return nil
+	})
+}
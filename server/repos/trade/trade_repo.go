@@ -0,0 +1,105 @@
+package trade_repo
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type TradeRepo interface {
+	GetTradeByTradeId(context echo.Context, tradeId uuid.UUID) (entities.Trade, error)
+	GetTradeIdsForLeague(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error)
+	// SaveTrade creates or overwrites the trade, makes sure it's listed under its league and
+	// schedules it to be looked at again at runAt, or takes it off the schedule when runAt
+	// is 0, in one atomic step
+	SaveTrade(context echo.Context, trade entities.Trade, runAt int64) error
+	// CounterTrade saves the countered trade off the schedule and the counter offer scheduled
+	// to expire, in one atomic step
+	CounterTrade(context echo.Context, trade entities.Trade, counterTrade entities.Trade) error
+	// GetDueTradeIds returns every trade scheduled at or before the given time
+	GetDueTradeIds(context echo.Context, now int64) ([]uuid.UUID, error)
+	RemoveScheduledTrade(context echo.Context, tradeId uuid.UUID) error
+	// ExchangeTradeAssets moves every player and dollar in the trade, records the funds each
+	// side sends and receives in their wallet ledgers, and saves the trade off the schedule,
+	// in one atomic step. If either side no longer has what they're trading away, nothing
+	// moves and the trade isn't saved.
+	ExchangeTradeAssets(context echo.Context, trade entities.Trade, acquiredAt int64) error
+}
+
+// Results of exchanging a trade's assets, shared by every backend (and the Redis script)
+const (
+	TRADE_EXCHANGE_APPLIED        int64 = 1
+	TRADE_EXCHANGE_MISSING_FUNDS  int64 = 0
+	TRADE_EXCHANGE_MISSING_PLAYER int64 = -1
+)
+
+// New returns the TradeRepo for the storage backend picked in the config
+func New(config *config_service.Config, redisClient *redis.Client, memoryStore *redis_client.MemoryStore, sqlClient *redis_client.SqlClient) TradeRepo {
+	switch config.GetStorageConfig().Backend {
+	case config_service.STORAGE_BACKEND_MEMORY:
+		return NewMemory(memoryStore)
+	case config_service.STORAGE_BACKEND_SQL:
+		return NewSql(sqlClient)
+	}
+
+	return NewRedis(redisClient)
+}
+
+// getTradeWalletTransactions returns the ledger entries for the funds in the trade, in the
+// order every backend moves them. Both sides send what they're trading away before either
+// side gets paid, so only the first two can be refused.
+func getTradeWalletTransactions(trade entities.Trade) []entities.WalletTransaction {
+	transactions := make([]entities.WalletTransaction, 0, 4)
+	for _, entry := range []struct {
+		userId uuid.UUID
+		amount int64
+	}{
+		{trade.ProposerId, trade.ProposerFunds * -1},
+		{trade.ReceiverId, trade.ReceiverFunds * -1},
+		{trade.ReceiverId, trade.ProposerFunds},
+		{trade.ProposerId, trade.ReceiverFunds},
+	} {
+		if entry.amount == 0 {
+			continue
+		}
+
+		transactions = append(transactions, entities.NewWalletTransaction(entry.userId, trade.LeagueId, entry.amount, 0, entities.WALLET_TRANSACTION_REASON_TRADE, uuid.Nil, ""))
+	}
+
+	return transactions
+}
+
+// checkTradeExchange turns an exchange that was refused into the error for it
+func checkTradeExchange(status int64, trade entities.Trade) error {
+	args := []interface{}{
+		"tradeId", trade.Id.String(),
+		"leagueId", trade.LeagueId.String(),
+		"status", fmt.Sprintf("%v", status),
+	}
+
+	switch status {
+	case TRADE_EXCHANGE_MISSING_FUNDS:
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "one side of the trade no longer has the funds they're trading away",
+			Args:    args,
+			Err:     nil,
+		})
+	case TRADE_EXCHANGE_MISSING_PLAYER:
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "one side of the trade no longer owns a player they're trading away",
+			Args:    args,
+			Err:     nil,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+package trade_repo
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/wilbertthelam/prop-ock/entities"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	"github.com/wilbertthelam/prop-ock/test_utils"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+const startingWalletFund = 100
+
+// tradeTestRepos are the repos a trade test needs, all on the same backend
+type tradeTestRepos struct {
+	tradeRepo  TradeRepo
+	leagueRepo league_repo.LeagueRepo
+	rosterRepo roster_repo.RosterRepo
+	userRepo   user_repo.UserRepo
+}
+
+func TestExchangeTradeAssets(t *testing.T) {
+	test_utils.RunOnEveryBackend(t, func(t *testing.T, backend test_utils.Backend) {
+		runExchangeTradeAssetsTests(t, tradeTestRepos{
+			New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			league_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			roster_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+			user_repo.New(backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient),
+		})
+	})
+}
+
+func runExchangeTradeAssetsTests(t *testing.T, repos tradeTestRepos) {
+	t.Run("players and funds move together", func(t *testing.T) {
+		trade := setUpTradeTest(t, repos)
+		trade.Status = entities.TRADE_STATUS_COMPLETED
+
+		err := repos.tradeRepo.ExchangeTradeAssets(test_utils.NewContext(), trade, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		proposerAvailable := startingWalletFund - trade.ProposerFunds + trade.ReceiverFunds
+		receiverAvailable := startingWalletFund - trade.ReceiverFunds + trade.ProposerFunds
+
+		checkOwners(t, repos, trade, trade.ReceiverId, trade.ProposerId)
+		checkWallets(t, repos, trade, proposerAvailable, receiverAvailable)
+		checkLedger(t, repos, trade.ProposerId, trade.LeagueId, []int64{trade.ProposerFunds * -1, trade.ReceiverFunds}, proposerAvailable)
+		checkLedger(t, repos, trade.ReceiverId, trade.LeagueId, []int64{trade.ReceiverFunds * -1, trade.ProposerFunds}, receiverAvailable)
+		checkTrade(t, repos, trade, entities.TRADE_STATUS_COMPLETED, false)
+	})
+
+	t.Run("nothing moves when a player was released", func(t *testing.T) {
+		trade := setUpTradeTest(t, repos)
+
+		err := repos.rosterRepo.RemovePlayerFromRoster(test_utils.NewContext(), trade.LeagueId, trade.ReceiverId, trade.ReceiverPlayerIds[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = repos.tradeRepo.ExchangeTradeAssets(test_utils.NewContext(), trade, 5)
+		checkExchangeRefused(t, err)
+
+		checkOwners(t, repos, trade, trade.ProposerId, uuid.Nil)
+		checkWallets(t, repos, trade, startingWalletFund, startingWalletFund)
+		checkLedger(t, repos, trade.ProposerId, trade.LeagueId, nil, startingWalletFund)
+		checkLedger(t, repos, trade.ReceiverId, trade.LeagueId, nil, startingWalletFund)
+		checkTrade(t, repos, trade, entities.TRADE_STATUS_ACCEPTED, true)
+	})
+
+	t.Run("nothing moves when the receiver is missing funds", func(t *testing.T) {
+		trade := setUpTradeTest(t, repos)
+		trade.ReceiverFunds = startingWalletFund + 1
+
+		err := repos.tradeRepo.ExchangeTradeAssets(test_utils.NewContext(), trade, 5)
+		checkExchangeRefused(t, err)
+
+		checkOwners(t, repos, trade, trade.ProposerId, trade.ReceiverId)
+		checkWallets(t, repos, trade, startingWalletFund, startingWalletFund)
+		checkLedger(t, repos, trade.ProposerId, trade.LeagueId, nil, startingWalletFund)
+		checkLedger(t, repos, trade.ReceiverId, trade.LeagueId, nil, startingWalletFund)
+		checkTrade(t, repos, trade, entities.TRADE_STATUS_ACCEPTED, true)
+	})
+}
+
+// setUpTradeTest creates a league with two funded members who each own one player,
+// and an accepted trade swapping those players along with some funds each way, saved
+// and due to be processed
+func setUpTradeTest(t *testing.T, repos tradeTestRepos) entities.Trade {
+	context := test_utils.NewContext()
+	trade := entities.Trade{
+		Id:                uuid.New(),
+		LeagueId:          uuid.New(),
+		ProposerId:        uuid.New(),
+		ReceiverId:        uuid.New(),
+		ProposerPlayerIds: []string{"proposer_player"},
+		ReceiverPlayerIds: []string{"receiver_player"},
+		ProposerFunds:     30,
+		ReceiverFunds:     10,
+		Status:            entities.TRADE_STATUS_ACCEPTED,
+	}
+
+	err := repos.leagueRepo.CreateLeague(context, trade.LeagueId, entities.League{Id: trade.LeagueId, Name: "trades"}, entities.NewDefaultLeagueSettings(trade.LeagueId), uuid.Nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, side := range []struct {
+		userId   uuid.UUID
+		playerId string
+	}{
+		{trade.ProposerId, trade.ProposerPlayerIds[0]},
+		{trade.ReceiverId, trade.ReceiverPlayerIds[0]},
+	} {
+		err = repos.userRepo.CreateUser(context, side.userId, entities.User{Id: side.userId, Name: "trader"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = repos.userRepo.AddFundsToUserWallet(context, side.userId, trade.LeagueId, startingWalletFund)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = repos.rosterRepo.AddPlayerToRoster(context, entities.RosterPlayer{
+			PlayerId:   side.playerId,
+			UserId:     side.userId,
+			LeagueId:   trade.LeagueId,
+			Price:      1,
+			AcquiredAt: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = repos.tradeRepo.SaveTrade(context, trade, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return trade
+}
+
+// checkTrade checks the saved status of the trade and whether it's still scheduled
+func checkTrade(t *testing.T, repos tradeTestRepos, trade entities.Trade, expectedStatus entities.TradeStatus, expectedScheduled bool) {
+	savedTrade, err := repos.tradeRepo.GetTradeByTradeId(test_utils.NewContext(), trade.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if savedTrade.Status != expectedStatus {
+		t.Errorf("trade status is %v, expected %v", savedTrade.Status, expectedStatus)
+	}
+
+	dueTradeIds, err := repos.tradeRepo.GetDueTradeIds(test_utils.NewContext(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	isScheduled := false
+	for _, tradeId := range dueTradeIds {
+		isScheduled = isScheduled || tradeId == trade.Id
+	}
+
+	if isScheduled != expectedScheduled {
+		t.Errorf("trade scheduled is %v, expected %v", isScheduled, expectedScheduled)
+	}
+}
+
+// checkOwners checks who owns each side's player, where an empty id means nobody does
+func checkOwners(t *testing.T, repos tradeTestRepos, trade entities.Trade, proposerPlayerOwner uuid.UUID, receiverPlayerOwner uuid.UUID) {
+	for playerId, expectedOwner := range map[string]uuid.UUID{
+		trade.ProposerPlayerIds[0]: proposerPlayerOwner,
+		trade.ReceiverPlayerIds[0]: receiverPlayerOwner,
+	} {
+		owner, err := repos.rosterRepo.GetPlayerOwner(test_utils.NewContext(), trade.LeagueId, playerId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if owner != expectedOwner {
+			t.Errorf("%v is owned by %v, expected %v", playerId, owner, expectedOwner)
+		}
+
+		if expectedOwner == uuid.Nil {
+			continue
+		}
+
+		roster, err := repos.rosterRepo.GetRoster(test_utils.NewContext(), trade.LeagueId, expectedOwner)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := false
+		for _, rosterPlayer := range roster {
+			if rosterPlayer.PlayerId == playerId {
+				found = rosterPlayer.UserId == expectedOwner
+			}
+		}
+
+		if !found {
+			t.Errorf("%v is missing from the roster of %v", playerId, expectedOwner)
+		}
+	}
+}
+
+func checkWallets(t *testing.T, repos tradeTestRepos, trade entities.Trade, proposerAvailable int64, receiverAvailable int64) {
+	for userId, expectedAvailable := range map[uuid.UUID]int64{
+		trade.ProposerId: proposerAvailable,
+		trade.ReceiverId: receiverAvailable,
+	} {
+		wallets, err := repos.userRepo.GetUserWallet(test_utils.NewContext(), userId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if wallets[trade.LeagueId].Available != expectedAvailable {
+			t.Errorf("wallet is %+v, expected %v available", wallets[trade.LeagueId], expectedAvailable)
+		}
+	}
+}
+
+// checkLedger checks the trade recorded exactly the expected amounts in the user's wallet
+// ledger, in order, and that the last entry's balance is what's left in the wallet
+func checkLedger(t *testing.T, repos tradeTestRepos, userId uuid.UUID, leagueId uuid.UUID, expectedAmounts []int64, expectedBalance int64) {
+	transactions, err := repos.userRepo.GetWalletTransactions(test_utils.NewContext(), userId, leagueId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transactions) != len(expectedAmounts) {
+		t.Fatalf("wallet ledger is %+v, expected amounts %v", transactions, expectedAmounts)
+	}
+
+	for index, transaction := range transactions {
+		if transaction.Amount != expectedAmounts[index] || transaction.Reason != entities.WALLET_TRANSACTION_REASON_TRADE {
+			t.Errorf("wallet ledger is %+v, expected amounts %v", transactions, expectedAmounts)
+		}
+	}
+
+	if len(transactions) > 0 && transactions[len(transactions)-1].Balance != expectedBalance {
+		t.Errorf("wallet ledger ends at %+v, expected a balance of %v", transactions[len(transactions)-1], expectedBalance)
+	}
+}
+
+func checkExchangeRefused(t *testing.T, err error) {
+	userErr, ok := err.(*utils.Error)
+	if !ok || userErr.Code >= http.StatusInternalServerError {
+		t.Fatalf("expected the exchange to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package user_repo
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// MemoryUserRepo keeps users and their wallets in the memory store. Each wallet
+// is a map of leagueId to the available and held funds in that league.
+type MemoryUserRepo struct {
+	memoryStore *redis_client.MemoryStore
+}
+
+func NewMemory(memoryStore *redis_client.MemoryStore) *MemoryUserRepo {
+	return &MemoryUserRepo{
+		memoryStore,
+	}
+}
+
+func (u *MemoryUserRepo) GetUserByUserId(context echo.Context, userId uuid.UUID) (entities.User, error) {
+	var user entities.User
+	err := u.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		// If user is not found, then return an empty user
+		value, ok := values.Get(redis_client.GenerateUserRedisKey(userId))
+		if ok {
+			user = value.(entities.User)
+		}
+
+		return nil
+	})
+
+	return user, err
+}
+
+func (u *MemoryUserRepo) CreateUser(context echo.Context, userId uuid.UUID, user entities.User) error {
+	return u.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Set(redis_client.GenerateUserRedisKey(userId), user)
+		return nil
+	})
+}
+
+// CreateUserWithSenderPsId creates the user and maps them to their senderPsId in both
+// directions, in one atomic step
+func (u *MemoryUserRepo) CreateUserWithSenderPsId(context echo.Context, user entities.User, senderPsId string) error {
+	return u.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Set(redis_client.GenerateUserRedisKey(user.Id), user)
+		values.Set(redis_client.GenerateSenderPsIdToUserIdRedisKey(senderPsId), user.Id)
+		values.Set(redis_client.GenerateUserIdToSenderPsIdRedisKey(user.Id), senderPsId)
+		return nil
+	})
+}
+
+// GetUserWallet returns the user's available and held funds for every league they're in
+func (u *MemoryUserRepo) GetUserWallet(context echo.Context, userId uuid.UUID) (map[uuid.UUID]entities.Wallet, error) {
+	wallet := make(map[uuid.UUID]entities.Wallet)
+	err := u.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		for leagueId, leagueWallet := range getMemoryWallet(values, userId) {
+			wallet[leagueId] = leagueWallet
+		}
+
+		return nil
+	})
+
+	return wallet, err
+}
+
+func (u *MemoryUserRepo) AddFundsToUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error) {
+	return u.adjustWalletFunds(context, userId, leagueId, value, 0)
+}
+
+func (u *MemoryUserRepo) RemoveFundsFromUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error) {
+	return u.adjustWalletFunds(context, userId, leagueId, value*-1, 0)
+}
+
+// ReleaseHeldFundsInUserWallet moves held funds back into available funds
+func (u *MemoryUserRepo) ReleaseHeldFundsInUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error) {
+	return u.adjustWalletFunds(context, userId, leagueId, value, value*-1)
+}
+
+// SpendHeldFundsInUserWallet takes funds out of held funds for good
+func (u *MemoryUserRepo) SpendHeldFundsInUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error) {
+	return u.adjustWalletFunds(context, userId, leagueId, 0, value*-1)
+}
+
+func (u *MemoryUserRepo) adjustWalletFunds(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, availableValue int64, heldValue int64) (entities.Wallet, error) {
+	var wallet entities.Wallet
+	err := u.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		var status int64
+		wallet, status = AdjustMemoryWalletFunds(values, userId, leagueId, availableValue, heldValue)
+
+		return CheckWalletAdjustment(status, wallet, []interface{}{
+			"userId", userId.String(),
+			"leagueId", leagueId.String(),
+			"availableValue", fmt.Sprintf("%v", availableValue),
+			"heldValue", fmt.Sprintf("%v", heldValue),
+		})
+	})
+	if err != nil {
+		return entities.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// AdjustMemoryWalletFunds applies both changes to the user's funds for the league, refusing
+// to take either balance below zero. It's exported so other memory repos can move funds
+// alongside their own writes, like placing a bid. The memory store must already be locked.
+func AdjustMemoryWalletFunds(values redis_client.MemoryValues, userId uuid.UUID, leagueId uuid.UUID, availableValue int64, heldValue int64) (entities.Wallet, int64) {
+	wallet := getMemoryWallet(values, userId)
+
+	leagueWallet := wallet[leagueId]
+	leagueWallet.LeagueId = leagueId
+
+	if availableValue < 0 && leagueWallet.Available+availableValue < 0 {
+		return leagueWallet, WALLET_ADJUSTMENT_MISSING_FUNDS
+	}
+
+	if heldValue < 0 && leagueWallet.Held+heldValue < 0 {
+		return leagueWallet, WALLET_ADJUSTMENT_MISSING_HELD_FUNDS
+	}
+
+	leagueWallet.Available += availableValue
+	leagueWallet.Held += heldValue
+	wallet[leagueId] = leagueWallet
+
+	values.Set(redis_client.GenerateUserWalletRedisKey(userId), wallet)
+
+	return leagueWallet, WALLET_ADJUSTMENT_APPLIED
+}
+
+func getMemoryWallet(values redis_client.MemoryValues, userId uuid.UUID) map[uuid.UUID]entities.Wallet {
+	value, ok := values.Get(redis_client.GenerateUserWalletRedisKey(userId))
+	if !ok {
+		return make(map[uuid.UUID]entities.Wallet)
+	}
+
+	return value.(map[uuid.UUID]entities.Wallet)
+}
+
+// ArchiveUserWallet moves the user's funds for the league out of their wallet and into
+// the wallet archive, so the league no longer shows up in their wallet but the balance
+// they left with is kept alongside their wallet ledger. Running it again once the league
+// is archived returns the archived wallet without changing it.
+func (u *MemoryUserRepo) ArchiveUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) (entities.Wallet, error) {
+	var archivedWallet entities.Wallet
+	err := u.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		wallet := getMemoryWallet(values, userId)
+
+		archivedWallets := make(map[uuid.UUID]entities.Wallet)
+		value, ok := values.Get(redis_client.GenerateUserArchivedWalletRedisKey(userId))
+		if ok {
+			archivedWallets = value.(map[uuid.UUID]entities.Wallet)
+		}
+
+		// Already archived by an earlier attempt, which an empty wallet mustn't overwrite
+		_, isInWallet := wallet[leagueId]
+		if existingWallet, isArchived := archivedWallets[leagueId]; isArchived && !isInWallet {
+			archivedWallet = existingWallet
+			return nil
+		}
+
+		archivedWallet = wallet[leagueId]
+		archivedWallet.LeagueId = leagueId
+
+		archivedWallets[leagueId] = archivedWallet
+		values.Set(redis_client.GenerateUserArchivedWalletRedisKey(userId), archivedWallets)
+
+		delete(wallet, leagueId)
+		values.Set(redis_client.GenerateUserWalletRedisKey(userId), wallet)
+
+		return nil
+	})
+
+	return archivedWallet, err
+}
+
+// GetArchivedUserWallets returns the balance the user left each league with, keyed on leagueId
+func (u *MemoryUserRepo) GetArchivedUserWallets(context echo.Context, userId uuid.UUID) (map[uuid.UUID]entities.Wallet, error) {
+	archivedWallets := make(map[uuid.UUID]entities.Wallet)
+	err := u.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		value, ok := values.Get(redis_client.GenerateUserArchivedWalletRedisKey(userId))
+		if !ok {
+			return nil
+		}
+
+		for leagueId, archivedWallet := range value.(map[uuid.UUID]entities.Wallet) {
+			archivedWallets[leagueId] = archivedWallet
+		}
+
+		return nil
+	})
+
+	return archivedWallets, err
+}
+
+// AddWalletTransaction appends a transaction to the end of the user's wallet ledger for the league
+func (u *MemoryUserRepo) AddWalletTransaction(context echo.Context, transaction entities.WalletTransaction) error {
+	return u.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		AddMemoryWalletTransaction(values, transaction)
+		return nil
+	})
+}
+
+// AddMemoryWalletTransaction appends a transaction to the user's wallet ledger for the league.
+// It's exported so other memory repos can record the funds they move alongside their own
+// writes. The memory store must already be locked.
+func AddMemoryWalletTransaction(values redis_client.MemoryValues, transaction entities.WalletTransaction) {
+	ledgerKey := redis_client.GenerateUserWalletLedgerRedisKey(transaction.UserId, transaction.LeagueId)
+
+	var transactions []entities.WalletTransaction
+	value, ok := values.Get(ledgerKey)
+	if ok {
+		transactions = value.([]entities.WalletTransaction)
+	}
+
+	values.Set(ledgerKey, append(transactions, transaction))
+}
+
+// GetWalletTransactions returns the user's wallet ledger for the league, oldest first
+func (u *MemoryUserRepo) GetWalletTransactions(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) ([]entities.WalletTransaction, error) {
+	transactions := []entities.WalletTransaction{}
+	err := u.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		value, ok := values.Get(redis_client.GenerateUserWalletLedgerRedisKey(userId, leagueId))
+		if ok {
+			transactions = append(transactions, value.([]entities.WalletTransaction)...)
+		}
+
+		return nil
+	})
+
+	return transactions, err
+}
+
+func (u *MemoryUserRepo) GetUserIdFromSenderPsId(context echo.Context, senderPsId string) (uuid.UUID, error) {
+	userId := uuid.Nil
+	err := u.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		value, ok := values.Get(redis_client.GenerateSenderPsIdToUserIdRedisKey(senderPsId))
+		if !ok {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusNotFound,
+				Message: "no userId found for senderPsId",
+				Args: []interface{}{
+					"senderPsId", senderPsId,
+				},
+				Err: nil,
+			})
+		}
+
+		userId = value.(uuid.UUID)
+		return nil
+	})
+
+	return userId, err
+}
+
+func (u *MemoryUserRepo) GetSenderPsIdFromUserId(context echo.Context, userId uuid.UUID) (string, error) {
+	var senderPsId string
+	err := u.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		value, ok := values.Get(redis_client.GenerateUserIdToSenderPsIdRedisKey(userId))
+		if !ok {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to get senderPsId from userId",
+				Args: []interface{}{
+					"userId", userId.String(),
+				},
+				Err: nil,
+			})
+		}
+
+		senderPsId = value.(string)
+		return nil
+	})
+
+	return senderPsId, err
+}
+
+func (u *MemoryUserRepo) SetSenderPsIdToUserIdRelationship(context echo.Context, senderPsId string, userId uuid.UUID) error {
+	return u.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Set(redis_client.GenerateSenderPsIdToUserIdRedisKey(senderPsId), userId)
+		return nil
+	})
+}
+
+func (u *MemoryUserRepo) SetUserIdToSenderPsIdRelationship(context echo.Context, senderPsId string, userId uuid.UUID) error {
+	return u.memoryStore.Update(context, func(values redis_client.MemoryValues) error {
+		values.Set(redis_client.GenerateUserIdToSenderPsIdRedisKey(userId), senderPsId)
+		return nil
+	})
+}
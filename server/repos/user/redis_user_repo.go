@@ -0,0 +1,642 @@
+package user_repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RedisUserRepo struct {
+	redisClient *redis.Client
+}
+
+func NewRedis(redisClient *redis.Client) *RedisUserRepo {
+	return &RedisUserRepo{
+		redisClient,
+	}
+}
+
+func (u *RedisUserRepo) GetUserByUserId(context echo.Context, userId uuid.UUID) (entities.User, error) {
+	redisUser, err := u.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GenerateUserRedisKey(userId),
+	).Result()
+	if err != nil {
+		return entities.User{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get user",
+			Args: []interface{}{
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	// If user is not found, then return an empty user
+	if len(redisUser) == 0 {
+		return entities.User{}, nil
+	}
+
+	user := entities.User{
+		Id:   uuid.MustParse(redisUser["id"]),
+		Name: redisUser["name"],
+	}
+
+	return user, nil
+}
+
+func (u *RedisUserRepo) CreateUser(context echo.Context, userId uuid.UUID, user entities.User) error {
+	// Format for database inserting (array of strings where even index is key, odd index is value)
+	redisUserKeyValuePairs := []string{
+		"id", user.Id.String(),
+		"name", user.Name,
+	}
+
+	err := u.updateUser(context, userId, redisUserKeyValuePairs)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createUserWithSenderPsIdScript writes the user and both senderPsId mappings in one step,
+// so a user is never left without a way to message them, or a senderPsId pointing at a
+// user who doesn't exist
+var createUserWithSenderPsIdScript = redis.NewScript(`
+redis.call('HSET', KEYS[1], 'id', ARGV[1], 'name', ARGV[2])
+redis.call('SET', KEYS[2], ARGV[1])
+redis.call('SET', KEYS[3], ARGV[3])
+
+return 1
+`)
+
+// CreateUserWithSenderPsId creates the user and maps them to their senderPsId in both
+// directions, in one atomic step
+func (u *RedisUserRepo) CreateUserWithSenderPsId(context echo.Context, user entities.User, senderPsId string) error {
+	_, err := createUserWithSenderPsIdScript.Run(
+		context.Request().Context(),
+		u.redisClient,
+		[]string{
+			redis_client.GenerateUserRedisKey(user.Id),
+			redis_client.GenerateSenderPsIdToUserIdRedisKey(senderPsId),
+			redis_client.GenerateUserIdToSenderPsIdRedisKey(user.Id),
+		},
+		user.Id.String(),
+		user.Name,
+		senderPsId,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to create user with senderPsId",
+			Args: []interface{}{
+				"userId", user.Id.String(),
+				"senderPsId", senderPsId,
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func (u *RedisUserRepo) updateUser(context echo.Context, userId uuid.UUID, keyValuePairs []string) error {
+	_, err := u.redisClient.HSet(
+		context.Request().Context(),
+		redis_client.GenerateUserRedisKey(userId),
+		keyValuePairs,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to update user fields",
+			Args: append(
+				[]interface{}{"userId", userId.String()},
+				utils.MapStringSliceToInterfaceSlice(keyValuePairs)...,
+			),
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// GetUserWallet returns the user's available and held funds for every league they're in
+func (u *RedisUserRepo) GetUserWallet(context echo.Context, userId uuid.UUID) (map[uuid.UUID]entities.Wallet, error) {
+	availableFunds, err := u.getWalletFunds(context, userId, redis_client.GenerateUserWalletRedisKey(userId))
+	if err != nil {
+		return nil, err
+	}
+
+	heldFunds, err := u.getWalletFunds(context, userId, redis_client.GenerateUserHeldWalletRedisKey(userId))
+	if err != nil {
+		return nil, err
+	}
+
+	wallet := make(map[uuid.UUID]entities.Wallet)
+	for leagueId, available := range availableFunds {
+		wallet[leagueId] = entities.Wallet{
+			LeagueId:  leagueId,
+			Available: available,
+			Held:      heldFunds[leagueId],
+		}
+	}
+
+	return wallet, nil
+}
+
+func (u *RedisUserRepo) getWalletFunds(context echo.Context, userId uuid.UUID, walletKey string) (map[uuid.UUID]int64, error) {
+	funds := make(map[uuid.UUID]int64)
+
+	redisWallet, err := u.redisClient.HGetAll(
+		context.Request().Context(),
+		walletKey,
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get user wallet player fields",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"walletKey", walletKey,
+			},
+			Err: err,
+		})
+	}
+
+	for key, value := range redisWallet {
+		uuidKey, err := uuid.Parse(key)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse user wallet player leagueId key",
+				Args: []interface{}{
+					"userId", userId.String(),
+					"key", key,
+				},
+				Err: err,
+			})
+		}
+
+		int64Value, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse user wallet player leagueId value",
+				Args: []interface{}{
+					"userId", userId.String(),
+					"value", value,
+				},
+				Err: err,
+			})
+		}
+
+		funds[uuidKey] = int64Value
+	}
+
+	return funds, nil
+}
+
+func (u *RedisUserRepo) AddFundsToUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error) {
+	return u.adjustWalletFunds(context, userId, leagueId, value, 0)
+}
+
+func (u *RedisUserRepo) RemoveFundsFromUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error) {
+	return u.adjustWalletFunds(context, userId, leagueId, value*-1, 0)
+}
+
+// ReleaseHeldFundsInUserWallet moves held funds back into available funds
+func (u *RedisUserRepo) ReleaseHeldFundsInUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error) {
+	return u.adjustWalletFunds(context, userId, leagueId, value, value*-1)
+}
+
+// SpendHeldFundsInUserWallet takes funds out of held funds for good
+func (u *RedisUserRepo) SpendHeldFundsInUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error) {
+	return u.adjustWalletFunds(context, userId, leagueId, 0, value*-1)
+}
+
+// adjustWalletFundsScript applies both changes to the league's available and held funds
+// in one step, and refuses to take either balance below zero. Doing the check inside
+// Redis stops two requests that both read the old balance from overdrawing the wallet.
+// Returns { status, available, held } with one of the wallet adjustment statuses.
+var adjustWalletFundsScript = redis.NewScript(`
+local available = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+local held = tonumber(redis.call('HGET', KEYS[2], ARGV[1]) or '0')
+local availableValue = tonumber(ARGV[2])
+local heldValue = tonumber(ARGV[3])
+
+if availableValue < 0 and available + availableValue < 0 then
+	return { 0, available, held }
+end
+
+if heldValue < 0 and held + heldValue < 0 then
+	return { -1, available, held }
+end
+
+available = redis.call('HINCRBY', KEYS[1], ARGV[1], availableValue)
+held = redis.call('HINCRBY', KEYS[2], ARGV[1], heldValue)
+
+return { 1, available, held }
+`)
+
+func (u *RedisUserRepo) adjustWalletFunds(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, availableValue int64, heldValue int64) (entities.Wallet, error) {
+	args := []interface{}{
+		"userId", userId.String(),
+		"leagueId", leagueId.String(),
+		"availableValue", fmt.Sprintf("%v", availableValue),
+		"heldValue", fmt.Sprintf("%v", heldValue),
+	}
+
+	result, err := adjustWalletFundsScript.Run(
+		context.Request().Context(),
+		u.redisClient,
+		[]string{redis_client.GenerateUserWalletRedisKey(userId), redis_client.GenerateUserHeldWalletRedisKey(userId)},
+		leagueId.String(),
+		availableValue,
+		heldValue,
+	).Int64Slice()
+	if err != nil {
+		return entities.Wallet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to adjust wallet funds",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	wallet := entities.Wallet{
+		LeagueId:  leagueId,
+		Available: result[1],
+		Held:      result[2],
+	}
+
+	err = CheckWalletAdjustment(result[0], wallet, args)
+	if err != nil {
+		return entities.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// REDIS_WALLET_LUA_FUNCTIONS defines the Lua functions other Redis repos put in front of their
+// scripts to move funds alongside their own writes, and record each move in the wallet ledger.
+//
+// checkWallet(walletKey, heldWalletKey, leagueId, availableValue, heldValue) returns one of the
+// WALLET_ADJUSTMENT_ statuses without changing anything, so a script can check every move it's
+// going to make before it writes anything.
+//
+// adjustWallet(walletKey, heldWalletKey, ledgerKey, leagueId, availableValue, heldValue, transaction)
+// applies the move without checking it, and appends the transaction from
+// SerializeRedisWalletTransaction to the ledger with the balances after the move, unless the
+// transaction is empty. Returns { available, held }.
+const REDIS_WALLET_LUA_FUNCTIONS = `
+local function checkWallet(walletKey, heldWalletKey, leagueId, availableValue, heldValue)
+	local available = tonumber(redis.call('HGET', walletKey, leagueId) or '0')
+	local held = tonumber(redis.call('HGET', heldWalletKey, leagueId) or '0')
+
+	if availableValue < 0 and available + availableValue < 0 then
+		return 0
+	end
+
+	if heldValue < 0 and held + heldValue < 0 then
+		return -1
+	end
+
+	return 1
+end
+
+local function adjustWallet(walletKey, heldWalletKey, ledgerKey, leagueId, availableValue, heldValue, transaction)
+	local available = redis.call('HINCRBY', walletKey, leagueId, availableValue)
+	local held = redis.call('HINCRBY', heldWalletKey, leagueId, heldValue)
+
+	if transaction ~= '' then
+		redis.call('RPUSH', ledgerKey, transaction .. '"balance":' .. available .. ',"held_balance":' .. held .. '}')
+	end
+
+	return { available, held }
+end
+`
+
+// redisWalletTransactionBalances ends every serialized transaction before its balances are known
+const redisWalletTransactionBalances = `"balance":0,"held_balance":0}`
+
+// SerializeRedisWalletTransaction serializes the transaction for adjustWallet in
+// REDIS_WALLET_LUA_FUNCTIONS. The balances are left off the end for the script to fill
+// in, since they aren't known until the funds have moved.
+func SerializeRedisWalletTransaction(transaction entities.WalletTransaction) (string, error) {
+	transaction.Balance = 0
+	transaction.HeldBalance = 0
+
+	serializedTransaction, err := json.Marshal(transaction)
+	if err == nil && !strings.HasSuffix(string(serializedTransaction), redisWalletTransactionBalances) {
+		err = fmt.Errorf("serialized wallet transaction doesn't end with its balances")
+	}
+	if err != nil {
+		return "", utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to serialize wallet transaction",
+			Args: []interface{}{
+				"userId", transaction.UserId.String(),
+				"leagueId", transaction.LeagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return strings.TrimSuffix(string(serializedTransaction), redisWalletTransactionBalances), nil
+}
+
+// archiveUserWalletScript moves the league out of the wallet and into the wallet archive
+// in one step. If the league was already archived by an earlier attempt, the archive is
+// left alone so a retry can't overwrite it with an empty wallet. Returns the archived wallet.
+var archiveUserWalletScript = redis.NewScript(`
+local available = redis.call('HGET', KEYS[1], ARGV[1])
+local held = redis.call('HGET', KEYS[2], ARGV[1])
+if not available and not held then
+	local archivedWallet = redis.call('HGET', KEYS[3], ARGV[1])
+	if archivedWallet then
+		return archivedWallet
+	end
+end
+
+local archivedWallet = '{"league_id":"' .. ARGV[1] .. '","available":' .. (available or '0') .. ',"held":' .. (held or '0') .. '}'
+redis.call('HSET', KEYS[3], ARGV[1], archivedWallet)
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+
+return archivedWallet
+`)
+
+// ArchiveUserWallet moves the user's funds for the league out of their wallet and into
+// the wallet archive, so the league no longer shows up in their wallet but the balance
+// they left with is kept alongside their wallet ledger. Running it again once the league
+// is archived returns the archived wallet without changing it.
+func (u *RedisUserRepo) ArchiveUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) (entities.Wallet, error) {
+	args := []interface{}{
+		"userId", userId.String(),
+		"leagueId", leagueId.String(),
+	}
+
+	serializedWallet, err := archiveUserWalletScript.Run(
+		context.Request().Context(),
+		u.redisClient,
+		[]string{
+			redis_client.GenerateUserWalletRedisKey(userId),
+			redis_client.GenerateUserHeldWalletRedisKey(userId),
+			redis_client.GenerateUserArchivedWalletRedisKey(userId),
+		},
+		leagueId.String(),
+	).Text()
+	if err != nil {
+		return entities.Wallet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to archive wallet",
+			Args:    args,
+			Err:     err,
+		})
+	}
+
+	var archivedWallet entities.Wallet
+	err = json.Unmarshal([]byte(serializedWallet), &archivedWallet)
+	if err != nil {
+		return entities.Wallet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to parse archived wallet",
+			Args:    append(args, "wallet", serializedWallet),
+			Err:     err,
+		})
+	}
+
+	return archivedWallet, nil
+}
+
+// GetArchivedUserWallets returns the balance the user left each league with, keyed on leagueId
+func (u *RedisUserRepo) GetArchivedUserWallets(context echo.Context, userId uuid.UUID) (map[uuid.UUID]entities.Wallet, error) {
+	serializedWallets, err := u.redisClient.HGetAll(
+		context.Request().Context(),
+		redis_client.GenerateUserArchivedWalletRedisKey(userId),
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get archived wallets",
+			Args: []interface{}{
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	archivedWallets := make(map[uuid.UUID]entities.Wallet)
+	for leagueId, serializedWallet := range serializedWallets {
+		var archivedWallet entities.Wallet
+		err = json.Unmarshal([]byte(serializedWallet), &archivedWallet)
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse archived wallet",
+				Args: []interface{}{
+					"userId", userId.String(),
+					"leagueId", leagueId,
+					"wallet", serializedWallet,
+				},
+				Err: err,
+			})
+		}
+
+		archivedWallets[archivedWallet.LeagueId] = archivedWallet
+	}
+
+	return archivedWallets, nil
+}
+
+// AddWalletTransaction appends a transaction to the end of the user's wallet ledger for the league
+func (u *RedisUserRepo) AddWalletTransaction(context echo.Context, transaction entities.WalletTransaction) error {
+	serializedTransaction, err := json.Marshal(transaction)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to serialize wallet transaction",
+			Args: []interface{}{
+				"userId", transaction.UserId.String(),
+				"leagueId", transaction.LeagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	_, err = u.redisClient.RPush(
+		context.Request().Context(),
+		redis_client.GenerateUserWalletLedgerRedisKey(transaction.UserId, transaction.LeagueId),
+		string(serializedTransaction),
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to add wallet transaction",
+			Args: []interface{}{
+				"userId", transaction.UserId.String(),
+				"leagueId", transaction.LeagueId.String(),
+				"amount", fmt.Sprintf("%v", transaction.Amount),
+				"reason", fmt.Sprintf("%v", transaction.Reason),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// GetWalletTransactions returns the user's wallet ledger for the league, oldest first
+func (u *RedisUserRepo) GetWalletTransactions(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) ([]entities.WalletTransaction, error) {
+	serializedTransactions, err := u.redisClient.LRange(
+		context.Request().Context(),
+		redis_client.GenerateUserWalletLedgerRedisKey(userId, leagueId),
+		0,
+		-1,
+	).Result()
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get wallet transactions",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	transactions := make([]entities.WalletTransaction, len(serializedTransactions))
+	for index, serializedTransaction := range serializedTransactions {
+		err = json.Unmarshal([]byte(serializedTransaction), &transactions[index])
+		if err != nil {
+			return nil, utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to parse wallet transaction",
+				Args: []interface{}{
+					"userId", userId.String(),
+					"leagueId", leagueId.String(),
+					"transaction", serializedTransaction,
+				},
+				Err: err,
+			})
+		}
+	}
+
+	return transactions, nil
+}
+
+func (u *RedisUserRepo) GetUserIdFromSenderPsId(context echo.Context, senderPsId string) (uuid.UUID, error) {
+	userIdString, err := u.redisClient.Get(
+		context.Request().Context(),
+		redis_client.GenerateSenderPsIdToUserIdRedisKey(senderPsId),
+	).Result()
+	if err == redis.Nil {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "no userId found for senderPsId",
+			Args: []interface{}{
+				"senderPsId", senderPsId,
+			},
+			Err: nil,
+		})
+	}
+	if err != nil {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get userId from senderPsId",
+			Args: []interface{}{
+				"senderPsId", senderPsId,
+			},
+			Err: err,
+		})
+	}
+
+	userId, err := uuid.Parse(userIdString)
+	if err != nil {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to parse userId from senderPsId",
+			Args: []interface{}{
+				"senderPsId", senderPsId,
+			},
+			Err: err,
+		})
+	}
+
+	return userId, nil
+}
+
+func (u *RedisUserRepo) GetSenderPsIdFromUserId(context echo.Context, userId uuid.UUID) (string, error) {
+	senderPsId, err := u.redisClient.Get(
+		context.Request().Context(),
+		redis_client.GenerateUserIdToSenderPsIdRedisKey(userId),
+	).Result()
+	if err != nil {
+		return "", utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get senderPsId from userId",
+			Args: []interface{}{
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return senderPsId, nil
+}
+
+func (u *RedisUserRepo) SetSenderPsIdToUserIdRelationship(context echo.Context, senderPsId string, userId uuid.UUID) error {
+	_, err := u.redisClient.Set(
+		context.Request().Context(),
+		redis_client.GenerateSenderPsIdToUserIdRedisKey(senderPsId),
+		userId.String(),
+		0,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to set senderPsId to userId relationship",
+			Args: []interface{}{
+				"senderPsId", senderPsId,
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+func (u *RedisUserRepo) SetUserIdToSenderPsIdRelationship(context echo.Context, senderPsId string, userId uuid.UUID) error {
+	_, err := u.redisClient.Set(
+		context.Request().Context(),
+		redis_client.GenerateUserIdToSenderPsIdRedisKey(userId),
+		senderPsId,
+		0,
+	).Result()
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to set userId to senderPsId relationship",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"senderPsId", senderPsId,
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
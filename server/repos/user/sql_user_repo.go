@@ -0,0 +1,533 @@
+package user_repo
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// SqlUserRepo keeps users in the users table and each league's funds
+// as a row in the wallets table
+type SqlUserRepo struct {
+	sqlClient *redis_client.SqlClient
+}
+
+func NewSql(sqlClient *redis_client.SqlClient) *SqlUserRepo {
+	return &SqlUserRepo{
+		sqlClient,
+	}
+}
+
+func (u *SqlUserRepo) GetUserByUserId(context echo.Context, userId uuid.UUID) (entities.User, error) {
+	var user entities.User
+	err := u.sqlClient.QueryRow(
+		context,
+		"SELECT id, name FROM users WHERE id = ?",
+		userId,
+	).Scan(&user.Id, &user.Name)
+
+	// If user is not found, then return an empty user
+	if err == sql.ErrNoRows {
+		return entities.User{}, nil
+	}
+	if err != nil {
+		return entities.User{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get user",
+			Args: []interface{}{
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return user, nil
+}
+
+func (u *SqlUserRepo) CreateUser(context echo.Context, userId uuid.UUID, user entities.User) error {
+	_, err := u.sqlClient.Exec(
+		context,
+		`INSERT INTO users (id, name) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name`,
+		userId,
+		user.Name,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to update user fields",
+			Args: []interface{}{
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// CreateUserWithSenderPsId creates the user and maps them to their senderPsId in both
+// directions, in one atomic step
+func (u *SqlUserRepo) CreateUserWithSenderPsId(context echo.Context, user entities.User, senderPsId string) error {
+	return u.sqlClient.StartTransaction(context, func() error {
+		err := u.CreateUser(context, user.Id, user)
+		if err != nil {
+			return err
+		}
+
+		// The mapping points at the user, so it has to come second
+		return u.SetSenderPsIdToUserIdRelationship(context, senderPsId, user.Id)
+	})
+}
+
+// GetUserWallet returns the user's available and held funds for every league they're in
+func (u *SqlUserRepo) GetUserWallet(context echo.Context, userId uuid.UUID) (map[uuid.UUID]entities.Wallet, error) {
+	wallet, err := u.getWallets(context, "wallets", userId)
+	if err != nil {
+		return nil, newGetUserWalletError(userId, err)
+	}
+
+	return wallet, nil
+}
+
+// getWallets reads the user's funds for every league out of the given wallet table
+func (u *SqlUserRepo) getWallets(context echo.Context, table string, userId uuid.UUID) (map[uuid.UUID]entities.Wallet, error) {
+	rows, err := u.sqlClient.Query(
+		context,
+		fmt.Sprintf("SELECT league_id, available, held FROM %v WHERE user_id = ?", table),
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wallet := make(map[uuid.UUID]entities.Wallet)
+	for rows.Next() {
+		var leagueWallet entities.Wallet
+		err = rows.Scan(&leagueWallet.LeagueId, &leagueWallet.Available, &leagueWallet.Held)
+		if err != nil {
+			return nil, err
+		}
+
+		wallet[leagueWallet.LeagueId] = leagueWallet
+	}
+
+	return wallet, rows.Err()
+}
+
+func newGetUserWalletError(userId uuid.UUID, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to get user wallet",
+		Args: []interface{}{
+			"userId", userId.String(),
+		},
+		Err: err,
+	})
+}
+
+func (u *SqlUserRepo) AddFundsToUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error) {
+	return u.adjustWalletFunds(context, userId, leagueId, value, 0)
+}
+
+func (u *SqlUserRepo) RemoveFundsFromUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error) {
+	return u.adjustWalletFunds(context, userId, leagueId, value*-1, 0)
+}
+
+// ReleaseHeldFundsInUserWallet moves held funds back into available funds
+func (u *SqlUserRepo) ReleaseHeldFundsInUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error) {
+	return u.adjustWalletFunds(context, userId, leagueId, value, value*-1)
+}
+
+// SpendHeldFundsInUserWallet takes funds out of held funds for good
+func (u *SqlUserRepo) SpendHeldFundsInUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error) {
+	return u.adjustWalletFunds(context, userId, leagueId, 0, value*-1)
+}
+
+func (u *SqlUserRepo) adjustWalletFunds(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, availableValue int64, heldValue int64) (entities.Wallet, error) {
+	var wallet entities.Wallet
+	err := u.sqlClient.StartTransaction(context, func() error {
+		var status int64
+		var err error
+		wallet, status, err = AdjustSqlWalletFunds(context, u.sqlClient, userId, leagueId, availableValue, heldValue)
+		if err != nil {
+			return err
+		}
+
+		return CheckWalletAdjustment(status, wallet, []interface{}{
+			"userId", userId.String(),
+			"leagueId", leagueId.String(),
+			"availableValue", fmt.Sprintf("%v", availableValue),
+			"heldValue", fmt.Sprintf("%v", heldValue),
+		})
+	})
+	if err != nil {
+		return entities.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// AdjustSqlWalletFunds applies both changes to the user's funds for the league, refusing
+// to take either balance below zero. It's exported so other SQL repos can move funds
+// alongside their own writes, like placing a bid. Run it in a transaction and fail the
+// transaction when the adjustment is refused, so the empty wallet it makes is rolled back.
+func AdjustSqlWalletFunds(context echo.Context, sqlClient *redis_client.SqlClient, userId uuid.UUID, leagueId uuid.UUID, availableValue int64, heldValue int64) (entities.Wallet, int64, error) {
+	newAdjustWalletFundsError := func(err error) error {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to adjust wallet funds",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"leagueId", leagueId.String(),
+				"availableValue", fmt.Sprintf("%v", availableValue),
+				"heldValue", fmt.Sprintf("%v", heldValue),
+			},
+			Err: err,
+		})
+	}
+
+	_, err := sqlClient.Exec(
+		context,
+		`INSERT INTO wallets (user_id, league_id, available, held) VALUES (?, ?, 0, 0)
+		ON CONFLICT (user_id, league_id) DO NOTHING`,
+		userId,
+		leagueId,
+	)
+	if err != nil {
+		return entities.Wallet{}, 0, newAdjustWalletFundsError(err)
+	}
+
+	// The balance checks are part of the update, so two requests that both
+	// read the old balance can't overdraw the wallet
+	result, err := sqlClient.Exec(
+		context,
+		`UPDATE wallets SET available = available + ?, held = held + ?
+		WHERE user_id = ? AND league_id = ? AND available + ? >= 0 AND held + ? >= 0`,
+		availableValue,
+		heldValue,
+		userId,
+		leagueId,
+		availableValue,
+		heldValue,
+	)
+	if err != nil {
+		return entities.Wallet{}, 0, newAdjustWalletFundsError(err)
+	}
+
+	updatedCount, err := result.RowsAffected()
+	if err != nil {
+		return entities.Wallet{}, 0, newAdjustWalletFundsError(err)
+	}
+
+	wallet := entities.Wallet{
+		LeagueId: leagueId,
+	}
+	err = sqlClient.QueryRow(
+		context,
+		"SELECT available, held FROM wallets WHERE user_id = ? AND league_id = ?",
+		userId,
+		leagueId,
+	).Scan(&wallet.Available, &wallet.Held)
+	if err != nil {
+		return entities.Wallet{}, 0, newAdjustWalletFundsError(err)
+	}
+
+	if updatedCount > 0 {
+		return wallet, WALLET_ADJUSTMENT_APPLIED, nil
+	}
+
+	if availableValue < 0 && wallet.Available+availableValue < 0 {
+		return wallet, WALLET_ADJUSTMENT_MISSING_FUNDS, nil
+	}
+
+	return wallet, WALLET_ADJUSTMENT_MISSING_HELD_FUNDS, nil
+}
+
+// ArchiveUserWallet moves the user's funds for the league out of their wallet and into
+// the wallet archive, so the league no longer shows up in their wallet but the balance
+// they left with is kept alongside their wallet ledger. Running it again once the league
+// is archived returns the archived wallet without changing it.
+func (u *SqlUserRepo) ArchiveUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) (entities.Wallet, error) {
+	newArchiveWalletError := func(err error) error {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to archive wallet",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	archivedWallet := entities.Wallet{
+		LeagueId: leagueId,
+	}
+	err := u.sqlClient.StartTransaction(context, func() error {
+		err := u.sqlClient.QueryRow(
+			context,
+			"SELECT available, held FROM wallets WHERE user_id = ? AND league_id = ?",
+			userId,
+			leagueId,
+		).Scan(&archivedWallet.Available, &archivedWallet.Held)
+		if err == sql.ErrNoRows {
+			// Already archived by an earlier attempt, which an empty wallet mustn't overwrite
+			err = u.sqlClient.QueryRow(
+				context,
+				"SELECT available, held FROM archived_wallets WHERE user_id = ? AND league_id = ?",
+				userId,
+				leagueId,
+			).Scan(&archivedWallet.Available, &archivedWallet.Held)
+			if err == nil {
+				return nil
+			}
+		}
+		if err != nil && err != sql.ErrNoRows {
+			return newArchiveWalletError(err)
+		}
+
+		_, err = u.sqlClient.Exec(
+			context,
+			`INSERT INTO archived_wallets (user_id, league_id, available, held) VALUES (?, ?, ?, ?)
+			ON CONFLICT (user_id, league_id) DO UPDATE SET available = excluded.available, held = excluded.held`,
+			userId,
+			leagueId,
+			archivedWallet.Available,
+			archivedWallet.Held,
+		)
+		if err != nil {
+			return newArchiveWalletError(err)
+		}
+
+		_, err = u.sqlClient.Exec(
+			context,
+			"DELETE FROM wallets WHERE user_id = ? AND league_id = ?",
+			userId,
+			leagueId,
+		)
+		if err != nil {
+			return newArchiveWalletError(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return entities.Wallet{}, err
+	}
+
+	return archivedWallet, nil
+}
+
+// GetArchivedUserWallets returns the balance the user left each league with, keyed on leagueId
+func (u *SqlUserRepo) GetArchivedUserWallets(context echo.Context, userId uuid.UUID) (map[uuid.UUID]entities.Wallet, error) {
+	archivedWallets, err := u.getWallets(context, "archived_wallets", userId)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get archived wallets",
+			Args: []interface{}{
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return archivedWallets, nil
+}
+
+// AddWalletTransaction appends a transaction to the end of the user's wallet ledger for the league
+func (u *SqlUserRepo) AddWalletTransaction(context echo.Context, transaction entities.WalletTransaction) error {
+	return AddSqlWalletTransaction(context, u.sqlClient, transaction)
+}
+
+// AddSqlWalletTransaction appends a transaction to the user's wallet ledger for the league.
+// It's exported so other SQL repos can record the funds they move in the same transaction.
+func AddSqlWalletTransaction(context echo.Context, sqlClient *redis_client.SqlClient, transaction entities.WalletTransaction) error {
+	_, err := sqlClient.Exec(
+		context,
+		`INSERT INTO wallet_transactions (
+			id, user_id, league_id, sort_order, amount, held_amount, reason,
+			auction_id, player_id, created_at, balance, held_balance
+		) VALUES (
+			?, ?, ?,
+			(SELECT COALESCE(MAX(sort_order), 0) + 1 FROM wallet_transactions WHERE user_id = ? AND league_id = ?),
+			?, ?, ?, ?, ?, ?, ?, ?
+		)`,
+		transaction.Id,
+		transaction.UserId,
+		transaction.LeagueId,
+		transaction.UserId,
+		transaction.LeagueId,
+		transaction.Amount,
+		transaction.HeldAmount,
+		transaction.Reason,
+		redis_client.NullUuid(transaction.AuctionId),
+		transaction.PlayerId,
+		transaction.Timestamp,
+		transaction.Balance,
+		transaction.HeldBalance,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to add wallet transaction",
+			Args: []interface{}{
+				"userId", transaction.UserId.String(),
+				"leagueId", transaction.LeagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// GetWalletTransactions returns the user's wallet ledger for the league, oldest first
+func (u *SqlUserRepo) GetWalletTransactions(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) ([]entities.WalletTransaction, error) {
+	newGetWalletTransactionsError := func(err error) error {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get wallet transactions",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"leagueId", leagueId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	rows, err := u.sqlClient.Query(
+		context,
+		`SELECT id, amount, held_amount, reason, auction_id, player_id, created_at, balance, held_balance
+		FROM wallet_transactions WHERE user_id = ? AND league_id = ? ORDER BY sort_order`,
+		userId,
+		leagueId,
+	)
+	if err != nil {
+		return nil, newGetWalletTransactionsError(err)
+	}
+	defer rows.Close()
+
+	transactions := []entities.WalletTransaction{}
+	for rows.Next() {
+		transaction := entities.WalletTransaction{
+			UserId:   userId,
+			LeagueId: leagueId,
+		}
+
+		var auctionId uuid.NullUUID
+		err = rows.Scan(
+			&transaction.Id,
+			&transaction.Amount,
+			&transaction.HeldAmount,
+			&transaction.Reason,
+			&auctionId,
+			&transaction.PlayerId,
+			&transaction.Timestamp,
+			&transaction.Balance,
+			&transaction.HeldBalance,
+		)
+		if err != nil {
+			return nil, newGetWalletTransactionsError(err)
+		}
+
+		transaction.AuctionId = auctionId.UUID
+		transactions = append(transactions, transaction)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, newGetWalletTransactionsError(err)
+	}
+
+	return transactions, nil
+}
+
+func (u *SqlUserRepo) GetUserIdFromSenderPsId(context echo.Context, senderPsId string) (uuid.UUID, error) {
+	var userId uuid.UUID
+	err := u.sqlClient.QueryRow(
+		context,
+		"SELECT user_id FROM user_sender_ps_ids WHERE sender_ps_id = ?",
+		senderPsId,
+	).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "no userId found for senderPsId",
+			Args: []interface{}{
+				"senderPsId", senderPsId,
+			},
+			Err: nil,
+		})
+	}
+	if err != nil {
+		return uuid.Nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get userId from senderPsId",
+			Args: []interface{}{
+				"senderPsId", senderPsId,
+			},
+			Err: err,
+		})
+	}
+
+	return userId, nil
+}
+
+func (u *SqlUserRepo) GetSenderPsIdFromUserId(context echo.Context, userId uuid.UUID) (string, error) {
+	var senderPsId string
+	err := u.sqlClient.QueryRow(
+		context,
+		"SELECT sender_ps_id FROM user_sender_ps_ids WHERE user_id = ? ORDER BY sender_ps_id LIMIT 1",
+		userId,
+	).Scan(&senderPsId)
+	if err != nil {
+		return "", utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get senderPsId from userId",
+			Args: []interface{}{
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return senderPsId, nil
+}
+
+func (u *SqlUserRepo) SetSenderPsIdToUserIdRelationship(context echo.Context, senderPsId string, userId uuid.UUID) error {
+	_, err := u.sqlClient.Exec(
+		context,
+		`INSERT INTO user_sender_ps_ids (sender_ps_id, user_id) VALUES (?, ?)
+		ON CONFLICT (sender_ps_id) DO UPDATE SET user_id = excluded.user_id`,
+		senderPsId,
+		userId,
+	)
+	if err != nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to set senderPsId to userId relationship",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"senderPsId", senderPsId,
+			},
+			Err: err,
+		})
+	}
+
+	return nil
+}
+
+// SetUserIdToSenderPsIdRelationship saves the same row as SetSenderPsIdToUserIdRelationship,
+// since a single row covers the lookup in both directions
+func (u *SqlUserRepo) SetUserIdToSenderPsIdRelationship(context echo.Context, senderPsId string, userId uuid.UUID) error {
+	return u.SetSenderPsIdToUserIdRelationship(context, senderPsId, userId)
+}
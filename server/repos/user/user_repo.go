@@ -3,295 +3,84 @@ package user_repo
 import (
 	"fmt"
 	"net/http"
-	"strconv"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	redis_client "github.com/wilbertthelam/prop-ock/db"
 	"github.com/wilbertthelam/prop-ock/entities"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
 	"github.com/wilbertthelam/prop-ock/utils"
 )
 
-type UserRepo struct {
-	redisClient *redis.Client
-}
-
-func New(redisClient *redis.Client) *UserRepo {
-	return &UserRepo{
-		redisClient,
-	}
-}
-
-func generateUserRedisKey(userId uuid.UUID) string {
-	return fmt.Sprintf("user:user_id:%v", userId.String())
-}
-
-func generateUserWalletRedisKey(userId uuid.UUID) string {
-	return fmt.Sprintf("wallet:user_id:%v", userId.String())
-}
-
-func generateSenderPsIdToUserIdRedisKey(senderPsId string) string {
-	return fmt.Sprintf("relationship:sender_ps_id_to_user_id:%v", senderPsId)
-}
-
-func generateUserIdToSenderPsIdRedisKey(userId uuid.UUID) string {
-	return fmt.Sprintf("relationship:user_id_to_sender_ps_id:%v", userId.String())
-}
-
-func (u *UserRepo) GetUserByUserId(context echo.Context, userId uuid.UUID) (entities.User, error) {
-	redisUser, err := u.redisClient.HGetAll(
-		context.Request().Context(),
-		generateUserRedisKey(userId),
-	).Result()
-	if err != nil {
-		return entities.User{}, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to get user",
-			Args: []interface{}{
-				"userId", userId.String(),
-			},
-			Err: err,
-		})
-	}
-
-	// If user is not found, then return an empty user
-	if len(redisUser) == 0 {
-		return entities.User{}, nil
-	}
-
-	user := entities.User{
-		Id:   uuid.MustParse(redisUser["id"]),
-		Name: redisUser["name"],
-	}
-
-	return user, nil
-}
-
-func (u *UserRepo) CreateUser(context echo.Context, userId uuid.UUID, user entities.User) error {
-	// Format for database inserting (array of strings where even index is key, odd index is value)
-	redisUserKeyValuePairs := []string{
-		"id", user.Id.String(),
-		"name", user.Name,
-	}
-
-	err := u.updateUser(context, userId, redisUserKeyValuePairs)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (u *UserRepo) updateUser(context echo.Context, userId uuid.UUID, keyValuePairs []string) error {
-	_, err := redis_client.
-		GetCmdable(context, u.redisClient).
-		HSet(
-			context.Request().Context(),
-			generateUserRedisKey(userId),
-			keyValuePairs,
-		).Result()
-	if err != nil {
-		return utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to update user fields",
-			Args: append(
-				[]interface{}{"userId", userId.String()},
-				utils.MapStringSliceToInterfaceSlice(keyValuePairs)...,
-			),
-			Err: err,
-		})
-	}
-
-	return nil
-}
-
-func (u *UserRepo) GetUserWallet(context echo.Context, userId uuid.UUID) (map[uuid.UUID]int64, error) {
-	wallet := make(map[uuid.UUID]int64)
-
-	redisWallet, err := u.redisClient.HGetAll(
-		context.Request().Context(),
-		generateUserWalletRedisKey(userId),
-	).Result()
-	if err != nil {
-		return nil, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to get user wallet player fields",
-			Args: []interface{}{
-				"userId", userId.String(),
-			},
-			Err: err,
-		})
-	}
-
-	for key, value := range redisWallet {
-		uuidKey, err := uuid.Parse(key)
-		if err != nil {
-			return nil, utils.NewError(utils.ErrorParams{
-				Code:    http.StatusInternalServerError,
-				Message: "failed to parse user wallet player leagueId key",
-				Args: []interface{}{
-					"userId", userId.String(),
-					"key", key,
-				},
-				Err: err,
-			})
-		}
-
-		int64Value, err := strconv.ParseInt(value, 10, 64)
-		if err != nil {
-			return nil, utils.NewError(utils.ErrorParams{
-				Code:    http.StatusInternalServerError,
-				Message: "failed to parse user wallet player leagueId value",
-				Args: []interface{}{
-					"userId", userId.String(),
-					"value", value,
-				},
-				Err: err,
-			})
-		}
-
-		wallet[uuidKey] = int64Value
-	}
-
-	return wallet, nil
-}
-
-func (u *UserRepo) AddFundsToUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (int64, error) {
-	updatedWalletValue, err := u.incrementWalletFund(context, userId, leagueId, value)
-	if err != nil {
-		return 0, err
-	}
-
-	return updatedWalletValue, nil
-}
-
-func (u *UserRepo) RemoveFundsFromUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (int64, error) {
-	updatedWalletValue, err := u.incrementWalletFund(context, userId, leagueId, value*-1)
-	if err != nil {
-		return 0, err
-	}
-
-	return updatedWalletValue, nil
-}
-
-func (u *UserRepo) incrementWalletFund(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (int64, error) {
-	updatedWalletValue, err := redis_client.
-		GetCmdable(context, u.redisClient).
-		HIncrBy(
-			context.Request().Context(),
-			generateUserWalletRedisKey(userId),
-			leagueId.String(),
-			value,
-		).Result()
-	if err != nil {
-		return 0, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to adjust wallet fund",
-			Args: []interface{}{
-				"userId", userId.String(),
-				"leagueId", leagueId.String(),
-				"value", fmt.Sprintf("%v", value),
-			},
-			Err: err,
-		})
-	}
-
-	return updatedWalletValue, nil
-}
-
-func (u *UserRepo) GetUserIdFromSenderPsId(context echo.Context, senderPsId string) (uuid.UUID, error) {
-	userIdString, err := u.redisClient.Get(
-		context.Request().Context(),
-		generateSenderPsIdToUserIdRedisKey(senderPsId),
-	).Result()
-	if err != nil {
-		return uuid.Nil, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to get userId from senderPsId",
-			Args: []interface{}{
-				"senderPsId", senderPsId,
-			},
-			Err: err,
-		})
-	}
-
-	userId, err := uuid.Parse(userIdString)
-	if err != nil {
-		return uuid.Nil, utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to parse userId from senderPsId",
-			Args: []interface{}{
-				"senderPsId", senderPsId,
-			},
-			Err: err,
-		})
-	}
-
-	return userId, nil
-}
+type UserRepo interface {
+	GetUserByUserId(context echo.Context, userId uuid.UUID) (entities.User, error)
+	CreateUser(context echo.Context, userId uuid.UUID, user entities.User) error
+	// CreateUserWithSenderPsId creates the user and maps them to their senderPsId in both
+	// directions, in one atomic step
+	CreateUserWithSenderPsId(context echo.Context, user entities.User, senderPsId string) error
+	// GetUserWallet returns the user's available and held funds for every league they're in
+	GetUserWallet(context echo.Context, userId uuid.UUID) (map[uuid.UUID]entities.Wallet, error)
+	AddFundsToUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error)
+	RemoveFundsFromUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error)
+	// ReleaseHeldFundsInUserWallet moves held funds back into available funds
+	ReleaseHeldFundsInUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error)
+	// SpendHeldFundsInUserWallet takes funds out of held funds for good
+	SpendHeldFundsInUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (entities.Wallet, error)
+	// ArchiveUserWallet moves the user's funds for the league out of their wallet and into
+	// the wallet archive, so the league no longer shows up in their wallet but the balance
+	// they left with is kept alongside their wallet ledger. Running it again once the league
+	// is archived returns the archived wallet without changing it.
+	ArchiveUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) (entities.Wallet, error)
+	// GetArchivedUserWallets returns the balance the user left each league with, keyed on leagueId
+	GetArchivedUserWallets(context echo.Context, userId uuid.UUID) (map[uuid.UUID]entities.Wallet, error)
+	// AddWalletTransaction appends a transaction to the end of the user's wallet ledger for the league
+	AddWalletTransaction(context echo.Context, transaction entities.WalletTransaction) error
+	// GetWalletTransactions returns the user's wallet ledger for the league, oldest first
+	GetWalletTransactions(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) ([]entities.WalletTransaction, error)
+	GetUserIdFromSenderPsId(context echo.Context, senderPsId string) (uuid.UUID, error)
+	GetSenderPsIdFromUserId(context echo.Context, userId uuid.UUID) (string, error)
+	SetSenderPsIdToUserIdRelationship(context echo.Context, senderPsId string, userId uuid.UUID) error
+	SetUserIdToSenderPsIdRelationship(context echo.Context, senderPsId string, userId uuid.UUID) error
+}
+
+// Results of adjusting a wallet, shared by every backend (and the Redis scripts)
+const (
+	WALLET_ADJUSTMENT_APPLIED            int64 = 1
+	WALLET_ADJUSTMENT_MISSING_FUNDS      int64 = 0
+	WALLET_ADJUSTMENT_MISSING_HELD_FUNDS int64 = -1
+)
 
-func (u *UserRepo) GetSenderPsIdFromUserId(context echo.Context, userId uuid.UUID) (string, error) {
-	senderPsId, err := u.redisClient.Get(
-		context.Request().Context(),
-		generateUserIdToSenderPsIdRedisKey(userId),
-	).Result()
-	if err != nil {
-		return "", utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to get senderPsId from userId",
-			Args: []interface{}{
-				"userId", userId.String(),
-			},
-			Err: err,
-		})
+// New returns the UserRepo for the storage backend picked in the config
+func New(config *config_service.Config, redisClient *redis.Client, memoryStore *redis_client.MemoryStore, sqlClient *redis_client.SqlClient) UserRepo {
+	switch config.GetStorageConfig().Backend {
+	case config_service.STORAGE_BACKEND_MEMORY:
+		return NewMemory(memoryStore)
+	case config_service.STORAGE_BACKEND_SQL:
+		return NewSql(sqlClient)
 	}
 
-	return senderPsId, nil
+	return NewRedis(redisClient)
 }
 
-func (u *UserRepo) SetSenderPsIdToUserIdRelationship(context echo.Context, senderPsId string, userId uuid.UUID) error {
-	_, err := redis_client.
-		GetCmdable(context, u.redisClient).
-		Set(
-			context.Request().Context(),
-			generateSenderPsIdToUserIdRedisKey(senderPsId),
-			userId.String(),
-			0,
-		).Result()
-	if err != nil {
+// CheckWalletAdjustment turns a wallet adjustment that was refused into the error for it.
+// It's exported so repos moving funds alongside their own writes report refusals the same way.
+func CheckWalletAdjustment(status int64, wallet entities.Wallet, args []interface{}) error {
+	if status == WALLET_ADJUSTMENT_MISSING_FUNDS {
 		return utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to set senderPsId to userId relationship",
-			Args: []interface{}{
-				"senderPsId", senderPsId,
-				"userId", userId.String(),
-			},
-			Err: err,
+			Code:    http.StatusBadRequest,
+			Message: "wallet does not have enough funds",
+			Args:    append(args, "available", fmt.Sprintf("%v", wallet.Available)),
+			Err:     nil,
 		})
 	}
 
-	return nil
-}
-
-func (u *UserRepo) SetUserIdToSenderPsIdRelationship(context echo.Context, senderPsId string, userId uuid.UUID) error {
-	_, err := redis_client.
-		GetCmdable(context, u.redisClient).
-		Set(
-			context.Request().Context(),
-			generateUserIdToSenderPsIdRedisKey(userId),
-			senderPsId,
-			0,
-		).Result()
-	if err != nil {
+	if status == WALLET_ADJUSTMENT_MISSING_HELD_FUNDS {
 		return utils.NewError(utils.ErrorParams{
-			Code:    http.StatusInternalServerError,
-			Message: "failed to set userId to senderPsId relationship",
-			Args: []interface{}{
-				"userId", userId.String(),
-				"senderPsId", senderPsId,
-			},
-			Err: err,
+			Code:    http.StatusBadRequest,
+			Message: "wallet does not have enough held funds",
+			Args:    append(args, "held", fmt.Sprintf("%v", wallet.Held)),
+			Err:     nil,
 		})
 	}
 
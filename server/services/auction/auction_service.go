@@ -2,41 +2,105 @@ package auction_service
 
 import (
 	"fmt"
+	"math/rand"
 	"net/http"
+	"sort"
+	"time"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/constants"
 	"github.com/wilbertthelam/prop-ock/entities"
 	auction_repo "github.com/wilbertthelam/prop-ock/repos/auction"
+	schedule_repo "github.com/wilbertthelam/prop-ock/repos/schedule"
 	league_service "github.com/wilbertthelam/prop-ock/services/league"
 	player_service "github.com/wilbertthelam/prop-ock/services/player"
+	player_set_service "github.com/wilbertthelam/prop-ock/services/player_set"
+	roster_service "github.com/wilbertthelam/prop-ock/services/roster"
 	user_service "github.com/wilbertthelam/prop-ock/services/user"
 	"github.com/wilbertthelam/prop-ock/utils"
 )
 
 type AuctionService struct {
-	auctionRepo   *auction_repo.AuctionRepo
-	userService   *user_service.UserService
-	playerService *player_service.PlayerService
-	leagueService *league_service.LeagueService
-	redisClient   *redis.Client
+	auctionRepo       auction_repo.AuctionRepo
+	scheduleRepo      schedule_repo.ScheduleRepo
+	userService       *user_service.UserService
+	playerService     *player_service.PlayerService
+	playerSetService  *player_set_service.PlayerSetService
+	leagueService     *league_service.LeagueService
+	rosterService     *roster_service.RosterService
+	statusChangeHooks []AuctionStatusChangeHook
+	bidHooks          []AuctionBidHook
 }
 
+// AuctionStatusChangeHook runs after an auction moves to a new status
+type AuctionStatusChangeHook func(context echo.Context, auction entities.Auction) error
+
+// AuctionBidHook runs after a user successfully places a bid
+type AuctionBidHook func(context echo.Context, auction entities.Auction, userId uuid.UUID) error
+
 func New(
-	auctionRepo *auction_repo.AuctionRepo,
+	auctionRepo auction_repo.AuctionRepo,
+	scheduleRepo schedule_repo.ScheduleRepo,
 	userService *user_service.UserService,
 	playerService *player_service.PlayerService,
+	playerSetService *player_set_service.PlayerSetService,
 	leagueService *league_service.LeagueService,
-	redisClient *redis.Client,
+	rosterService *roster_service.RosterService,
 ) *AuctionService {
-	return &AuctionService{
+	auctionService := &AuctionService{
 		auctionRepo,
+		scheduleRepo,
 		userService,
 		playerService,
+		playerSetService,
 		leagueService,
-		redisClient,
+		rosterService,
+		nil,
+		nil,
+	}
+
+	return auctionService
+}
+
+// AddStatusChangeHook registers a hook to run whenever an auction starts, stops or closes
+func (a *AuctionService) AddStatusChangeHook(hook AuctionStatusChangeHook) {
+	a.statusChangeHooks = append(a.statusChangeHooks, hook)
+}
+
+// AddBidHook registers a hook to run whenever a bid is placed
+func (a *AuctionService) AddBidHook(hook AuctionBidHook) {
+	a.bidHooks = append(a.bidHooks, hook)
+}
+
+// runStatusChangeHooks lets every hook know the auction changed status. The status
+// change has already happened, so hook failures are logged instead of returned.
+func (a *AuctionService) runStatusChangeHooks(context echo.Context, auctionId uuid.UUID) {
+	if len(a.statusChangeHooks) == 0 {
+		return
+	}
+
+	auction, err := a.auctionRepo.GetAuctionByAuctionId(context, auctionId)
+	if err != nil {
+		context.Logger().Errorf("failed to get auction for status change hooks: auctionId: %v, err: %v", auctionId, err)
+		return
+	}
+
+	for _, hook := range a.statusChangeHooks {
+		err = hook(context, auction)
+		if err != nil {
+			context.Logger().Errorf("auction status change hook failed: auctionId: %v, status: %v, err: %v", auctionId, auction.Status, err)
+		}
+	}
+}
+
+// runBidHooks lets every hook know a bid was placed, logging any failures
+func (a *AuctionService) runBidHooks(context echo.Context, auction entities.Auction, userId uuid.UUID) {
+	for _, hook := range a.bidHooks {
+		err := hook(context, auction, userId)
+		if err != nil {
+			context.Logger().Errorf("auction bid hook failed: auctionId: %v, userId: %v, err: %v", auction.Id, userId, err)
+		}
 	}
 }
 
@@ -48,13 +112,91 @@ func (a *AuctionService) GetCurrentAuctionIdByLeagueId(context echo.Context, lea
 	return a.auctionRepo.GetCurrentAuctionIdByLeagueId(context, leagueId)
 }
 
-func (a *AuctionService) CreateAuction(context echo.Context, auctionId uuid.UUID, leagueId uuid.UUID, startTime int64, endTime int64) (entities.Auction, error) {
-	// Check if there's already an existing auction running for this league
-	existingAuctionId, err := a.auctionRepo.GetCurrentAuctionIdByLeagueId(context, leagueId)
+func (a *AuctionService) CreateAuction(context echo.Context, auctionId uuid.UUID, leagueId uuid.UUID, playerSetId uuid.UUID, pricingMode entities.AuctionPricingMode, startTime int64, endTime int64) (entities.Auction, error) {
+	// Auctions without an end time run for the league's default duration
+	if endTime == 0 {
+		settings, err := a.leagueService.GetLeagueSettings(context, leagueId)
+		if err != nil {
+			return entities.Auction{}, err
+		}
+
+		endTime = startTime + settings.AuctionDuration
+	}
+
+	// Auctions need a window to take bids in
+	if endTime <= startTime {
+		return entities.Auction{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "auction end time must be after its start time",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"startTime", fmt.Sprintf("%v", startTime),
+				"endTime", fmt.Sprintf("%v", endTime),
+			},
+			Err: nil,
+		})
+	}
+
+	// Auctions default to charging the winner their full bid
+	if pricingMode == entities.AUCTION_PRICING_MODE_INVALID {
+		pricingMode = entities.AUCTION_PRICING_MODE_FIRST_PRICE
+	}
+
+	if pricingMode != entities.AUCTION_PRICING_MODE_FIRST_PRICE &&
+		pricingMode != entities.AUCTION_PRICING_MODE_SECOND_PRICE {
+		return entities.Auction{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "invalid auction pricing mode",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"pricingMode", fmt.Sprintf("%v", pricingMode),
+			},
+			Err: nil,
+		})
+	}
+
+	// Verify league exists
+	league, err := a.leagueService.GetLeagueByLeagueId(context, leagueId)
+	if err != nil {
+		return entities.Auction{}, err
+	}
+
+	if league.Id != leagueId {
+		return entities.Auction{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "league does not exist",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	// Verify the players up for auction belong to this league
+	playerSet, err := a.playerSetService.GetPlayerSetByPlayerSetId(context, playerSetId)
 	if err != nil {
 		return entities.Auction{}, err
 	}
 
+	if playerSet.LeagueId != leagueId {
+		return entities.Auction{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "player set does not belong to this league",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"playerSetId", playerSetId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	// Check if there's already an existing auction running for this league.
+	// A league that has never run an auction won't have a current auction yet.
+	existingAuctionId, err := a.auctionRepo.GetCurrentAuctionIdByLeagueId(context, leagueId)
+	if err != nil && !utils.IsNotFoundError(err) {
+		return entities.Auction{}, err
+	}
+
 	if existingAuctionId != uuid.Nil {
 		// Check the auction status, if it is not finished yet then we don't want to start a new one
 		existingAuction, err := a.GetAuctionByAuctionId(context, existingAuctionId)
@@ -85,32 +227,18 @@ func (a *AuctionService) CreateAuction(context echo.Context, auctionId uuid.UUID
 
 	// Create the auction object
 	auction := entities.Auction{
-		Id:        auctionId,
-		LeagueId:  leagueId,
-		StartTime: startTime,
-		EndTime:   endTime,
-		Name:      "",
-		Status:    entities.AUCTION_STATUS_CREATED,
-	}
-
-	// Start Redis transaction here to create auction
-	err = redis_client.StartTransaction(
-		context,
-		a.redisClient,
-		func() error {
-			err = a.auctionRepo.SetLeagueToAuctionRelationship(context, leagueId, auctionId)
-			if err != nil {
-				return err
-			}
-
-			err = a.auctionRepo.CreateAuction(context, auctionId, auction)
-			if err != nil {
-				return err
-			}
-
-			return nil
-		},
-	)
+		Id:          auctionId,
+		LeagueId:    leagueId,
+		PlayerSetId: playerSetId,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Name:        "",
+		Status:      entities.AUCTION_STATUS_CREATED,
+		PricingMode: pricingMode,
+	}
+
+	// Point the league at the auction and let the scheduler open and close it on time
+	err = a.auctionRepo.CreateLeagueAuction(context, auction)
 	if err != nil {
 		return entities.Auction{}, err
 	}
@@ -118,6 +246,11 @@ func (a *AuctionService) CreateAuction(context echo.Context, auctionId uuid.UUID
 	return auction, nil
 }
 
+// ScheduleAuctionTransition queues up a lifecycle transition for the scheduler to run at the given time
+func (a *AuctionService) ScheduleAuctionTransition(context echo.Context, auctionId uuid.UUID, transition entities.AuctionTransition, runAt int64) error {
+	return a.scheduleRepo.ScheduleAuctionTransition(context, auctionId, transition, runAt)
+}
+
 // Start auction
 func (a *AuctionService) StartAuction(context echo.Context, auctionId uuid.UUID) error {
 	// Check if the auction is already created
@@ -139,7 +272,14 @@ func (a *AuctionService) StartAuction(context echo.Context, auctionId uuid.UUID)
 		})
 	}
 
-	return a.auctionRepo.StartAuction(context, auctionId)
+	err = a.auctionRepo.StartAuction(context, auctionId)
+	if err != nil {
+		return err
+	}
+
+	a.runStatusChangeHooks(context, auctionId)
+
+	return nil
 }
 
 // Stop auction
@@ -163,7 +303,14 @@ func (a *AuctionService) StopAuction(context echo.Context, auctionId uuid.UUID)
 		})
 	}
 
-	return a.auctionRepo.StopAuction(context, auctionId)
+	err = a.auctionRepo.StopAuction(context, auctionId)
+	if err != nil {
+		return err
+	}
+
+	a.runStatusChangeHooks(context, auctionId)
+
+	return nil
 }
 
 // Close auction
@@ -187,7 +334,14 @@ func (a *AuctionService) CloseAuction(context echo.Context, auctionId uuid.UUID)
 		})
 	}
 
-	return a.auctionRepo.CloseAuction(context, auctionId)
+	err = a.auctionRepo.CloseAuction(context, auctionId)
+	if err != nil {
+		return err
+	}
+
+	a.runStatusChangeHooks(context, auctionId)
+
+	return nil
 }
 
 // MakeBid sends in a bid for a player by a given user for a specific auction
@@ -232,20 +386,19 @@ func (a *AuctionService) MakeBid(context echo.Context, auctionId uuid.UUID, user
 		return err
 	}
 
-	// TODO: Make sure the player exists
-
-	// Make sure the user hasn't already made a bid
-	existingBid, err := a.GetBid(context, auctionId, userId, playerId)
+	// Make sure the player is up for bidding in this auction
+	isPlayerInAuction, err := a.playerSetService.IsPlayerInPlayerSet(context, auction.PlayerSetId, playerId)
 	if err != nil {
 		return err
 	}
 
-	if existingBid >= 0 {
+	if !isPlayerInAuction {
 		return utils.NewError(utils.ErrorParams{
 			Code:    http.StatusBadRequest,
-			Message: "cannot make another bids on the same player if bid already exists",
+			Message: "cannot make bid on a player that is not up for auction",
 			Args: []interface{}{
 				"auctionId", auctionId.String(),
+				"playerSetId", auction.PlayerSetId.String(),
 				"userId", userId.String(),
 				"playerId", playerId,
 				"bid", fmt.Sprintf("%v", bid),
@@ -254,64 +407,105 @@ func (a *AuctionService) MakeBid(context echo.Context, auctionId uuid.UUID, user
 		})
 	}
 
-	// Place bid updates in transaction as there are multiple updates
-	// to multiple keys (for the wallet and for the bid item)
-	return redis_client.StartTransaction(
-		context,
-		a.redisClient,
-		func() error {
-			// Try removing funds from the user wallet (validation happens inside user service)
-			_, err = a.userService.RemoveFundsFromUserWallet(context, userId, auction.LeagueId, bid)
-			if err != nil {
-				return err
-			}
+	isUserInLeague, err := a.leagueService.IsUserInLeague(context, userId, auction.LeagueId)
+	if err != nil {
+		return err
+	}
 
-			// Create a bid for the player
-			return a.auctionRepo.MakeBid(context, auctionId, userId, playerId, bid)
-		},
-	)
-}
+	if !isUserInLeague {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusForbidden,
+			Message: "user does not exist in this league",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+				"leagueId", auction.LeagueId.String(),
+				"userId", userId.String(),
+				"playerId", playerId,
+				"bid", fmt.Sprintf("%v", bid),
+			},
+			Err: nil,
+		})
+	}
 
-func (a *AuctionService) GetBid(context echo.Context, auctionId uuid.UUID, userId uuid.UUID, playerId string) (int64, error) {
-	return a.auctionRepo.GetBid(context, auctionId, userId, playerId)
-}
+	limits, err := a.validateBidAgainstLeagueSettings(context, auction, userId, playerId, bid)
+	if err != nil {
+		return err
+	}
 
-func (a *AuctionService) CancelBid(context echo.Context, auctionId uuid.UUID, userId uuid.UUID, playerId string) error {
-	// Check if auction is open and is active
-	isAuctionOpen, err := a.ValidateAuctionIsActive(context, auctionId)
+	// Checking the auction is still active, the bid caps, an existing bid and enough funds,
+	// holding the funds and saving the bid all happen in one atomic step, so parallel bids
+	// can't overdraw the wallet or go over the caps, and a bid racing the auction being
+	// stopped can't hold funds that settlement won't release
+	updatedWallet, err := a.auctionRepo.MakeBid(context, auctionId, auction.LeagueId, userId, playerId, bid, time.Now().UnixMilli(), limits)
 	if err != nil {
 		return err
 	}
 
-	if !isAuctionOpen {
+	err = a.userService.RecordWalletTransaction(context, userId, auction.LeagueId, bid*-1, bid, updatedWallet, entities.WALLET_TRANSACTION_REASON_BID_HOLD, auctionId, playerId)
+	if err != nil {
+		return err
+	}
+
+	a.runBidHooks(context, auction, userId)
+
+	return nil
+}
+
+// validateBidAgainstLeagueSettings checks the bid follows the league's bid minimum and
+// increment, and returns the league's bid and roster caps. The caps are checked when
+// the bid is placed, since parallel bids could all pass them here.
+func (a *AuctionService) validateBidAgainstLeagueSettings(context echo.Context, auction entities.Auction, userId uuid.UUID, playerId string, bid int64) (entities.BidLimits, error) {
+	settings, err := a.leagueService.GetLeagueSettings(context, auction.LeagueId)
+	if err != nil {
+		return entities.BidLimits{}, err
+	}
+
+	newBidError := func(message string) error {
 		return utils.NewError(utils.ErrorParams{
 			Code:    http.StatusBadRequest,
-			Message: "cannot cancel bid on a non-active auction",
+			Message: message,
 			Args: []interface{}{
-				"auctionId", auctionId.String(),
+				"auctionId", auction.Id.String(),
 				"userId", userId.String(),
 				"playerId", playerId,
+				"bid", fmt.Sprintf("%v", bid),
+				"settings", fmt.Sprintf("%+v", settings),
 			},
 			Err: nil,
 		})
 	}
 
-	auction, err := a.auctionRepo.GetAuctionByAuctionId(context, auctionId)
-	if err != nil {
-		return err
+	if bid < settings.MinBid {
+		return entities.BidLimits{}, newBidError(fmt.Sprintf("bids must be at least $%v", settings.MinBid))
+	}
+
+	if (bid-settings.MinBid)%settings.BidIncrement != 0 {
+		return entities.BidLimits{}, newBidError(fmt.Sprintf("bids must go up in steps of $%v", settings.BidIncrement))
+	}
+
+	limits := entities.BidLimits{
+		MaxBidsPerAuction: settings.MaxBidsPerAuction,
+		RosterSizeCap:     settings.RosterSizeCap,
 	}
 
-	// Get the prior bid amount
-	bid, err := a.GetBid(context, auctionId, userId, playerId)
+	return limits, nil
+}
+
+func (a *AuctionService) GetBid(context echo.Context, auctionId uuid.UUID, userId uuid.UUID, playerId string) (int64, error) {
+	return a.auctionRepo.GetBid(context, auctionId, userId, playerId)
+}
+
+func (a *AuctionService) CancelBid(context echo.Context, auctionId uuid.UUID, userId uuid.UUID, playerId string) error {
+	// Check if auction is open and is active
+	isAuctionOpen, err := a.ValidateAuctionIsActive(context, auctionId)
 	if err != nil {
 		return err
 	}
 
-	// Check to make sure the bid exists before canceling
-	if bid < 0 {
+	if !isAuctionOpen {
 		return utils.NewError(utils.ErrorParams{
 			Code:    http.StatusBadRequest,
-			Message: "cannot cancel bid that doesn't exist for player",
+			Message: "cannot cancel bid on a non-active auction",
 			Args: []interface{}{
 				"auctionId", auctionId.String(),
 				"userId", userId.String(),
@@ -321,12 +515,22 @@ func (a *AuctionService) CancelBid(context echo.Context, auctionId uuid.UUID, us
 		})
 	}
 
-	_, err = a.userService.AddFundsToUserWallet(context, userId, auction.LeagueId, bid)
+	auction, err := a.auctionRepo.GetAuctionByAuctionId(context, auctionId)
 	if err != nil {
 		return err
 	}
 
-	return a.auctionRepo.CancelBid(context, auctionId, userId, playerId)
+	return a.cancelBid(context, auction, userId, playerId)
+}
+
+// cancelBid removes the bid and releases the funds held for it in one atomic step
+func (a *AuctionService) cancelBid(context echo.Context, auction entities.Auction, userId uuid.UUID, playerId string) error {
+	bid, updatedWallet, err := a.auctionRepo.CancelBid(context, auction.Id, auction.LeagueId, userId, playerId)
+	if err != nil {
+		return err
+	}
+
+	return a.userService.RecordWalletTransaction(context, userId, auction.LeagueId, bid, bid*-1, updatedWallet, entities.WALLET_TRANSACTION_REASON_BID_CANCEL, auction.Id, playerId)
 }
 
 func (a *AuctionService) ValidateAuctionIsActive(context echo.Context, auctionId uuid.UUID) (bool, error) {
@@ -343,7 +547,7 @@ func (a *AuctionService) GetAllUserBids(context echo.Context, auctionId uuid.UUI
 	return a.auctionRepo.GetAllUserBids(context, auctionId, userId)
 }
 
-func (a *AuctionService) GetAuctionResults(context echo.Context, auctionId uuid.UUID) (map[string][]entities.AuctionBid, error) {
+func (a *AuctionService) GetAuctionResults(context echo.Context, auctionId uuid.UUID) (map[string]entities.AuctionResult, error) {
 	_, err := a.GetAuctionByAuctionId(context, auctionId)
 	if err != nil {
 		return nil, err
@@ -353,6 +557,31 @@ func (a *AuctionService) GetAuctionResults(context echo.Context, auctionId uuid.
 }
 
 func (a *AuctionService) ProcessAuction(context echo.Context, auctionId uuid.UUID) error {
+	// Only one request can process an auction at a time. The status is read after
+	// the claim, so a request that loses the race sees the auction already closed.
+	isClaimed, err := a.auctionRepo.ClaimAuctionProcessing(context, auctionId, constants.AUCTION_PROCESSING_CLAIM_TTL)
+	if err != nil {
+		return err
+	}
+
+	if !isClaimed {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusConflict,
+			Message: "auction is already being processed",
+			Args: []interface{}{
+				"auctionId", auctionId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	defer func() {
+		err := a.auctionRepo.ReleaseAuctionProcessing(context, auctionId)
+		if err != nil {
+			context.Logger().Error(err)
+		}
+	}()
+
 	// Make sure auction is stopped first
 	// Check if the auction is created
 	auction, err := a.auctionRepo.GetAuctionByAuctionId(context, auctionId)
@@ -375,16 +604,22 @@ func (a *AuctionService) ProcessAuction(context echo.Context, auctionId uuid.UUI
 
 	leagueId := auction.LeagueId
 
+	settings, err := a.leagueService.GetLeagueSettings(context, leagueId)
+	if err != nil {
+		return err
+	}
+
 	// Get users inside this auction
 	userIds, err := a.leagueService.GetMembersInLeague(context, leagueId)
 	if err != nil {
-		return nil
+		return err
 	}
 
 	// Create a map keyed on playerId with a value of a list of the highest
 	// bids ({ userId, bid })
 	playerWinningBidsMap := make(map[string][]entities.AuctionBid)
 	playerLosingBidsMap := make(map[string][]entities.AuctionBid)
+	auctionBids := []entities.AuctionBid{}
 
 	for _, userId := range userIds {
 		bids, err := a.GetAllUserBids(context, auctionId, userId)
@@ -392,13 +627,20 @@ func (a *AuctionService) ProcessAuction(context echo.Context, auctionId uuid.UUI
 			return err
 		}
 
+		bidTimestamps, err := a.auctionRepo.GetAllUserBidTimestamps(context, auctionId, userId)
+		if err != nil {
+			return err
+		}
+
 		for playerId, bid := range bids {
 			auctionBid := entities.AuctionBid{
 				UserId:    userId,
 				Bid:       bid,
 				AuctionId: auctionId,
 				PlayerId:  playerId,
+				Timestamp: bidTimestamps[playerId],
 			}
+			auctionBids = append(auctionBids, auctionBid)
 
 			// If no value instantiated yet, then they are the highest bid
 			highBidList, ok := playerWinningBidsMap[playerId]
@@ -445,42 +687,271 @@ func (a *AuctionService) ProcessAuction(context echo.Context, auctionId uuid.UUI
 		}
 	}
 
-	// Save the auction results for retrieval
-	err = a.auctionRepo.SaveAuctionResult(context, auctionId, playerWinningBidsMap)
+	return a.settleAuction(context, auction, settings, auctionBids, playerWinningBidsMap, playerLosingBidsMap)
+}
+
+// settleAuction picks the winners and works out every hold to release or spend and every
+// player won, then applies it all and closes the auction in one atomic step. Settling
+// only goes through while the auction is stopped, so a retry can't pay anything out twice.
+func (a *AuctionService) settleAuction(context echo.Context, auction entities.Auction, settings entities.LeagueSettings, auctionBids []entities.AuctionBid, playerWinningBidsMap map[string][]entities.AuctionBid, playerLosingBidsMap map[string][]entities.AuctionBid) error {
+	auctionId := auction.Id
+	leagueId := auction.LeagueId
+
+	// Pick a single winner for every player. Tied bids that lose the
+	// tie-break get refunded just like any other losing bid.
+	auctionResults, waiverPriorityMoves, err := a.resolveAuctionResults(context, settings, playerWinningBidsMap)
 	if err != nil {
 		return err
 	}
 
-	// Issue refunds for failed bids
-	userTotalRefundAmount := make(map[uuid.UUID]int64)
-	for _, playerBids := range playerLosingBidsMap {
-		for _, playerBid := range playerBids {
-			userId := playerBid.UserId
-			bidAmount := playerBid.Bid
-
-			totalRefundAmount, ok := userTotalRefundAmount[userId]
-			if !ok {
-				userTotalRefundAmount[userId] = bidAmount
-			} else {
-				userTotalRefundAmount[userId] = totalRefundAmount + bidAmount
+	for playerId, auctionResult := range auctionResults {
+		for _, tiedBid := range auctionResult.TiedBids {
+			if tiedBid.UserId == auctionResult.WinningBid.UserId {
+				continue
 			}
+
+			playerLosingBidsMap[playerId] = append(playerLosingBidsMap[playerId], tiedBid)
 		}
 	}
 
-	for userId, bid := range userTotalRefundAmount {
-		updatedFunds, err := a.userService.AddFundsToUserWallet(context, userId, leagueId, bid)
-		if err != nil {
-			return err
+	// Work out what each winner actually pays now that every losing bid is known
+	for playerId, auctionResult := range auctionResults {
+		auctionResult.Price = getClearingPrice(auction.PricingMode, settings, auctionResult.WinningBid, playerLosingBidsMap[playerId])
+		auctionResults[playerId] = auctionResult
+	}
+
+	settlement := entities.AuctionSettlement{
+		Results:             auctionResults,
+		Bids:                auctionBids,
+		WaiverPriorityMoves: waiverPriorityMoves,
+	}
+
+	// Release the holds on losing bids, one per bid so each shows up in the wallet ledger
+	for playerId, playerBids := range playerLosingBidsMap {
+		for _, playerBid := range playerBids {
+			settlement.WalletTransactions = append(
+				settlement.WalletTransactions,
+				entities.NewWalletTransaction(playerBid.UserId, leagueId, playerBid.Bid, playerBid.Bid*-1, entities.WALLET_TRANSACTION_REASON_REFUND, auctionId, playerId),
+			)
+		}
+	}
+
+	// Winners pay the clearing price out of their hold, get back anything they bid over it,
+	// and now own the player
+	acquiredAt := time.Now().UnixMilli()
+	for playerId, auctionResult := range auctionResults {
+		winningBid := auctionResult.WinningBid
+
+		settlement.WalletTransactions = append(
+			settlement.WalletTransactions,
+			entities.NewWalletTransaction(winningBid.UserId, leagueId, 0, auctionResult.Price*-1, entities.WALLET_TRANSACTION_REASON_WINNING_BID, auctionId, playerId),
+		)
+
+		overpaidAmount := winningBid.Bid - auctionResult.Price
+		if overpaidAmount > 0 {
+			settlement.WalletTransactions = append(
+				settlement.WalletTransactions,
+				entities.NewWalletTransaction(winningBid.UserId, leagueId, overpaidAmount, overpaidAmount*-1, entities.WALLET_TRANSACTION_REASON_REFUND, auctionId, playerId),
+			)
 		}
 
-		context.Logger().Infof("updated funds after bid returns: userId: %v, funds: %v", userId, updatedFunds)
+		settlement.RosterPlayers = append(settlement.RosterPlayers, entities.RosterPlayer{
+			PlayerId:   playerId,
+			UserId:     winningBid.UserId,
+			LeagueId:   leagueId,
+			AuctionId:  auctionId,
+			Price:      auctionResult.Price,
+			AcquiredAt: acquiredAt,
+		})
 	}
 
-	// Close auction once it's been processed
-	err = a.CloseAuction(context, auctionId)
+	err = a.auctionRepo.SettleAuction(context, auction, settlement)
 	if err != nil {
 		return err
 	}
 
+	context.Logger().Infof("settled auction: auctionId: %v, players won: %v, wallet transactions: %v", auctionId, len(settlement.RosterPlayers), len(settlement.WalletTransactions))
+
+	a.runStatusChangeHooks(context, auctionId)
+
 	return nil
 }
+
+// resolveAuctionResults picks the winning bid for each player, breaking ties
+// between the highest bids using the league's tie-break policy. Nothing is written, so
+// it also returns the users who won a tie on waiver priority, in the order they go to
+// the back of the line.
+func (a *AuctionService) resolveAuctionResults(context echo.Context, settings entities.LeagueSettings, playerWinningBidsMap map[string][]entities.AuctionBid) (map[string]entities.AuctionResult, []uuid.UUID, error) {
+	// Resolve players in a fixed order so waiver priority changes
+	// and random draws can be replayed from the saved results
+	playerIds := make([]string, 0, len(playerWinningBidsMap))
+	for playerId := range playerWinningBidsMap {
+		playerIds = append(playerIds, playerId)
+	}
+	sort.Strings(playerIds)
+
+	seed := time.Now().UnixNano()
+	random := rand.New(rand.NewSource(seed))
+
+	// Waiver priority is read once and kept up to date here as ties are won, so later
+	// ties in the same auction see the winners already at the back of the line
+	var waiverPriority []uuid.UUID
+	var waiverPriorityMoves []uuid.UUID
+	if settings.TieBreakPolicy == entities.TIE_BREAK_POLICY_WAIVER_PRIORITY {
+		var err error
+		waiverPriority, err = a.leagueService.GetWaiverPriority(context, settings.LeagueId)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	auctionResults := make(map[string]entities.AuctionResult, len(playerIds))
+	for _, playerId := range playerIds {
+		highestBids := playerWinningBidsMap[playerId]
+
+		if len(highestBids) == 1 {
+			auctionResults[playerId] = entities.AuctionResult{
+				PlayerId:   playerId,
+				WinningBid: highestBids[0],
+			}
+			continue
+		}
+
+		// Sort the tied bids so the outcome doesn't depend on the order Redis returned league members in
+		tiedBids := append([]entities.AuctionBid{}, highestBids...)
+		sort.Slice(tiedBids, func(i, j int) bool {
+			return tiedBids[i].UserId.String() < tiedBids[j].UserId.String()
+		})
+
+		winningBid, err := a.breakTie(context, settings, tiedBids, random, waiverPriority)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Using waiver priority sends the winner to the back of the line
+		if settings.TieBreakPolicy == entities.TIE_BREAK_POLICY_WAIVER_PRIORITY {
+			waiverPriority = moveToBackOfWaiverPriority(waiverPriority, winningBid.UserId)
+			waiverPriorityMoves = append(waiverPriorityMoves, winningBid.UserId)
+		}
+
+		auctionResult := entities.AuctionResult{
+			PlayerId:       playerId,
+			WinningBid:     winningBid,
+			TiedBids:       tiedBids,
+			TieBreakPolicy: settings.TieBreakPolicy,
+		}
+		if settings.TieBreakPolicy == entities.TIE_BREAK_POLICY_RANDOM {
+			auctionResult.TieBreakSeed = seed
+		}
+
+		context.Logger().Infof("broke tie for player: playerId: %v, policy: %v, winner: %v", playerId, settings.TieBreakPolicy, winningBid.UserId)
+
+		auctionResults[playerId] = auctionResult
+	}
+
+	return auctionResults, waiverPriorityMoves, nil
+}
+
+// breakTie picks the winner among the tied bids. Waiver priority ties are broken using the
+// given waiver order, which is only read for that policy.
+func (a *AuctionService) breakTie(context echo.Context, settings entities.LeagueSettings, tiedBids []entities.AuctionBid, random *rand.Rand, waiverPriority []uuid.UUID) (entities.AuctionBid, error) {
+	switch settings.TieBreakPolicy {
+	case entities.TIE_BREAK_POLICY_LOWEST_WALLET:
+		walletBalances := make(map[uuid.UUID]int64, len(tiedBids))
+		for _, tiedBid := range tiedBids {
+			wallet, err := a.userService.GetUserWallet(context, tiedBid.UserId)
+			if err != nil {
+				return entities.AuctionBid{}, err
+			}
+
+			// Compare what each user has left to spend, not counting funds held in bids
+			walletBalances[tiedBid.UserId] = wallet[settings.LeagueId].Available
+		}
+
+		// Fall back to the earliest bid if wallets are tied too
+		winningBid := getEarliestBid(tiedBids)
+		for _, tiedBid := range tiedBids {
+			if walletBalances[tiedBid.UserId] < walletBalances[winningBid.UserId] {
+				winningBid = tiedBid
+			}
+		}
+
+		return winningBid, nil
+	case entities.TIE_BREAK_POLICY_WAIVER_PRIORITY:
+		// Anyone missing from the waiver order is treated as having the lowest priority
+		waiverRanks := make(map[uuid.UUID]int, len(waiverPriority))
+		for rank, userId := range waiverPriority {
+			waiverRanks[userId] = rank
+		}
+
+		getWaiverRank := func(userId uuid.UUID) int {
+			rank, ok := waiverRanks[userId]
+			if !ok {
+				return len(waiverPriority)
+			}
+
+			return rank
+		}
+
+		winningBid := tiedBids[0]
+		for _, tiedBid := range tiedBids {
+			if getWaiverRank(tiedBid.UserId) < getWaiverRank(winningBid.UserId) {
+				winningBid = tiedBid
+			}
+		}
+
+		return winningBid, nil
+	case entities.TIE_BREAK_POLICY_RANDOM:
+		return tiedBids[random.Intn(len(tiedBids))], nil
+	}
+
+	return getEarliestBid(tiedBids), nil
+}
+
+// moveToBackOfWaiverPriority returns a new waiver order with the user moved to the back,
+// adding them if they weren't in it yet
+func moveToBackOfWaiverPriority(waiverPriority []uuid.UUID, userId uuid.UUID) []uuid.UUID {
+	movedWaiverPriority := make([]uuid.UUID, 0, len(waiverPriority)+1)
+	for _, waiverUserId := range waiverPriority {
+		if waiverUserId != userId {
+			movedWaiverPriority = append(movedWaiverPriority, waiverUserId)
+		}
+	}
+
+	return append(movedWaiverPriority, userId)
+}
+
+// getClearingPrice returns what the winner pays for a player. Second price auctions
+// charge the highest losing bid plus $1 (or the minimum bid if nobody else bid),
+// capped at what the winner actually bid.
+func getClearingPrice(pricingMode entities.AuctionPricingMode, settings entities.LeagueSettings, winningBid entities.AuctionBid, losingBids []entities.AuctionBid) int64 {
+	if pricingMode != entities.AUCTION_PRICING_MODE_SECOND_PRICE {
+		return winningBid.Bid
+	}
+
+	price := settings.MinBid
+	for _, losingBid := range losingBids {
+		if losingBid.Bid+1 > price {
+			price = losingBid.Bid + 1
+		}
+	}
+
+	if price >= winningBid.Bid {
+		return winningBid.Bid
+	}
+
+	return price
+}
+
+// getEarliestBid returns the first bid placed. Bids made before timestamps
+// were recorded are treated as coming in last.
+func getEarliestBid(bids []entities.AuctionBid) entities.AuctionBid {
+	earliestBid := bids[0]
+	for _, bid := range bids {
+		if bid.Timestamp != 0 && (earliestBid.Timestamp == 0 || bid.Timestamp < earliestBid.Timestamp) {
+			earliestBid = bid
+		}
+	}
+
+	return earliestBid
+}
@@ -0,0 +1,277 @@
+package auction_service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wilbertthelam/prop-ock/entities"
+	auction_repo "github.com/wilbertthelam/prop-ock/repos/auction"
+	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	member_repo "github.com/wilbertthelam/prop-ock/repos/member"
+	player_repo "github.com/wilbertthelam/prop-ock/repos/player"
+	player_set_repo "github.com/wilbertthelam/prop-ock/repos/player_set"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	schedule_repo "github.com/wilbertthelam/prop-ock/repos/schedule"
+	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
+	league_service "github.com/wilbertthelam/prop-ock/services/league"
+	player_service "github.com/wilbertthelam/prop-ock/services/player"
+	player_set_service "github.com/wilbertthelam/prop-ock/services/player_set"
+	roster_service "github.com/wilbertthelam/prop-ock/services/roster"
+	user_service "github.com/wilbertthelam/prop-ock/services/user"
+	"github.com/wilbertthelam/prop-ock/test_utils"
+)
+
+const auctionedPlayerId = "auctioned_player"
+
+// auctionTest is a league with two funded bidders and an active auction for one player
+type auctionTest struct {
+	auctionService *AuctionService
+	userService    *user_service.UserService
+	rosterService  *roster_service.RosterService
+	auction        entities.Auction
+	winnerId       uuid.UUID
+	loserId        uuid.UUID
+}
+
+func TestMakeBidHoldsFunds(t *testing.T) {
+	test_utils.RunOnEveryBackend(t, func(t *testing.T, backend test_utils.Backend) {
+		test := setUpAuctionTest(t, backend)
+
+		err := test.auctionService.MakeBid(test_utils.NewContext(), test.auction.Id, test.winnerId, auctionedPlayerId, 40)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test.checkWallet(t, test.winnerId, entities.DEFAULT_STARTING_WALLET-40, 40)
+
+		bid, err := test.auctionService.GetBid(test_utils.NewContext(), test.auction.Id, test.winnerId, auctionedPlayerId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bid != 40 {
+			t.Errorf("saved bid is %v, expected 40", bid)
+		}
+
+		// A bid the wallet can't cover is refused without touching the hold
+		err = test.auctionService.MakeBid(test_utils.NewContext(), test.auction.Id, test.loserId, auctionedPlayerId, entities.DEFAULT_STARTING_WALLET+1)
+		if err == nil {
+			t.Error("made a bid over the wallet's available funds")
+		}
+
+		test.checkWallet(t, test.loserId, entities.DEFAULT_STARTING_WALLET, 0)
+	})
+}
+
+func TestCancelBidReleasesHold(t *testing.T) {
+	test_utils.RunOnEveryBackend(t, func(t *testing.T, backend test_utils.Backend) {
+		test := setUpAuctionTest(t, backend)
+
+		err := test.auctionService.MakeBid(test_utils.NewContext(), test.auction.Id, test.winnerId, auctionedPlayerId, 40)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = test.auctionService.CancelBid(test_utils.NewContext(), test.auction.Id, test.winnerId, auctionedPlayerId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test.checkWallet(t, test.winnerId, entities.DEFAULT_STARTING_WALLET, 0)
+
+		bids, err := test.auctionService.GetAllUserBids(test_utils.NewContext(), test.auction.Id, test.winnerId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(bids) != 0 {
+			t.Errorf("bids are %v after canceling", bids)
+		}
+
+		// The hold was already released, so canceling again can't release it twice
+		err = test.auctionService.CancelBid(test_utils.NewContext(), test.auction.Id, test.winnerId, auctionedPlayerId)
+		if err == nil {
+			t.Error("canceled a bid that was already canceled")
+		}
+
+		test.checkWallet(t, test.winnerId, entities.DEFAULT_STARTING_WALLET, 0)
+	})
+}
+
+func TestProcessAuctionSettlesBids(t *testing.T) {
+	test_utils.RunOnEveryBackend(t, func(t *testing.T, backend test_utils.Backend) {
+		test := setUpAuctionTest(t, backend)
+
+		err := test.auctionService.MakeBid(test_utils.NewContext(), test.auction.Id, test.winnerId, auctionedPlayerId, 40)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = test.auctionService.MakeBid(test_utils.NewContext(), test.auction.Id, test.loserId, auctionedPlayerId, 25)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = test.auctionService.StopAuction(test_utils.NewContext(), test.auction.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = test.auctionService.ProcessAuction(test_utils.NewContext(), test.auction.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The winner pays their full bid and the loser gets their hold back
+		test.checkWallet(t, test.winnerId, entities.DEFAULT_STARTING_WALLET-40, 0)
+		test.checkWallet(t, test.loserId, entities.DEFAULT_STARTING_WALLET, 0)
+
+		ownerId, err := test.rosterService.GetPlayerOwner(test_utils.NewContext(), test.auction.LeagueId, auctionedPlayerId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ownerId != test.winnerId {
+			t.Errorf("player is owned by %v, expected the winner %v", ownerId, test.winnerId)
+		}
+
+		auction, err := test.auctionService.GetAuctionByAuctionId(test_utils.NewContext(), test.auction.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if auction.Status != entities.AUCTION_STATUS_CLOSED {
+			t.Errorf("auction status is %v after processing, expected closed", auction.Status)
+		}
+
+		results, err := test.auctionService.GetAuctionResults(test_utils.NewContext(), test.auction.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := results[auctionedPlayerId]
+		if result.WinningBid.UserId != test.winnerId || result.Price != 40 {
+			t.Errorf("auction result is %+v, expected the winner to pay 40", result)
+		}
+
+		// Settling a closed auction again mustn't pay out twice
+		err = test.auctionService.ProcessAuction(test_utils.NewContext(), test.auction.Id)
+		if err == nil {
+			t.Error("processed an auction that was already closed")
+		}
+
+		test.checkWallet(t, test.winnerId, entities.DEFAULT_STARTING_WALLET-40, 0)
+		test.checkWallet(t, test.loserId, entities.DEFAULT_STARTING_WALLET, 0)
+	})
+}
+
+func TestGetClearingPrice(t *testing.T) {
+	settings := entities.LeagueSettings{MinBid: 1, BidIncrement: 5}
+	winningBid := entities.AuctionBid{Bid: 40}
+
+	for _, testCase := range []struct {
+		name          string
+		pricingMode   entities.AuctionPricingMode
+		losingBids    []entities.AuctionBid
+		expectedPrice int64
+	}{
+		{"first price charges the winning bid", entities.AUCTION_PRICING_MODE_FIRST_PRICE, []entities.AuctionBid{{Bid: 25}}, 40},
+		{"second price charges the runner up plus one", entities.AUCTION_PRICING_MODE_SECOND_PRICE, []entities.AuctionBid{{Bid: 10}, {Bid: 25}}, 26},
+		{"second price without a runner up charges the minimum bid", entities.AUCTION_PRICING_MODE_SECOND_PRICE, nil, 1},
+		{"second price never charges over the winning bid", entities.AUCTION_PRICING_MODE_SECOND_PRICE, []entities.AuctionBid{{Bid: 40}}, 40},
+	} {
+		price := getClearingPrice(testCase.pricingMode, settings, winningBid, testCase.losingBids)
+		if price != testCase.expectedPrice {
+			t.Errorf("%v: price is %v, expected %v", testCase.name, price, testCase.expectedPrice)
+		}
+	}
+}
+
+// setUpAuctionTest wires up the auction service the same way the server does, and starts
+// an auction for one player between two members with starting wallets
+func setUpAuctionTest(t *testing.T, backend test_utils.Backend) auctionTest {
+	config, client, memoryStore, sqlClient := backend.Config, backend.RedisClient, backend.MemoryStore, backend.SqlClient
+
+	userRepo := user_repo.New(config, client, memoryStore, sqlClient)
+	leagueService := league_service.New(league_repo.New(config, client, memoryStore, sqlClient), member_repo.New(config, client, memoryStore, sqlClient))
+	userService := user_service.New(userRepo, leagueService)
+	playerService := player_service.New(player_repo.New(config, client, memoryStore, sqlClient))
+	rosterService := roster_service.New(roster_repo.New(config, client, memoryStore, sqlClient), leagueService)
+	playerSetService := player_set_service.New(player_set_repo.New(config, client, memoryStore, sqlClient), leagueService, playerService, rosterService)
+	auctionService := New(
+		auction_repo.New(config, client, memoryStore, sqlClient),
+		schedule_repo.New(config, client, memoryStore, sqlClient),
+		userService,
+		playerService,
+		playerSetService,
+		leagueService,
+		rosterService,
+	)
+
+	context := test_utils.NewContext()
+
+	league, err := leagueService.CreateLeague(context, uuid.Nil, "auctions", uuid.Nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test := auctionTest{
+		auctionService: auctionService,
+		userService:    userService,
+		rosterService:  rosterService,
+		winnerId:       uuid.New(),
+		loserId:        uuid.New(),
+	}
+
+	for _, userId := range []uuid.UUID{test.winnerId, test.loserId} {
+		err = userRepo.CreateUser(context, userId, entities.User{Id: userId, Name: "bidder"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = leagueService.AddUserToLeague(context, userId, league.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = userService.GrantStartingWallet(context, userId, league.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = playerService.CreatePlayer(context, entities.Player{Id: auctionedPlayerId, Name: "Auctioned Player"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	playerSet, err := playerSetService.CreatePlayerSet(context, league.Id, "auctioned players", []string{auctionedPlayerId})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test.auction, err = auctionService.CreateAuction(context, uuid.Nil, league.Id, playerSet.Id, entities.AUCTION_PRICING_MODE_FIRST_PRICE, time.Now().UnixMilli(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = auctionService.StartAuction(context, test.auction.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return test
+}
+
+func (a auctionTest) checkWallet(t *testing.T, userId uuid.UUID, expectedAvailable int64, expectedHeld int64) {
+	wallets, err := a.userService.GetUserWallet(test_utils.NewContext(), userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallet := wallets[a.auction.LeagueId]
+	if wallet.Available != expectedAvailable || wallet.Held != expectedHeld {
+		t.Errorf("wallet is %+v, expected %v available and %v held", wallet, expectedAvailable, expectedHeld)
+	}
+}
@@ -0,0 +1,266 @@
+package auth_service
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/constants"
+	"github.com/wilbertthelam/prop-ock/entities"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+	league_service "github.com/wilbertthelam/prop-ock/services/league"
+	user_service "github.com/wilbertthelam/prop-ock/services/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// Signed into each kind of token so a token made for one is never accepted as the other
+const authTokenPurpose = "auth"
+const webviewTokenPurpose = "webview"
+
+const bearerPrefix = "Bearer "
+
+type AuthService struct {
+	userService   *user_service.UserService
+	leagueService *league_service.LeagueService
+	config        *config_service.Config
+}
+
+func New(
+	userService *user_service.UserService,
+	leagueService *league_service.LeagueService,
+	config *config_service.Config,
+) *AuthService {
+	return &AuthService{
+		userService,
+		leagueService,
+		config,
+	}
+}
+
+// IssueToken signs a token the user can call the API with until it expires
+func (a *AuthService) IssueToken(context echo.Context, userId uuid.UUID) (entities.AuthToken, error) {
+	user, err := a.userService.GetUserByUserId(context, userId)
+	if err != nil {
+		return entities.AuthToken{}, err
+	}
+
+	if user.Id == uuid.Nil {
+		return entities.AuthToken{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "no user found",
+			Args: []interface{}{
+				"userId", userId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	claims := entities.AuthClaims{
+		UserId:    userId,
+		ExpiresAt: time.Now().Add(constants.AUTH_TOKEN_EXPIRATION).UnixMilli(),
+	}
+
+	token, err := utils.SignToken(authTokenPurpose, claims, a.config.GetAuthConfig().TokenSecret)
+	if err != nil {
+		return entities.AuthToken{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to sign auth token",
+			Args: []interface{}{
+				"userId", userId.String(),
+			},
+			Err: err,
+		})
+	}
+
+	return entities.AuthToken{
+		UserId:    userId,
+		Token:     token,
+		ExpiresAt: claims.ExpiresAt,
+	}, nil
+}
+
+// IssueWebviewToken signs a token for the bid webview that only lets the user bid on the player in the auction
+func (a *AuthService) IssueWebviewToken(userId uuid.UUID, auctionId uuid.UUID, playerId string) (string, error) {
+	claims := entities.WebviewClaims{
+		UserId:    userId,
+		AuctionId: auctionId,
+		PlayerId:  playerId,
+		ExpiresAt: time.Now().Add(constants.WEBVIEW_TOKEN_EXPIRATION).UnixMilli(),
+	}
+
+	token, err := utils.SignToken(webviewTokenPurpose, claims, a.config.GetAuthConfig().TokenSecret)
+	if err != nil {
+		return "", utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to sign webview token",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"auctionId", auctionId.String(),
+				"playerId", playerId,
+			},
+			Err: err,
+		})
+	}
+
+	return token, nil
+}
+
+// VerifyWebviewToken returns who the bid webview token was issued to and what for, as long as it hasn't expired
+func (a *AuthService) VerifyWebviewToken(token string) (entities.WebviewClaims, error) {
+	var claims entities.WebviewClaims
+	if !utils.VerifyToken(webviewTokenPurpose, token, a.config.GetAuthConfig().TokenSecret, &claims) {
+		return entities.WebviewClaims{}, newUnauthorizedError("invalid webview token")
+	}
+
+	if claims.UserId == uuid.Nil || claims.AuctionId == uuid.Nil || claims.PlayerId == "" {
+		return entities.WebviewClaims{}, newUnauthorizedError("invalid webview token")
+	}
+
+	if claims.ExpiresAt <= time.Now().UnixMilli() {
+		return entities.WebviewClaims{}, newUnauthorizedError("webview token has expired, open the latest bid link instead")
+	}
+
+	return claims, nil
+}
+
+// AuthenticateRequest works out who made the request from the admin API key in
+// the X-Api-Key header or the user token in the Authorization header, and
+// records them in the context for the checks below
+func (a *AuthService) AuthenticateRequest(context echo.Context) error {
+	authConfig := a.config.GetAuthConfig()
+
+	apiKey := context.Request().Header.Get("X-Api-Key")
+	if apiKey != "" {
+		// Compare in constant time so the key can't be guessed byte by byte
+		if authConfig.AdminApiKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(authConfig.AdminApiKey)) != 1 {
+			return newUnauthorizedError("invalid api key")
+		}
+
+		context.Set(constants.AUTH_IS_ADMIN, true)
+		return nil
+	}
+
+	authorization := context.Request().Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, bearerPrefix) {
+		return newUnauthorizedError("missing api key or auth token")
+	}
+
+	var claims entities.AuthClaims
+	if !utils.VerifyToken(authTokenPurpose, strings.TrimPrefix(authorization, bearerPrefix), authConfig.TokenSecret, &claims) {
+		return newUnauthorizedError("invalid auth token")
+	}
+
+	if claims.UserId == uuid.Nil || claims.ExpiresAt <= time.Now().UnixMilli() {
+		return newUnauthorizedError("auth token has expired")
+	}
+
+	context.Set(constants.AUTH_USER_ID, claims.UserId)
+	return nil
+}
+
+// IsAdmin reports whether the request was made with the admin API key
+func IsAdmin(context echo.Context) bool {
+	isAdmin, ok := context.Get(constants.AUTH_IS_ADMIN).(bool)
+	return ok && isAdmin
+}
+
+// GetAuthenticatedUserId returns the user the request's token was issued to,
+// or a nil id for admin and unauthenticated requests
+func GetAuthenticatedUserId(context echo.Context) uuid.UUID {
+	userId, ok := context.Get(constants.AUTH_USER_ID).(uuid.UUID)
+	if !ok {
+		return uuid.Nil
+	}
+
+	return userId
+}
+
+func (a *AuthService) RequireAdmin(context echo.Context) error {
+	if IsAdmin(context) {
+		return nil
+	}
+
+	return newForbiddenError("only admins can do this", GetAuthenticatedUserId(context), uuid.Nil)
+}
+
+// RequireUser makes sure the request was made by the user it acts for
+func (a *AuthService) RequireUser(context echo.Context, userId uuid.UUID) error {
+	if IsAdmin(context) {
+		return nil
+	}
+
+	authenticatedUserId := GetAuthenticatedUserId(context)
+	if authenticatedUserId != uuid.Nil && authenticatedUserId == userId {
+		return nil
+	}
+
+	return newForbiddenError("users can only act for themselves", authenticatedUserId, uuid.Nil)
+}
+
+// RequireLeagueRole makes sure the request was made by someone with at least the role in the league
+func (a *AuthService) RequireLeagueRole(context echo.Context, leagueId uuid.UUID, role entities.LeagueRole) error {
+	if IsAdmin(context) {
+		return nil
+	}
+
+	authenticatedUserId := GetAuthenticatedUserId(context)
+	if authenticatedUserId == uuid.Nil {
+		return newForbiddenError("only league members can do this", authenticatedUserId, leagueId)
+	}
+
+	userRole, err := a.leagueService.GetLeagueRole(context, leagueId, authenticatedUserId)
+	if err != nil {
+		return err
+	}
+
+	if userRole < role {
+		return newForbiddenError(fmt.Sprintf("only league %vs can do this", getLeagueRoleName(role)), authenticatedUserId, leagueId)
+	}
+
+	return nil
+}
+
+// RequireUserOrLeagueRole lets the user act for themselves, or someone with the role act for them
+func (a *AuthService) RequireUserOrLeagueRole(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, role entities.LeagueRole) error {
+	err := a.RequireUser(context, userId)
+	if err == nil {
+		return nil
+	}
+
+	return a.RequireLeagueRole(context, leagueId, role)
+}
+
+func getLeagueRoleName(role entities.LeagueRole) string {
+	switch role {
+	case entities.LEAGUE_ROLE_OWNER:
+		return "owner"
+	case entities.LEAGUE_ROLE_COMMISSIONER:
+		return "commissioner"
+	default:
+		return "member"
+	}
+}
+
+func newUnauthorizedError(message string) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusUnauthorized,
+		Message: message,
+		Err:     nil,
+	})
+}
+
+func newForbiddenError(message string, userId uuid.UUID, leagueId uuid.UUID) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusForbidden,
+		Message: message,
+		Args: []interface{}{
+			"userId", userId.String(),
+			"leagueId", leagueId.String(),
+		},
+		Err: nil,
+	})
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
 )
 
 type TransactionsResponse struct {
@@ -105,10 +106,6 @@ type RedisPlayer struct {
 	PlayerId string
 }
 
-func generatePlayerDebutRedisKey(playerId string) string {
-	return "debut:" + playerId
-}
-
 // Check Redis cache to see if we know this player has already debuted
 // If no results, make a call to MLB API to check if they have debuted
 func (c *CallupsService) isPlayerDebut(context echo.Context, playerId string) (bool, error) {
@@ -117,7 +114,7 @@ func (c *CallupsService) isPlayerDebut(context echo.Context, playerId string) (b
 	}
 
 	// Check Redis to see if playerId exists already
-	playerExists, err := c.redisClient.Get(context.Request().Context(), generatePlayerDebutRedisKey(playerId)).Result()
+	playerExists, err := c.redisClient.Get(context.Request().Context(), redis_client.GeneratePlayerDebutRedisKey(playerId)).Result()
 	if err != nil {
 		fmt.Println("error grabbing from Redis")
 		return false, nil
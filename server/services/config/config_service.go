@@ -1,16 +1,34 @@
 package config_service
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 )
 
+// Storage backends the repos can be run on
+const STORAGE_BACKEND_REDIS = "redis"
+const STORAGE_BACKEND_MEMORY = "memory"
+const STORAGE_BACKEND_SQL = "sql"
+
+// Drivers the SQL backend can be run on
+const SQL_DRIVER_SQLITE = "sqlite3"
+const SQL_DRIVER_POSTGRES = "postgres"
+
+// Where the SQL backend keeps its data when no URL is given
+const DEFAULT_SQLITE_URL = "prop-ock.db"
+
 type Config struct {
 	Environment string    `json:"ENVIRONMENT,omitempty"`
 	Redis       Redis     `json:"REDIS,omitempty"`
 	Messenger   Messenger `json:"MESSENGER,omitempty"`
+	Auth        Auth      `json:"AUTH,omitempty"`
+	Storage     Storage   `json:"STORAGE,omitempty"`
 	HostUrl     string    `json:"HOST_URL,omitempty"`
 }
 
@@ -23,6 +41,26 @@ type Redis struct {
 type Messenger struct {
 	WebhookVerificationToken string `json:"WEBHOOK_VERIFICATION_TOKEN,omitempty"`
 	AccessToken              string `json:"ACCESS_TOKEN,omitempty"`
+	// AppSecret signs every webhook event Messenger sends us
+	AppSecret string `json:"APP_SECRET,omitempty"`
+	// PageUsername builds m.me invite links, they're left out when it isn't set
+	PageUsername string `json:"PAGE_USERNAME,omitempty"`
+}
+
+type Auth struct {
+	// AdminApiKey is sent as the X-Api-Key header and is allowed to do anything
+	AdminApiKey string `json:"ADMIN_API_KEY,omitempty"`
+	// TokenSecret signs the tokens users call the API with
+	TokenSecret string `json:"TOKEN_SECRET,omitempty"`
+}
+
+type Storage struct {
+	// Backend is "redis" (the default when left out), "memory" or "sql"
+	Backend string `json:"BACKEND,omitempty"`
+	// SqlDriver is "sqlite3" (the default when left out) or "postgres"
+	SqlDriver string `json:"SQL_DRIVER,omitempty"`
+	// SqlUrl is the file for SQLite or the connection string for PostgreSQL
+	SqlUrl string `json:"SQL_URL,omitempty"`
 }
 
 func New() *Config {
@@ -33,6 +71,12 @@ func New() *Config {
 		return getConfigFromEnvVariables()
 	}
 
+	// Without a local.json, run everything in memory so the server starts with no setup
+	if _, err := os.Stat("secrets/local.json"); errors.Is(err, fs.ErrNotExist) {
+		fmt.Println("No secrets/local.json found, loading *in-memory* config...")
+		return getInMemoryConfig()
+	}
+
 	fmt.Println("Loading config from *JSON*...")
 	return getConfigFromJSON("secrets/local.json")
 }
@@ -45,6 +89,24 @@ func (c *Config) GetMessengerConfig() Messenger {
 	return c.Messenger
 }
 
+func (c *Config) GetAuthConfig() Auth {
+	return c.Auth
+}
+
+// GetStorageConfig fills in the SQLite defaults when no SQL driver or URL is set
+func (c *Config) GetStorageConfig() Storage {
+	storage := c.Storage
+	if storage.SqlDriver == "" {
+		storage.SqlDriver = SQL_DRIVER_SQLITE
+	}
+
+	if storage.SqlUrl == "" && storage.SqlDriver == SQL_DRIVER_SQLITE {
+		storage.SqlUrl = DEFAULT_SQLITE_URL
+	}
+
+	return storage
+}
+
 func (c *Config) GetHostUrl() string {
 	return c.HostUrl
 }
@@ -61,8 +123,49 @@ func getConfigFromEnvVariables() *Config {
 		Messenger: Messenger{
 			WebhookVerificationToken: getEnvOrPanic("MESSENGER.WEBHOOK_VERIFICATION_TOKEN"),
 			AccessToken:              getEnvOrPanic("MESSENGER.ACCESS_TOKEN"),
+			AppSecret:                getEnvOrPanic("MESSENGER.APP_SECRET"),
+			PageUsername:             os.Getenv("MESSENGER.PAGE_USERNAME"),
+		},
+		Auth: Auth{
+			AdminApiKey: getEnvOrPanic("AUTH.ADMIN_API_KEY"),
+			TokenSecret: getEnvOrPanic("AUTH.TOKEN_SECRET"),
+		},
+		Storage: Storage{
+			Backend:   os.Getenv("STORAGE.BACKEND"),
+			SqlDriver: os.Getenv("STORAGE.SQL_DRIVER"),
+			SqlUrl:    os.Getenv("STORAGE.SQL_URL"),
+		},
+	}
+}
+
+// getInMemoryConfig stores everything in memory and makes up fresh auth secrets
+// each time the server starts. Messenger isn't set up, so sends to it will fail.
+func getInMemoryConfig() *Config {
+	config := &Config{
+		Environment: "LOCAL",
+		HostUrl:     "http://localhost:8000",
+		Auth: Auth{
+			AdminApiKey: generateSecret(),
+			TokenSecret: generateSecret(),
+		},
+		Storage: Storage{
+			Backend: STORAGE_BACKEND_MEMORY,
 		},
 	}
+
+	fmt.Printf("Admin API key for this run: %v\n", config.Auth.AdminApiKey)
+
+	return config
+}
+
+func generateSecret() string {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		panic(fmt.Sprintf("failed to start server when generating secrets: %+v", err))
+	}
+
+	return hex.EncodeToString(secret)
 }
 
 // GetEnvOrPanic checks to see if the key exists or else it panics
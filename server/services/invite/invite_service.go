@@ -0,0 +1,266 @@
+package invite_service
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/constants"
+	"github.com/wilbertthelam/prop-ock/entities"
+	invite_repo "github.com/wilbertthelam/prop-ock/repos/invite"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+	league_service "github.com/wilbertthelam/prop-ock/services/league"
+	user_service "github.com/wilbertthelam/prop-ock/services/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// Invite codes leave out characters that are easy to mix up when typed (0/O, 1/I)
+const inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const inviteCodeLength = 8
+
+type InviteService struct {
+	inviteRepo    invite_repo.InviteRepo
+	leagueService *league_service.LeagueService
+	userService   *user_service.UserService
+	config        *config_service.Config
+}
+
+func New(
+	inviteRepo invite_repo.InviteRepo,
+	leagueService *league_service.LeagueService,
+	userService *user_service.UserService,
+	config *config_service.Config,
+) *InviteService {
+	return &InviteService{
+		inviteRepo,
+		leagueService,
+		userService,
+		config,
+	}
+}
+
+func (i *InviteService) GetInviteByCode(context echo.Context, code string) (entities.LeagueInvite, error) {
+	invite, err := i.inviteRepo.GetInviteByCode(context, NormalizeInviteCode(code))
+	if err != nil {
+		return entities.LeagueInvite{}, err
+	}
+
+	return i.attachInviteLink(invite), nil
+}
+
+// GetInvitesForLeague returns the league's invites that haven't expired yet, newest first
+func (i *InviteService) GetInvitesForLeague(context echo.Context, leagueId uuid.UUID) ([]entities.LeagueInvite, error) {
+	codes, err := i.inviteRepo.GetInviteCodesForLeague(context, leagueId)
+	if err != nil {
+		return nil, err
+	}
+
+	invites := make([]entities.LeagueInvite, 0, len(codes))
+	for _, code := range codes {
+		invite, err := i.GetInviteByCode(context, code)
+		if utils.IsNotFoundError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		invites = append(invites, invite)
+	}
+
+	sort.Slice(invites, func(a, b int) bool {
+		return invites[a].CreatedAt > invites[b].CreatedAt
+	})
+
+	return invites, nil
+}
+
+// CreateInvite makes a new invite code for the league. Leaving out the expiry
+// gives the invite the default lifetime.
+func (i *InviteService) CreateInvite(context echo.Context, leagueId uuid.UUID, maxUses int64, expiresAt int64) (entities.LeagueInvite, error) {
+	now := time.Now()
+	if expiresAt == 0 {
+		expiresAt = now.Add(constants.INVITE_EXPIRATION).UnixMilli()
+	}
+
+	if maxUses < 0 || expiresAt <= now.UnixMilli() {
+		return entities.LeagueInvite{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "invites need a non-negative use limit and an expiry in the future",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+				"maxUses", fmt.Sprintf("%v", maxUses),
+				"expiresAt", fmt.Sprintf("%v", expiresAt),
+			},
+			Err: nil,
+		})
+	}
+
+	// Verify league exists
+	league, err := i.leagueService.GetLeagueByLeagueId(context, leagueId)
+	if err != nil {
+		return entities.LeagueInvite{}, err
+	}
+
+	if league.Id != leagueId {
+		return entities.LeagueInvite{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "league does not exist",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	invite := entities.LeagueInvite{
+		LeagueId:  leagueId,
+		MaxUses:   maxUses,
+		Uses:      0,
+		ExpiresAt: expiresAt,
+		CreatedAt: now.UnixMilli(),
+	}
+
+	// Codes are random, so a handful of tries is plenty to get past any collision
+	for attempt := 0; attempt < 5; attempt++ {
+		invite.Code, err = generateInviteCode()
+		if err != nil {
+			return entities.LeagueInvite{}, err
+		}
+
+		isCreated, err := i.inviteRepo.CreateInvite(context, invite)
+		if err != nil {
+			return entities.LeagueInvite{}, err
+		}
+
+		if isCreated {
+			return i.attachInviteLink(invite), nil
+		}
+	}
+
+	return entities.LeagueInvite{}, utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to generate a unique invite code",
+		Args: []interface{}{
+			"leagueId", leagueId.String(),
+		},
+		Err: nil,
+	})
+}
+
+func (i *InviteService) RevokeInvite(context echo.Context, code string) error {
+	invite, err := i.GetInviteByCode(context, code)
+	if err != nil {
+		return err
+	}
+
+	return i.inviteRepo.DeleteInvite(context, invite.LeagueId, invite.Code)
+}
+
+// RedeemInvite adds the user to the invite's league and gives them the league's
+// starting budget, as long as the invite hasn't expired or run out of uses
+func (i *InviteService) RedeemInvite(context echo.Context, userId uuid.UUID, code string) (entities.League, error) {
+	invite, err := i.GetInviteByCode(context, code)
+	if utils.IsNotFoundError(err) {
+		return entities.League{}, newRedeemInviteError(userId, code, "that invite code doesn't exist or has expired")
+	}
+	if err != nil {
+		return entities.League{}, err
+	}
+
+	if invite.ExpiresAt <= time.Now().UnixMilli() {
+		return entities.League{}, newRedeemInviteError(userId, code, "that invite code has expired")
+	}
+
+	league, err := i.leagueService.GetLeagueByLeagueId(context, invite.LeagueId)
+	if err != nil {
+		return entities.League{}, err
+	}
+
+	// Make sure the user exists before they're given a wallet
+	user, err := i.userService.GetUserByUserId(context, userId)
+	if err != nil {
+		return entities.League{}, err
+	}
+
+	if user.Id != userId {
+		return entities.League{}, newRedeemInviteError(userId, code, "user does not exist")
+	}
+
+	settings, err := i.leagueService.GetLeagueSettings(context, invite.LeagueId)
+	if err != nil {
+		return entities.League{}, err
+	}
+
+	startingWallet := entities.NewWalletTransaction(userId, invite.LeagueId, settings.StartingWallet, 0, entities.WALLET_TRANSACTION_REASON_STARTING_GRANT, uuid.Nil, "")
+
+	// The repo checks membership and claims the use in the same step that adds the user,
+	// so redeeming twice or racing for the last use can't grant the starting wallet twice
+	result, err := i.inviteRepo.RedeemInvite(context, invite, userId, startingWallet)
+	if err != nil {
+		return entities.League{}, err
+	}
+
+	switch result {
+	case invite_repo.INVITE_REDEMPTION_ALREADY_MEMBER:
+		return entities.League{}, newRedeemInviteError(userId, code, fmt.Sprintf("you're already in %v", league.Name))
+	case invite_repo.INVITE_REDEMPTION_USED_UP:
+		return entities.League{}, newRedeemInviteError(userId, code, "that invite code has already been used up")
+	case invite_repo.INVITE_REDEMPTION_MISSING_INVITE:
+		return entities.League{}, newRedeemInviteError(userId, code, "that invite code doesn't exist or has expired")
+	}
+
+	return league, nil
+}
+
+// NormalizeInviteCode lets users type codes in any case and with stray spaces
+func NormalizeInviteCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// attachInviteLink adds the m.me link for the invite when the page username is configured
+func (i *InviteService) attachInviteLink(invite entities.LeagueInvite) entities.LeagueInvite {
+	pageUsername := i.config.GetMessengerConfig().PageUsername
+	if pageUsername != "" {
+		invite.Link = fmt.Sprintf("https://m.me/%v?ref=%v", pageUsername, url.QueryEscape(invite.Code))
+	}
+
+	return invite
+}
+
+func generateInviteCode() (string, error) {
+	code := make([]byte, inviteCodeLength)
+	for index := range code {
+		charIndex, err := rand.Int(rand.Reader, big.NewInt(int64(len(inviteCodeAlphabet))))
+		if err != nil {
+			return "", utils.NewError(utils.ErrorParams{
+				Code:    http.StatusInternalServerError,
+				Message: "failed to generate invite code",
+				Err:     err,
+			})
+		}
+
+		code[index] = inviteCodeAlphabet[charIndex.Int64()]
+	}
+
+	return string(code), nil
+}
+
+func newRedeemInviteError(userId uuid.UUID, code string, message string) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusBadRequest,
+		Message: message,
+		Args: []interface{}{
+			"userId", userId.String(),
+			"code", code,
+		},
+		Err: nil,
+	})
+}
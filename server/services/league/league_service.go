@@ -1,25 +1,43 @@
 package league_service
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/wilbertthelam/prop-ock/entities"
 	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	member_repo "github.com/wilbertthelam/prop-ock/repos/member"
 	"github.com/wilbertthelam/prop-ock/utils"
 )
 
 type LeagueService struct {
-	leagueRepo *league_repo.LeagueRepo
+	leagueRepo         league_repo.LeagueRepo
+	memberRepo         member_repo.MemberRepo
+	memberRemovedHooks []LeagueMemberHook
 }
 
-func New(leagueRepo *league_repo.LeagueRepo) *LeagueService {
+// LeagueMemberHook runs when a user leaves a league
+type LeagueMemberHook func(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error
+
+func New(
+	leagueRepo league_repo.LeagueRepo,
+	memberRepo member_repo.MemberRepo,
+) *LeagueService {
 	return &LeagueService{
 		leagueRepo,
+		memberRepo,
+		nil,
 	}
 }
 
+// AddMemberRemovedHook registers a hook to run once a user has left a league
+func (l *LeagueService) AddMemberRemovedHook(hook LeagueMemberHook) {
+	l.memberRemovedHooks = append(l.memberRemovedHooks, hook)
+}
+
 func (l *LeagueService) GetLeagueByLeagueId(context echo.Context, leagueId uuid.UUID) (entities.League, error) {
 	return l.leagueRepo.GetLeagueByLeagueId(context, leagueId)
 }
@@ -28,6 +46,10 @@ func (l *LeagueService) GetMembersInLeague(context echo.Context, leagueId uuid.U
 	return l.leagueRepo.GetMembersInLeague(context, leagueId)
 }
 
+func (l *LeagueService) GetLeaguesForUser(context echo.Context, userId uuid.UUID) ([]uuid.UUID, error) {
+	return l.leagueRepo.GetLeaguesForUser(context, userId)
+}
+
 func (l *LeagueService) IsUserInLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) (bool, error) {
 	members, err := l.GetMembersInLeague(context, leagueId)
 	if err != nil {
@@ -62,22 +84,318 @@ func (l *LeagueService) AddUserToLeague(context echo.Context, userId uuid.UUID,
 		})
 	}
 
+	// New members start with the lowest waiver priority
 	return l.leagueRepo.AddUserToLeague(context, userId, leagueId)
 }
 
+// GetLeagueSettings returns the rules the league plays by
+func (l *LeagueService) GetLeagueSettings(context echo.Context, leagueId uuid.UUID) (entities.LeagueSettings, error) {
+	err := l.validateLeagueExists(context, leagueId)
+	if err != nil {
+		return entities.LeagueSettings{}, err
+	}
+
+	return l.leagueRepo.GetLeagueSettings(context, leagueId)
+}
+
+// UpdateLeagueSettings replaces the league's settings after checking every rule makes sense
+func (l *LeagueService) UpdateLeagueSettings(context echo.Context, settings entities.LeagueSettings) (entities.LeagueSettings, error) {
+	err := validateLeagueSettings(settings)
+	if err != nil {
+		return entities.LeagueSettings{}, err
+	}
+
+	err = l.validateLeagueExists(context, settings.LeagueId)
+	if err != nil {
+		return entities.LeagueSettings{}, err
+	}
+
+	err = l.leagueRepo.SaveLeagueSettings(context, settings.LeagueId, settings)
+	if err != nil {
+		return entities.LeagueSettings{}, err
+	}
+
+	return settings, nil
+}
+
+func (l *LeagueService) validateLeagueExists(context echo.Context, leagueId uuid.UUID) error {
+	league, err := l.GetLeagueByLeagueId(context, leagueId)
+	if err != nil {
+		return err
+	}
+
+	if league.Id != leagueId {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "league does not exist",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	return nil
+}
+
+func validateLeagueSettings(settings entities.LeagueSettings) error {
+	var message string
+	switch {
+	case settings.StartingWallet < 0:
+		message = "starting wallet cannot be negative"
+	case settings.MinBid < 0:
+		message = "min bid cannot be negative"
+	case settings.BidIncrement < 1:
+		message = "bid increment must be at least 1"
+	case settings.MaxBidsPerAuction < 0:
+		message = "max bids per auction cannot be negative"
+	case settings.RosterSizeCap < 0:
+		message = "roster size cap cannot be negative"
+	case settings.AuctionDuration <= 0:
+		message = "auction duration must be positive"
+	case settings.TieBreakPolicy < entities.TIE_BREAK_POLICY_EARLIEST_BID || settings.TieBreakPolicy > entities.TIE_BREAK_POLICY_RANDOM:
+		message = "invalid tie break policy"
+	case settings.ReleaseRefundPercentage < 0 || settings.ReleaseRefundPercentage > 100:
+		message = "release refund percentage must be between 0 and 100"
+	default:
+		return nil
+	}
+
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusBadRequest,
+		Message: message,
+		Args: []interface{}{
+			"leagueId", settings.LeagueId.String(),
+			"settings", fmt.Sprintf("%+v", settings),
+		},
+		Err: nil,
+	})
+}
+
+// GetLeagueRole returns the user's role in the league. Users without a stored role
+// are members if they're in the league and have an invalid role otherwise.
+func (l *LeagueService) GetLeagueRole(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) (entities.LeagueRole, error) {
+	role, err := l.leagueRepo.GetLeagueRole(context, leagueId, userId)
+	if err != nil {
+		return entities.LEAGUE_ROLE_INVALID, err
+	}
+
+	if role != entities.LEAGUE_ROLE_INVALID {
+		return role, nil
+	}
+
+	isUserInLeague, err := l.leagueRepo.IsUserMemberOfLeague(context, userId, leagueId)
+	if err != nil {
+		return entities.LEAGUE_ROLE_INVALID, err
+	}
+
+	if isUserInLeague {
+		return entities.LEAGUE_ROLE_MEMBER, nil
+	}
+
+	return entities.LEAGUE_ROLE_INVALID, nil
+}
+
+// GetLeagueRoles returns the role of every member, owner and commissioner in the league, highest role first
+func (l *LeagueService) GetLeagueRoles(context echo.Context, leagueId uuid.UUID) ([]entities.LeagueMemberRole, error) {
+	err := l.validateLeagueExists(context, leagueId)
+	if err != nil {
+		return nil, err
+	}
+
+	storedRoles, err := l.leagueRepo.GetLeagueRoles(context, leagueId)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := l.GetMembersInLeague(context, leagueId)
+	if err != nil {
+		return nil, err
+	}
+
+	memberRoles := make([]entities.LeagueMemberRole, 0, len(members)+len(storedRoles))
+	for userId, role := range storedRoles {
+		memberRoles = append(memberRoles, entities.LeagueMemberRole{
+			LeagueId: leagueId,
+			UserId:   userId,
+			Role:     role,
+		})
+	}
+
+	for _, userId := range members {
+		if _, ok := storedRoles[userId]; ok {
+			continue
+		}
+
+		memberRoles = append(memberRoles, entities.LeagueMemberRole{
+			LeagueId: leagueId,
+			UserId:   userId,
+			Role:     entities.LEAGUE_ROLE_MEMBER,
+		})
+	}
+
+	sort.Slice(memberRoles, func(i, j int) bool {
+		if memberRoles[i].Role != memberRoles[j].Role {
+			return memberRoles[i].Role > memberRoles[j].Role
+		}
+
+		return memberRoles[i].UserId.String() < memberRoles[j].UserId.String()
+	})
+
+	return memberRoles, nil
+}
+
+// SetLeagueRole gives a member of the league a new role in it. Making someone the owner
+// turns the current owner into a commissioner, since a league only has one owner.
+func (l *LeagueService) SetLeagueRole(context echo.Context, memberRole entities.LeagueMemberRole) error {
+	if memberRole.UserId == uuid.Nil ||
+		memberRole.Role < entities.LEAGUE_ROLE_MEMBER ||
+		memberRole.Role > entities.LEAGUE_ROLE_OWNER {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "a user and a member, commissioner or owner role are required",
+			Args: []interface{}{
+				"leagueId", memberRole.LeagueId.String(),
+				"userId", memberRole.UserId.String(),
+				"role", fmt.Sprintf("%v", memberRole.Role),
+			},
+			Err: nil,
+		})
+	}
+
+	err := l.validateLeagueExists(context, memberRole.LeagueId)
+	if err != nil {
+		return err
+	}
+
+	// Only members of the league can be given a role in it
+	isUserInLeague, err := l.IsUserInLeague(context, memberRole.UserId, memberRole.LeagueId)
+	if err != nil {
+		return err
+	}
+
+	if !isUserInLeague {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "user is not a member of this league",
+			Args: []interface{}{
+				"leagueId", memberRole.LeagueId.String(),
+				"userId", memberRole.UserId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	currentRole, err := l.leagueRepo.GetLeagueRole(context, memberRole.LeagueId, memberRole.UserId)
+	if err != nil {
+		return err
+	}
+
+	if currentRole == entities.LEAGUE_ROLE_OWNER && memberRole.Role != entities.LEAGUE_ROLE_OWNER {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "the league needs an owner, make someone else the owner first",
+			Args: []interface{}{
+				"leagueId", memberRole.LeagueId.String(),
+				"userId", memberRole.UserId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	// Plain members are worked out from the league's members rather than stored
+	if memberRole.Role == entities.LEAGUE_ROLE_MEMBER {
+		return l.leagueRepo.RemoveLeagueRole(context, memberRole.LeagueId, memberRole.UserId)
+	}
+
+	if memberRole.Role == entities.LEAGUE_ROLE_OWNER {
+		return l.leagueRepo.TransferLeagueOwnership(context, memberRole.LeagueId, memberRole.UserId)
+	}
+
+	return l.leagueRepo.SetLeagueRole(context, memberRole.LeagueId, memberRole.UserId, memberRole.Role)
+}
+
+// GetWaiverPriority returns the league's members ordered from highest to lowest waiver priority
+func (l *LeagueService) GetWaiverPriority(context echo.Context, leagueId uuid.UUID) ([]uuid.UUID, error) {
+	return l.leagueRepo.GetWaiverPriority(context, leagueId)
+}
+
+func (l *LeagueService) MoveUserToBackOfWaiverPriority(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error {
+	return l.leagueRepo.MoveUserToBackOfWaiverPriority(context, leagueId, userId)
+}
+
+// RemoveUserFromLeague takes the user out of the league. Their open bids are canceled and
+// refunded, their roster is released, their wallet for the league is archived and they're
+// removed from the league's members, all in one atomic step.
 func (l *LeagueService) RemoveUserFromLeague(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) error {
+	isUserInLeague, err := l.leagueRepo.IsUserMemberOfLeague(context, userId, leagueId)
+	if err != nil {
+		return err
+	}
+
+	if !isUserInLeague {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "user is not a member of this league",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"leagueId", leagueId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	role, err := l.leagueRepo.GetLeagueRole(context, leagueId, userId)
+	if err != nil {
+		return err
+	}
+
+	if role == entities.LEAGUE_ROLE_OWNER {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "the league owner can't leave the league, make someone else the owner first",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"leagueId", leagueId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	archivedWallet, err := l.memberRepo.RemoveLeagueMember(context, leagueId, userId)
+	if err != nil {
+		return err
+	}
+
+	context.Logger().Infof("archived wallet for user leaving league: userId: %v, leagueId: %v, wallet: %+v", userId, leagueId, archivedWallet)
+
+	// The user is already out of the league, so hook failures are only logged
+	for _, hook := range l.memberRemovedHooks {
+		err = hook(context, leagueId, userId)
+		if err != nil {
+			context.Logger().Errorf("league member removed hook failed: leagueId: %v, userId: %v, err: %v", leagueId, userId, err)
+		}
+	}
+
 	return nil
 }
 
-func (l *LeagueService) CreateLeague(context echo.Context, leagueId uuid.UUID, name string) error {
+// CreateLeague makes a new league with the default settings. The owner is left out
+// when an admin creates the league for someone who'll be given ownership later.
+func (l *LeagueService) CreateLeague(context echo.Context, leagueId uuid.UUID, name string, ownerId uuid.UUID) (entities.League, error) {
+	// Create new league UUID if not provided
+	if leagueId == uuid.Nil {
+		leagueId = uuid.New()
+	}
+
 	// Verify league isn't already created
 	league, err := l.GetLeagueByLeagueId(context, leagueId)
 	if err != nil {
-		return err
+		return entities.League{}, err
 	}
 
 	if league.Id != uuid.Nil {
-		return utils.NewError(utils.ErrorParams{
+		return entities.League{}, utils.NewError(utils.ErrorParams{
 			Code:    http.StatusBadRequest,
 			Message: "league is already created",
 			Args: []interface{}{
@@ -93,5 +411,10 @@ func (l *LeagueService) CreateLeague(context echo.Context, leagueId uuid.UUID, n
 		Name: name,
 	}
 
-	return l.leagueRepo.CreateLeague(context, leagueId, league)
+	err = l.leagueRepo.CreateLeague(context, leagueId, league, entities.NewDefaultLeagueSettings(leagueId), ownerId)
+	if err != nil {
+		return entities.League{}, err
+	}
+
+	return league, nil
 }
@@ -0,0 +1,453 @@
+package message_service
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/constants"
+	"github.com/wilbertthelam/prop-ock/entities"
+	messenger_entities "github.com/wilbertthelam/prop-ock/entities/messenger"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type Command string
+
+const (
+	COMMAND_BID     Command = "bid"
+	COMMAND_CANCEL  Command = "cancel"
+	COMMAND_MY_BIDS Command = "mybids"
+	COMMAND_WALLET  Command = "wallet"
+	COMMAND_PLAYERS Command = "players"
+	COMMAND_JOIN    Command = "join"
+	COMMAND_HELP    Command = "help"
+)
+
+// HandleTextCommand parses a message typed by the user into a command,
+// runs it and replies with the outcome through the Send API
+func (m *MessageService) HandleTextCommand(context echo.Context, userId uuid.UUID, message messenger_entities.WebhookMessage) error {
+	leagueName, commandText := parseLeagueQualifier(message.Text)
+	command, args := parseTextCommand(commandText)
+
+	var reply string
+	var err error
+	switch command {
+	case COMMAND_BID:
+		reply, err = m.handleBidCommand(context, userId, leagueName, args)
+	case COMMAND_CANCEL:
+		reply, err = m.handleCancelCommand(context, userId, leagueName, args)
+	case COMMAND_MY_BIDS:
+		reply, err = m.handleMyBidsCommand(context, userId, leagueName)
+	case COMMAND_WALLET:
+		reply, err = m.handleWalletCommand(context, userId)
+	case COMMAND_PLAYERS:
+		reply, err = m.handlePlayersCommand(context, userId, leagueName)
+	case COMMAND_JOIN:
+		reply, err = m.handleJoinCommand(context, userId, args)
+	default:
+		reply, err = m.handleUnknownCommand(context, userId, message.Text)
+	}
+
+	return m.replyToUser(context, userId, reply, err)
+}
+
+// JoinLeagueWithInviteCode redeems the invite for the user and lets them know how it went
+func (m *MessageService) JoinLeagueWithInviteCode(context echo.Context, userId uuid.UUID, code string) error {
+	reply, err := m.joinLeague(context, userId, code)
+	return m.replyToUser(context, userId, reply, err)
+}
+
+// replyToUser sends the reply, or explains what went wrong when the error was caused by bad input.
+// Anything else is on us and gets returned instead.
+func (m *MessageService) replyToUser(context echo.Context, userId uuid.UUID, reply string, err error) error {
+	if err != nil {
+		userErr, ok := err.(*utils.Error)
+		if !ok || userErr.Code >= http.StatusInternalServerError {
+			return err
+		}
+
+		reply = fmt.Sprintf("Sorry, %v.", userErr.Message)
+	}
+
+	return m.SendTextToUser(context, userId, reply)
+}
+
+// SendTextToUser sends a plain text message to the user on Messenger
+func (m *MessageService) SendTextToUser(context echo.Context, userId uuid.UUID, text string) error {
+	event, err := m.AttachSenderToEvent(context, userId, messenger_entities.SendEvent{
+		Message: messenger_entities.SendMessage{
+			Text: text,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	errMap := m.SendEvents(context, []messenger_entities.SendEvent{event})
+	if len(errMap) > 0 {
+		return newSendEventsError("failed to send text message to user on messenger", errMap)
+	}
+
+	return nil
+}
+
+// parseLeagueQualifier splits off the league a command is for, written in front of it
+// like "My League: mybids". Commands without one go to the only running auction.
+func parseLeagueQualifier(text string) (string, string) {
+	index := strings.Index(text, ":")
+	if index < 0 {
+		return "", text
+	}
+
+	return strings.TrimSpace(text[:index]), text[index+1:]
+}
+
+// parseTextCommand splits a message into its command and the rest of its words
+func parseTextCommand(text string) (Command, []string) {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return COMMAND_HELP, nil
+	}
+
+	return Command(strings.ToLower(words[0])), words[1:]
+}
+
+// "bid <player> <amount>", where the player can be their id or any part of their name
+func (m *MessageService) handleBidCommand(context echo.Context, userId uuid.UUID, leagueName string, args []string) (string, error) {
+	if len(args) < 2 {
+		return "", newCommandError("a bid looks like \"bid <player> <amount>\"", args)
+	}
+
+	bid, err := strconv.ParseInt(strings.TrimPrefix(args[len(args)-1], "$"), 10, 64)
+	if err != nil {
+		return "", newCommandError(fmt.Sprintf("\"%v\" is not a bid amount", args[len(args)-1]), args)
+	}
+
+	auction, err := m.getActiveAuctionForUser(context, userId, leagueName)
+	if err != nil {
+		return "", err
+	}
+
+	player, err := m.findPlayerInAuction(context, auction, strings.Join(args[:len(args)-1], " "))
+	if err != nil {
+		return "", err
+	}
+
+	err = m.auctionService.MakeBid(context, auction.Id, userId, player.Id, bid)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Bid placed: $%v on %v.", bid, player.Name), nil
+}
+
+// "cancel <player>" takes back the user's bid and releases the funds held for it
+func (m *MessageService) handleCancelCommand(context echo.Context, userId uuid.UUID, leagueName string, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", newCommandError("a cancel looks like \"cancel <player>\"", args)
+	}
+
+	auction, err := m.getActiveAuctionForUser(context, userId, leagueName)
+	if err != nil {
+		return "", err
+	}
+
+	player, err := m.findPlayerInAuction(context, auction, strings.Join(args, " "))
+	if err != nil {
+		return "", err
+	}
+
+	err = m.auctionService.CancelBid(context, auction.Id, userId, player.Id)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Bid on %v cancelled, the funds held for it are available again.", player.Name), nil
+}
+
+// "mybids" lists the user's bids, by player id for any player missing from the catalog
+func (m *MessageService) handleMyBidsCommand(context echo.Context, userId uuid.UUID, leagueName string) (string, error) {
+	auction, err := m.getActiveAuctionForUser(context, userId, leagueName)
+	if err != nil {
+		return "", err
+	}
+
+	bids, err := m.auctionService.GetAllUserBids(context, auction.Id, userId)
+	if err != nil {
+		return "", err
+	}
+
+	if len(bids) == 0 {
+		return "You haven't made any bids in this auction yet.", nil
+	}
+
+	playerIds := make([]string, 0, len(bids))
+	for playerId := range bids {
+		playerIds = append(playerIds, playerId)
+	}
+
+	players, err := m.playerService.GetPlayersByPlayerIds(context, playerIds)
+	if err != nil {
+		return "", err
+	}
+
+	playerNames := make(map[string]string)
+	for _, player := range players {
+		playerNames[player.Id] = player.Name
+	}
+
+	bidLines := make([]string, 0, len(playerIds))
+	for _, playerId := range playerIds {
+		playerName, ok := playerNames[playerId]
+		if !ok {
+			playerName = playerId
+		}
+
+		bidLines = append(bidLines, fmt.Sprintf("%v: $%v", playerName, bids[playerId]))
+	}
+
+	sort.Strings(bidLines)
+
+	return "Your bids:\n" + strings.Join(bidLines, "\n"), nil
+}
+
+func (m *MessageService) handleWalletCommand(context echo.Context, userId uuid.UUID) (string, error) {
+	wallet, err := m.userService.GetUserWallet(context, userId)
+	if err != nil {
+		return "", err
+	}
+
+	if len(wallet) == 0 {
+		return "You aren't in any leagues yet.", nil
+	}
+
+	lines := make([]string, 0, len(wallet))
+	for leagueId, leagueWallet := range wallet {
+		league, err := m.leagueService.GetLeagueByLeagueId(context, leagueId)
+		if err != nil {
+			return "", err
+		}
+
+		lines = append(lines, fmt.Sprintf("%v: $%v available, $%v held in bids", league.Name, leagueWallet.Available, leagueWallet.Held))
+	}
+
+	sort.Strings(lines)
+
+	return "Your wallet:\n" + strings.Join(lines, "\n"), nil
+}
+
+func (m *MessageService) handlePlayersCommand(context echo.Context, userId uuid.UUID, leagueName string) (string, error) {
+	auction, err := m.getActiveAuctionForUser(context, userId, leagueName)
+	if err != nil {
+		return "", err
+	}
+
+	players, err := m.getPlayersInAuction(context, auction)
+	if err != nil {
+		return "", err
+	}
+
+	if len(players) == 0 {
+		return "There are no players up for auction.", nil
+	}
+
+	lines := []string{"Players up for auction:"}
+	for _, player := range players {
+		lines = append(lines, fmt.Sprintf("%v | %v | %v", player.Name, player.Team, player.Position))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// "join <code>" adds the user to the league the invite code was made for
+func (m *MessageService) handleJoinCommand(context echo.Context, userId uuid.UUID, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", newCommandError("a join looks like \"join <invite code>\"", args)
+	}
+
+	return m.joinLeague(context, userId, args[0])
+}
+
+// handleUnknownCommand lets new users send just their invite code, anything else gets the help text
+func (m *MessageService) handleUnknownCommand(context echo.Context, userId uuid.UUID, text string) (string, error) {
+	words := strings.Fields(text)
+	if len(words) != 1 {
+		return constants.COMMAND_HELP_TEXT, nil
+	}
+
+	_, err := m.inviteService.GetInviteByCode(context, words[0])
+	if utils.IsNotFoundError(err) {
+		return constants.COMMAND_HELP_TEXT, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return m.joinLeague(context, userId, words[0])
+}
+
+func (m *MessageService) joinLeague(context echo.Context, userId uuid.UUID, code string) (string, error) {
+	league, err := m.inviteService.RedeemInvite(context, userId, code)
+	if err != nil {
+		return "", err
+	}
+
+	settings, err := m.leagueService.GetLeagueSettings(context, league.Id)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Welcome to %v! You've got $%v to bid with. Send \"help\" to see what you can do.", league.Name, settings.StartingWallet), nil
+}
+
+// getActiveAuctionForUser finds the running auction in the user's leagues, only looking at
+// the named league when there is one. When auctions are running in more than one league,
+// the user is told which so they can name the league the command is for.
+func (m *MessageService) getActiveAuctionForUser(context echo.Context, userId uuid.UUID, leagueName string) (entities.Auction, error) {
+	leagueIds, err := m.leagueService.GetLeaguesForUser(context, userId)
+	if err != nil {
+		return entities.Auction{}, err
+	}
+
+	activeAuctions := make([]entities.Auction, 0)
+	activeLeagueNames := make([]string, 0)
+	for _, leagueId := range leagueIds {
+		auctionId, err := m.auctionService.GetCurrentAuctionIdByLeagueId(context, leagueId)
+		if utils.IsNotFoundError(err) {
+			continue
+		}
+		if err != nil {
+			return entities.Auction{}, err
+		}
+
+		auction, err := m.auctionService.GetAuctionByAuctionId(context, auctionId)
+		if err != nil {
+			return entities.Auction{}, err
+		}
+
+		if auction.Status != entities.AUCTION_STATUS_ACTIVE {
+			continue
+		}
+
+		league, err := m.leagueService.GetLeagueByLeagueId(context, leagueId)
+		if err != nil {
+			return entities.Auction{}, err
+		}
+
+		if leagueName != "" && !strings.EqualFold(league.Name, leagueName) {
+			continue
+		}
+
+		activeAuctions = append(activeAuctions, auction)
+		activeLeagueNames = append(activeLeagueNames, league.Name)
+	}
+
+	if len(activeAuctions) == 1 {
+		return activeAuctions[0], nil
+	}
+
+	if len(activeAuctions) == 0 {
+		message := "there's no auction running right now"
+		if leagueName != "" {
+			message = fmt.Sprintf("there's no auction running in %v right now", leagueName)
+		}
+
+		return entities.Auction{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: message,
+			Args: []interface{}{
+				"userId", userId.String(),
+				"leagueName", leagueName,
+			},
+			Err: nil,
+		})
+	}
+
+	sort.Strings(activeLeagueNames)
+
+	return entities.Auction{}, utils.NewError(utils.ErrorParams{
+		Code: http.StatusBadRequest,
+		Message: fmt.Sprintf(
+			"auctions are running in %v, start your message with the league it's for, like \"%v: mybids\"",
+			strings.Join(activeLeagueNames, ", "),
+			activeLeagueNames[0],
+		),
+		Args: []interface{}{
+			"userId", userId.String(),
+			"leagueName", leagueName,
+		},
+		Err: nil,
+	})
+}
+
+// getPlayersInAuction returns the players up for bidding sorted by name
+func (m *MessageService) getPlayersInAuction(context echo.Context, auction entities.Auction) ([]entities.Player, error) {
+	playerSet, err := m.playerSetService.GetPlayerSetByPlayerSetId(context, auction.PlayerSetId)
+	if err != nil {
+		return nil, err
+	}
+
+	players, err := m.playerService.GetPlayersByPlayerIds(context, playerSet.PlayerIds)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Name < players[j].Name
+	})
+
+	return players, nil
+}
+
+// findPlayerInAuction matches what the user typed against the players up for
+// bidding. An exact id or name wins, otherwise it has to match only one name.
+func (m *MessageService) findPlayerInAuction(context echo.Context, auction entities.Auction, query string) (entities.Player, error) {
+	players, err := m.getPlayersInAuction(context, auction)
+	if err != nil {
+		return entities.Player{}, err
+	}
+
+	matchingPlayers := make([]entities.Player, 0)
+	for _, player := range players {
+		if player.Id == query || strings.EqualFold(player.Name, query) {
+			return player, nil
+		}
+
+		if strings.Contains(strings.ToLower(player.Name), strings.ToLower(query)) {
+			matchingPlayers = append(matchingPlayers, player)
+		}
+	}
+
+	if len(matchingPlayers) == 1 {
+		return matchingPlayers[0], nil
+	}
+
+	if len(matchingPlayers) == 0 {
+		return entities.Player{}, newCommandError(fmt.Sprintf("no player up for auction matches \"%v\"", query), []string{query})
+	}
+
+	names := make([]string, len(matchingPlayers))
+	for index, player := range matchingPlayers {
+		names[index] = player.Name
+	}
+
+	return entities.Player{}, newCommandError(
+		fmt.Sprintf("\"%v\" matches more than one player: %v", query, strings.Join(names, ", ")),
+		[]string{query},
+	)
+}
+
+func newCommandError(message string, args []string) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusBadRequest,
+		Message: message,
+		Args: []interface{}{
+			"args", strings.Join(args, " "),
+		},
+		Err: nil,
+	})
+}
@@ -0,0 +1,26 @@
+package message_service
+
+import (
+	"testing"
+)
+
+func TestParseLeagueQualifier(t *testing.T) {
+	for _, testCase := range []struct {
+		text                string
+		expectedLeagueName  string
+		expectedCommandText string
+	}{
+		{"mybids", "", "mybids"},
+		{"bid Shohei Ohtani 40", "", "bid Shohei Ohtani 40"},
+		{"My League: mybids", "My League", " mybids"},
+		{" Dynasty :bid Ohtani 40", "Dynasty", "bid Ohtani 40"},
+	} {
+		leagueName, commandText := parseLeagueQualifier(testCase.text)
+		if leagueName != testCase.expectedLeagueName || commandText != testCase.expectedCommandText {
+			t.Errorf(
+				"parsed %q into league %q and command %q, expected %q and %q",
+				testCase.text, leagueName, commandText, testCase.expectedLeagueName, testCase.expectedCommandText,
+			)
+		}
+	}
+}
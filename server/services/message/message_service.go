@@ -1,72 +1,239 @@
 package message_service
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
-	"strings"
-	"sync"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/wilbertthelam/prop-ock/constants"
 	"github.com/wilbertthelam/prop-ock/entities"
 	messenger_entities "github.com/wilbertthelam/prop-ock/entities/messenger"
+	message_repo "github.com/wilbertthelam/prop-ock/repos/message"
 	auction_service "github.com/wilbertthelam/prop-ock/services/auction"
+	auth_service "github.com/wilbertthelam/prop-ock/services/auth"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+	invite_service "github.com/wilbertthelam/prop-ock/services/invite"
 	league_service "github.com/wilbertthelam/prop-ock/services/league"
 	player_service "github.com/wilbertthelam/prop-ock/services/player"
+	player_set_service "github.com/wilbertthelam/prop-ock/services/player_set"
 	user_service "github.com/wilbertthelam/prop-ock/services/user"
+	"github.com/wilbertthelam/prop-ock/utils"
 )
 
 type MessageService struct {
-	auctionService *auction_service.AuctionService
-	userService    *user_service.UserService
-	playerService  *player_service.PlayerService
-	leagueService  *league_service.LeagueService
-	state          *State
+	messageRepo      message_repo.MessageRepo
+	auctionService   *auction_service.AuctionService
+	userService      *user_service.UserService
+	playerService    *player_service.PlayerService
+	playerSetService *player_set_service.PlayerSetService
+	leagueService    *league_service.LeagueService
+	inviteService    *invite_service.InviteService
+	authService      *auth_service.AuthService
+	config           *config_service.Config
 }
 
-type State struct {
-	state map[uuid.UUID]entities.MessageState
-	mutex sync.Mutex
+func New(
+	messageRepo message_repo.MessageRepo,
+	auctionService *auction_service.AuctionService,
+	userService *user_service.UserService,
+	playerService *player_service.PlayerService,
+	playerSetService *player_set_service.PlayerSetService,
+	leagueService *league_service.LeagueService,
+	inviteService *invite_service.InviteService,
+	authService *auth_service.AuthService,
+	config *config_service.Config,
+) *MessageService {
+	messageService := &MessageService{
+		messageRepo,
+		auctionService,
+		userService,
+		playerService,
+		playerSetService,
+		leagueService,
+		inviteService,
+		authService,
+		config,
+	}
+
+	// Move users through the conversation as auctions open, close and take bids
+	auctionService.AddStatusChangeHook(messageService.handleAuctionStatusChange)
+	auctionService.AddBidHook(messageService.handleAuctionBid)
+	leagueService.AddMemberRemovedHook(messageService.handleLeagueMemberRemoved)
+
+	return messageService
+}
+
+// GetMessageState returns where the user currently is in the conversation
+func (m *MessageService) GetMessageState(context echo.Context, userId uuid.UUID) (entities.MessageState, error) {
+	return m.messageRepo.GetMessageState(context, userId)
 }
 
-func NewState() *State {
-	return &State{
-		state: make(map[uuid.UUID]entities.MessageState),
+// TransitionMessageState moves the user to a new state, as long as it can be reached
+// from the state they're in. Every transition refreshes how long the state lives for.
+func (m *MessageService) TransitionMessageState(context echo.Context, userId uuid.UUID, newState entities.MessageState) error {
+	currentState, err := m.GetMessageState(context, userId)
+	if err != nil {
+		return err
 	}
+
+	isValidTransition := false
+	for _, nextState := range entities.MESSAGE_STATE_TRANSITIONS[currentState] {
+		if nextState == newState {
+			isValidTransition = true
+			break
+		}
+	}
+
+	if !isValidTransition {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "invalid message state transition",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"currentState", fmt.Sprintf("%v", currentState),
+				"newState", fmt.Sprintf("%v", newState),
+			},
+			Err: nil,
+		})
+	}
+
+	return m.messageRepo.SetMessageState(context, userId, newState, constants.MESSAGE_STATE_TTL)
 }
 
-func (s *State) Set(userId uuid.UUID, newState entities.MessageState) {
-	// Lock before setting since this map is shared among all users
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// ClaimWebhookEvent returns true the first time it sees an event and false for any retries of it
+func (m *MessageService) ClaimWebhookEvent(context echo.Context, eventId string) (bool, error) {
+	return m.messageRepo.ClaimWebhookEvent(context, eventId, constants.WEBHOOK_EVENT_DEDUPE_TTL)
+}
 
-	s.state[userId] = newState
+// ReleaseWebhookEvent lets an event that failed to process be retried
+func (m *MessageService) ReleaseWebhookEvent(context echo.Context, eventId string) error {
+	return m.messageRepo.ReleaseWebhookEvent(context, eventId)
 }
 
-func (s *State) Get(userId uuid.UUID) entities.MessageState {
-	return s.state[userId]
+// handleLeagueMemberRemoved lets the user know they're out of the league and what happened to their bids and players
+func (m *MessageService) handleLeagueMemberRemoved(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) error {
+	league, err := m.leagueService.GetLeagueByLeagueId(context, leagueId)
+	if err != nil {
+		return err
+	}
+
+	return m.SendTextToUser(
+		context,
+		userId,
+		fmt.Sprintf("You've left %v. Your open bids were cancelled and refunded, and your players are back in the pool.", league.Name),
+	)
 }
 
-func New(
-	auctionService *auction_service.AuctionService,
-	userService *user_service.UserService,
-	playerService *player_service.PlayerService,
-	leagueService *league_service.LeagueService,
-) *MessageService {
-	state := NewState()
+// handleAuctionStatusChange moves every member of the auction's league into the
+// state matching the auction. Created and closed auctions don't move anyone.
+// Message state is kept per user rather than per league, so members with an auction
+// still running in another of their leagues stay where they are. Members whose state
+// can't move are logged and skipped.
+func (m *MessageService) handleAuctionStatusChange(context echo.Context, auction entities.Auction) error {
+	var newState entities.MessageState
+	switch auction.Status {
+	case entities.AUCTION_STATUS_ACTIVE:
+		newState = entities.STATE_AUCTION_OPENED
+	case entities.AUCTION_STATUS_STOPPED:
+		newState = entities.STATE_BIDDING_FINISHED
+	default:
+		return nil
+	}
 
-	return &MessageService{
-		auctionService,
-		userService,
-		playerService,
-		leagueService,
-		state,
+	userIds, err := m.leagueService.GetMembersInLeague(context, auction.LeagueId)
+	if err != nil {
+		return err
+	}
+
+	// One member's state failing to move shouldn't stop the rest of the league from moving
+	for _, userId := range userIds {
+		inOtherAuction, err := m.isInOtherActiveAuction(context, userId, auction)
+		if err != nil {
+			context.Logger().Errorf("skipped message state change for auction: auctionId: %v, userId: %v, newState: %v, err: %v", auction.Id, userId, newState, err)
+			continue
+		}
+
+		if inOtherAuction {
+			continue
+		}
+
+		err = m.TransitionMessageState(context, userId, newState)
+		if err != nil {
+			context.Logger().Errorf("skipped message state change for auction: auctionId: %v, userId: %v, newState: %v, err: %v", auction.Id, userId, newState, err)
+		}
+	}
+
+	return nil
+}
+
+// isInOtherActiveAuction checks if any of the user's other leagues has an auction running
+func (m *MessageService) isInOtherActiveAuction(context echo.Context, userId uuid.UUID, auction entities.Auction) (bool, error) {
+	leagueIds, err := m.leagueService.GetLeaguesForUser(context, userId)
+	if err != nil {
+		return false, err
+	}
+
+	for _, leagueId := range leagueIds {
+		if leagueId == auction.LeagueId {
+			continue
+		}
+
+		auctionId, err := m.auctionService.GetCurrentAuctionIdByLeagueId(context, leagueId)
+		if utils.IsNotFoundError(err) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		otherAuction, err := m.auctionService.GetAuctionByAuctionId(context, auctionId)
+		if err != nil {
+			return false, err
+		}
+
+		if otherAuction.Status == entities.AUCTION_STATUS_ACTIVE {
+			return true, nil
+		}
 	}
+
+	return false, nil
+}
+
+// handleAuctionBid moves the user into bidding once they place a bid from anywhere
+func (m *MessageService) handleAuctionBid(context echo.Context, auction entities.Auction, userId uuid.UUID) error {
+	state, err := m.GetMessageState(context, userId)
+	if err != nil {
+		return err
+	}
+
+	// Users whose state expired while the auction was open catch back up first
+	if state == entities.STATE_INVALID {
+		err = m.TransitionMessageState(context, userId, entities.STATE_AUCTION_OPENED)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.TransitionMessageState(context, userId, entities.STATE_BIDDING)
 }
 
 func (m *MessageService) SendAction(context echo.Context, action entities.Action, userId uuid.UUID, event interface{}) error {
-	switch m.state.Get(userId) {
+	// Text commands work no matter where the user is in the auction
+	if action == entities.ACTION_SEND_MESSAGE {
+		return m.HandleTextCommand(context, userId, event.(messenger_entities.WebhookMessage))
+	}
+
+	state, err := m.GetMessageState(context, userId)
+	if err != nil {
+		return err
+	}
+
+	switch state {
 	case entities.STATE_AUCTION_OPENED:
 		break
 	case entities.STATE_BIDDING:
@@ -86,15 +253,6 @@ func (m *MessageService) SendAction(context echo.Context, action entities.Action
 
 func (m *MessageService) handleBiddingState(context echo.Context, action entities.Action, userId uuid.UUID, event interface{}) error {
 	switch action {
-	case entities.ACTION_SEND_MESSAGE:
-		message := event.(messenger_entities.WebhookMessage)
-
-		// If the user is sending a bid, parse it for the bid value
-		if strings.HasPrefix(message.Text, "bid") {
-
-		}
-
-		break
 	case entities.ACTION_SEND_POSTBACK:
 
 		break
@@ -110,23 +268,31 @@ func (m *MessageService) handleBiddingState(context echo.Context, action entitie
 	return nil
 }
 
-func (m *MessageService) CreateWinningBidForPlayerEvent(context echo.Context, winningBid entities.AuctionBid) (messenger_entities.SendEvent, error) {
+func (m *MessageService) CreateWinningBidForPlayerEvent(context echo.Context, auctionResult entities.AuctionResult) (messenger_entities.SendEvent, error) {
+	winningBid := auctionResult.WinningBid
+
 	player, err := m.playerService.GetPlayerByPlayerId(context, winningBid.PlayerId)
 	if err != nil {
 		return messenger_entities.SendEvent{}, err
 	}
 
+	// Let the winner know how much they get back when they paid less than they bid
+	subtitle := fmt.Sprintf("%v | %v | %v \n%v", player.Name, player.Team, player.Position, constants.CLAIM_INSTRUCTIONS)
+	if auctionResult.Price < winningBid.Bid {
+		subtitle = fmt.Sprintf("%v | %v | %v \nYou bid $%v, $%v was refunded \n%v", player.Name, player.Team, player.Position, winningBid.Bid, winningBid.Bid-auctionResult.Price, constants.CLAIM_INSTRUCTIONS)
+	}
+
 	return messenger_entities.SendEvent{
 		Message: messenger_entities.SendMessage{
-			Attachment: messenger_entities.Template{
+			Attachment: &messenger_entities.Template{
 				Type: "template",
 				Payload: messenger_entities.TemplatePayload{
 					TemplateType: "generic",
 					Elements: []messenger_entities.TemplateElements{
 						{
-							Title:    fmt.Sprintf("%v $%v!", constants.WINNING_BID_TITLE, winningBid.Bid),
+							Title:    fmt.Sprintf("%v $%v!", constants.WINNING_BID_TITLE, auctionResult.Price),
 							ImageUrl: player.Image,
-							Subtitle: fmt.Sprintf("%v | %v | %v \n%v", player.Name, player.Team, player.Position, constants.CLAIM_INSTRUCTIONS),
+							Subtitle: subtitle,
 						},
 					},
 				},
@@ -135,6 +301,62 @@ func (m *MessageService) CreateWinningBidForPlayerEvent(context echo.Context, wi
 	}, nil
 }
 
+// SendWinningBidsForAuction lets every winner of a processed auction know what they won
+func (m *MessageService) SendWinningBidsForAuction(context echo.Context, auctionId uuid.UUID) error {
+	auctionResults, err := m.auctionService.GetAuctionResults(context, auctionId)
+	if err != nil {
+		return err
+	}
+
+	// For each winning bid, create a success response for it
+	playerEvents := make([]messenger_entities.SendEvent, 0)
+	for _, auctionResult := range auctionResults {
+		winningBid := auctionResult.WinningBid
+
+		playerEvent, err := m.CreateWinningBidForPlayerEvent(context, auctionResult)
+		if err != nil {
+			return err
+		}
+
+		playerEvent, err = m.AttachSenderToEvent(context, winningBid.UserId, playerEvent)
+		if err != nil {
+			return err
+		}
+
+		playerEvent = m.AttachConnectionTagToEvent(context, playerEvent)
+
+		playerEvents = append(playerEvents, playerEvent)
+	}
+
+	// Once all events are generated, send them out
+	errMap := m.SendEvents(context, playerEvents)
+	if len(errMap) > 0 {
+		return newSendEventsError("failed to send winning bid events to users on messenger", errMap)
+	}
+
+	return nil
+}
+
+// SendPlayersForBiddingForAuction sends every league member the players up for bidding
+func (m *MessageService) SendPlayersForBiddingForAuction(context echo.Context, auctionId uuid.UUID) error {
+	sendEvents, err := m.CreateBidsForAuction(context, auctionId)
+	if err != nil {
+		return err
+	}
+
+	for index, sendEvent := range sendEvents {
+		sendEvents[index] = m.AttachConnectionTagToEvent(context, sendEvent)
+	}
+
+	// Once all events are generated, send them out
+	errMap := m.SendEvents(context, sendEvents)
+	if len(errMap) > 0 {
+		return newSendEventsError("failed to send auction bid events to users on messenger", errMap)
+	}
+
+	return nil
+}
+
 func (m *MessageService) CreateBidsForAuction(context echo.Context, auctionId uuid.UUID) ([]messenger_entities.SendEvent, error) {
 	auction, err := m.auctionService.GetAuctionByAuctionId(context, auctionId)
 	if err != nil {
@@ -159,15 +381,15 @@ func (m *MessageService) CreateBidsForAuction(context echo.Context, auctionId uu
 	}
 
 	// Get all playerIds from the auction's player set
-	// TODO: create player set endpoint
-	playerIds := []string{
-		"44-julio-rodriguez",
-		"7-jarred-kelenic",
-		"13-bobby-witt",
+	playerSet, err := m.playerSetService.GetPlayerSetByPlayerSetId(context, auction.PlayerSetId)
+	if err != nil {
+		return nil, err
 	}
 
+	playerIds := playerSet.PlayerIds
+
 	// Create player bid template item for each player
-	playerBidTemplateElementsMap, err := m.CreatePlayerBidTemplateElementsMap(context, playerIds, senderPsIds, auctionId)
+	playerBidTemplateElementsMap, err := m.CreatePlayerBidTemplateElementsMap(context, playerIds, userIds, senderPsIds, auctionId)
 	if err != nil {
 		return nil, err
 	}
@@ -183,7 +405,7 @@ func (m *MessageService) CreatePlayerBidEvents(context echo.Context, senderPsIds
 				Id: senderPsId,
 			},
 			Message: messenger_entities.SendMessage{
-				Attachment: messenger_entities.Template{
+				Attachment: &messenger_entities.Template{
 					Type: "template",
 					Payload: messenger_entities.TemplatePayload{
 						TemplateType: "generic",
@@ -199,13 +421,15 @@ func (m *MessageService) CreatePlayerBidEvents(context echo.Context, senderPsIds
 	return events, nil
 }
 
-func (m *MessageService) CreatePlayerBidTemplateElementsMap(context echo.Context, playerIds []string, senderPsIds []string, auctionId uuid.UUID) (map[string][]messenger_entities.TemplateElements, error) {
+// CreatePlayerBidTemplateElementsMap builds each user's bid cards keyed on their senderPsId. The userIds
+// line up with the senderPsIds, and every bid link carries a token signed for that user and player.
+func (m *MessageService) CreatePlayerBidTemplateElementsMap(context echo.Context, playerIds []string, userIds []uuid.UUID, senderPsIds []string, auctionId uuid.UUID) (map[string][]messenger_entities.TemplateElements, error) {
 	senderPsIdsTemplateElementMap := make(map[string][]messenger_entities.TemplateElements)
 
 	// For performance reasons, keep a map of the players we already retrieved
 	playerMap := make(map[string]*entities.Player)
 
-	for _, senderPsId := range senderPsIds {
+	for senderIndex, senderPsId := range senderPsIds {
 		templateElements := make([]messenger_entities.TemplateElements, len(playerIds))
 
 		for index, playerId := range playerIds {
@@ -219,12 +443,21 @@ func (m *MessageService) CreatePlayerBidTemplateElementsMap(context echo.Context
 					return nil, err
 				}
 				player = &result
+				playerMap[playerId] = player
 			}
 
+			token, err := m.authService.IssueWebviewToken(userIds[senderIndex], auctionId, playerId)
+			if err != nil {
+				return nil, err
+			}
+
+			// The webview reads the player to show from player_id, but bids only trust the token.
+			// The token goes in the fragment, which browsers never send, so it stays out of request logs.
 			params := url.Values{}
-			params.Add("auction_id", auctionId.String())
 			params.Add("player_id", playerId)
-			params.Add("sender_ps_id", senderPsId)
+
+			fragment := url.Values{}
+			fragment.Add("token", token)
 
 			templateElement := messenger_entities.TemplateElements{
 				Title:    player.Name,
@@ -233,7 +466,7 @@ func (m *MessageService) CreatePlayerBidTemplateElementsMap(context echo.Context
 				Buttons: []messenger_entities.TemplateDefaultAction{
 					{
 						Type:               "web_url",
-						Url:                "https://3638-50-35-81-67.ngrok.io/webview/bid/?" + params.Encode(),
+						Url:                m.config.GetHostUrl() + "/webview/bid/?" + params.Encode() + "#" + fragment.Encode(),
 						WebviewHeightRatio: "compact",
 						Title:              "Place bid",
 					},
@@ -253,3 +486,93 @@ func (m *MessageService) CreatePlayerBidTemplateElementsMap(context echo.Context
 
 	return senderPsIdsTemplateElementMap, nil
 }
+
+func (m *MessageService) AttachConnectionTagToEvent(context echo.Context, event messenger_entities.SendEvent) messenger_entities.SendEvent {
+	// Attached required tags to the event to make sure that we can keep
+	// sending the user messages after 24 hours
+	event.Tag = constants.CONFIRM_TAG_UPDATE
+	return event
+}
+
+func (m *MessageService) AttachSenderToEvent(context echo.Context, userId uuid.UUID, event messenger_entities.SendEvent) (messenger_entities.SendEvent, error) {
+	senderPsId, err := m.userService.GetSenderPsIdFromUserId(context, userId)
+	if err != nil {
+		return messenger_entities.SendEvent{}, err
+	}
+
+	// Attach intended sender the event should be directed towards
+	event.Recipient = messenger_entities.Id{
+		Id: senderPsId,
+	}
+
+	return event, nil
+}
+
+// SendEvents posts each event to the Messenger Send API and returns
+// any failures keyed on the recipient's senderPsId
+func (m *MessageService) SendEvents(context echo.Context, sendEvents []messenger_entities.SendEvent) map[string]error {
+	postURL := fmt.Sprintf("https://graph.facebook.com/v12.0/me/messages?access_token=%v", m.config.GetMessengerConfig().AccessToken)
+
+	errors := make(map[string]error)
+	for _, sendEvent := range sendEvents {
+		sendEventJSON, _ := json.Marshal(sendEvent)
+
+		rawResp, httpErr := http.Post(postURL, "application/json", bytes.NewBuffer(sendEventJSON))
+		context.Logger().Infof("response: %+v, error: %+v", rawResp, httpErr)
+
+		if httpErr != nil {
+			newHttpErr := utils.NewError(utils.ErrorParams{
+				Code:    http.StatusBadRequest,
+				Message: "failed to post send event request",
+				Args: []interface{}{
+					"sendEventJson", string(sendEventJSON),
+				},
+				Err: httpErr,
+			})
+			errors[sendEvent.Recipient.Id] = newHttpErr
+			continue
+		}
+
+		var resp messenger_entities.SendEventResponse
+		decodeErr := json.NewDecoder(rawResp.Body).Decode(&resp)
+		rawResp.Body.Close()
+		if decodeErr != nil {
+			newDecodeErr := utils.NewError(utils.ErrorParams{
+				Code:    http.StatusBadRequest,
+				Message: "failed to decode send event request",
+				Err:     decodeErr,
+			})
+			errors[sendEvent.Recipient.Id] = newDecodeErr
+			continue
+		}
+
+		// If the Messenger SendAPI returns an error, give us a heads up
+		if resp.Error.Code > 0 {
+			respErr := utils.NewError(utils.ErrorParams{
+				Code:    http.StatusBadRequest,
+				Message: "failed to post send event request",
+				Args: []interface{}{
+					"error", resp.Error,
+				},
+			})
+			errors[sendEvent.Recipient.Id] = respErr
+			continue
+		}
+	}
+
+	return errors
+}
+
+func newSendEventsError(message string, errMap map[string]error) error {
+	errList := make([]interface{}, 0, len(errMap)*2)
+	for senderPsId, err := range errMap {
+		errList = append(errList, senderPsId, err.Error())
+	}
+
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: message,
+		Args:    errList,
+		Err:     errors.New("error list"),
+	})
+}
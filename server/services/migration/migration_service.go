@@ -0,0 +1,272 @@
+package migration_service
+
+import (
+	goContext "context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	"github.com/wilbertthelam/prop-ock/entities"
+	archive_repo "github.com/wilbertthelam/prop-ock/repos/archive"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// MigrationService keeps the Redis key schema up to date, and moves data out of
+// Redis and into the SQL database, either directly or through a JSON archive on disk
+type MigrationService struct {
+	config      *config_service.Config
+	redisClient *redis.Client
+}
+
+func New(
+	config *config_service.Config,
+	redisClient *redis.Client,
+) *MigrationService {
+	return &MigrationService{
+		config,
+		redisClient,
+	}
+}
+
+// RunStartupMigrations brings the Redis key schema up to date when the server
+// runs on Redis. The other backends keep their schema up to date themselves.
+func (m *MigrationService) RunStartupMigrations(context echo.Context) error {
+	switch m.config.GetStorageConfig().Backend {
+	case config_service.STORAGE_BACKEND_MEMORY, config_service.STORAGE_BACKEND_SQL:
+		return nil
+	}
+
+	results, err := m.MigrateRedisSchema(context, false)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		context.Logger().Infof("applied redis migration: version: %v, name: %v, changedKeys: %v", result.Version, result.Name, result.ChangedKeys)
+	}
+
+	return nil
+}
+
+// MigrateRedisSchema applies every Redis migration that hasn't run yet.
+// With dryRun set, nothing is written and the results count the keys each would change.
+func (m *MigrationService) MigrateRedisSchema(context echo.Context, dryRun bool) ([]redis_client.RedisMigrationResult, error) {
+	results, err := redis_client.MigrateRedis(context.Request().Context(), m.redisClient, dryRun)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to migrate redis schema",
+			Args: []interface{}{
+				"appliedCount", fmt.Sprintf("%v", len(results)),
+				"dryRun", fmt.Sprintf("%v", dryRun),
+			},
+			Err: err,
+		})
+	}
+
+	return results, nil
+}
+
+// MigrateRedisToSql copies everything in Redis into the SQL database
+// from the storage config, and checks every record and coin made it across
+func (m *MigrationService) MigrateRedisToSql(context echo.Context) (entities.ArchiveSummary, error) {
+	archive, err := m.exportRedisArchive(context)
+	if err != nil {
+		return entities.ArchiveSummary{}, err
+	}
+
+	return m.importArchive(context, archive)
+}
+
+// ExportArchive writes everything in Redis to a JSON archive at the given path
+func (m *MigrationService) ExportArchive(context echo.Context, path string) (entities.ArchiveSummary, error) {
+	archive, err := m.exportRedisArchive(context)
+	if err != nil {
+		return entities.ArchiveSummary{}, err
+	}
+
+	archive.Version = entities.ARCHIVE_VERSION
+	archive.ExportedAt = time.Now().UnixMilli()
+
+	archiveJSON, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return entities.ArchiveSummary{}, newArchiveFileError("failed to encode archive", path, err)
+	}
+
+	err = os.WriteFile(path, archiveJSON, 0600)
+	if err != nil {
+		return entities.ArchiveSummary{}, newArchiveFileError("failed to write archive", path, err)
+	}
+
+	return archive_repo.SummarizeArchive(archive), nil
+}
+
+// exportRedisArchive reads everything out of Redis, which has to be on the
+// latest schema for the repos to read it correctly
+func (m *MigrationService) exportRedisArchive(context echo.Context) (entities.Archive, error) {
+	schemaVersion, err := redis_client.GetRedisSchemaVersion(context.Request().Context(), m.redisClient)
+	if err != nil {
+		return entities.Archive{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to get redis schema version",
+			Err:     err,
+		})
+	}
+
+	if schemaVersion != redis_client.RedisSchemaVersion {
+		return entities.Archive{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusConflict,
+			Message: "redis schema is out of date, run the redis-schema command first",
+			Args: []interface{}{
+				"version", fmt.Sprintf("%v", schemaVersion),
+				"latestVersion", fmt.Sprintf("%v", redis_client.RedisSchemaVersion),
+			},
+			Err: nil,
+		})
+	}
+
+	return archive_repo.NewRedis(m.redisClient).ExportArchive(context)
+}
+
+// ImportArchive reads the JSON archive at the given path into the SQL database
+// from the storage config, and checks every record and coin made it across
+func (m *MigrationService) ImportArchive(context echo.Context, path string) (entities.ArchiveSummary, error) {
+	archiveJSON, err := os.ReadFile(path)
+	if err != nil {
+		return entities.ArchiveSummary{}, newArchiveFileError("failed to read archive", path, err)
+	}
+
+	var archive entities.Archive
+	err = json.Unmarshal(archiveJSON, &archive)
+	if err != nil {
+		return entities.ArchiveSummary{}, newArchiveFileError("failed to parse archive", path, err)
+	}
+
+	if archive.Version > entities.ARCHIVE_VERSION {
+		return entities.ArchiveSummary{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "archive was written by a newer version of the server",
+			Args: []interface{}{
+				"path", path,
+				"version", fmt.Sprintf("%v", archive.Version),
+			},
+			Err: nil,
+		})
+	}
+
+	return m.importArchive(context, archive)
+}
+
+func newArchiveFileError(message string, path string, err error) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: message,
+		Args: []interface{}{
+			"path", path,
+		},
+		Err: err,
+	})
+}
+
+// importArchive writes the archive and compares what the database holds against it.
+// The import is rolled back unless everything matches.
+func (m *MigrationService) importArchive(context echo.Context, archive entities.Archive) (entities.ArchiveSummary, error) {
+	sqlClient, err := m.openSqlClient()
+	if err != nil {
+		return entities.ArchiveSummary{}, err
+	}
+	defer sqlClient.Close()
+
+	archiveRepo := archive_repo.NewSql(sqlClient)
+	expectedSummary := archive_repo.SummarizeArchive(archive)
+
+	var summary entities.ArchiveSummary
+	err = sqlClient.StartTransaction(context, func() error {
+		err := archiveRepo.ImportArchive(context, archive)
+		if err != nil {
+			return err
+		}
+
+		summary, err = archiveRepo.GetArchiveSummary(context)
+		if err != nil {
+			return err
+		}
+
+		return verifyArchiveSummary(expectedSummary, summary)
+	})
+	if err != nil {
+		return entities.ArchiveSummary{}, err
+	}
+
+	return summary, nil
+}
+
+// openSqlClient connects to the SQL database from the storage config,
+// whichever backend the server itself is set to run on
+func (m *MigrationService) openSqlClient() (*redis_client.SqlClient, error) {
+	storageConfig := m.config.GetStorageConfig()
+
+	sqlClient, err := redis_client.OpenSqlClient(storageConfig.SqlDriver, storageConfig.SqlUrl)
+	if err != nil {
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to connect to SQL",
+			Args: []interface{}{
+				"driver", storageConfig.SqlDriver,
+			},
+			Err: err,
+		})
+	}
+
+	err = sqlClient.Migrate(goContext.Background())
+	if err != nil {
+		sqlClient.Close()
+		return nil, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusInternalServerError,
+			Message: "failed to migrate SQL schema",
+			Args: []interface{}{
+				"driver", storageConfig.SqlDriver,
+			},
+			Err: err,
+		})
+	}
+
+	return sqlClient, nil
+}
+
+func verifyArchiveSummary(expected entities.ArchiveSummary, actual entities.ArchiveSummary) error {
+	for table, expectedCount := range expected.Counts {
+		if actual.Counts[table] != expectedCount {
+			return newVerificationError(table, expectedCount, actual.Counts[table])
+		}
+	}
+
+	if actual.WalletAvailable != expected.WalletAvailable {
+		return newVerificationError("wallets.available", expected.WalletAvailable, actual.WalletAvailable)
+	}
+
+	if actual.WalletHeld != expected.WalletHeld {
+		return newVerificationError("wallets.held", expected.WalletHeld, actual.WalletHeld)
+	}
+
+	return nil
+}
+
+func newVerificationError(field string, expected int64, actual int64) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "imported data does not match the archive",
+		Args: []interface{}{
+			"field", field,
+			"expected", fmt.Sprintf("%v", expected),
+			"actual", fmt.Sprintf("%v", actual),
+		},
+		Err: nil,
+	})
+}
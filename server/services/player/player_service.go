@@ -1,49 +1,198 @@
 package player_service
 
 import (
+	"net/http"
+	"sort"
+	"strings"
+
 	"github.com/labstack/echo/v4"
 	"github.com/wilbertthelam/prop-ock/entities"
 	player_repo "github.com/wilbertthelam/prop-ock/repos/player"
+	"github.com/wilbertthelam/prop-ock/utils"
 )
 
 type PlayerService struct {
-	playerRepo *player_repo.PlayerRepo
+	playerRepo player_repo.PlayerRepo
 }
 
-func New(playerRepo *player_repo.PlayerRepo) *PlayerService {
+func New(
+	playerRepo player_repo.PlayerRepo,
+) *PlayerService {
 	return &PlayerService{
 		playerRepo,
 	}
 }
 
 func (p *PlayerService) GetPlayerByPlayerId(context echo.Context, playerId string) (entities.Player, error) {
-	// return p.playerRepo.GetPlayerByPlayerId(context, playerId)
-
-	if playerId == "44-julio-rodriguez" {
-		return entities.Player{
-			Id:       playerId,
-			Name:     "Julio Rodriguez",
-			Image:    "https://a.espncdn.com/combiner/i?img=/i/headshots/mlb/players/full/41044.png",
-			Team:     "SEA",
-			Position: "OF",
-		}, nil
-	} else if playerId == "7-jarred-kelenic" {
-		return entities.Player{
-			Id:       playerId,
-			Name:     "Jarred Kelenic",
-			Image:    "https://a.espncdn.com/combiner/i?img=/i/headshots/mlb/players/full/41150.png",
-			Team:     "SEA",
-			Position: "OF",
-		}, nil
-	} else if playerId == "13-bobby-witt" {
-		return entities.Player{
-			Id:       playerId,
-			Name:     "Bobby Witt",
-			Image:    "https://a.espncdn.com/combiner/i?img=/i/headshots/mlb/players/full/42403.png",
-			Team:     "KC",
-			Position: "SS",
-		}, nil
-	}
-
-	return entities.Player{}, nil
+	return p.playerRepo.GetPlayerByPlayerId(context, playerId)
+}
+
+// GetPlayersByPlayerIds returns the players that exist out of the given ids
+func (p *PlayerService) GetPlayersByPlayerIds(context echo.Context, playerIds []string) ([]entities.Player, error) {
+	return p.playerRepo.GetPlayersByPlayerIds(context, playerIds)
+}
+
+// GetAllPlayers returns the full catalog sorted by name
+func (p *PlayerService) GetAllPlayers(context echo.Context) ([]entities.Player, error) {
+	playerIds, err := p.playerRepo.GetAllPlayerIds(context)
+	if err != nil {
+		return nil, err
+	}
+
+	players, err := p.playerRepo.GetPlayersByPlayerIds(context, playerIds)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Name < players[j].Name
+	})
+
+	return players, nil
+}
+
+// SearchPlayers filters the catalog. Name matches on any part of the player's name,
+// while team and position have to match exactly. Empty filters match everyone.
+func (p *PlayerService) SearchPlayers(context echo.Context, name string, team string, position string) ([]entities.Player, error) {
+	players, err := p.GetAllPlayers(context)
+	if err != nil {
+		return nil, err
+	}
+
+	matchingPlayers := make([]entities.Player, 0)
+	for _, player := range players {
+		if name != "" && !strings.Contains(strings.ToLower(player.Name), strings.ToLower(name)) {
+			continue
+		}
+
+		if team != "" && !strings.EqualFold(player.Team, team) {
+			continue
+		}
+
+		if position != "" && !strings.EqualFold(player.Position, position) {
+			continue
+		}
+
+		matchingPlayers = append(matchingPlayers, player)
+	}
+
+	return matchingPlayers, nil
+}
+
+func (p *PlayerService) CreatePlayer(context echo.Context, player entities.Player) (entities.Player, error) {
+	err := validatePlayer(player)
+	if err != nil {
+		return entities.Player{}, err
+	}
+
+	// Verify player isn't already created
+	existingPlayer, err := p.GetPlayerByPlayerId(context, player.Id)
+	if err != nil {
+		return entities.Player{}, err
+	}
+
+	if existingPlayer.Id != "" {
+		return entities.Player{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "player is already created",
+			Args: []interface{}{
+				"playerId", player.Id,
+			},
+			Err: nil,
+		})
+	}
+
+	err = p.playerRepo.UpsertPlayers(context, []entities.Player{player})
+	if err != nil {
+		return entities.Player{}, err
+	}
+
+	return player, nil
+}
+
+// UpdatePlayer overwrites any fields set on the given player
+func (p *PlayerService) UpdatePlayer(context echo.Context, player entities.Player) (entities.Player, error) {
+	existingPlayer, err := p.GetPlayerByPlayerId(context, player.Id)
+	if err != nil {
+		return entities.Player{}, err
+	}
+
+	if existingPlayer.Id == "" {
+		return entities.Player{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "player does not exist",
+			Args: []interface{}{
+				"playerId", player.Id,
+			},
+			Err: nil,
+		})
+	}
+
+	if player.Name != "" {
+		existingPlayer.Name = player.Name
+	}
+	if player.Image != "" {
+		existingPlayer.Image = player.Image
+	}
+	if player.Team != "" {
+		existingPlayer.Team = player.Team
+	}
+	if player.Position != "" {
+		existingPlayer.Position = player.Position
+	}
+
+	err = p.playerRepo.UpsertPlayers(context, []entities.Player{existingPlayer})
+	if err != nil {
+		return entities.Player{}, err
+	}
+
+	return existingPlayer, nil
+}
+
+func (p *PlayerService) DeletePlayer(context echo.Context, playerId string) error {
+	existingPlayer, err := p.GetPlayerByPlayerId(context, playerId)
+	if err != nil {
+		return err
+	}
+
+	if existingPlayer.Id == "" {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "player does not exist",
+			Args: []interface{}{
+				"playerId", playerId,
+			},
+			Err: nil,
+		})
+	}
+
+	return p.playerRepo.DeletePlayer(context, playerId)
+}
+
+// BulkUpsertPlayers creates or fully replaces every player in the list in one atomic step
+func (p *PlayerService) BulkUpsertPlayers(context echo.Context, players []entities.Player) error {
+	for _, player := range players {
+		err := validatePlayer(player)
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.playerRepo.UpsertPlayers(context, players)
+}
+
+func validatePlayer(player entities.Player) error {
+	if player.Id == "" || player.Name == "" {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "player id and name are required",
+			Args: []interface{}{
+				"playerId", player.Id,
+				"name", player.Name,
+			},
+			Err: nil,
+		})
+	}
+
+	return nil
 }
@@ -0,0 +1,237 @@
+package player_set_service
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/entities"
+	player_set_repo "github.com/wilbertthelam/prop-ock/repos/player_set"
+	league_service "github.com/wilbertthelam/prop-ock/services/league"
+	player_service "github.com/wilbertthelam/prop-ock/services/player"
+	roster_service "github.com/wilbertthelam/prop-ock/services/roster"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type PlayerSetService struct {
+	playerSetRepo player_set_repo.PlayerSetRepo
+	leagueService *league_service.LeagueService
+	playerService *player_service.PlayerService
+	rosterService *roster_service.RosterService
+}
+
+func New(
+	playerSetRepo player_set_repo.PlayerSetRepo,
+	leagueService *league_service.LeagueService,
+	playerService *player_service.PlayerService,
+	rosterService *roster_service.RosterService,
+) *PlayerSetService {
+	return &PlayerSetService{
+		playerSetRepo,
+		leagueService,
+		playerService,
+		rosterService,
+	}
+}
+
+// GetPlayerSetByPlayerSetId returns the player set, leaving out any
+// players that have been picked up by someone in the league since it was made
+func (p *PlayerSetService) GetPlayerSetByPlayerSetId(context echo.Context, playerSetId uuid.UUID) (entities.PlayerSet, error) {
+	playerSet, err := p.playerSetRepo.GetPlayerSetByPlayerSetId(context, playerSetId)
+	if err != nil {
+		return entities.PlayerSet{}, err
+	}
+
+	if playerSet.Id != playerSetId {
+		return entities.PlayerSet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusNotFound,
+			Message: "no player set found",
+			Args: []interface{}{
+				"playerSetId", playerSetId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	ownedPlayerIds, err := p.rosterService.GetOwnedPlayerIds(context, playerSet.LeagueId)
+	if err != nil {
+		return entities.PlayerSet{}, err
+	}
+
+	availablePlayerIds := make([]string, 0, len(playerSet.PlayerIds))
+	for _, playerId := range playerSet.PlayerIds {
+		if !ownedPlayerIds[playerId] {
+			availablePlayerIds = append(availablePlayerIds, playerId)
+		}
+	}
+	playerSet.PlayerIds = availablePlayerIds
+
+	return playerSet, nil
+}
+
+func (p *PlayerSetService) GetPlayerSetsByLeagueId(context echo.Context, leagueId uuid.UUID) ([]entities.PlayerSet, error) {
+	playerSetIds, err := p.playerSetRepo.GetPlayerSetIdsByLeagueId(context, leagueId)
+	if err != nil {
+		return nil, err
+	}
+
+	playerSets := make([]entities.PlayerSet, len(playerSetIds))
+	for index, playerSetId := range playerSetIds {
+		playerSet, err := p.GetPlayerSetByPlayerSetId(context, playerSetId)
+		if err != nil {
+			return nil, err
+		}
+
+		playerSets[index] = playerSet
+	}
+
+	return playerSets, nil
+}
+
+// IsPlayerInPlayerSet checks the player is in the set and hasn't been picked up by anyone in the league
+func (p *PlayerSetService) IsPlayerInPlayerSet(context echo.Context, playerSetId uuid.UUID, playerId string) (bool, error) {
+	isPlayerInPlayerSet, err := p.playerSetRepo.IsPlayerInPlayerSet(context, playerSetId, playerId)
+	if err != nil || !isPlayerInPlayerSet {
+		return false, err
+	}
+
+	playerSet, err := p.playerSetRepo.GetPlayerSetByPlayerSetId(context, playerSetId)
+	if err != nil {
+		return false, err
+	}
+
+	ownerId, err := p.rosterService.GetPlayerOwner(context, playerSet.LeagueId, playerId)
+	if err != nil {
+		return false, err
+	}
+
+	return ownerId == uuid.Nil, nil
+}
+
+func (p *PlayerSetService) CreatePlayerSet(context echo.Context, leagueId uuid.UUID, name string, playerIds []string) (entities.PlayerSet, error) {
+	// Verify league exists
+	league, err := p.leagueService.GetLeagueByLeagueId(context, leagueId)
+	if err != nil {
+		return entities.PlayerSet{}, err
+	}
+
+	if league.Id != leagueId {
+		return entities.PlayerSet{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "league does not exist",
+			Args: []interface{}{
+				"leagueId", leagueId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	err = p.validatePlayersExist(context, playerIds)
+	if err != nil {
+		return entities.PlayerSet{}, err
+	}
+
+	err = p.validatePlayersNotOwned(context, leagueId, playerIds)
+	if err != nil {
+		return entities.PlayerSet{}, err
+	}
+
+	playerSet := entities.PlayerSet{
+		Id:        uuid.New(),
+		LeagueId:  leagueId,
+		Name:      name,
+		PlayerIds: playerIds,
+	}
+
+	err = p.playerSetRepo.UpsertPlayerSet(context, playerSet.Id, playerSet)
+	if err != nil {
+		return entities.PlayerSet{}, err
+	}
+
+	return playerSet, nil
+}
+
+// UpdatePlayerSet renames the player set and replaces its players
+func (p *PlayerSetService) UpdatePlayerSet(context echo.Context, playerSetId uuid.UUID, name string, playerIds []string) (entities.PlayerSet, error) {
+	playerSet, err := p.GetPlayerSetByPlayerSetId(context, playerSetId)
+	if err != nil {
+		return entities.PlayerSet{}, err
+	}
+
+	err = p.validatePlayersExist(context, playerIds)
+	if err != nil {
+		return entities.PlayerSet{}, err
+	}
+
+	err = p.validatePlayersNotOwned(context, playerSet.LeagueId, playerIds)
+	if err != nil {
+		return entities.PlayerSet{}, err
+	}
+
+	if name != "" {
+		playerSet.Name = name
+	}
+	playerSet.PlayerIds = playerIds
+
+	err = p.playerSetRepo.UpsertPlayerSet(context, playerSetId, playerSet)
+	if err != nil {
+		return entities.PlayerSet{}, err
+	}
+
+	return playerSet, nil
+}
+
+func (p *PlayerSetService) DeletePlayerSet(context echo.Context, playerSetId uuid.UUID) error {
+	playerSet, err := p.GetPlayerSetByPlayerSetId(context, playerSetId)
+	if err != nil {
+		return err
+	}
+
+	return p.playerSetRepo.DeletePlayerSet(context, playerSetId, playerSet.LeagueId)
+}
+
+func (p *PlayerSetService) validatePlayersExist(context echo.Context, playerIds []string) error {
+	for _, playerId := range playerIds {
+		player, err := p.playerService.GetPlayerByPlayerId(context, playerId)
+		if err != nil {
+			return err
+		}
+
+		if player.Id != playerId {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusBadRequest,
+				Message: "player does not exist",
+				Args: []interface{}{
+					"playerId", playerId,
+				},
+				Err: nil,
+			})
+		}
+	}
+
+	return nil
+}
+
+// validatePlayersNotOwned stops players already on someone's roster from going up for auction again
+func (p *PlayerSetService) validatePlayersNotOwned(context echo.Context, leagueId uuid.UUID, playerIds []string) error {
+	ownedPlayerIds, err := p.rosterService.GetOwnedPlayerIds(context, leagueId)
+	if err != nil {
+		return err
+	}
+
+	for _, playerId := range playerIds {
+		if ownedPlayerIds[playerId] {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusBadRequest,
+				Message: "player is already owned in this league",
+				Args: []interface{}{
+					"leagueId", leagueId.String(),
+					"playerId", playerId,
+				},
+				Err: nil,
+			})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package roster_service
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/entities"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	league_service "github.com/wilbertthelam/prop-ock/services/league"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type RosterService struct {
+	rosterRepo    roster_repo.RosterRepo
+	leagueService *league_service.LeagueService
+}
+
+func New(
+	rosterRepo roster_repo.RosterRepo,
+	leagueService *league_service.LeagueService,
+) *RosterService {
+	return &RosterService{
+		rosterRepo,
+		leagueService,
+	}
+}
+
+func (r *RosterService) GetRoster(context echo.Context, leagueId uuid.UUID, userId uuid.UUID) (entities.Roster, error) {
+	rosterPlayers, err := r.rosterRepo.GetRoster(context, leagueId, userId)
+	if err != nil {
+		return entities.Roster{}, err
+	}
+
+	return entities.Roster{
+		LeagueId: leagueId,
+		UserId:   userId,
+		Players:  rosterPlayers,
+	}, nil
+}
+
+// GetRostersForLeague returns the roster of every member in the league
+func (r *RosterService) GetRostersForLeague(context echo.Context, leagueId uuid.UUID) ([]entities.Roster, error) {
+	userIds, err := r.leagueService.GetMembersInLeague(context, leagueId)
+	if err != nil {
+		return nil, err
+	}
+
+	rosters := make([]entities.Roster, len(userIds))
+	for index, userId := range userIds {
+		rosters[index], err = r.GetRoster(context, leagueId, userId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return rosters, nil
+}
+
+// GetPlayerOwner returns the user that owns the player in the league, or an empty id if nobody does
+func (r *RosterService) GetPlayerOwner(context echo.Context, leagueId uuid.UUID, playerId string) (uuid.UUID, error) {
+	return r.rosterRepo.GetPlayerOwner(context, leagueId, playerId)
+}
+
+// GetOwnedPlayerIds returns the set of every player already owned by someone in the league
+func (r *RosterService) GetOwnedPlayerIds(context echo.Context, leagueId uuid.UUID) (map[string]bool, error) {
+	owners, err := r.rosterRepo.GetPlayerOwners(context, leagueId)
+	if err != nil {
+		return nil, err
+	}
+
+	ownedPlayerIds := make(map[string]bool, len(owners))
+	for playerId := range owners {
+		ownedPlayerIds[playerId] = true
+	}
+
+	return ownedPlayerIds, nil
+}
+
+// AddPlayerToRoster gives the player to the user. A player can only have one owner per league.
+func (r *RosterService) AddPlayerToRoster(context echo.Context, rosterPlayer entities.RosterPlayer) error {
+	ownerId, err := r.GetPlayerOwner(context, rosterPlayer.LeagueId, rosterPlayer.PlayerId)
+	if err != nil {
+		return err
+	}
+
+	if ownerId != uuid.Nil {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "player is already owned in this league",
+			Args: []interface{}{
+				"leagueId", rosterPlayer.LeagueId.String(),
+				"playerId", rosterPlayer.PlayerId,
+				"ownerId", ownerId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	return r.rosterRepo.AddPlayerToRoster(context, rosterPlayer)
+}
+
+// ReleasePlayer drops the player from the user's roster and puts them back in the pool
+// for future auctions. The user gets back the league's release refund percentage of
+// the price they won the player for, rounded down. Returns the amount refunded.
+func (r *RosterService) ReleasePlayer(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, playerId string) (int64, error) {
+	rosterPlayer, err := r.getRosterPlayer(context, leagueId, userId, playerId)
+	if err != nil {
+		return 0, err
+	}
+
+	settings, err := r.leagueService.GetLeagueSettings(context, leagueId)
+	if err != nil {
+		return 0, err
+	}
+
+	refund := rosterPlayer.Price * settings.ReleaseRefundPercentage / 100
+
+	// Only the request that actually takes the player off the roster gets the refund
+	_, err = r.rosterRepo.ReleasePlayerFromRoster(
+		context,
+		leagueId,
+		userId,
+		playerId,
+		entities.NewWalletTransaction(userId, leagueId, refund, 0, entities.WALLET_TRANSACTION_REASON_RELEASE_REFUND, rosterPlayer.AuctionId, playerId),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return refund, nil
+}
+
+// ValidateUserOwnsPlayers fails if any of the players aren't on the user's roster
+func (r *RosterService) ValidateUserOwnsPlayers(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, playerIds []string) error {
+	for _, playerId := range playerIds {
+		_, err := r.getRosterPlayer(context, leagueId, userId, playerId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getRosterPlayer finds the player on the user's roster, failing if the user doesn't own them
+func (r *RosterService) getRosterPlayer(context echo.Context, leagueId uuid.UUID, userId uuid.UUID, playerId string) (entities.RosterPlayer, error) {
+	rosterPlayers, err := r.rosterRepo.GetRoster(context, leagueId, userId)
+	if err != nil {
+		return entities.RosterPlayer{}, err
+	}
+
+	for _, rosterPlayer := range rosterPlayers {
+		if rosterPlayer.PlayerId == playerId {
+			return rosterPlayer, nil
+		}
+	}
+
+	return entities.RosterPlayer{}, utils.NewError(utils.ErrorParams{
+		Code:    http.StatusBadRequest,
+		Message: "user does not own player in this league",
+		Args: []interface{}{
+			"leagueId", leagueId.String(),
+			"userId", userId.String(),
+			"playerId", playerId,
+		},
+		Err: nil,
+	})
+}
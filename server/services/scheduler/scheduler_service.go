@@ -0,0 +1,157 @@
+package scheduler_service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/constants"
+	"github.com/wilbertthelam/prop-ock/entities"
+	schedule_repo "github.com/wilbertthelam/prop-ock/repos/schedule"
+	auction_service "github.com/wilbertthelam/prop-ock/services/auction"
+	message_service "github.com/wilbertthelam/prop-ock/services/message"
+	trade_service "github.com/wilbertthelam/prop-ock/services/trade"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type SchedulerService struct {
+	scheduleRepo   schedule_repo.ScheduleRepo
+	auctionService *auction_service.AuctionService
+	messageService *message_service.MessageService
+	tradeService   *trade_service.TradeService
+}
+
+func New(
+	scheduleRepo schedule_repo.ScheduleRepo,
+	auctionService *auction_service.AuctionService,
+	messageService *message_service.MessageService,
+	tradeService *trade_service.TradeService,
+) *SchedulerService {
+	return &SchedulerService{
+		scheduleRepo,
+		auctionService,
+		messageService,
+		tradeService,
+	}
+}
+
+// Start polls Redis for due auction transitions and trades in the background.
+// Pending transitions are only removed from Redis once they succeed,
+// so anything that came due while the server was down gets picked up
+// on the first poll after a restart.
+func (s *SchedulerService) Start(e *echo.Echo) {
+	go func() {
+		ticker := time.NewTicker(constants.SCHEDULER_POLL_INTERVAL)
+		defer ticker.Stop()
+
+		s.RunDueTransitions(e)
+		s.RunDueTrades(e)
+		for range ticker.C {
+			s.RunDueTransitions(e)
+			s.RunDueTrades(e)
+		}
+	}()
+}
+
+func (s *SchedulerService) RunDueTransitions(e *echo.Echo) {
+	transitions, err := s.scheduleRepo.GetDueAuctionTransitions(
+		utils.NewBackgroundContext(e),
+		time.Now().UnixMilli(),
+	)
+	if err != nil {
+		e.Logger.Error(err)
+		return
+	}
+
+	for _, transition := range transitions {
+		context := utils.NewBackgroundContext(e)
+
+		err := s.runAuctionTransition(context, transition)
+		if err != nil {
+			// Leave the transition in place so it's retried on the next poll
+			context.Logger().Error(err)
+			continue
+		}
+
+		err = s.scheduleRepo.RemoveAuctionTransition(context, transition.AuctionId, transition.Transition)
+		if err != nil {
+			context.Logger().Error(err)
+		}
+	}
+}
+
+// RunDueTrades expires stale trade proposals and processes accepted trades
+// once their review period is over
+func (s *SchedulerService) RunDueTrades(e *echo.Echo) {
+	context := utils.NewBackgroundContext(e)
+
+	err := s.tradeService.RunDueTrades(context, time.Now().UnixMilli())
+	if err != nil {
+		e.Logger.Error(err)
+	}
+}
+
+// runAuctionTransition moves the auction along its lifecycle. Each step checks the
+// auction's status first so a step that already happened (either by hand through
+// the API or by a previous run that crashed before cleaning up) is a no-op.
+func (s *SchedulerService) runAuctionTransition(context echo.Context, transition entities.ScheduledAuctionTransition) error {
+	auctionId := transition.AuctionId
+
+	auction, err := s.auctionService.GetAuctionByAuctionId(context, auctionId)
+	if err != nil {
+		return err
+	}
+
+	context.Logger().Infof("running scheduled auction transition: auctionId: %v, transition: %v, status: %v", auctionId, transition.Transition, auction.Status)
+
+	switch transition.Transition {
+	case entities.AUCTION_TRANSITION_START:
+		if auction.Status != entities.AUCTION_STATUS_CREATED {
+			return nil
+		}
+
+		return s.auctionService.StartAuction(context, auctionId)
+	case entities.AUCTION_TRANSITION_STOP:
+		if auction.Status == entities.AUCTION_STATUS_ACTIVE {
+			err = s.auctionService.StopAuction(context, auctionId)
+			if err != nil {
+				return err
+			}
+		} else if auction.Status != entities.AUCTION_STATUS_STOPPED {
+			return nil
+		}
+
+		return s.auctionService.ScheduleAuctionTransition(context, auctionId, entities.AUCTION_TRANSITION_PROCESS, time.Now().UnixMilli())
+	case entities.AUCTION_TRANSITION_PROCESS:
+		if auction.Status != entities.AUCTION_STATUS_STOPPED {
+			return nil
+		}
+
+		err = s.auctionService.ProcessAuction(context, auctionId)
+		if err != nil {
+			return err
+		}
+
+		return s.auctionService.ScheduleAuctionTransition(context, auctionId, entities.AUCTION_TRANSITION_BROADCAST_RESULTS, time.Now().UnixMilli())
+	case entities.AUCTION_TRANSITION_BROADCAST_RESULTS:
+		// Don't retry failed broadcasts, otherwise users who did get
+		// their results would keep getting them every poll
+		err = s.messageService.SendWinningBidsForAuction(context, auctionId)
+		if err != nil {
+			context.Logger().Error(err)
+		}
+
+		return nil
+	}
+
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusInternalServerError,
+		Message: "unknown scheduled auction transition",
+		Args: []interface{}{
+			"auctionId", auctionId.String(),
+			"transition", fmt.Sprintf("%v", transition.Transition),
+		},
+		Err: nil,
+	})
+}
@@ -0,0 +1,522 @@
+package trade_service
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/wilbertthelam/prop-ock/constants"
+	"github.com/wilbertthelam/prop-ock/entities"
+	trade_repo "github.com/wilbertthelam/prop-ock/repos/trade"
+	league_service "github.com/wilbertthelam/prop-ock/services/league"
+	message_service "github.com/wilbertthelam/prop-ock/services/message"
+	player_service "github.com/wilbertthelam/prop-ock/services/player"
+	roster_service "github.com/wilbertthelam/prop-ock/services/roster"
+	user_service "github.com/wilbertthelam/prop-ock/services/user"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+type TradeService struct {
+	tradeRepo      trade_repo.TradeRepo
+	rosterService  *roster_service.RosterService
+	userService    *user_service.UserService
+	leagueService  *league_service.LeagueService
+	playerService  *player_service.PlayerService
+	messageService *message_service.MessageService
+}
+
+func New(
+	tradeRepo trade_repo.TradeRepo,
+	rosterService *roster_service.RosterService,
+	userService *user_service.UserService,
+	leagueService *league_service.LeagueService,
+	playerService *player_service.PlayerService,
+	messageService *message_service.MessageService,
+) *TradeService {
+	return &TradeService{
+		tradeRepo,
+		rosterService,
+		userService,
+		leagueService,
+		playerService,
+		messageService,
+	}
+}
+
+func (t *TradeService) GetTradeByTradeId(context echo.Context, tradeId uuid.UUID) (entities.Trade, error) {
+	return t.tradeRepo.GetTradeByTradeId(context, tradeId)
+}
+
+// GetTradesForLeague returns every trade made in the league, newest first
+func (t *TradeService) GetTradesForLeague(context echo.Context, leagueId uuid.UUID) ([]entities.Trade, error) {
+	tradeIds, err := t.tradeRepo.GetTradeIdsForLeague(context, leagueId)
+	if err != nil {
+		return nil, err
+	}
+
+	trades := make([]entities.Trade, len(tradeIds))
+	for index, tradeId := range tradeIds {
+		trades[index], err = t.GetTradeByTradeId(context, tradeId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(trades, func(i, j int) bool {
+		return trades[i].CreatedAt > trades[j].CreatedAt
+	})
+
+	return trades, nil
+}
+
+// ProposeTrade offers the receiver the proposer's players and funds in exchange
+// for theirs. The proposal expires if the receiver doesn't answer in time.
+func (t *TradeService) ProposeTrade(context echo.Context, trade entities.Trade) (entities.Trade, error) {
+	err := t.validateTradeTerms(context, trade)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	now := time.Now()
+	trade.Id = uuid.New()
+	trade.Status = entities.TRADE_STATUS_PROPOSED
+	trade.CounterOfTradeId = uuid.Nil
+	trade.CreatedAt = now.UnixMilli()
+	trade.UpdatedAt = now.UnixMilli()
+	trade.ExpiresAt = now.Add(constants.TRADE_EXPIRATION).UnixMilli()
+	trade.ProcessAt = 0
+
+	err = t.tradeRepo.SaveTrade(context, trade, trade.ExpiresAt)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	t.notifyTradeParties(context, trade, "New trade proposal")
+
+	return trade, nil
+}
+
+// CounterTrade replaces an open proposal with new terms from its receiver,
+// who becomes the proposer of the counter offer
+func (t *TradeService) CounterTrade(context echo.Context, counterTrade entities.Trade) (entities.Trade, error) {
+	trade, err := t.getOpenTradeForReceiver(context, counterTrade.CounterOfTradeId, counterTrade.ProposerId)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	counterTrade.LeagueId = trade.LeagueId
+	counterTrade.ReceiverId = trade.ProposerId
+
+	err = t.validateTradeTerms(context, counterTrade)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	now := time.Now()
+	counterTrade.Id = uuid.New()
+	counterTrade.Status = entities.TRADE_STATUS_PROPOSED
+	counterTrade.CounterOfTradeId = trade.Id
+	counterTrade.CreatedAt = now.UnixMilli()
+	counterTrade.UpdatedAt = now.UnixMilli()
+	counterTrade.ExpiresAt = now.Add(constants.TRADE_EXPIRATION).UnixMilli()
+	counterTrade.ProcessAt = 0
+
+	trade.Status = entities.TRADE_STATUS_COUNTERED
+	trade.UpdatedAt = now.UnixMilli()
+
+	err = t.tradeRepo.CounterTrade(context, trade, counterTrade)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	t.notifyTradeParties(context, counterTrade, "Trade countered")
+
+	return counterTrade, nil
+}
+
+// AcceptTrade agrees to an open proposal. The trade goes through once the
+// review period is over, unless the commissioner vetoes it first.
+func (t *TradeService) AcceptTrade(context echo.Context, tradeId uuid.UUID, userId uuid.UUID) (entities.Trade, error) {
+	trade, err := t.getOpenTradeForReceiver(context, tradeId, userId)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	// Both sides have to still be able to cover the trade when it's accepted
+	err = t.validateTradeTerms(context, trade)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	now := time.Now()
+	trade.Status = entities.TRADE_STATUS_ACCEPTED
+	trade.UpdatedAt = now.UnixMilli()
+	trade.ProcessAt = now.Add(constants.TRADE_REVIEW_PERIOD).UnixMilli()
+
+	err = t.tradeRepo.SaveTrade(context, trade, trade.ProcessAt)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	t.notifyTradeParties(context, trade, "Trade accepted, it goes through once the review period is over")
+
+	return trade, nil
+}
+
+func (t *TradeService) RejectTrade(context echo.Context, tradeId uuid.UUID, userId uuid.UUID) (entities.Trade, error) {
+	trade, err := t.getOpenTradeForReceiver(context, tradeId, userId)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	trade, err = t.closeTrade(context, trade, entities.TRADE_STATUS_REJECTED)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	t.notifyTradeParties(context, trade, "Trade rejected")
+
+	return trade, nil
+}
+
+// VetoTrade lets the commissioner stop a trade that hasn't gone through yet
+func (t *TradeService) VetoTrade(context echo.Context, tradeId uuid.UUID) (entities.Trade, error) {
+	trade, err := t.GetTradeByTradeId(context, tradeId)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	if trade.Status != entities.TRADE_STATUS_PROPOSED && trade.Status != entities.TRADE_STATUS_ACCEPTED {
+		return entities.Trade{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "only pending trades can be vetoed",
+			Args: []interface{}{
+				"tradeId", tradeId.String(),
+				"status", fmt.Sprintf("%v", trade.Status),
+			},
+			Err: nil,
+		})
+	}
+
+	trade, err = t.closeTrade(context, trade, entities.TRADE_STATUS_VETOED)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	t.notifyTradeParties(context, trade, "Trade vetoed by the commissioner")
+
+	return trade, nil
+}
+
+// RunDueTrades expires proposals nobody answered and processes accepted trades
+// whose review period is over. Trades that fail are left scheduled so they're
+// retried on the next run.
+func (t *TradeService) RunDueTrades(context echo.Context, now int64) error {
+	tradeIds, err := t.tradeRepo.GetDueTradeIds(context, now)
+	if err != nil {
+		return err
+	}
+
+	for _, tradeId := range tradeIds {
+		err = t.runDueTrade(context, tradeId, now)
+		if err != nil {
+			context.Logger().Error(err)
+		}
+	}
+
+	return nil
+}
+
+func (t *TradeService) runDueTrade(context echo.Context, tradeId uuid.UUID, now int64) error {
+	trade, err := t.GetTradeByTradeId(context, tradeId)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case trade.Status == entities.TRADE_STATUS_PROPOSED && trade.ExpiresAt <= now:
+		trade, err = t.closeTrade(context, trade, entities.TRADE_STATUS_EXPIRED)
+		if err != nil {
+			return err
+		}
+
+		t.notifyTradeParties(context, trade, "Trade expired")
+		return nil
+	case trade.Status == entities.TRADE_STATUS_ACCEPTED && trade.ProcessAt <= now:
+		return t.processTrade(context, trade)
+	case trade.Status == entities.TRADE_STATUS_PROPOSED || trade.Status == entities.TRADE_STATUS_ACCEPTED:
+		// Not due yet
+		return nil
+	}
+
+	// Anything else is already settled and shouldn't be scheduled
+	return t.tradeRepo.RemoveScheduledTrade(context, tradeId)
+}
+
+// processTrade moves the players and funds on both sides of an accepted trade in
+// one atomic step. If either side no longer has what they're trading away, the
+// trade fails and nothing moves.
+func (t *TradeService) processTrade(context echo.Context, trade entities.Trade) error {
+	trade.UpdatedAt = time.Now().UnixMilli()
+
+	validationErr := t.validateTradeTerms(context, trade)
+	if validationErr == nil {
+		// The exchange saves the trade as completed along with the moves
+		trade.Status = entities.TRADE_STATUS_COMPLETED
+		validationErr = t.tradeRepo.ExchangeTradeAssets(context, trade, trade.UpdatedAt)
+	}
+
+	if validationErr != nil {
+		// A player or funds may have moved between validating the trade and exchanging it
+		userErr, ok := validationErr.(*utils.Error)
+		if !ok || userErr.Code >= http.StatusInternalServerError {
+			return validationErr
+		}
+
+		trade.Status = entities.TRADE_STATUS_FAILED
+
+		err := t.tradeRepo.SaveTrade(context, trade, 0)
+		if err != nil {
+			return err
+		}
+
+		context.Logger().Infof("trade failed: tradeId: %v, error: %v", trade.Id, validationErr)
+		t.notifyTradeParties(context, trade, "Trade failed, one side no longer has what they were trading away")
+		return nil
+	}
+
+	t.notifyTradeParties(context, trade, "Trade completed")
+
+	return nil
+}
+
+// closeTrade ends a pending trade without moving anything
+func (t *TradeService) closeTrade(context echo.Context, trade entities.Trade, status entities.TradeStatus) (entities.Trade, error) {
+	trade.Status = status
+	trade.UpdatedAt = time.Now().UnixMilli()
+
+	err := t.tradeRepo.SaveTrade(context, trade, 0)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	return trade, nil
+}
+
+// getOpenTradeForReceiver returns the trade as long as it's still waiting on an answer from the user
+func (t *TradeService) getOpenTradeForReceiver(context echo.Context, tradeId uuid.UUID, userId uuid.UUID) (entities.Trade, error) {
+	trade, err := t.GetTradeByTradeId(context, tradeId)
+	if err != nil {
+		return entities.Trade{}, err
+	}
+
+	if trade.ReceiverId != userId {
+		return entities.Trade{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusForbidden,
+			Message: "only the receiver of a trade can respond to it",
+			Args: []interface{}{
+				"tradeId", tradeId.String(),
+				"userId", userId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	if trade.Status != entities.TRADE_STATUS_PROPOSED || trade.ExpiresAt <= time.Now().UnixMilli() {
+		return entities.Trade{}, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "trade is no longer open",
+			Args: []interface{}{
+				"tradeId", tradeId.String(),
+				"status", fmt.Sprintf("%v", trade.Status),
+			},
+			Err: nil,
+		})
+	}
+
+	return trade, nil
+}
+
+// validateTradeTerms checks both users are in the league and each side owns
+// the players and has the funds they're trading away
+func (t *TradeService) validateTradeTerms(context echo.Context, trade entities.Trade) error {
+	if trade.ProposerId == trade.ReceiverId {
+		return newTradeTermsError(trade, "users can't trade with themselves")
+	}
+
+	if trade.ProposerFunds < 0 || trade.ReceiverFunds < 0 {
+		return newTradeTermsError(trade, "traded funds can't be negative")
+	}
+
+	if len(trade.ProposerPlayerIds) == 0 && len(trade.ReceiverPlayerIds) == 0 {
+		return newTradeTermsError(trade, "trade must include at least one player")
+	}
+
+	seenPlayerIds := make(map[string]bool)
+	for _, playerId := range append(append([]string{}, trade.ProposerPlayerIds...), trade.ReceiverPlayerIds...) {
+		if seenPlayerIds[playerId] {
+			return newTradeTermsError(trade, "trade includes the same player more than once")
+		}
+		seenPlayerIds[playerId] = true
+	}
+
+	settings, err := t.leagueService.GetLeagueSettings(context, trade.LeagueId)
+	if err != nil {
+		return err
+	}
+
+	sides := []struct {
+		userId            uuid.UUID
+		playerIds         []string
+		funds             int64
+		receivedPlayerIds []string
+	}{
+		{trade.ProposerId, trade.ProposerPlayerIds, trade.ProposerFunds, trade.ReceiverPlayerIds},
+		{trade.ReceiverId, trade.ReceiverPlayerIds, trade.ReceiverFunds, trade.ProposerPlayerIds},
+	}
+
+	for _, side := range sides {
+		isUserInLeague, err := t.leagueService.IsUserInLeague(context, side.userId, trade.LeagueId)
+		if err != nil {
+			return err
+		}
+
+		if !isUserInLeague {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusForbidden,
+				Message: "user does not exist in this league",
+				Args: []interface{}{
+					"userId", side.userId.String(),
+					"leagueId", trade.LeagueId.String(),
+				},
+				Err: nil,
+			})
+		}
+
+		err = t.rosterService.ValidateUserOwnsPlayers(context, trade.LeagueId, side.userId, side.playerIds)
+		if err != nil {
+			return err
+		}
+
+		hasEnoughFunds, err := t.userService.ValidateUserHasEnoughFunds(context, side.userId, trade.LeagueId, side.funds)
+		if err != nil {
+			return err
+		}
+
+		if !hasEnoughFunds {
+			return utils.NewError(utils.ErrorParams{
+				Code:    http.StatusBadRequest,
+				Message: "user does not have enough funds for this trade",
+				Args: []interface{}{
+					"userId", side.userId.String(),
+					"leagueId", trade.LeagueId.String(),
+					"funds", fmt.Sprintf("%v", side.funds),
+				},
+				Err: nil,
+			})
+		}
+
+		if settings.RosterSizeCap > 0 {
+			roster, err := t.rosterService.GetRoster(context, trade.LeagueId, side.userId)
+			if err != nil {
+				return err
+			}
+
+			rosterSize := len(roster.Players) - len(side.playerIds) + len(side.receivedPlayerIds)
+			if int64(rosterSize) > settings.RosterSizeCap {
+				return utils.NewError(utils.ErrorParams{
+					Code:    http.StatusBadRequest,
+					Message: "trade would put user over the league's roster size cap",
+					Args: []interface{}{
+						"userId", side.userId.String(),
+						"leagueId", trade.LeagueId.String(),
+						"rosterSize", fmt.Sprintf("%v", rosterSize),
+						"rosterSizeCap", fmt.Sprintf("%v", settings.RosterSizeCap),
+					},
+					Err: nil,
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// notifyTradeParties messages both sides of the trade. Failing to reach
+// someone shouldn't undo the trade, so errors are only logged.
+func (t *TradeService) notifyTradeParties(context echo.Context, trade entities.Trade, headline string) {
+	description, err := t.describeTrade(context, trade)
+	if err != nil {
+		context.Logger().Error(err)
+		return
+	}
+
+	text := fmt.Sprintf("%v:\n%v", headline, description)
+	for _, userId := range []uuid.UUID{trade.ProposerId, trade.ReceiverId} {
+		err = t.messageService.SendTextToUser(context, userId, text)
+		if err != nil {
+			context.Logger().Error(err)
+		}
+	}
+}
+
+// describeTrade lists what each side of the trade gives up
+func (t *TradeService) describeTrade(context echo.Context, trade entities.Trade) (string, error) {
+	proposerSide, err := t.describeTradeSide(context, trade.ProposerId, trade.ProposerPlayerIds, trade.ProposerFunds)
+	if err != nil {
+		return "", err
+	}
+
+	receiverSide, err := t.describeTradeSide(context, trade.ReceiverId, trade.ReceiverPlayerIds, trade.ReceiverFunds)
+	if err != nil {
+		return "", err
+	}
+
+	return proposerSide + "\n" + receiverSide, nil
+}
+
+func (t *TradeService) describeTradeSide(context echo.Context, userId uuid.UUID, playerIds []string, funds int64) (string, error) {
+	user, err := t.userService.GetUserByUserId(context, userId)
+	if err != nil {
+		return "", err
+	}
+
+	assets := make([]string, 0, len(playerIds)+1)
+	if len(playerIds) > 0 {
+		players, err := t.playerService.GetPlayersByPlayerIds(context, playerIds)
+		if err != nil {
+			return "", err
+		}
+
+		for _, player := range players {
+			assets = append(assets, player.Name)
+		}
+	}
+
+	if funds > 0 {
+		assets = append(assets, fmt.Sprintf("$%v", funds))
+	}
+
+	if len(assets) == 0 {
+		assets = append(assets, "nothing")
+	}
+
+	return fmt.Sprintf("%v gives: %v", user.Name, strings.Join(assets, ", ")), nil
+}
+
+func newTradeTermsError(trade entities.Trade, message string) error {
+	return utils.NewError(utils.ErrorParams{
+		Code:    http.StatusBadRequest,
+		Message: message,
+		Args: []interface{}{
+			"leagueId", trade.LeagueId.String(),
+			"proposerId", trade.ProposerId.String(),
+			"receiverId", trade.ReceiverId.String(),
+		},
+		Err: nil,
+	})
+}
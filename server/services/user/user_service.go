@@ -3,11 +3,10 @@ package user_service
 import (
 	"fmt"
 	"net/http"
+	"sort"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	redis_client "github.com/wilbertthelam/prop-ock/db"
 	"github.com/wilbertthelam/prop-ock/entities"
 	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
 	league_service "github.com/wilbertthelam/prop-ock/services/league"
@@ -15,20 +14,17 @@ import (
 )
 
 type UserService struct {
-	userRepo      *user_repo.UserRepo
+	userRepo      user_repo.UserRepo
 	leagueService *league_service.LeagueService
-	redisClient   *redis.Client
 }
 
 func New(
-	userRepo *user_repo.UserRepo,
+	userRepo user_repo.UserRepo,
 	leagueService *league_service.LeagueService,
-	redisClient *redis.Client,
 ) *UserService {
 	return &UserService{
 		userRepo,
 		leagueService,
-		redisClient,
 	}
 }
 
@@ -39,7 +35,7 @@ func (u *UserService) GetUserByUserId(context echo.Context, userId uuid.UUID) (e
 func (u *UserService) InitializeUser(context echo.Context, userId uuid.UUID, senderPsId string, name string) error {
 	// Check if account was already created for new user
 	checkedUserId, err := u.GetUserIdFromSenderPsId(context, senderPsId)
-	if err == nil {
+	if !utils.IsNotFoundError(err) {
 		return err
 	}
 
@@ -55,38 +51,11 @@ func (u *UserService) InitializeUser(context echo.Context, userId uuid.UUID, sen
 		})
 	}
 
-	// Start Redis transaction to create user and relationships
-	err = redis_client.StartTransaction(
-		context,
-		u.redisClient,
-		func() error {
-			err = u.createUser(context, userId, "[add name]")
-			if err != nil {
-				return err
-			}
-
-			// Create senderPsId <> userId mappings in both directions
-			err = u.SetUserIdToSenderPsIdRelationship(context, senderPsId, userId)
-			if err != nil {
-				return err
-			}
-
-			err = u.SetSenderPsIdToUserIdRelationship(context, senderPsId, userId)
-			if err != nil {
-				return err
-			}
-
-			return nil
-		},
-	)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	// Create the user along with the senderPsId <> userId mappings in both directions
+	return u.createUser(context, userId, senderPsId, "[add name]")
 }
 
-func (u *UserService) createUser(context echo.Context, userId uuid.UUID, name string) error {
+func (u *UserService) createUser(context echo.Context, userId uuid.UUID, senderPsId string, name string) error {
 	// Verify user isn't already created
 	user, err := u.GetUserByUserId(context, userId)
 	if err != nil {
@@ -109,14 +78,17 @@ func (u *UserService) createUser(context echo.Context, userId uuid.UUID, name st
 		Name: name,
 	}
 
-	return u.userRepo.CreateUser(context, userId, user)
+	return u.userRepo.CreateUserWithSenderPsId(context, user, senderPsId)
 }
 
-func (u *UserService) GetUserWallet(context echo.Context, userId uuid.UUID) (map[uuid.UUID]int64, error) {
+// GetUserWallet returns the user's available and held funds keyed on leagueId
+func (u *UserService) GetUserWallet(context echo.Context, userId uuid.UUID) (map[uuid.UUID]entities.Wallet, error) {
 	return u.userRepo.GetUserWallet(context, userId)
 }
 
-func (u *UserService) AddFundsToUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (int64, error) {
+// AddFundsToUserWallet adds funds to the user's wallet for the league and records why in the wallet ledger.
+// The auctionId and playerId can be left empty when the change isn't tied to an auction.
+func (u *UserService) AddFundsToUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64, reason entities.WalletTransactionReason, auctionId uuid.UUID, playerId string) (int64, error) {
 	// Verify user exists
 	user, err := u.GetUserByUserId(context, userId)
 	if err != nil {
@@ -188,10 +160,31 @@ func (u *UserService) AddFundsToUserWallet(context echo.Context, userId uuid.UUI
 		})
 	}
 
-	return u.userRepo.AddFundsToUserWallet(context, userId, leagueId, value)
+	updatedWallet, err := u.userRepo.AddFundsToUserWallet(context, userId, leagueId, value)
+	if err != nil {
+		return 0, err
+	}
+
+	err = u.RecordWalletTransaction(context, userId, leagueId, value, 0, updatedWallet, reason, auctionId, playerId)
+	if err != nil {
+		return 0, err
+	}
+
+	return updatedWallet.Available, nil
+}
+
+// GrantStartingWallet gives a new league member the starting budget from the league's settings
+func (u *UserService) GrantStartingWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) (int64, error) {
+	settings, err := u.leagueService.GetLeagueSettings(context, leagueId)
+	if err != nil {
+		return 0, err
+	}
+
+	return u.AddFundsToUserWallet(context, userId, leagueId, settings.StartingWallet, entities.WALLET_TRANSACTION_REASON_STARTING_GRANT, uuid.Nil, "")
 }
 
-func (u *UserService) RemoveFundsFromUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (int64, error) {
+// RemoveFundsFromUserWallet takes funds out of the user's wallet for the league and records why in the wallet ledger
+func (u *UserService) RemoveFundsFromUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64, reason entities.WalletTransactionReason, auctionId uuid.UUID, playerId string) (int64, error) {
 	// Verify user exists
 	user, err := u.GetUserByUserId(context, userId)
 	if err != nil {
@@ -263,16 +256,45 @@ func (u *UserService) RemoveFundsFromUserWallet(context echo.Context, userId uui
 		})
 	}
 
-	// Verify the user has enough funds to remove
-	hasEnoughFunds, err := u.ValidateUserHasEnoughFunds(context, userId, leagueId, value)
+	// The repo refuses to take the wallet below zero, checking the balance
+	// atomically with the update so concurrent requests can't overdraw it
+	updatedWallet, err := u.userRepo.RemoveFundsFromUserWallet(context, userId, leagueId, value)
 	if err != nil {
 		return 0, err
 	}
 
-	if !hasEnoughFunds {
-		return 0, utils.NewError(utils.ErrorParams{
+	err = u.RecordWalletTransaction(context, userId, leagueId, value*-1, 0, updatedWallet, reason, auctionId, playerId)
+	if err != nil {
+		return 0, err
+	}
+
+	return updatedWallet.Available, nil
+}
+
+// validateWalletUpdate checks the user is in the league and the value is positive
+func (u *UserService) validateWalletUpdate(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) error {
+	isUserInLeague, err := u.leagueService.IsUserInLeague(context, userId, leagueId)
+	if err != nil {
+		return err
+	}
+
+	if !isUserInLeague {
+		return utils.NewError(utils.ErrorParams{
+			Code:    http.StatusForbidden,
+			Message: "user does not exist in this league",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"leagueId", leagueId.String(),
+				"value", fmt.Sprintf("%v", value),
+			},
+			Err: nil,
+		})
+	}
+
+	if value < 0 {
+		return utils.NewError(utils.ErrorParams{
 			Code:    http.StatusBadRequest,
-			Message: "wallet does not have enough funds to remove value",
+			Message: "wallet update must be a positive value",
 			Args: []interface{}{
 				"userId", userId.String(),
 				"leagueId", leagueId.String(),
@@ -282,16 +304,126 @@ func (u *UserService) RemoveFundsFromUserWallet(context echo.Context, userId uui
 		})
 	}
 
-	return u.userRepo.RemoveFundsFromUserWallet(context, userId, leagueId, value)
+	return nil
+}
+
+// AdjustUserWallet lets an admin correct a wallet by any amount, positive or negative
+func (u *UserService) AdjustUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, amount int64) (int64, error) {
+	if amount == 0 {
+		return 0, utils.NewError(utils.ErrorParams{
+			Code:    http.StatusBadRequest,
+			Message: "wallet adjustment cannot be zero",
+			Args: []interface{}{
+				"userId", userId.String(),
+				"leagueId", leagueId.String(),
+			},
+			Err: nil,
+		})
+	}
+
+	if amount > 0 {
+		return u.AddFundsToUserWallet(context, userId, leagueId, amount, entities.WALLET_TRANSACTION_REASON_ADMIN_ADJUSTMENT, uuid.Nil, "")
+	}
+
+	return u.RemoveFundsFromUserWallet(context, userId, leagueId, amount*-1, entities.WALLET_TRANSACTION_REASON_ADMIN_ADJUSTMENT, uuid.Nil, "")
+}
+
+// RecordWalletTransaction appends a change to the user's wallet ledger for the league,
+// for wallet updates made alongside other writes outside the user service, like bids
+func (u *UserService) RecordWalletTransaction(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, amount int64, heldAmount int64, wallet entities.Wallet, reason entities.WalletTransactionReason, auctionId uuid.UUID, playerId string) error {
+	transaction := entities.NewWalletTransaction(userId, leagueId, amount, heldAmount, reason, auctionId, playerId)
+	transaction.Balance = wallet.Available
+	transaction.HeldBalance = wallet.Held
+
+	return u.userRepo.AddWalletTransaction(context, transaction)
+}
+
+// GetWalletHistory returns the user's wallet ledger, oldest first. Passing
+// an empty leagueId returns the history across every league in their wallet.
+func (u *UserService) GetWalletHistory(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) ([]entities.WalletTransaction, error) {
+	if leagueId != uuid.Nil {
+		return u.userRepo.GetWalletTransactions(context, userId, leagueId)
+	}
+
+	wallet, err := u.GetUserWallet(context, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]entities.WalletTransaction, 0)
+	for walletLeagueId := range wallet {
+		leagueTransactions, err := u.userRepo.GetWalletTransactions(context, userId, walletLeagueId)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, leagueTransactions...)
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Timestamp < transactions[j].Timestamp
+	})
+
+	return transactions, nil
+}
+
+// ReconcileUserWallet recomputes the wallet balance from the ledger and compares it to the stored balance
+func (u *UserService) ReconcileUserWallet(context echo.Context, userId uuid.UUID, leagueId uuid.UUID) (entities.WalletReconciliation, error) {
+	wallet, err := u.GetUserWallet(context, userId)
+	if err != nil {
+		return entities.WalletReconciliation{}, err
+	}
+
+	transactions, err := u.userRepo.GetWalletTransactions(context, userId, leagueId)
+	if err != nil {
+		return entities.WalletReconciliation{}, err
+	}
+
+	var ledgerBalance int64
+	var ledgerHeldBalance int64
+	for _, transaction := range transactions {
+		ledgerBalance += transaction.Amount
+		ledgerHeldBalance += transaction.HeldAmount
+	}
+
+	return entities.WalletReconciliation{
+		UserId:            userId,
+		LeagueId:          leagueId,
+		Balance:           wallet[leagueId].Available,
+		LedgerBalance:     ledgerBalance,
+		HeldBalance:       wallet[leagueId].Held,
+		LedgerHeldBalance: ledgerHeldBalance,
+		IsReconciled:      wallet[leagueId].Available == ledgerBalance && wallet[leagueId].Held == ledgerHeldBalance,
+	}, nil
+}
+
+// ReconcileLeagueWallets reconciles the wallet of every member in the league
+func (u *UserService) ReconcileLeagueWallets(context echo.Context, leagueId uuid.UUID) ([]entities.WalletReconciliation, error) {
+	userIds, err := u.leagueService.GetMembersInLeague(context, leagueId)
+	if err != nil {
+		return nil, err
+	}
+
+	reconciliations := make([]entities.WalletReconciliation, len(userIds))
+	for index, userId := range userIds {
+		reconciliations[index], err = u.ReconcileUserWallet(context, userId, leagueId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return reconciliations, nil
 }
 
+// ValidateUserHasEnoughFunds is a quick read for giving a clear error up front. Wallet
+// updates check the balance again atomically, so this doesn't need to be in a transaction.
 func (u *UserService) ValidateUserHasEnoughFunds(context echo.Context, userId uuid.UUID, leagueId uuid.UUID, value int64) (bool, error) {
 	wallet, err := u.GetUserWallet(context, userId)
 	if err != nil {
 		return false, err
 	}
 
-	return wallet[leagueId] >= value, nil
+	return wallet[leagueId].Available >= value, nil
 }
 
 func (u *UserService) GetUserIdFromSenderPsId(context echo.Context, senderPsId string) (uuid.UUID, error) {
@@ -0,0 +1,118 @@
+package test_utils
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	redis_client "github.com/wilbertthelam/prop-ock/db"
+	config_service "github.com/wilbertthelam/prop-ock/services/config"
+	"github.com/wilbertthelam/prop-ock/utils"
+)
+
+// Backend is an empty store on one of the storage backends, with a config that picks it,
+// so tests can build repos and services with the same New functions the server uses
+type Backend struct {
+	Config      *config_service.Config
+	RedisClient *redis.Client
+	MemoryStore *redis_client.MemoryStore
+	SqlClient   *redis_client.SqlClient
+}
+
+// RunOnEveryBackend runs the test once for each storage backend, as a subtest named after it.
+// Redis tests run against the Redis at REDIS_ADDR when it's set, like in CI, and against
+// an in-process miniredis otherwise, so they're never skipped.
+func RunOnEveryBackend(t *testing.T, test func(t *testing.T, backend Backend)) {
+	for _, storageBackend := range []string{
+		config_service.STORAGE_BACKEND_REDIS,
+		config_service.STORAGE_BACKEND_MEMORY,
+		config_service.STORAGE_BACKEND_SQL,
+	} {
+		storageBackend := storageBackend
+		t.Run(storageBackend, func(t *testing.T) {
+			test(t, newBackend(t, storageBackend))
+		})
+	}
+}
+
+func newBackend(t *testing.T, storageBackend string) Backend {
+	config := &config_service.Config{
+		Environment: "TEST",
+		HostUrl:     "http://localhost:8000",
+		Storage: config_service.Storage{
+			Backend: storageBackend,
+		},
+	}
+
+	backend := Backend{
+		Config:      config,
+		MemoryStore: redis_client.NewMemoryStore(),
+	}
+
+	switch storageBackend {
+	case config_service.STORAGE_BACKEND_REDIS:
+		backend.RedisClient = newRedisClient(t, config)
+	case config_service.STORAGE_BACKEND_SQL:
+		backend.SqlClient = newSqliteClient(t, config)
+	}
+
+	return backend
+}
+
+func newRedisClient(t *testing.T, config *config_service.Config) *redis.Client {
+	redisAddr := os.Getenv("REDIS_ADDR")
+	if redisAddr == "" {
+		redisAddr = miniredis.RunT(t).Addr()
+	}
+
+	host, port, err := net.SplitHostPort(redisAddr)
+	if err != nil {
+		t.Fatalf("REDIS_ADDR %v isn't a host and port: %v", redisAddr, err)
+	}
+
+	config.Redis = config_service.Redis{
+		HostAddress: host,
+		Port:        port,
+	}
+
+	redisClient := redis_client.New(config)
+	t.Cleanup(func() {
+		redisClient.Close()
+	})
+
+	err = redisClient.Ping(NewContext().Request().Context()).Err()
+	if err != nil {
+		t.Fatalf("no Redis at %v: %v", redisAddr, err)
+	}
+
+	return redisClient
+}
+
+func newSqliteClient(t *testing.T, config *config_service.Config) *redis_client.SqlClient {
+	config.Storage.SqlDriver = config_service.SQL_DRIVER_SQLITE
+	config.Storage.SqlUrl = filepath.Join(t.TempDir(), "prop-ock.db")
+
+	sqlClient, err := redis_client.OpenSqlClient(config.Storage.SqlDriver, config.Storage.SqlUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sqlClient.Close()
+	})
+
+	err = sqlClient.Migrate(NewContext().Request().Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sqlClient
+}
+
+// NewContext returns a context for calling repos and services outside of a request
+func NewContext() echo.Context {
+	return utils.NewBackgroundContext(echo.New())
+}
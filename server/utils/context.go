@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// NewBackgroundContext creates an Echo context for work that runs outside
+// of an HTTP request (ie. scheduled jobs), so services and repos can be
+// called the same way a handler would call them
+func NewBackgroundContext(e *echo.Echo) echo.Context {
+	request, _ := http.NewRequest(http.MethodPost, "/background", nil)
+	return e.NewContext(request, nil)
+}
@@ -1,6 +1,9 @@
 package utils
 
-import "fmt"
+import (
+	"fmt"
+	"net/http"
+)
 
 // Error is an implementation of the golang error.
 // It provides storage for extra fields.
@@ -46,3 +49,13 @@ func NewError(params ErrorParams) error {
 func (e *Error) Error() string {
 	return fmt.Sprintf("%v: code: %v, args: %+v, err: %+v", e.Message, e.Code, e.Args, e.Err)
 }
+
+// IsNotFoundError checks if the error was created with a 404 status code
+func IsNotFoundError(err error) bool {
+	newErr, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+
+	return newErr.Code == http.StatusNotFound
+}
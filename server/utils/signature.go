@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const hubSignaturePrefix = "sha256="
+
+// VerifyHubSignature checks an X-Hub-Signature-256 header ("sha256=<hex digest>")
+// against the HMAC-SHA256 of the raw request body signed with the app secret
+func VerifyHubSignature(body []byte, signatureHeader string, appSecret string) bool {
+	if appSecret == "" || !strings.HasPrefix(signatureHeader, hubSignaturePrefix) {
+		return false
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(signatureHeader, hubSignaturePrefix))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+
+	// Compare in constant time so the signature can't be guessed byte by byte
+	return hmac.Equal(signature, mac.Sum(nil))
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+const testAppSecret = "test_app_secret"
+
+func TestVerifyHubSignature(t *testing.T) {
+	body := []byte(`{"object":"page","entry":[]}`)
+	validSignature := signHubBody(body, testAppSecret)
+
+	tests := []struct {
+		name            string
+		body            []byte
+		signatureHeader string
+		appSecret       string
+		expected        bool
+	}{
+		{"valid signature", body, validSignature, testAppSecret, true},
+		{"missing header", body, "", testAppSecret, false},
+		{"signed with another secret", body, signHubBody(body, "another_secret"), testAppSecret, false},
+		{"body changed after signing", []byte(`{"object":"page","entry":[{}]}`), validSignature, testAppSecret, false},
+		{"missing sha256 prefix", body, validSignature[len(hubSignaturePrefix):], testAppSecret, false},
+		{"digest isn't hex", body, hubSignaturePrefix + "not-hex", testAppSecret, false},
+		{"app secret isn't configured", body, signHubBody(body, ""), "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := VerifyHubSignature(test.body, test.signatureHeader, test.appSecret)
+			if actual != test.expected {
+				t.Errorf("VerifyHubSignature returned %v, expected %v", actual, test.expected)
+			}
+		})
+	}
+}
+
+func signHubBody(body []byte, appSecret string) string {
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+
+	return hubSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// SignToken serializes the claims and signs them with the secret, giving "<claims>.<signature>".
+// The purpose is signed along with the claims so a token made for one use can't be passed off as another.
+func SignToken(purpose string, claims interface{}, secret string) (string, error) {
+	serializedClaims, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	encodedClaims := base64.RawURLEncoding.EncodeToString(serializedClaims)
+
+	return encodedClaims + "." + base64.RawURLEncoding.EncodeToString(signTokenClaims(purpose, encodedClaims, secret)), nil
+}
+
+// VerifyToken checks the token was signed with the secret for the purpose and decodes its claims
+func VerifyToken(purpose string, token string, secret string, claims interface{}) bool {
+	if secret == "" {
+		return false
+	}
+
+	tokenParts := strings.Split(token, ".")
+	if len(tokenParts) != 2 {
+		return false
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(tokenParts[1])
+	if err != nil {
+		return false
+	}
+
+	// Compare in constant time so the signature can't be guessed byte by byte
+	if !hmac.Equal(signature, signTokenClaims(purpose, tokenParts[0], secret)) {
+		return false
+	}
+
+	serializedClaims, err := base64.RawURLEncoding.DecodeString(tokenParts[0])
+	if err != nil {
+		return false
+	}
+
+	return json.Unmarshal(serializedClaims, claims) == nil
+}
+
+func signTokenClaims(purpose string, encodedClaims string, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose + ":" + encodedClaims))
+	return mac.Sum(nil)
+}
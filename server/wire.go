@@ -7,21 +7,41 @@ import (
 	"github.com/google/wire"
 	redis_client "github.com/wilbertthelam/prop-ock/db"
 	"github.com/wilbertthelam/prop-ock/handlers/auction"
+	"github.com/wilbertthelam/prop-ock/handlers/auth"
 	"github.com/wilbertthelam/prop-ock/handlers/health"
+	"github.com/wilbertthelam/prop-ock/handlers/invite"
 	"github.com/wilbertthelam/prop-ock/handlers/league"
 	"github.com/wilbertthelam/prop-ock/handlers/message"
 	"github.com/wilbertthelam/prop-ock/handlers/player"
+	"github.com/wilbertthelam/prop-ock/handlers/player_set"
+	"github.com/wilbertthelam/prop-ock/handlers/roster"
+	"github.com/wilbertthelam/prop-ock/handlers/trade"
+	"github.com/wilbertthelam/prop-ock/handlers/wallet"
 	"github.com/wilbertthelam/prop-ock/handlers/webview"
 	auction_repo "github.com/wilbertthelam/prop-ock/repos/auction"
+	invite_repo "github.com/wilbertthelam/prop-ock/repos/invite"
 	league_repo "github.com/wilbertthelam/prop-ock/repos/league"
+	member_repo "github.com/wilbertthelam/prop-ock/repos/member"
+	message_repo "github.com/wilbertthelam/prop-ock/repos/message"
 	player_repo "github.com/wilbertthelam/prop-ock/repos/player"
+	player_set_repo "github.com/wilbertthelam/prop-ock/repos/player_set"
+	roster_repo "github.com/wilbertthelam/prop-ock/repos/roster"
+	schedule_repo "github.com/wilbertthelam/prop-ock/repos/schedule"
+	trade_repo "github.com/wilbertthelam/prop-ock/repos/trade"
 	user_repo "github.com/wilbertthelam/prop-ock/repos/user"
 	auction_service "github.com/wilbertthelam/prop-ock/services/auction"
+	auth_service "github.com/wilbertthelam/prop-ock/services/auth"
 	callups_service "github.com/wilbertthelam/prop-ock/services/callups"
 	config_service "github.com/wilbertthelam/prop-ock/services/config"
+	invite_service "github.com/wilbertthelam/prop-ock/services/invite"
 	league_service "github.com/wilbertthelam/prop-ock/services/league"
 	message_service "github.com/wilbertthelam/prop-ock/services/message"
+	migration_service "github.com/wilbertthelam/prop-ock/services/migration"
 	player_service "github.com/wilbertthelam/prop-ock/services/player"
+	player_set_service "github.com/wilbertthelam/prop-ock/services/player_set"
+	roster_service "github.com/wilbertthelam/prop-ock/services/roster"
+	scheduler_service "github.com/wilbertthelam/prop-ock/services/scheduler"
+	trade_service "github.com/wilbertthelam/prop-ock/services/trade"
 	user_service "github.com/wilbertthelam/prop-ock/services/user"
 )
 
@@ -32,21 +52,53 @@ func InitializeDependencyInjectedModules() *Root {
 		webview.New,
 		message.New,
 		player.New,
+		player_set.New,
+		wallet.New,
+		roster.New,
+		trade.New,
+		invite.New,
+		auth.New,
 		league.New,
 		auction.New,
 		auction_service.New,
+		auth_service.New,
 		callups_service.New,
 		user_service.New,
 		league_service.New,
 		message_service.New,
 		player_service.New,
+		player_set_service.New,
+		roster_service.New,
+		scheduler_service.New,
+		migration_service.New,
+		trade_service.New,
+		invite_service.New,
 		auction_repo.New,
 		league_repo.New,
+		member_repo.New,
+		message_repo.New,
 		player_repo.New,
+		player_set_repo.New,
+		roster_repo.New,
+		schedule_repo.New,
+		trade_repo.New,
+		invite_repo.New,
 		user_repo.New,
 		redis_client.New,
+		redis_client.NewMemoryStore,
+		redis_client.NewSqlClient,
 		config_service.New,
 	)
 
 	return &Root{}
 }
+
+func InitializeMigrationService() *migration_service.MigrationService {
+	wire.Build(
+		migration_service.New,
+		redis_client.New,
+		config_service.New,
+	)
+
+	return &migration_service.MigrationService{}
+}
@@ -9,21 +9,41 @@ package main
 import (
 	"github.com/wilbertthelam/prop-ock/db"
 	"github.com/wilbertthelam/prop-ock/handlers/auction"
+	"github.com/wilbertthelam/prop-ock/handlers/auth"
 	"github.com/wilbertthelam/prop-ock/handlers/health"
+	"github.com/wilbertthelam/prop-ock/handlers/invite"
 	"github.com/wilbertthelam/prop-ock/handlers/league"
 	"github.com/wilbertthelam/prop-ock/handlers/message"
 	"github.com/wilbertthelam/prop-ock/handlers/player"
+	"github.com/wilbertthelam/prop-ock/handlers/player_set"
+	"github.com/wilbertthelam/prop-ock/handlers/roster"
+	"github.com/wilbertthelam/prop-ock/handlers/trade"
+	"github.com/wilbertthelam/prop-ock/handlers/wallet"
 	"github.com/wilbertthelam/prop-ock/handlers/webview"
 	"github.com/wilbertthelam/prop-ock/repos/auction"
+	"github.com/wilbertthelam/prop-ock/repos/invite"
 	"github.com/wilbertthelam/prop-ock/repos/league"
+	"github.com/wilbertthelam/prop-ock/repos/member"
+	"github.com/wilbertthelam/prop-ock/repos/message"
 	"github.com/wilbertthelam/prop-ock/repos/player"
+	"github.com/wilbertthelam/prop-ock/repos/player_set"
+	"github.com/wilbertthelam/prop-ock/repos/roster"
+	"github.com/wilbertthelam/prop-ock/repos/schedule"
+	"github.com/wilbertthelam/prop-ock/repos/trade"
 	"github.com/wilbertthelam/prop-ock/repos/user"
 	"github.com/wilbertthelam/prop-ock/services/auction"
+	"github.com/wilbertthelam/prop-ock/services/auth"
 	"github.com/wilbertthelam/prop-ock/services/callups"
 	"github.com/wilbertthelam/prop-ock/services/config"
+	"github.com/wilbertthelam/prop-ock/services/invite"
 	"github.com/wilbertthelam/prop-ock/services/league"
 	"github.com/wilbertthelam/prop-ock/services/message"
+	"github.com/wilbertthelam/prop-ock/services/migration"
 	"github.com/wilbertthelam/prop-ock/services/player"
+	"github.com/wilbertthelam/prop-ock/services/player_set"
+	"github.com/wilbertthelam/prop-ock/services/roster"
+	"github.com/wilbertthelam/prop-ock/services/scheduler"
+	"github.com/wilbertthelam/prop-ock/services/trade"
 	"github.com/wilbertthelam/prop-ock/services/user"
 )
 
@@ -33,21 +53,50 @@ func InitializeDependencyInjectedModules() *Root {
 	healthHandler := health.New()
 	config := config_service.New()
 	client := redis_client.New(config)
-	auctionRepo := auction_repo.New(client)
-	userRepo := user_repo.New(client)
-	leagueRepo := league_repo.New(client)
-	leagueService := league_service.New(leagueRepo)
-	userService := user_service.New(userRepo, leagueService, client)
-	playerRepo := player_repo.New(client)
+	memoryStore := redis_client.NewMemoryStore()
+	sqlClient := redis_client.NewSqlClient(config)
+	auctionRepo := auction_repo.New(config, client, memoryStore, sqlClient)
+	userRepo := user_repo.New(config, client, memoryStore, sqlClient)
+	leagueRepo := league_repo.New(config, client, memoryStore, sqlClient)
+	memberRepo := member_repo.New(config, client, memoryStore, sqlClient)
+	leagueService := league_service.New(leagueRepo, memberRepo)
+	userService := user_service.New(userRepo, leagueService)
+	playerRepo := player_repo.New(config, client, memoryStore, sqlClient)
 	playerService := player_service.New(playerRepo)
-	auctionService := auction_service.New(auctionRepo, userService, playerService, leagueService, client)
+	scheduleRepo := schedule_repo.New(config, client, memoryStore, sqlClient)
+	playerSetRepo := player_set_repo.New(config, client, memoryStore, sqlClient)
+	rosterRepo := roster_repo.New(config, client, memoryStore, sqlClient)
+	rosterService := roster_service.New(rosterRepo, leagueService)
+	playerSetService := player_set_service.New(playerSetRepo, leagueService, playerService, rosterService)
+	auctionService := auction_service.New(auctionRepo, scheduleRepo, userService, playerService, playerSetService, leagueService, rosterService)
 	callupsService := callups_service.New(client)
-	messageService := message_service.New(auctionService, userService, playerService, leagueService)
-	messageHandler := message.New(auctionService, callupsService, userService, leagueService, messageService, config)
+	messageRepo := message_repo.New(config, client, memoryStore, sqlClient)
+	inviteRepo := invite_repo.New(config, client, memoryStore, sqlClient)
+	inviteService := invite_service.New(inviteRepo, leagueService, userService, config)
+	authService := auth_service.New(userService, leagueService, config)
+	messageService := message_service.New(messageRepo, auctionService, userService, playerService, playerSetService, leagueService, inviteService, authService, config)
+	messageHandler := message.New(auctionService, callupsService, userService, leagueService, messageService, config, authService)
 	webviewHandler := webview.New(playerService, auctionService, userService)
-	auctionHandler := auction.New(auctionService, userService)
-	leagueHandler := league.New(leagueService)
-	playerHandler := player.New(playerService)
-	root := New(healthHandler, messageHandler, webviewHandler, auctionHandler, leagueHandler, playerHandler)
+	auctionHandler := auction.New(auctionService, authService)
+	leagueHandler := league.New(leagueService, authService)
+	playerHandler := player.New(playerService, authService)
+	playerSetHandler := player_set.New(playerSetService, authService)
+	walletHandler := wallet.New(userService, authService)
+	rosterHandler := roster.New(rosterService, authService)
+	tradeRepo := trade_repo.New(config, client, memoryStore, sqlClient)
+	tradeService := trade_service.New(tradeRepo, rosterService, userService, leagueService, playerService, messageService)
+	tradeHandler := trade.New(tradeService, authService)
+	inviteHandler := invite.New(inviteService, authService)
+	authHandler := auth.New(authService)
+	schedulerService := scheduler_service.New(scheduleRepo, auctionService, messageService, tradeService)
+	migrationService := migration_service.New(config, client)
+	root := New(healthHandler, messageHandler, webviewHandler, auctionHandler, leagueHandler, playerHandler, playerSetHandler, walletHandler, rosterHandler, tradeHandler, inviteHandler, authHandler, schedulerService, migrationService)
 	return root
 }
+
+func InitializeMigrationService() *migration_service.MigrationService {
+	config := config_service.New()
+	client := redis_client.New(config)
+	migrationService := migration_service.New(config, client)
+	return migrationService
+}